@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// Anchore imports SBOMs into Anchore Enterprise through its source import API.
+//
+// The host is imported as a source, with the hostname as source host, the distribution
+// as repository name and the distribution version as revision, so that SBOMs of the
+// same host are grouped as revisions of one source in Anchore.
+type Anchore struct {
+	URL       string
+	Username  string
+	Password  string
+	Account   string
+	TLSVerify bool
+	Timeout   time.Duration
+
+	client *http.Client
+}
+
+// AnchoreSource identifies the imported source in Anchore Enterprise.
+type AnchoreSource struct {
+	Host           string `json:"host"`
+	RepositoryName string `json:"repository_name"`
+	Revision       string `json:"revision"`
+	BranchName     string `json:"branch_name"`
+	ChangeAuthor   string `json:"change_author"`
+}
+
+// AnchoreSourceImport is the request finishing a source import operation.
+type AnchoreSourceImport struct {
+	Source   AnchoreSource     `json:"source"`
+	Contents map[string]string `json:"contents"`
+}
+
+// anchoreSource maps the metadata component of the SBOM to the source identity fields.
+//
+// Parameters:
+// - bom: the SBOM being imported.
+// - hostname: the hostname of the system.
+//
+// Returns:
+// - AnchoreSource: the source identity.
+func anchoreSource(bom *cyclonedx.BOM, hostname string) AnchoreSource {
+	source := AnchoreSource{
+		Host:         hostname,
+		BranchName:   "operations",
+		ChangeAuthor: "distro2sbom",
+	}
+	if bom.Metadata != nil && bom.Metadata.Component != nil {
+		source.RepositoryName = bom.Metadata.Component.Name
+		source.Revision = bom.Metadata.Component.Version
+	}
+	if bom.Metadata != nil && bom.Metadata.Lifecycles != nil && len(*bom.Metadata.Lifecycles) > 0 {
+		source.BranchName = string((*bom.Metadata.Lifecycles)[0].Phase)
+	}
+	return source
+}
+
+// importSBOM imports an SBOM as a source into Anchore Enterprise.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the requests.
+// - source: the source identity of the host.
+// - sbomJSON: the SBOM in JSON format.
+//
+// Returns:
+// - string: the UUID of the import operation.
+// - error: an error if any step of the import fails.
+func (a *Anchore) importSBOM(ctx context.Context, source AnchoreSource, sbomJSON []byte) (string, error) {
+	a.client = newHTTPClient(a.TLSVerify, a.Timeout)
+
+	var operation struct {
+		UUID string `json:"uuid"`
+	}
+	if err := a.request(ctx, "POST", "/v2/imports/sources", nil, &operation); err != nil {
+		return "", fmt.Errorf("error starting import operation: %v", err)
+	}
+
+	var content struct {
+		Digest string `json:"digest"`
+	}
+	if err := a.request(ctx, "POST", "/v2/imports/sources/"+operation.UUID+"/sbom", sbomJSON, &content); err != nil {
+		return operation.UUID, fmt.Errorf("error uploading SBOM: %v", err)
+	}
+
+	sourceImport, err := json.Marshal(AnchoreSourceImport{
+		Source:   source,
+		Contents: map[string]string{"sbom": content.Digest},
+	})
+	if err != nil {
+		return operation.UUID, fmt.Errorf("error marshaling source import: %v", err)
+	}
+	if err := a.request(ctx, "POST", "/v2/imports/sources/"+operation.UUID+"/finalize", sourceImport, nil); err != nil {
+		return operation.UUID, fmt.Errorf("error finalizing import: %v", err)
+	}
+
+	return operation.UUID, nil
+}
+
+// request sends a JSON request to the Anchore Enterprise API and decodes the response into result.
+func (a *Anchore) request(ctx context.Context, method, endpoint string, body []byte, result any) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(a.URL, "/")+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(a.Username, a.Password)
+	if a.Account != "" {
+		req.Header.Set("x-anchore-account", a.Account)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(respBody))
+	}
+
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("error decoding response: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// ReviewerNote is a note of a security reviewer on a component in the annotations file, e.g.
+//
+//	[
+//	  {
+//	    "subject": "pkg:deb/debian/openssl",
+//	    "note": "CVE-2023-0464 not reachable, no policy constraints in use",
+//	    "annotator": "Jane Doe <jane@acme.example>",
+//	    "timestamp": "2024-05-02T10:00:00Z"
+//	  }
+//	]
+type ReviewerNote struct {
+	// Subject is the bom-ref or purl of the annotated components. A purl without version
+	// and qualifiers annotates every version of the package, so that notes survive upgrades.
+	Subject   string `json:"subject"`
+	Note      string `json:"note"`
+	Annotator string `json:"annotator"`
+	Timestamp string `json:"timestamp"`
+}
+
+// loadReviewerNotes reads the annotations file.
+//
+// Parameters:
+// - path: the path to the JSON file.
+//
+// Returns:
+// - []ReviewerNote: the notes in file order.
+// - error: an error if the file cannot be read or a note is incomplete.
+func loadReviewerNotes(path string) ([]ReviewerNote, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading annotations: %v", err)
+	}
+	var notes []ReviewerNote
+	if err := json.Unmarshal(data, &notes); err != nil {
+		return nil, fmt.Errorf("error decoding annotations %s: %v", path, err)
+	}
+	for i, note := range notes {
+		if note.Subject == "" || note.Note == "" || note.Annotator == "" {
+			return nil, fmt.Errorf("annotation %d: subject, note and annotator are required", i+1)
+		}
+		if _, err := parseContact(note.Annotator); err != nil {
+			return nil, fmt.Errorf("annotation %d: invalid annotator %q: %v", i+1, note.Annotator, err)
+		}
+		if _, err := time.Parse(time.RFC3339, note.Timestamp); err != nil {
+			return nil, fmt.Errorf("annotation %d: timestamp must be RFC 3339, e.g. 2024-05-02T10:00:00Z: %v", i+1, err)
+		}
+	}
+	return notes, nil
+}
+
+// annotate adds the reviewer notes to the SBOM as annotations of the components they refer to.
+//
+// Notes matching no component, e.g. of removed packages, are logged and left out.
+//
+// Parameters:
+// - bom: the SBOM, changed in place.
+// - notes: the notes as read by loadReviewerNotes.
+func annotate(bom *cyclonedx.BOM, notes []ReviewerNote) {
+	if len(notes) == 0 || bom.Components == nil {
+		return
+	}
+	var annotations []cyclonedx.Annotation
+	for _, note := range notes {
+		var subjects []cyclonedx.BOMReference
+		for _, component := range *bom.Components {
+			if noteMatches(note.Subject, component) {
+				subjects = append(subjects, cyclonedx.BOMReference(component.BOMRef))
+			}
+		}
+		if len(subjects) == 0 {
+			slog.Warn("Annotation matches no component", "subject", note.Subject)
+			continue
+		}
+		// Validated when the file was loaded
+		annotator, _ := parseContact(note.Annotator)
+		annotations = append(annotations, cyclonedx.Annotation{
+			Subjects: &subjects,
+			Annotator: &cyclonedx.Annotator{
+				Individual: &cyclonedx.OrganizationalContact{Name: annotator.Name, Email: annotator.Email},
+			},
+			Timestamp: note.Timestamp,
+			Text:      note.Note,
+		})
+	}
+	if len(annotations) > 0 {
+		bom.Annotations = &annotations
+	}
+}
+
+// noteMatches reports whether a note subject refers to a component: its bom-ref, its purl,
+// or its purl without version and qualifiers.
+func noteMatches(subject string, component cyclonedx.Component) bool {
+	if subject == component.BOMRef || subject == component.PackageURL {
+		return true
+	}
+	if component.PackageURL == "" || strings.ContainsAny(subject, "@?#") {
+		return false
+	}
+	purl, _, _ := strings.Cut(component.PackageURL, "?")
+	purl, _, _ = strings.Cut(purl, "@")
+	return subject == purl
+}
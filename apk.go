@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apkInstalledDatabase is the database of the packages installed by apk.
+const apkInstalledDatabase = "/lib/apk/db/installed"
+
+// splitAPKPackage splits the name and version apk prints as one word, e.g. busybox-1.36.1-r5
+// into busybox and 1.36.1-r5. The version is the last two hyphen separated parts, as the
+// release -rN always follows it.
+//
+// Parameters:
+// - nameVersion: the name and version.
+//
+// Returns:
+// - string: the name of the package.
+// - string: the version of the package.
+// - bool: whether the word is a name and version.
+func splitAPKPackage(nameVersion string) (string, string, bool) {
+	parts := strings.Split(nameVersion, "-")
+	if len(parts) < 3 || !strings.HasPrefix(parts[len(parts)-1], "r") {
+		return "", "", false
+	}
+	return strings.Join(parts[:len(parts)-2], "-"), strings.Join(parts[len(parts)-2:], "-"), true
+}
+
+// apkDependencyName returns the package or capability a dependency of apk info -R refers
+// to, without version constraint, e.g. so:libc.musl-x86_64.so.1 or zlib for zlib>=1.2.
+//
+// Parameters:
+// - dependency: a line of apk info -R.
+//
+// Returns:
+// - string: the package name or capability, empty for the header line and conflicts,
+// which start with !.
+func apkDependencyName(dependency string) string {
+	if dependency == "" || strings.HasPrefix(dependency, "!") || strings.HasSuffix(dependency, " depends on:") {
+		return ""
+	}
+	if i := strings.IndexAny(dependency, "<>=~"); i >= 0 {
+		return dependency[:i]
+	}
+	return dependency
+}
+
+// apkProviders reads the capabilities the installed packages provide, e.g. the shared
+// libraries of so:libz.so.1, from the apk database, as apk lists dependencies on
+// capabilities instead of the packages providing them.
+//
+// Parameters:
+// - ctx: the context, cancelling it stops reading.
+// - runner: the runner of the scanned system the database is read from.
+//
+// Returns:
+// - map[string]string: the name of the providing package by capability.
+// - error: an error if the database cannot be read.
+func apkProviders(ctx context.Context, runner Runner) (map[string]string, error) {
+	database, err := readFile(ctx, runner, apkInstalledDatabase)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := make(map[string]string)
+	var name string
+	scanner := bufio.NewScanner(bytes.NewReader(database))
+	scanner.Buffer(make([]byte, 0, 64*1024), defaultMaxLineSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			name = ""
+		case strings.HasPrefix(line, "P:"):
+			name = line[2:]
+		case strings.HasPrefix(line, "p:") && name != "":
+			for _, capability := range strings.Fields(line[2:]) {
+				capability, _, _ = strings.Cut(capability, "=")
+				if _, ok := providers[capability]; !ok {
+					providers[capability] = name
+				}
+			}
+		}
+	}
+	return providers, scanner.Err()
+}
+
+// readAPKInstalled streams the packages of the apk database.
+//
+// The database has a block of single letter fields per package, separated by empty lines:
+// P name, V version, A architecture, L license, o origin, t build time and D dependencies,
+// which are names or capabilities with optional version constraints, e.g. so:libc.musl-x86_64.so.1
+// or zlib>=1.2. Conflicts, which start with !, are skipped like apk info -R does.
+//
+// Parameters:
+// - ctx: the context, cancelling it stops reading.
+// - runner: the runner of the scanned system the file is read from.
+// - path: the path to the database, usually /lib/apk/db/installed.
+// - maxLineSize: the longest line of the file that is accepted, 0 for defaultMaxLineSize.
+// - emit: called with every package in the order of the file.
+//
+// Returns:
+// - error: an error if the file cannot be read.
+func readAPKInstalled(ctx context.Context, runner Runner, path string, maxLineSize int, emit func(pkg installedPackage)) error {
+	if maxLineSize <= 0 {
+		maxLineSize = defaultMaxLineSize
+	}
+	file, err := runner.Open(ctx, path)
+	if err != nil {
+		return fmt.Errorf("error reading package database: %v", err)
+	}
+	defer file.Close()
+
+	var pkg installedPackage
+	flush := func() {
+		if pkg.name != "" {
+			pkg.hasLicense, pkg.hasDependencies = true, true
+			emit(pkg)
+		}
+		pkg = installedPackage{}
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, min(64*1024, maxLineSize)), maxLineSize)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		value := line[2:]
+		switch line[0] {
+		case 'P':
+			pkg.name = value
+		case 'V':
+			pkg.version = value
+		case 'A':
+			pkg.arch = value
+		case 'L':
+			pkg.license = value
+		case 'o':
+			pkg.sourcePackage = value
+		case 't':
+			if buildTime, err := strconv.ParseInt(value, 10, 64); err == nil {
+				pkg.buildTime = time.Unix(buildTime, 0)
+			}
+		case 'D':
+			for _, dependency := range strings.Fields(value) {
+				if name := apkDependencyName(dependency); name != "" {
+					pkg.depends = append(pkg.depends, name)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("error reading package database: line longer than %d bytes, raise --max-line-size", maxLineSize)
+		}
+		return fmt.Errorf("error reading package database: %v", err)
+	}
+	flush()
+	return nil
+}
+
+// apkLicense returns the license apk info --license prints after the line naming the
+// package, e.g. "busybox-1.36.1-r5 license:" followed by "GPL-2.0-only".
+func apkLicense(output string) string {
+	var licenses []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasSuffix(line, " license:") {
+			licenses = append(licenses, line)
+		}
+	}
+	return strings.Join(licenses, " ")
+}
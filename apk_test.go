@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReadAPKInstalled(t *testing.T) {
+	var packages []installedPackage
+	err := readAPKInstalled(context.Background(), &fixtureRunner{}, "apk/installed", 0, func(pkg installedPackage) {
+		packages = append(packages, pkg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []installedPackage{
+		{name: "musl", version: "1.2.4-r2", arch: "x86_64", license: "MIT", sourcePackage: "musl", buildTime: time.Unix(1698068574, 0)},
+		{name: "busybox", version: "1.36.1-r15", arch: "x86_64", license: "GPL-2.0-only", sourcePackage: "busybox", buildTime: time.Unix(1700000000, 0),
+			depends: []string{"so:libc.musl-x86_64.so.1"}},
+		{name: "ssl_client", version: "1.36.1-r15", arch: "x86_64", license: "GPL-2.0-only", sourcePackage: "busybox",
+			depends: []string{"so:libc.musl-x86_64.so.1", "so:libcrypto.so.3", "libssl3"}},
+	}
+	if len(packages) != len(want) {
+		t.Fatalf("readAPKInstalled() read %d packages, want %d", len(packages), len(want))
+	}
+	for i, pkg := range packages {
+		if pkg.name != want[i].name || pkg.version != want[i].version || pkg.arch != want[i].arch || pkg.license != want[i].license || pkg.sourcePackage != want[i].sourcePackage {
+			t.Errorf("package %d = %s %s %s %q %s, want %s %s %s %q %s", i, pkg.name, pkg.version, pkg.arch, pkg.license, pkg.sourcePackage,
+				want[i].name, want[i].version, want[i].arch, want[i].license, want[i].sourcePackage)
+		}
+		if !pkg.buildTime.Equal(want[i].buildTime) {
+			t.Errorf("build time of %s = %v, want %v", pkg.name, pkg.buildTime, want[i].buildTime)
+		}
+		if !slices.Equal(pkg.depends, want[i].depends) {
+			t.Errorf("dependencies of %s = %q, want %q", pkg.name, pkg.depends, want[i].depends)
+		}
+		if !pkg.hasLicense || !pkg.hasDependencies {
+			t.Errorf("%s has hasLicense %t and hasDependencies %t, want both set", pkg.name, pkg.hasLicense, pkg.hasDependencies)
+		}
+	}
+}
+
+func TestAPKDependencyName(t *testing.T) {
+	tests := []struct {
+		dependency, want string
+	}{
+		{"musl", "musl"},
+		{"zlib>=1.2", "zlib"},
+		{"so:libc.musl-x86_64.so.1", "so:libc.musl-x86_64.so.1"},
+		{"busybox~1.36", "busybox"},
+		{"!busybox-extras", ""},
+		{"busybox-1.36.1-r15 depends on:", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := apkDependencyName(test.dependency); got != test.want {
+			t.Errorf("apkDependencyName(%q) = %q, want %q", test.dependency, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v1"
+	inTotoPayloadType   = "application/vnd.in-toto+json"
+	cycloneDXPredicate  = "https://cyclonedx.org/bom"
+	defaultFulcioURL    = "https://fulcio.sigstore.dev"
+	sigstoreKeyPEMType  = "ENCRYPTED SIGSTORE PRIVATE KEY"
+	cosignKeyPEMType    = "ENCRYPTED COSIGN PRIVATE KEY"
+)
+
+// InTotoSubject identifies the artifact an attestation is about.
+type InTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// InTotoStatement is an in-toto v1 statement carrying the SBOM as predicate.
+type InTotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []InTotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// DSSESignature is a single signature of a DSSE envelope.
+type DSSESignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// DSSEEnvelope is a Dead Simple Signing Envelope as produced by cosign attest.
+type DSSEEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []DSSESignature `json:"signatures"`
+}
+
+// newAttestCmd creates the attest subcommand.
+//
+// The command wraps an SBOM in an in-toto statement and signs it into a DSSE envelope,
+// either with a private key (cosign generated keys are supported, the password is read
+// from COSIGN_PASSWORD) or keyless with a short-lived certificate from Fulcio for the
+// OIDC identity token in SIGSTORE_ID_TOKEN.
+//
+// Returns:
+// - *cobra.Command: the attest command.
+func newAttestCmd() *cobra.Command {
+	var keyPath string
+	var keyless bool
+	var fulcioURL string
+	var subject string
+	var output string
+	var outputCertificate string
+
+	cmd := &cobra.Command{
+		Use:   "attest <sbom.json|->",
+		Short: "Wrap an SBOM in a signed in-toto attestation.",
+		Long: `attest wraps a CycloneDX SBOM in an in-toto statement with predicate type https://cyclonedx.org/bom
+and signs it into a DSSE envelope that can be verified with cosign verify-blob-attestation.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var sbomJSON []byte
+			var err error
+			if args[0] == "-" {
+				sbomJSON, err = io.ReadAll(os.Stdin)
+			} else {
+				sbomJSON, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				fatal(exitConfig, "Error reading SBOM", "error", err)
+			}
+
+			if keyPath == "" && !keyless {
+				fatal(exitConfig, "Either --key or --keyless must be given")
+			}
+			if keyless && outputCertificate == "" {
+				fatal(exitConfig, "--output-certificate is required with --keyless")
+			}
+
+			statement, err := newSBOMStatement(sbomJSON, subject)
+			if err != nil {
+				fatal(exitValidation, "Error creating in-toto statement", "error", err)
+			}
+
+			var signer crypto.Signer
+			if keyless {
+				var certPEM []byte
+				signer, certPEM, err = fulcioSigner(context.Background(), fulcioURL, os.Getenv("SIGSTORE_ID_TOKEN"))
+				if err != nil {
+					fatal(exitError, "Error obtaining signing certificate", "error", err)
+				}
+				if err := os.WriteFile(outputCertificate, certPEM, 0644); err != nil {
+					fatal(exitError, "Error writing certificate", "error", err)
+				}
+			} else {
+				signer, err = loadSigningKey(keyPath, os.Getenv("COSIGN_PASSWORD"))
+				if err != nil {
+					fatal(exitConfig, "Error loading signing key", "error", err)
+				}
+			}
+
+			envelope, err := signDSSE(signer, inTotoPayloadType, statement)
+			if err != nil {
+				fatal(exitError, "Error signing attestation", "error", err)
+			}
+
+			envelopeJSON, err := json.Marshal(envelope)
+			if err != nil {
+				fatal(exitError, "Error marshaling attestation", "error", err)
+			}
+
+			if output == "" {
+				fmt.Println(string(envelopeJSON))
+			} else if err := os.WriteFile(output, append(envelopeJSON, '\n'), 0644); err != nil {
+				fatal(exitError, "Error writing attestation", "error", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&keyPath, "key", "", "Private key in PEM format, cosign encrypted keys use COSIGN_PASSWORD")
+	cmd.Flags().BoolVar(&keyless, "keyless", false, "Sign with a Fulcio certificate for the OIDC token in SIGSTORE_ID_TOKEN")
+	cmd.Flags().StringVar(&fulcioURL, "fulcio-url", defaultFulcioURL, "Fulcio server used for keyless signing")
+	cmd.Flags().StringVar(&subject, "subject", "", "Subject of the statement as name@sha256:digest (default: the SBOM document itself)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file for the DSSE envelope (default: stdout)")
+	cmd.Flags().StringVar(&outputCertificate, "output-certificate", "", "Output file for the signing certificate chain when using --keyless")
+
+	return cmd
+}
+
+// newSBOMStatement wraps an SBOM in an in-toto statement.
+//
+// Parameters:
+// - sbomJSON: the SBOM in JSON format, used as predicate.
+// - subject: the subject as name@sha256:digest, or empty to use the SBOM document itself.
+//
+// Returns:
+// - []byte: the statement in JSON format.
+// - error: an error if the SBOM is not valid JSON or the subject cannot be parsed.
+func newSBOMStatement(sbomJSON []byte, subject string) ([]byte, error) {
+	var predicate json.RawMessage
+	if err := json.Unmarshal(sbomJSON, &predicate); err != nil {
+		return nil, fmt.Errorf("SBOM is not valid JSON: %v", err)
+	}
+
+	var statementSubject InTotoSubject
+	if subject == "" {
+		var bom struct {
+			Metadata struct {
+				Component struct {
+					Name string `json:"name"`
+				} `json:"component"`
+			} `json:"metadata"`
+		}
+		json.Unmarshal(sbomJSON, &bom)
+		sum := sha256.Sum256(sbomJSON)
+		statementSubject = InTotoSubject{
+			Name:   bom.Metadata.Component.Name,
+			Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])},
+		}
+	} else {
+		name, digest, found := strings.Cut(subject, "@sha256:")
+		if !found || name == "" || digest == "" {
+			return nil, fmt.Errorf("invalid subject %s, expected name@sha256:digest", subject)
+		}
+		statementSubject = InTotoSubject{Name: name, Digest: map[string]string{"sha256": digest}}
+	}
+
+	return json.Marshal(InTotoStatement{
+		Type:          inTotoStatementType,
+		Subject:       []InTotoSubject{statementSubject},
+		PredicateType: cycloneDXPredicate,
+		Predicate:     predicate,
+	})
+}
+
+// dssePAE returns the DSSE pre-authentication encoding of a payload.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// signDSSE signs a payload into a DSSE envelope.
+//
+// Parameters:
+// - signer: the ECDSA or Ed25519 signing key.
+// - payloadType: the media type of the payload.
+// - payload: the payload to sign.
+//
+// Returns:
+// - DSSEEnvelope: the signed envelope.
+// - error: an error if signing fails.
+func signDSSE(signer crypto.Signer, payloadType string, payload []byte) (DSSEEnvelope, error) {
+	sig, err := signBytes(signer, dssePAE(payloadType, payload))
+	if err != nil {
+		return DSSEEnvelope{}, err
+	}
+
+	return DSSEEnvelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []DSSESignature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+// signBytes signs a message, Ed25519 keys sign the message itself and ECDSA and RSA keys
+// its SHA-256 digest, as cosign does.
+//
+// Parameters:
+// - signer: the Ed25519, ECDSA or RSA signing key.
+// - message: the message to sign.
+//
+// Returns:
+// - []byte: the signature, ASN.1 encoded for ECDSA.
+// - error: an error if signing fails.
+func signBytes(signer crypto.Signer, message []byte) ([]byte, error) {
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		return signer.Sign(rand.Reader, message, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(message)
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// loadSigningKey reads a private key from a PEM file.
+//
+// Unencrypted PKCS#8 and SEC 1 keys are supported, as well as keys generated by
+// cosign generate-key-pair, which are encrypted with scrypt and NaCl secretbox.
+//
+// Parameters:
+// - path: the path to the PEM file.
+// - password: the password of an encrypted cosign key.
+//
+// Returns:
+// - crypto.Signer: the private key.
+// - error: an error if the file cannot be read, decrypted or parsed.
+func loadSigningKey(path, password string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	der := block.Bytes
+	switch block.Type {
+	case sigstoreKeyPEMType, cosignKeyPEMType:
+		der, err = decryptCosignKey(block.Bytes, password)
+		if err != nil {
+			return nil, err
+		}
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(der)
+	case "PRIVATE KEY":
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %v", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// decryptCosignKey decrypts the body of an encrypted cosign private key.
+func decryptCosignKey(data []byte, password string) ([]byte, error) {
+	var encrypted struct {
+		KDF struct {
+			Name   string `json:"name"`
+			Params struct {
+				N int `json:"N"`
+				R int `json:"r"`
+				P int `json:"p"`
+			} `json:"params"`
+			Salt []byte `json:"salt"`
+		} `json:"kdf"`
+		Cipher struct {
+			Name  string `json:"name"`
+			Nonce []byte `json:"nonce"`
+		} `json:"cipher"`
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	if err := json.Unmarshal(data, &encrypted); err != nil {
+		return nil, fmt.Errorf("error decoding encrypted key: %v", err)
+	}
+	if encrypted.KDF.Name != "scrypt" || encrypted.Cipher.Name != "nacl/secretbox" || len(encrypted.Cipher.Nonce) != 24 {
+		return nil, fmt.Errorf("unsupported key encryption %s/%s", encrypted.KDF.Name, encrypted.Cipher.Name)
+	}
+
+	secret, err := scrypt.Key([]byte(password), encrypted.KDF.Salt, encrypted.KDF.Params.N, encrypted.KDF.Params.R, encrypted.KDF.Params.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key: %v", err)
+	}
+	var key [32]byte
+	var nonce [24]byte
+	copy(key[:], secret)
+	copy(nonce[:], encrypted.Cipher.Nonce)
+
+	der, ok := secretbox.Open(nil, encrypted.Ciphertext, &nonce, &key)
+	if !ok {
+		return nil, fmt.Errorf("error decrypting key, check COSIGN_PASSWORD")
+	}
+	return der, nil
+}
+
+// fulcioSigner creates an ephemeral key and obtains a signing certificate for it from Fulcio.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the request.
+// - fulcioURL: the base URL of the Fulcio server.
+// - idToken: the OIDC identity token proving the signer's identity.
+//
+// Returns:
+// - crypto.Signer: the ephemeral private key.
+// - []byte: the PEM encoded certificate chain.
+// - error: an error if no token is given or the certificate request fails.
+func fulcioSigner(ctx context.Context, fulcioURL, idToken string) (crypto.Signer, []byte, error) {
+	if idToken == "" {
+		return nil, nil, fmt.Errorf("SIGSTORE_ID_TOKEN must be set for keyless signing")
+	}
+
+	// The proof of possession is a signature over the subject of the identity token
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("SIGSTORE_ID_TOKEN is not a JWT")
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding identity token: %v", err)
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+		Email   string `json:"email"`
+	}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, nil, fmt.Errorf("error decoding identity token claims: %v", err)
+	}
+	proofSubject := claims.Subject
+	if claims.Email != "" {
+		proofSubject = claims.Email
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating ephemeral key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding public key: %v", err)
+	}
+	proofDigest := sha256.Sum256([]byte(proofSubject))
+	proof, err := key.Sign(rand.Reader, proofDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating proof of possession: %v", err)
+	}
+
+	request := map[string]any{
+		"credentials": map[string]string{"oidcIdentityToken": idToken},
+		"publicKeyRequest": map[string]any{
+			"publicKey": map[string]string{
+				"algorithm": "ECDSA",
+				"content":   string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+			},
+			"proofOfPossession": base64.StdEncoding.EncodeToString(proof),
+		},
+	}
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error marshaling certificate request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(fulcioURL, "/")+"/api/v2/signingCert", bytes.NewReader(requestJSON))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := newHTTPClient(true, 60*time.Second).Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, nil, fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	type chain struct {
+		Chain struct {
+			Certificates []string `json:"certificates"`
+		} `json:"chain"`
+	}
+	var response struct {
+		SignedCertificateEmbeddedSct *chain `json:"signedCertificateEmbeddedSct"`
+		SignedCertificateDetachedSct *chain `json:"signedCertificateDetachedSct"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	certificates := response.SignedCertificateEmbeddedSct
+	if certificates == nil {
+		certificates = response.SignedCertificateDetachedSct
+	}
+	if certificates == nil || len(certificates.Chain.Certificates) == 0 {
+		return nil, nil, fmt.Errorf("Fulcio returned no certificate")
+	}
+
+	return key, []byte(strings.Join(certificates.Chain.Certificates, "")), nil
+}
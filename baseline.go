@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// Baseline holds the licenses and dependencies of the packages of a previous SBOM, so that
+// packages that did not change since are not queried again.
+type Baseline struct {
+	packages map[string]baselinePackage
+}
+
+// baselinePackage is the collected data of a package in the baseline.
+type baselinePackage struct {
+	licenses     []string
+	dependencies []string
+}
+
+// loadBaseline reads the packages of a previous SBOM generated by distro2sbom.
+//
+// Parameters:
+// - path: the path to the CycloneDX JSON file.
+//
+// Returns:
+// - *Baseline: the packages of the SBOM, nil if the file does not exist yet.
+// - error: an error if the file cannot be read or decoded.
+func loadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Info("Baseline does not exist yet, collecting every package", "path", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading baseline: %v", err)
+	}
+
+	var bom cyclonedx.BOM
+	if err := cyclonedx.NewBOMDecoder(bytes.NewReader(data), cyclonedx.BOMFileFormatJSON).Decode(&bom); err != nil {
+		return nil, fmt.Errorf("error decoding baseline %s: %v", path, err)
+	}
+
+	baseline := &Baseline{packages: make(map[string]baselinePackage)}
+	if bom.Components == nil {
+		return baseline, nil
+	}
+
+	// Dependencies reference bom-refs, which are renumbered in every SBOM
+	names := make(map[string]string)
+	for _, component := range *bom.Components {
+		if component.Type == cyclonedx.ComponentTypeLibrary {
+			names[component.BOMRef] = component.Name
+		}
+	}
+	dependencies := make(map[string][]string)
+	if bom.Dependencies != nil {
+		for _, dependency := range *bom.Dependencies {
+			if _, ok := names[dependency.Ref]; !ok || dependency.Dependencies == nil {
+				continue
+			}
+			for _, ref := range *dependency.Dependencies {
+				if name, ok := names[ref]; ok {
+					dependencies[dependency.Ref] = append(dependencies[dependency.Ref], name)
+				}
+			}
+		}
+	}
+
+	for _, component := range *bom.Components {
+		if component.Type != cyclonedx.ComponentTypeLibrary {
+			continue
+		}
+		pkg := baselinePackage{dependencies: dependencies[component.BOMRef]}
+		if component.Licenses != nil {
+			for _, license := range *component.Licenses {
+				if license.License != nil && license.License.ID != "" {
+					pkg.licenses = append(pkg.licenses, license.License.ID)
+				}
+			}
+		}
+		key := installedPackage{name: component.Name, arch: componentProperty(component, archProperty)}.key()
+		baseline.packages[key+"@"+component.Version] = pkg
+	}
+	slog.Info("Loaded baseline", "path", path, "packages", len(baseline.packages))
+	return baseline, nil
+}
+
+// lookup returns the baseline data of a package if the same version is in the baseline.
+//
+// Baselines written before the architecture was recorded match packages by name.
+//
+// Parameters:
+// - pkg: the installed package, matched by name, architecture and version.
+//
+// Returns:
+// - baselinePackage: the licenses and dependencies of the package in the baseline.
+// - bool: whether the package is unchanged since the baseline, false for a nil baseline.
+func (b *Baseline) lookup(pkg installedPackage) (baselinePackage, bool) {
+	if b == nil {
+		return baselinePackage{}, false
+	}
+	if baseline, ok := b.packages[pkg.key()+"@"+pkg.version]; ok {
+		return baseline, true
+	}
+	baseline, ok := b.packages[pkg.name+"@"+pkg.version]
+	return baseline, ok
+}
+
+// componentProperty returns the value of a property of a component, empty if it has none.
+func componentProperty(component cyclonedx.Component, name string) string {
+	if component.Properties == nil {
+		return ""
+	}
+	for _, property := range *component.Properties {
+		if property.Name == name {
+			return property.Value
+		}
+	}
+	return ""
+}
+
+// Drift is the difference between the packages of an SBOM and a baseline.
+type Drift struct {
+	// Added are the packages missing in the baseline, as name@version.
+	Added []string
+	// Removed are the packages of the baseline missing in the SBOM, as name@version.
+	Removed []string
+	// Changed are the packages in another version than in the baseline, as name old → new.
+	Changed []string
+}
+
+// empty reports whether the SBOM has the packages of the baseline.
+func (d Drift) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// drift compares the packages of an SBOM with the baseline by name, architecture and version.
+//
+// Parameters:
+// - bom: the SBOM.
+//
+// Returns:
+// - Drift: the added, removed and changed packages, sorted.
+func (b *Baseline) drift(bom *cyclonedx.BOM) Drift {
+	versions := func(keys map[string]baselinePackage) map[string]string {
+		packages := make(map[string]string)
+		for key := range keys {
+			// Versions do not contain an @, names and architectures neither
+			at := strings.LastIndex(key, "@")
+			packages[key[:at]] = key[at+1:]
+		}
+		return packages
+	}
+	baseline := versions(b.packages)
+	current := make(map[string]string)
+	if bom.Components != nil {
+		for _, component := range *bom.Components {
+			if component.Type == cyclonedx.ComponentTypeLibrary {
+				key := installedPackage{name: component.Name, arch: componentProperty(component, archProperty)}.key()
+				current[key] = component.Version
+			}
+		}
+	}
+
+	var drift Drift
+	for key, version := range current {
+		baselineVersion, ok := baseline[key]
+		switch {
+		case !ok:
+			drift.Added = append(drift.Added, key+"@"+version)
+		case baselineVersion != version:
+			drift.Changed = append(drift.Changed, key+" "+baselineVersion+" → "+version)
+		}
+	}
+	for key, version := range baseline {
+		if _, ok := current[key]; !ok {
+			drift.Removed = append(drift.Removed, key+"@"+version)
+		}
+	}
+	sort.Strings(drift.Added)
+	sort.Strings(drift.Removed)
+	sort.Strings(drift.Changed)
+	return drift
+}
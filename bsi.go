@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// profileBSI is the compliance profile of the German BSI technical guideline TR-03183-2,
+// selected by --profile.
+const profileBSI = "bsi"
+
+// ProfileViolation is a requirement of a compliance profile an SBOM does not meet.
+type ProfileViolation struct {
+	// Requirement is the requirement of the profile, e.g. component hash.
+	Requirement string
+	// Component is the name and version of the component, empty for the document.
+	Component   string
+	Description string
+}
+
+// String returns the violation in the form requirement (component): description.
+func (v ProfileViolation) String() string {
+	if v.Component != "" {
+		return v.Requirement + " (" + v.Component + "): " + v.Description
+	}
+	return v.Requirement + ": " + v.Description
+}
+
+// validProfile reports whether a profile is supported, empty selects none.
+func validProfile(profile string) bool {
+	return profile == "" || profile == profileBSI
+}
+
+// applyProfile fills the fields a compliance profile requires from the data the SBOM
+// already holds under other names.
+//
+// For bsi the creator of the SBOM is the manufacturer of the metadata and the creator of a
+// component its manufacturer, both default to the respective supplier. Data the SBOM does
+// not hold at all, like the SHA-512 hashes of the package archives, is left out.
+//
+// Parameters:
+// - profile: the profile, empty for none.
+// - bom: the SBOM, changed in place.
+func applyProfile(profile string, bom *cyclonedx.BOM) {
+	if profile != profileBSI {
+		return
+	}
+	if bom.Metadata != nil && bom.Metadata.Manufacturer == nil {
+		bom.Metadata.Manufacturer = bom.Metadata.Supplier
+	}
+	if bom.Components != nil {
+		for i := range *bom.Components {
+			component := &(*bom.Components)[i]
+			if component.Manufacturer == nil {
+				component.Manufacturer = component.Supplier
+			}
+		}
+	}
+}
+
+// checkProfile checks an SBOM against the requirements of a compliance profile.
+//
+// bsi requires the creator of the SBOM with an email address or URL, the timestamp and
+// serial number of the SBOM and the creator, a license, a SHA-512 hash and a valid package
+// URL of every component.
+//
+// Parameters:
+// - profile: the profile, empty for none.
+// - bom: the SBOM.
+//
+// Returns:
+// - []ProfileViolation: the requirements not met, empty if the SBOM meets the profile.
+func checkProfile(profile string, bom *cyclonedx.BOM) []ProfileViolation {
+	if profile != profileBSI {
+		return nil
+	}
+	var violations []ProfileViolation
+	if bom.Metadata == nil || !reachable(bom.Metadata.Manufacturer) {
+		violations = append(violations, ProfileViolation{Requirement: "SBOM creator", Description: "metadata.manufacturer has no email address or URL"})
+	}
+	if bom.Metadata == nil || bom.Metadata.Timestamp == "" {
+		violations = append(violations, ProfileViolation{Requirement: "timestamp", Description: "metadata.timestamp is missing"})
+	}
+	if bom.SerialNumber == "" {
+		violations = append(violations, ProfileViolation{Requirement: "SBOM URI", Description: "serialNumber is missing"})
+	}
+	if bom.Components == nil {
+		return violations
+	}
+	for _, component := range *bom.Components {
+		name := component.Name + "@" + component.Version
+		if component.Version == "" {
+			violations = append(violations, ProfileViolation{Requirement: "component version", Component: name, Description: "version is missing"})
+		}
+		if !reachable(component.Manufacturer) && !reachable(component.Supplier) {
+			violations = append(violations, ProfileViolation{Requirement: "component creator", Component: name, Description: "manufacturer has no email address or URL"})
+		}
+		if component.Licenses == nil || len(*component.Licenses) == 0 {
+			violations = append(violations, ProfileViolation{Requirement: "component license", Component: name, Description: "licenses are missing"})
+		}
+		if !hasHash(component, cyclonedx.HashAlgoSHA512) {
+			violations = append(violations, ProfileViolation{Requirement: "component hash", Component: name, Description: "SHA-512 hash is missing"})
+		}
+		if component.PackageURL == "" {
+			violations = append(violations, ProfileViolation{Requirement: "component purl", Component: name, Description: "purl is missing"})
+		} else if err := validatePURL(component.PackageURL); err != nil {
+			violations = append(violations, ProfileViolation{Requirement: "component purl", Component: name, Description: fmt.Sprintf("invalid purl %s: %v", component.PackageURL, err)})
+		}
+	}
+	return violations
+}
+
+// logProfileViolations logs the violations of a profile, one line per requirement, so
+// that a requirement missed by every package does not flood the log.
+//
+// Parameters:
+// - profile: the profile.
+// - violations: the violations as returned by checkProfile.
+func logProfileViolations(profile string, violations []ProfileViolation) {
+	counts := make(map[string]int)
+	first := make(map[string]ProfileViolation)
+	for _, violation := range violations {
+		if counts[violation.Requirement] == 0 {
+			first[violation.Requirement] = violation
+		}
+		counts[violation.Requirement]++
+	}
+	requirements := make([]string, 0, len(counts))
+	for requirement := range counts {
+		requirements = append(requirements, requirement)
+	}
+	sort.Strings(requirements)
+	for _, requirement := range requirements {
+		slog.Warn("SBOM does not meet profile requirement", "profile", profile, "requirement", requirement, "count", counts[requirement], "first", first[requirement].String())
+	}
+}
+
+// reachable reports whether an organization has an email address or URL.
+func reachable(entity *cyclonedx.OrganizationalEntity) bool {
+	if entity == nil {
+		return false
+	}
+	if entity.URL != nil && len(*entity.URL) > 0 {
+		return true
+	}
+	if entity.Contact != nil {
+		for _, contact := range *entity.Contact {
+			if contact.Email != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasHash reports whether a component has a hash of an algorithm.
+func hasHash(component cyclonedx.Component, algorithm cyclonedx.HashAlgorithm) bool {
+	if component.Hashes == nil {
+		return false
+	}
+	for _, hash := range *component.Hashes {
+		if hash.Algorithm == algorithm && hash.Value != "" {
+			return true
+		}
+	}
+	return false
+}
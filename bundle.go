@@ -0,0 +1,245 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// Formats of the asset inventory bundle, selected by --bundle-format.
+const (
+	// bundleFormatDir writes the bundle as a directory.
+	bundleFormatDir = "dir"
+	// bundleFormatTarGz writes the bundle as a gzip compressed tar archive holding the directory.
+	bundleFormatTarGz = "tar.gz"
+)
+
+// Bundle collects the files handed over to auditors per host: the SBOM, the CSV inventory,
+// the license report, the run result and their checksums. The files are kept in memory
+// until the result of the run is known and written together by write.
+type Bundle struct {
+	// root is the directory the bundle is written to.
+	root string
+	// name is the name of the bundle directory, the hostname and the time of the SBOM.
+	name   string
+	format string
+	files  []bundleFile
+}
+
+// bundleFile is a file of the bundle.
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// newBundle creates the bundle of a run.
+//
+// Parameters:
+// - root: the directory the bundle is written to.
+// - format: dir or tar.gz.
+// - hostname: the hostname of the scanned system.
+// - created: the time the SBOM was generated.
+//
+// Returns:
+// - *Bundle: the empty bundle.
+func newBundle(root, format, hostname string, created time.Time) *Bundle {
+	return &Bundle{
+		root:   root,
+		name:   hostname + "-" + created.UTC().Format("20060102T150405Z"),
+		format: format,
+	}
+}
+
+// add adds a file to the bundle.
+func (b *Bundle) add(name string, data []byte) {
+	b.files = append(b.files, bundleFile{name: name, data: data})
+}
+
+// addSBOM adds the SBOM with its CSV inventory and license report to the bundle.
+//
+// Parameters:
+// - bom: the SBOM.
+// - sbomJSON: the SBOM in JSON format.
+//
+// Returns:
+// - error: an error if the reports cannot be encoded.
+func (b *Bundle) addSBOM(bom *cyclonedx.BOM, sbomJSON []byte) error {
+	inventory, err := inventoryCSV(bom)
+	if err != nil {
+		return fmt.Errorf("error encoding inventory: %v", err)
+	}
+	licenses, err := licenseReportCSV(bom)
+	if err != nil {
+		return fmt.Errorf("error encoding license report: %v", err)
+	}
+	b.add("sbom.json", sbomJSON)
+	b.add("inventory.csv", inventory)
+	b.add("licenses.csv", licenses)
+	return nil
+}
+
+// write writes the bundle with a SHA256SUMS file covering every other file.
+//
+// Returns:
+// - string: the path of the bundle directory or archive.
+// - error: an error if the bundle cannot be written.
+func (b *Bundle) write() (string, error) {
+	var sums strings.Builder
+	for _, file := range b.files {
+		digest, _ := fileChecksum("sha256", file.data)
+		fmt.Fprintf(&sums, "%s  %s\n", digest, file.name)
+	}
+	files := append(b.files, bundleFile{name: "SHA256SUMS", data: []byte(sums.String())})
+
+	if err := os.MkdirAll(b.root, 0755); err != nil {
+		return "", err
+	}
+	if b.format == bundleFormatTarGz {
+		path := filepath.Join(b.root, b.name+".tar.gz")
+		archive, err := tarGz(b.name, files)
+		if err != nil {
+			return "", err
+		}
+		return path, writeFileAtomic(path, archive, 0644)
+	}
+
+	// The directory appears complete or not at all
+	path := filepath.Join(b.root, b.name)
+	temp, err := os.MkdirTemp(b.root, "."+b.name+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(temp)
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(temp, file.name), file.data, 0644); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Chmod(temp, 0755); err != nil {
+		return "", err
+	}
+	return path, os.Rename(temp, path)
+}
+
+// tarGz packs files into a gzip compressed tar archive below a directory.
+func tarGz(dir string, files []bundleFile) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0755, ModTime: now}); err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: dir + "/" + file.name, Mode: 0644, Size: int64(len(file.data)), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inventoryCSV lists the components of an SBOM as CSV, one row per component with its
+// name, version, type, architecture, purl, CPE, licenses separated by semicolons and supplier.
+func inventoryCSV(bom *cyclonedx.BOM) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"name", "version", "type", "arch", "purl", "cpe", "licenses", "supplier"})
+	if bom.Components != nil {
+		for _, component := range *bom.Components {
+			supplier := ""
+			if component.Supplier != nil {
+				supplier = component.Supplier.Name
+			}
+			w.Write([]string{
+				component.Name,
+				component.Version,
+				string(component.Type),
+				componentProperty(component, archProperty),
+				component.PackageURL,
+				component.CPE,
+				strings.Join(componentLicenses(component), "; "),
+				supplier,
+			})
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// licenseReportCSV counts the components of an SBOM per license as CSV, the most used
+// license first. Components without license are counted as UNKNOWN.
+func licenseReportCSV(bom *cyclonedx.BOM) ([]byte, error) {
+	components := make(map[string][]string)
+	if bom.Components != nil {
+		for _, component := range *bom.Components {
+			if component.Type != cyclonedx.ComponentTypeLibrary {
+				continue
+			}
+			licenses := componentLicenses(component)
+			if len(licenses) == 0 {
+				licenses = []string{"UNKNOWN"}
+			}
+			for _, license := range licenses {
+				components[license] = append(components[license], component.Name)
+			}
+		}
+	}
+	licenses := make([]string, 0, len(components))
+	for license := range components {
+		licenses = append(licenses, license)
+	}
+	sort.Slice(licenses, func(i, j int) bool {
+		if len(components[licenses[i]]) != len(components[licenses[j]]) {
+			return len(components[licenses[i]]) > len(components[licenses[j]])
+		}
+		return licenses[i] < licenses[j]
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"license", "count", "components"})
+	for _, license := range licenses {
+		w.Write([]string{license, strconv.Itoa(len(components[license])), strings.Join(components[license], " ")})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// componentLicenses returns the license identifiers, names or expressions of a component.
+func componentLicenses(component cyclonedx.Component) []string {
+	if component.Licenses == nil {
+		return nil
+	}
+	var licenses []string
+	for _, choice := range *component.Licenses {
+		switch {
+		case choice.License != nil && choice.License.ID != "":
+			licenses = append(licenses, choice.License.ID)
+		case choice.License != nil && choice.License.Name != "":
+			licenses = append(licenses, choice.License.Name)
+		case choice.Expression != "":
+			licenses = append(licenses, choice.Expression)
+		}
+	}
+	return licenses
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultCacheTTL is how long cached package data is used when no TTL is configured.
+const defaultCacheTTL = 7 * 24 * time.Hour
+
+// Cache stores the data collected per package in plain files, so that runs on hosts
+// whose packages rarely change do not query the package manager for every package.
+//
+// Entries are keyed by the kind of data (e.g. licenses or dependencies), the package
+// manager and the name, version and architecture of the package, so that an upgraded
+// package is collected again. A nil Cache stores nothing.
+type Cache struct {
+	dir string
+	ttl time.Duration
+}
+
+// cacheEntry is the file stored for a package.
+type cacheEntry struct {
+	Kind           string          `json:"kind"`
+	PackageManager string          `json:"packageManager"`
+	Name           string          `json:"name"`
+	Version        string          `json:"version"`
+	Arch           string          `json:"arch,omitempty"`
+	Stored         time.Time       `json:"stored"`
+	Value          json.RawMessage `json:"value"`
+}
+
+// openCache opens the cache directory, creating it if it does not exist.
+//
+// Parameters:
+// - dir: the cache directory.
+// - ttl: how long entries are used after they were stored, 0 for defaultCacheTTL.
+//
+// Returns:
+// - *Cache: the cache.
+// - error: an error if the directory cannot be created.
+func openCache(dir string, ttl time.Duration) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %v", err)
+	}
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &Cache{dir: dir, ttl: ttl}, nil
+}
+
+// path returns the file of an entry, named by the hash of its key.
+func (c *Cache) path(kind, packageManager string, pkg installedPackage) string {
+	key := strings.Join([]string{kind, packageManager, pkg.name, pkg.version, pkg.arch}, "\x00")
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, kind, hex.EncodeToString(sum[:])+".json")
+}
+
+// get reads the cached data of a package.
+//
+// Parameters:
+// - kind: the kind of data, e.g. licenses.
+// - packageManager: the package manager of the package.
+// - pkg: the package.
+// - value: decoded from the entry.
+//
+// Returns:
+// - bool: whether an entry younger than the TTL was found, false for a nil cache.
+func (c *Cache) get(kind, packageManager string, pkg installedPackage, value any) bool {
+	if c == nil {
+		return false
+	}
+	data, err := os.ReadFile(c.path(kind, packageManager, pkg))
+	if err != nil {
+		return false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		slog.Debug("Ignoring invalid cache entry", "package", pkg.name, "kind", kind, "error", err)
+		return false
+	}
+	if time.Since(entry.Stored) > c.ttl {
+		return false
+	}
+	return json.Unmarshal(entry.Value, value) == nil
+}
+
+// put stores the data of a package, a failure is logged as the data is only cached.
+//
+// Parameters:
+// - kind: the kind of data, e.g. licenses.
+// - packageManager: the package manager of the package.
+// - pkg: the package.
+// - value: the data, encoded as JSON.
+func (c *Cache) put(kind, packageManager string, pkg installedPackage, value any) {
+	if c == nil {
+		return
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		slog.Debug("Error encoding cache entry", "package", pkg.name, "kind", kind, "error", err)
+		return
+	}
+	data, err := json.Marshal(cacheEntry{
+		Kind:           kind,
+		PackageManager: packageManager,
+		Name:           pkg.name,
+		Version:        pkg.version,
+		Arch:           pkg.arch,
+		Stored:         time.Now().UTC(),
+		Value:          encoded,
+	})
+	if err != nil {
+		return
+	}
+	path := c.path(kind, packageManager, pkg)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		slog.Debug("Error creating cache directory", "path", filepath.Dir(path), "error", err)
+		return
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		slog.Debug("Error writing cache entry", "package", pkg.name, "kind", kind, "error", err)
+	}
+}
+
+// purgeCache removes the entries of the cache directory.
+//
+// Parameters:
+// - dir: the cache directory.
+// - ttl: entries older than the TTL are removed.
+// - all: removes every entry regardless of its age.
+//
+// Returns:
+// - int: the number of removed entries.
+// - error: an error if the directory cannot be walked or an entry cannot be removed.
+func purgeCache(dir string, ttl time.Duration, all bool) (int, error) {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	removed := 0
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		if !all {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			var cached cacheEntry
+			// Unreadable entries are never used, so they are removed as well
+			if json.Unmarshal(data, &cached) == nil && time.Since(cached.Stored) <= ttl {
+				return nil
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// newCacheCmd creates the cache subcommand.
+//
+// Returns:
+// - *cobra.Command: the cache command with its purge subcommand.
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache of collected package data.",
+		Long: `cache manages the directory given by --cache-dir, in which the licenses and dependencies of every
+package are stored by name, version and architecture, so that unchanged packages are not queried again.`,
+	}
+
+	purgeCmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Remove expired entries from the cache.",
+		Long: `purge removes the entries older than --cache-ttl from the cache directory, or every entry
+with --all.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			dir, _ := cmd.Flags().GetString("cache-dir")
+			if !cmd.Flags().Changed("cache-dir") {
+				dir = viper.GetString("cache-dir")
+			}
+			ttl, _ := cmd.Flags().GetDuration("cache-ttl")
+			if !cmd.Flags().Changed("cache-ttl") {
+				ttl = viper.GetDuration("cache-ttl")
+			}
+			all, _ := cmd.Flags().GetBool("all")
+			if dir == "" {
+				fatal(exitConfig, "No cache directory configured, please specify --cache-dir")
+			}
+
+			removed, err := purgeCache(dir, ttl, all)
+			if err != nil {
+				fatal(exitError, "Error purging cache", "dir", dir, "error", err)
+			}
+			slog.Info("Purged cache", "dir", dir, "removed", removed)
+		},
+	}
+	purgeCmd.Flags().String("cache-dir", "", "Cache directory, defaults to the configured cache-dir")
+	purgeCmd.Flags().Duration("cache-ttl", defaultCacheTTL, "Entries older than this are removed")
+	purgeCmd.Flags().Bool("all", false, "Remove every entry regardless of its age")
+	cmd.AddCommand(purgeCmd)
+
+	return cmd
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path/filepath"
+)
+
+// checksumAlgorithms are the algorithms of the checksum files, by the name used as file
+// extension and by the matching coreutils tool, e.g. sha256sum.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// fileChecksum returns the hex encoded digest of data.
+//
+// Parameters:
+// - algorithm: sha256 or sha512.
+// - data: the file content.
+//
+// Returns:
+// - string: the digest.
+// - error: an error if the algorithm is not supported.
+func fileChecksum(algorithm string, data []byte) (string, error) {
+	newHash, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported checksum algorithm %q, expected sha256 or sha512", algorithm)
+	}
+	h := newHash()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksumFile writes a checksum file in the format of sha256sum and sha512sum.
+//
+// Parameters:
+// - path: the checksum file.
+// - filePath: the checksummed file, only its base name is written, so that sha256sum -c
+// works next to the file.
+// - digest: the hex encoded digest of the file.
+//
+// Returns:
+// - error: an error if the checksum file cannot be written.
+func writeChecksumFile(path, filePath, digest string) error {
+	return writeFileAtomic(path, []byte(fmt.Sprintf("%s  %s\n", digest, filepath.Base(filePath))), 0644)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+	"github.com/spf13/viper"
+)
+
+// Frameworks of the compliance properties, selected by --compliance-tags.
+const (
+	// complianceSSDF references the practices of the NIST Secure Software Development
+	// Framework (SP 800-218) the SBOM is evidence for.
+	complianceSSDF = "ssdf"
+	// complianceFedRAMP references the FedRAMP system the host belongs to.
+	complianceFedRAMP = "fedramp"
+)
+
+// defaultSSDFPractices are the SSDF practices an SBOM is evidence for unless configured:
+// PS.3.2 collects, safeguards, maintains and shares provenance data of all components.
+var defaultSSDFPractices = []string{"PS.3.2"}
+
+// ComplianceConfig is the compliance section of the configuration file, e.g.
+//
+//	compliance:
+//	  ssdf:
+//	    practices:
+//	      - PS.3.2
+//	      - PW.4.1
+//	  fedramp:
+//	    system-id: F1234567890
+type ComplianceConfig struct {
+	SSDF struct {
+		Practices []string `mapstructure:"practices"`
+	} `mapstructure:"ssdf"`
+	FedRAMP struct {
+		SystemID string `mapstructure:"system-id"`
+	} `mapstructure:"fedramp"`
+}
+
+// loadComplianceProperties builds the metadata properties referencing the compliance
+// frameworks, so that GRC tools can index the SBOM as evidence of their controls.
+//
+// Parameters:
+// - frameworks: the frameworks to reference, ssdf and fedramp.
+//
+// Returns:
+// - []cyclonedx.Property: the properties, nil without frameworks.
+// - error: an error if a framework is unknown or its configuration is incomplete.
+func loadComplianceProperties(frameworks []string) ([]cyclonedx.Property, error) {
+	if len(frameworks) == 0 {
+		return nil, nil
+	}
+	var config ComplianceConfig
+	if err := viper.UnmarshalKey("compliance", &config); err != nil {
+		return nil, fmt.Errorf("error reading compliance: %v", err)
+	}
+	var properties []cyclonedx.Property
+	for _, framework := range frameworks {
+		switch strings.ToLower(framework) {
+		case complianceSSDF:
+			practices := config.SSDF.Practices
+			if len(practices) == 0 {
+				practices = defaultSSDFPractices
+			}
+			properties = append(properties, cyclonedx.Property{Name: "distro2sbom:compliance:framework", Value: "NIST SP 800-218"})
+			for _, practice := range practices {
+				properties = append(properties, cyclonedx.Property{Name: "distro2sbom:compliance:ssdf:practice", Value: practice})
+			}
+		case complianceFedRAMP:
+			if config.FedRAMP.SystemID == "" {
+				return nil, fmt.Errorf("fedramp needs compliance.fedramp.system-id in the configuration file")
+			}
+			properties = append(properties,
+				cyclonedx.Property{Name: "distro2sbom:compliance:framework", Value: "FedRAMP"},
+				cyclonedx.Property{Name: "distro2sbom:compliance:fedramp:system-id", Value: config.FedRAMP.SystemID},
+			)
+		default:
+			return nil, fmt.Errorf("unknown compliance framework %q, expected ssdf or fedramp", framework)
+		}
+	}
+	return properties, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// envPrefix is the prefix of the environment variables holding settings.
+const envPrefix = "DISTRO2SBOM"
+
+// configName is the name of the configuration file without its extension.
+const configName = "dist02cyclonedx"
+
+// configSearchPaths returns the directories searched for the configuration file, in order of precedence.
+//
+// The working directory comes first, followed by the XDG user and system configuration
+// directories and /etc, so that a user or project configuration overrides the system one.
+//
+// Returns:
+// - []string: the directories to search.
+func configSearchPaths() []string {
+	paths := []string{"."}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		paths = append(paths, configHome)
+	}
+
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	for _, dir := range strings.Split(configDirs, ":") {
+		if dir != "" {
+			paths = append(paths, dir)
+		}
+	}
+
+	return append(paths, "/etc")
+}
+
+// readConfig reads the configuration file into viper.
+//
+// Values from the file take precedence over flag defaults, while environment variables
+// and flags given on the command line take precedence over the file.
+//
+// Parameters:
+// - configFile: an explicit configuration file, or empty to search configSearchPaths.
+//
+// Returns:
+// - error: an error if the file cannot be read. A missing file is only reported as
+// viper.ConfigFileNotFoundError when no file was requested explicitly.
+func readConfig(configFile string) error {
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+		if filepath.Ext(configFile) == "" {
+			viper.SetConfigType("yaml")
+		}
+	} else {
+		// No config type is set, so that only files with an extension such as
+		// dist02cyclonedx.yaml match and not a dist02cyclonedx binary in the directory
+		viper.SetConfigName(configName)
+		for _, path := range configSearchPaths() {
+			viper.AddConfigPath(path)
+		}
+	}
+	return viper.ReadInConfig()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// ContainerSBOM is the SBOM of a container image running on the host.
+type ContainerSBOM struct {
+	Name   string
+	Digest string
+	SBOM   []byte
+}
+
+// loadContainerSBOM reads a CycloneDX SBOM of a container image and determines the image identity.
+//
+// The image name is taken from the metadata component of the SBOM. The digest is taken from
+// the component version when it is a digest, from the version of an oci or docker package URL,
+// or from the SHA-256 hash of the component, in that order.
+//
+// Parameters:
+// - path: the path to the CycloneDX JSON file.
+//
+// Returns:
+// - ContainerSBOM: the image name, digest and the raw SBOM.
+// - error: an error if the file cannot be read or does not identify an image digest.
+func loadContainerSBOM(path string) (ContainerSBOM, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ContainerSBOM{}, fmt.Errorf("error reading container SBOM: %v", err)
+	}
+
+	var bom cyclonedx.BOM
+	if err := cyclonedx.NewBOMDecoder(bytes.NewReader(data), cyclonedx.BOMFileFormatJSON).Decode(&bom); err != nil {
+		return ContainerSBOM{}, fmt.Errorf("error decoding container SBOM %s: %v", path, err)
+	}
+	if bom.Metadata == nil || bom.Metadata.Component == nil || bom.Metadata.Component.Name == "" {
+		return ContainerSBOM{}, fmt.Errorf("container SBOM %s has no metadata component", path)
+	}
+
+	component := bom.Metadata.Component
+	digest := ""
+	switch {
+	case strings.HasPrefix(component.Version, "sha256:"):
+		digest = component.Version
+	case strings.HasPrefix(component.PackageURL, "pkg:oci/") || strings.HasPrefix(component.PackageURL, "pkg:docker/"):
+		if i := strings.Index(component.PackageURL, "@"); i != -1 {
+			digest = strings.SplitN(component.PackageURL[i+1:], "?", 2)[0]
+			digest = strings.ReplaceAll(digest, "%3A", ":")
+		}
+	}
+	if digest == "" && component.Hashes != nil {
+		for _, hash := range *component.Hashes {
+			if hash.Algorithm == cyclonedx.HashAlgoSHA256 {
+				digest = "sha256:" + hash.Value
+			}
+		}
+	}
+	if digest == "" {
+		return ContainerSBOM{}, fmt.Errorf("container SBOM %s does not identify an image digest", path)
+	}
+
+	return ContainerSBOM{
+		Name:   component.Name,
+		Digest: digest,
+		SBOM:   data,
+	}, nil
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/CycloneDX/cyclonedx-go"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+const (
+	spdxVersion       = "SPDX-2.3"
+	spdxDataLicense   = "CC0-1.0"
+	spdxDocumentID    = "SPDXRef-DOCUMENT"
+	spdxNoAssertion   = "NOASSERTION"
+	spdxNamespaceBase = "https://spdx.org/spdxdocs/distro2sbom-"
+)
+
+// SPDXDocument is the subset of an SPDX 2.3 JSON document that maps to CycloneDX.
+type SPDXDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      SPDXCreationInfo   `json:"creationInfo"`
+	DocumentDescribes []string           `json:"documentDescribes,omitempty"`
+	Packages          []SPDXPackage      `json:"packages"`
+	Relationships     []SPDXRelationship `json:"relationships,omitempty"`
+}
+
+// SPDXCreationInfo records when and by whom an SPDX document was created.
+type SPDXCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+// SPDXPackage is a package of an SPDX document.
+type SPDXPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	Supplier              string            `json:"supplier,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	Checksums             []SPDXChecksum    `json:"checksums,omitempty"`
+	LicenseConcluded      string            `json:"licenseConcluded,omitempty"`
+	LicenseDeclared       string            `json:"licenseDeclared,omitempty"`
+	CopyrightText         string            `json:"copyrightText,omitempty"`
+	Description           string            `json:"description,omitempty"`
+	ExternalRefs          []SPDXExternalRef `json:"externalRefs,omitempty"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+}
+
+// SPDXChecksum is a checksum of an SPDX package.
+type SPDXChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+// SPDXExternalRef is an external reference of an SPDX package, e.g. its package URL.
+type SPDXExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+// SPDXRelationship relates two elements of an SPDX document.
+type SPDXRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxHashAlgorithms maps SPDX checksum algorithms to CycloneDX hash algorithms.
+var spdxHashAlgorithms = map[string]cyclonedx.HashAlgorithm{
+	"MD5":      cyclonedx.HashAlgoMD5,
+	"SHA1":     cyclonedx.HashAlgoSHA1,
+	"SHA256":   cyclonedx.HashAlgoSHA256,
+	"SHA384":   cyclonedx.HashAlgoSHA384,
+	"SHA512":   cyclonedx.HashAlgoSHA512,
+	"SHA3-256": cyclonedx.HashAlgoSHA3_256,
+	"SHA3-384": cyclonedx.HashAlgoSHA3_384,
+	"SHA3-512": cyclonedx.HashAlgoSHA3_512,
+}
+
+// spdxPurposes maps SPDX primary package purposes to CycloneDX component types.
+var spdxPurposes = map[string]cyclonedx.ComponentType{
+	"APPLICATION":      cyclonedx.ComponentTypeApplication,
+	"FRAMEWORK":        cyclonedx.ComponentTypeFramework,
+	"LIBRARY":          cyclonedx.ComponentTypeLibrary,
+	"CONTAINER":        cyclonedx.ComponentTypeContainer,
+	"OPERATING-SYSTEM": cyclonedx.ComponentTypeOS,
+	"DEVICE":           cyclonedx.ComponentTypeDevice,
+	"FIRMWARE":         cyclonedx.ComponentTypeFirmware,
+	"FILE":             cyclonedx.ComponentTypeFile,
+}
+
+// spdxIDInvalid matches the characters not allowed in an SPDX identifier.
+var spdxIDInvalid = regexp.MustCompile(`[^A-Za-z0-9.-]`)
+
+// spdxSupplierPattern matches an SPDX supplier, e.g. Organization: Debian (debian@example.org).
+var spdxSupplierPattern = regexp.MustCompile(`^(?:Organization|Person):\s*([^(]*?)\s*(?:\(([^)]*)\))?$`)
+
+// newConvertCmd creates the convert subcommand.
+//
+// Returns:
+// - *cobra.Command: the convert command.
+func newConvertCmd() *cobra.Command {
+	var output string
+	var to string
+
+	cmd := &cobra.Command{
+		Use:   "convert <sbom.json|->",
+		Short: "Convert an SBOM between CycloneDX and SPDX.",
+		Long: `convert reads a CycloneDX or SPDX 2.3 JSON document and writes it in the other format, so that
+SPDX archives can be normalized to CycloneDX before they are uploaded to Dependency-Track. The input
+format is detected from the document. Packages, versions, suppliers, licenses, package URLs, CPEs,
+checksums and dependencies are converted, converted CycloneDX documents are validated.`,
+		Example: `  distro2sbom convert in.spdx.json -o out.cdx.json
+  distro2sbom convert sbom.json --to spdx -o sbom.spdx.json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var input []byte
+			var err error
+			if args[0] == "-" {
+				input, err = io.ReadAll(os.Stdin)
+			} else {
+				input, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				fatal(exitConfig, "Error reading SBOM", "error", err)
+			}
+
+			var header struct {
+				BOMFormat   string `json:"bomFormat"`
+				SPDXVersion string `json:"spdxVersion"`
+			}
+			if err := json.Unmarshal(input, &header); err != nil {
+				fatal(exitValidation, "Error decoding SBOM", "error", err)
+			}
+			from := ""
+			switch {
+			case header.BOMFormat == "CycloneDX":
+				from = "cyclonedx"
+			case strings.HasPrefix(header.SPDXVersion, "SPDX-2."):
+				from = "spdx"
+			default:
+				fatal(exitValidation, "Input is neither a CycloneDX nor an SPDX 2 JSON document")
+			}
+			if to == "" {
+				to = "cyclonedx"
+				if from == "cyclonedx" {
+					to = "spdx"
+				}
+			}
+
+			var converted []byte
+			switch {
+			case from == to:
+				fatal(exitConfig, "Input is already in the requested format", "format", to)
+			case to == "cyclonedx":
+				var document SPDXDocument
+				if err := json.Unmarshal(input, &document); err != nil {
+					fatal(exitValidation, "Error decoding SPDX document", "error", err)
+				}
+				converted, err = encodeBOM(spdxToBOM(&document))
+				if err != nil {
+					fatal(exitError, "Error encoding SBOM", "error", err)
+				}
+				if _, schemaErrors, err := validateSBOM(converted); err != nil {
+					fatal(exitValidation, "Error validating converted SBOM", "error", err)
+				} else if len(schemaErrors) > 0 {
+					for _, schemaError := range schemaErrors {
+						slog.Error("SBOM schema violation", "path", schemaError.Path, "component", schemaError.Component, "error", schemaError.Description)
+					}
+					fatal(exitValidation, "Converted SBOM is not valid against the CycloneDX schema", "errors", len(schemaErrors))
+				}
+			case to == "spdx":
+				var bom cyclonedx.BOM
+				if err := cyclonedx.NewBOMDecoder(bytes.NewReader(input), cyclonedx.BOMFileFormatJSON).Decode(&bom); err != nil {
+					fatal(exitValidation, "Error decoding CycloneDX document", "error", err)
+				}
+				converted, err = json.MarshalIndent(bomToSPDX(&bom), "", "  ")
+				if err != nil {
+					fatal(exitError, "Error marshaling SPDX document to JSON", "error", err)
+				}
+			default:
+				fatal(exitConfig, "Invalid --to, expected cyclonedx or spdx", "to", to)
+			}
+
+			if output == "" {
+				fmt.Println(string(converted))
+				return
+			}
+			if err := writeFileAtomic(output, append(converted, '\n'), 0644); err != nil {
+				fatal(exitError, "Error writing converted SBOM", "error", err)
+			}
+			slog.Info("Converted SBOM", "from", from, "to", to, "output", output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file for the converted SBOM (default: stdout)")
+	cmd.Flags().StringVar(&to, "to", "", "Output format, cyclonedx or spdx (default: the other format of the input)")
+
+	return cmd
+}
+
+// spdxToBOM converts an SPDX document to a CycloneDX BOM.
+//
+// The package described by the document becomes the metadata component, the other
+// packages become components and DEPENDS_ON and DEPENDENCY_OF relationships dependencies.
+//
+// Parameters:
+// - document: the SPDX document.
+//
+// Returns:
+// - *cyclonedx.BOM: the BOM.
+func spdxToBOM(document *SPDXDocument) *cyclonedx.BOM {
+	bom := cyclonedx.NewBOM()
+	bom.SpecVersion = cyclonedx.SpecVersion1_6
+	bom.SerialNumber = uuid.New().URN()
+	bom.Metadata = &cyclonedx.Metadata{
+		Timestamp: document.CreationInfo.Created,
+		Tools: &cyclonedx.ToolsChoice{
+			Components: &[]cyclonedx.Component{toolComponent()},
+		},
+	}
+
+	described := make(map[string]bool)
+	for _, id := range document.DocumentDescribes {
+		described[id] = true
+	}
+	for _, relationship := range document.Relationships {
+		if relationship.SPDXElementID == spdxDocumentID && relationship.RelationshipType == "DESCRIBES" {
+			described[relationship.RelatedSPDXElement] = true
+		}
+	}
+
+	components := []cyclonedx.Component{}
+	for _, pkg := range document.Packages {
+		component := spdxPackageComponent(pkg)
+		// A single described package is the subject of the BOM
+		if described[pkg.SPDXID] && len(described) == 1 && bom.Metadata.Component == nil {
+			if component.Type == cyclonedx.ComponentTypeLibrary && pkg.PrimaryPackagePurpose == "" {
+				component.Type = cyclonedx.ComponentTypeApplication
+			}
+			bom.Metadata.Component = &component
+			continue
+		}
+		components = append(components, component)
+	}
+	bom.Components = &components
+
+	dependsOn := make(map[string][]string)
+	var refs []string
+	for _, relationship := range document.Relationships {
+		from, to := relationship.SPDXElementID, relationship.RelatedSPDXElement
+		switch relationship.RelationshipType {
+		case "DEPENDS_ON":
+		case "DEPENDENCY_OF":
+			from, to = to, from
+		default:
+			continue
+		}
+		if strings.HasPrefix(to, "DocumentRef-") || to == spdxNoAssertion || to == "NONE" {
+			continue
+		}
+		if _, ok := dependsOn[from]; !ok {
+			refs = append(refs, from)
+		}
+		dependsOn[from] = append(dependsOn[from], to)
+	}
+	dependencies := []cyclonedx.Dependency{}
+	for _, ref := range refs {
+		dependencyRefs := dependsOn[ref]
+		dependencies = append(dependencies, cyclonedx.Dependency{Ref: ref, Dependencies: &dependencyRefs})
+	}
+	bom.Dependencies = &dependencies
+
+	return bom
+}
+
+// spdxPackageComponent converts an SPDX package to a CycloneDX component, the SPDX
+// identifier becomes the bom-ref.
+func spdxPackageComponent(pkg SPDXPackage) cyclonedx.Component {
+	component := cyclonedx.Component{
+		Type:        cyclonedx.ComponentTypeLibrary,
+		BOMRef:      pkg.SPDXID,
+		Name:        pkg.Name,
+		Version:     pkg.VersionInfo,
+		Description: pkg.Description,
+	}
+	if componentType, ok := spdxPurposes[pkg.PrimaryPackagePurpose]; ok {
+		component.Type = componentType
+	}
+	if pkg.CopyrightText != "" && pkg.CopyrightText != spdxNoAssertion && pkg.CopyrightText != "NONE" {
+		component.Copyright = pkg.CopyrightText
+	}
+
+	if match := spdxSupplierPattern.FindStringSubmatch(pkg.Supplier); match != nil {
+		supplier := cyclonedx.OrganizationalEntity{Name: match[1]}
+		if match[2] != "" {
+			supplier.Contact = &[]cyclonedx.OrganizationalContact{{Email: match[2]}}
+		}
+		component.Supplier = &supplier
+	}
+
+	for _, ref := range pkg.ExternalRefs {
+		switch ref.ReferenceType {
+		case "purl":
+			component.PackageURL = ref.ReferenceLocator
+		case "cpe23Type", "cpe22Type":
+			component.CPE = ref.ReferenceLocator
+		}
+	}
+	if pkg.DownloadLocation != "" && pkg.DownloadLocation != spdxNoAssertion && pkg.DownloadLocation != "NONE" {
+		component.ExternalReferences = &[]cyclonedx.ExternalReference{
+			{URL: pkg.DownloadLocation, Type: cyclonedx.ERTypeDistribution},
+		}
+	}
+
+	var hashes []cyclonedx.Hash
+	for _, checksum := range pkg.Checksums {
+		if algorithm, ok := spdxHashAlgorithms[checksum.Algorithm]; ok {
+			hashes = append(hashes, cyclonedx.Hash{Algorithm: algorithm, Value: checksum.ChecksumValue})
+		}
+	}
+	if len(hashes) > 0 {
+		component.Hashes = &hashes
+	}
+
+	license := pkg.LicenseConcluded
+	if license == "" || license == spdxNoAssertion || license == "NONE" {
+		license = pkg.LicenseDeclared
+	}
+	if license != "" && license != spdxNoAssertion && license != "NONE" {
+		if strings.ContainsAny(license, " ()") {
+			component.Licenses = &cyclonedx.Licenses{{Expression: license}}
+		} else {
+			component.Licenses = &cyclonedx.Licenses{{License: &cyclonedx.License{ID: license}}}
+		}
+	}
+	return component
+}
+
+// bomToSPDX converts a CycloneDX BOM to an SPDX document.
+//
+// The metadata component becomes the package described by the document, and every
+// dependency a DEPENDS_ON relationship.
+//
+// Parameters:
+// - bom: the BOM.
+//
+// Returns:
+// - *SPDXDocument: the SPDX document.
+func bomToSPDX(bom *cyclonedx.BOM) *SPDXDocument {
+	document := &SPDXDocument{
+		SPDXVersion: spdxVersion,
+		DataLicense: spdxDataLicense,
+		SPDXID:      spdxDocumentID,
+		Name:        "distro2sbom",
+		CreationInfo: SPDXCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: distro2sbom-" + getBuildInfo().Version},
+		},
+		Packages: []SPDXPackage{},
+	}
+	namespace := uuid.New().String()
+	if strings.HasPrefix(bom.SerialNumber, "urn:uuid:") {
+		namespace = strings.TrimPrefix(bom.SerialNumber, "urn:uuid:")
+	}
+	document.DocumentNamespace = spdxNamespaceBase + namespace
+
+	// bom-refs are mapped to unique SPDX identifiers
+	ids := make(map[string]string)
+	used := make(map[string]bool)
+	addPackage := func(component cyclonedx.Component) string {
+		id := "SPDXRef-" + spdxIDInvalid.ReplaceAllString(strings.TrimPrefix(component.BOMRef, "SPDXRef-"), "-")
+		if component.BOMRef == "" {
+			id = "SPDXRef-" + spdxIDInvalid.ReplaceAllString(component.Name+"-"+component.Version, "-")
+		}
+		base := id
+		for i := 2; used[id]; i++ {
+			id = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[id] = true
+		if component.BOMRef != "" {
+			ids[component.BOMRef] = id
+		}
+		document.Packages = append(document.Packages, componentSPDXPackage(id, component))
+		return id
+	}
+
+	if bom.Metadata != nil {
+		if bom.Metadata.Timestamp != "" {
+			document.CreationInfo.Created = bom.Metadata.Timestamp
+		}
+		if bom.Metadata.Component != nil {
+			document.Name = bom.Metadata.Component.Name
+			id := addPackage(*bom.Metadata.Component)
+			document.DocumentDescribes = []string{id}
+			document.Relationships = append(document.Relationships, SPDXRelationship{
+				SPDXElementID:      spdxDocumentID,
+				RelationshipType:   "DESCRIBES",
+				RelatedSPDXElement: id,
+			})
+		}
+	}
+	if bom.Components != nil {
+		for _, component := range *bom.Components {
+			addPackage(component)
+		}
+	}
+
+	if bom.Dependencies != nil {
+		for _, dependency := range *bom.Dependencies {
+			from, ok := ids[dependency.Ref]
+			if !ok || dependency.Dependencies == nil {
+				continue
+			}
+			for _, ref := range *dependency.Dependencies {
+				if to, ok := ids[ref]; ok {
+					document.Relationships = append(document.Relationships, SPDXRelationship{
+						SPDXElementID:      from,
+						RelationshipType:   "DEPENDS_ON",
+						RelatedSPDXElement: to,
+					})
+				}
+			}
+		}
+	}
+	return document
+}
+
+// componentSPDXPackage converts a CycloneDX component to an SPDX package.
+func componentSPDXPackage(id string, component cyclonedx.Component) SPDXPackage {
+	pkg := SPDXPackage{
+		SPDXID:           id,
+		Name:             component.Name,
+		VersionInfo:      component.Version,
+		Description:      component.Description,
+		DownloadLocation: spdxNoAssertion,
+		LicenseConcluded: spdxNoAssertion,
+		LicenseDeclared:  spdxNoAssertion,
+		CopyrightText:    spdxNoAssertion,
+	}
+	for purpose, componentType := range spdxPurposes {
+		if componentType == component.Type {
+			pkg.PrimaryPackagePurpose = purpose
+		}
+	}
+	if component.Copyright != "" {
+		pkg.CopyrightText = component.Copyright
+	}
+
+	if component.Supplier != nil && component.Supplier.Name != "" {
+		pkg.Supplier = "Organization: " + component.Supplier.Name
+		if component.Supplier.Contact != nil && len(*component.Supplier.Contact) > 0 && (*component.Supplier.Contact)[0].Email != "" {
+			pkg.Supplier += " (" + (*component.Supplier.Contact)[0].Email + ")"
+		}
+	}
+
+	if component.PackageURL != "" {
+		pkg.ExternalRefs = append(pkg.ExternalRefs, SPDXExternalRef{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: component.PackageURL})
+	}
+	if component.CPE != "" {
+		pkg.ExternalRefs = append(pkg.ExternalRefs, SPDXExternalRef{ReferenceCategory: "SECURITY", ReferenceType: "cpe23Type", ReferenceLocator: component.CPE})
+	}
+	if component.ExternalReferences != nil {
+		for _, ref := range *component.ExternalReferences {
+			if ref.Type == cyclonedx.ERTypeDistribution {
+				pkg.DownloadLocation = ref.URL
+				break
+			}
+		}
+	}
+
+	if component.Hashes != nil {
+		for _, hash := range *component.Hashes {
+			for algorithm, hashAlgorithm := range spdxHashAlgorithms {
+				if hashAlgorithm == hash.Algorithm {
+					pkg.Checksums = append(pkg.Checksums, SPDXChecksum{Algorithm: algorithm, ChecksumValue: hash.Value})
+				}
+			}
+		}
+	}
+
+	if component.Licenses != nil {
+		// Licenses given by name only have no SPDX identifier and are left out
+		var expressions []string
+		for _, license := range *component.Licenses {
+			switch {
+			case license.Expression != "":
+				expressions = append(expressions, license.Expression)
+			case license.License != nil && license.License.ID != "":
+				expressions = append(expressions, license.License.ID)
+			}
+		}
+		if len(expressions) == 1 {
+			pkg.LicenseConcluded = expressions[0]
+		} else if len(expressions) > 1 {
+			for i, expression := range expressions {
+				if strings.Contains(expression, " ") {
+					expressions[i] = "(" + expression + ")"
+				}
+			}
+			pkg.LicenseConcluded = strings.Join(expressions, " AND ")
+		}
+	}
+	return pkg
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+)
+
+// cpePartApplication is the CPE 2.3 part of packages.
+const cpePartApplication = "a"
+
+// cpeVendors are the CPE vendor names NVD uses for the distributions, distributions missing
+// here use their name.
+var cpeVendors = map[string]string{
+	"ubuntu":      "canonical",
+	"debian":      "debian",
+	"alpine":      "alpinelinux",
+	"centos":      "centos",
+	"fedora":      "fedoraproject",
+	"rhel":        "redhat",
+	"opensuse":    "opensuse",
+	"sles":        "suse",
+	"rocky":       "rockylinux",
+	"ol":          "oracle",
+	"amazonlinux": "amazon",
+	"photon":      "vmware",
+	"slackware":   "slackware",
+	"openwrt":     "openwrt",
+	"arch":        "archlinux",
+	"void":        "voidlinux",
+	"nixos":       "nixos",
+}
+
+// cpeVendorFor returns the CPE vendor of the packages of a distribution.
+func cpeVendorFor(distro string) string {
+	distro = strings.ToLower(distro)
+	if vendor, ok := cpeVendors[distro]; ok {
+		return vendor
+	}
+	return distro
+}
+
+// formatCPE builds a CPE 2.3 formatted string, the attributes other than part, vendor,
+// product and version are ANY.
+//
+// Parameters:
+// - part: a for applications, o for operating systems or h for hardware.
+// - vendor: the vendor, escaped by formatCPE.
+// - product: the product, escaped by formatCPE.
+// - version: the version, escaped by formatCPE.
+//
+// Returns:
+// - string: the CPE, e.g. cpe:2.3:a:debian:libstdc\+\+6:12.2.0-14:*:*:*:*:*:*:*.
+func formatCPE(part, vendor, product, version string) string {
+	return "cpe:2.3:" + part + ":" + cpeEscape(vendor) + ":" + cpeEscape(product) + ":" + cpeEscape(version) + ":*:*:*:*:*:*:*"
+}
+
+// cpeEscape encodes a value as attribute of a CPE 2.3 formatted string.
+//
+// The value is lowercased, whitespace becomes an underscore and every character other than
+// letters, digits, underscore, hyphen and period is quoted with a backslash, e.g. the epoch
+// separator of 1:2.3~rc1 and the plus signs of libstdc++6. An empty value is ANY.
+//
+// Parameters:
+// - value: the attribute value.
+//
+// Returns:
+// - string: the encoded value.
+func cpeEscape(value string) string {
+	if value == "" {
+		return "*"
+	}
+	var escaped strings.Builder
+	for _, r := range strings.ToLower(value) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			escaped.WriteRune(r)
+		case r == ' ' || r == '\t':
+			escaped.WriteByte('_')
+		case r < 0x20 || r > 0x7e:
+			// Only printable ASCII is allowed, other characters cannot be quoted
+			escaped.WriteByte('_')
+		default:
+			escaped.WriteByte('\\')
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestCPEEscape(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "*"},
+		{"libc6", "libc6"},
+		{"libstdc++6", `libstdc\+\+6`},
+		{"1:2.3~rc1-1", `1\:2.3\~rc1-1`},
+		{"2.36-9+deb12u4", `2.36-9\+deb12u4`},
+		{"NetworkManager", "networkmanager"},
+		{"Perl-Text_CSV", "perl-text_csv"},
+		{"a:b", `a\:b`},
+		{"lib*", `lib\*`},
+		{"what?", `what\?`},
+		{`back\slash`, `back\\slash`},
+		{"two words", "two_words"},
+		{"café", "caf_"},
+	}
+	for _, test := range tests {
+		if got := cpeEscape(test.value); got != test.want {
+			t.Errorf("cpeEscape(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestFormatCPE(t *testing.T) {
+	tests := []struct {
+		vendor, product, version string
+		want                     string
+	}{
+		{"debian", "libstdc++6", "12.2.0-14", `cpe:2.3:a:debian:libstdc\+\+6:12.2.0-14:*:*:*:*:*:*:*`},
+		{"canonical", "dpkg", "1:2.3~rc1-1", `cpe:2.3:a:canonical:dpkg:1\:2.3\~rc1-1:*:*:*:*:*:*:*`},
+		{"fedoraproject", "NetworkManager", "1.44.2-1.fc39", `cpe:2.3:a:fedoraproject:networkmanager:1.44.2-1.fc39:*:*:*:*:*:*:*`},
+		{"redhat", "glob*?", "", `cpe:2.3:a:redhat:glob\*\?:*:*:*:*:*:*:*:*`},
+	}
+	for _, test := range tests {
+		if got := formatCPE(cpePartApplication, test.vendor, test.product, test.version); got != test.want {
+			t.Errorf("formatCPE(%q, %q, %q) = %q, want %q", test.vendor, test.product, test.version, got, test.want)
+		}
+	}
+}
+
+func TestCPEVendorFor(t *testing.T) {
+	tests := []struct {
+		distro string
+		want   string
+	}{
+		{"ubuntu", "canonical"},
+		{"Ubuntu", "canonical"},
+		{"rhel", "redhat"},
+		{"sles", "suse"},
+		{"alpine", "alpinelinux"},
+		{"Gentoo", "gentoo"},
+	}
+	for _, test := range tests {
+		if got := cpeVendorFor(test.distro); got != test.want {
+			t.Errorf("cpeVendorFor(%q) = %q, want %q", test.distro, got, test.want)
+		}
+	}
+}
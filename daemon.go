@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// runDaemon calls run on a cron schedule and whenever the process receives SIGHUP.
+//
+// Parameters:
+// - ctx: the context, the daemon stops when it is cancelled.
+// - schedule: a standard five field cron expression or a descriptor such as @daily.
+// - run: the function generating and delivering the SBOM.
+//
+// Returns:
+// - error: an error if the schedule is invalid.
+func runDaemon(ctx context.Context, schedule string, run func()) error {
+	parsed, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %v", schedule, err)
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		next := parsed.Next(time.Now())
+		slog.Info("Waiting for next run", "schedule", schedule, "next", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-hangup:
+			timer.Stop()
+			slog.Info("Received SIGHUP, running now")
+		case <-timer.C:
+		}
+
+		run()
+	}
+}
@@ -1,111 +1,357 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
+	"runtime"
 	"strings"
 )
 
-// GetDependencies fetches the dependencies of a list of packages using a specified package manager.
+// maxWorkers caps the default number of package manager commands run in parallel,
+// more only adds contention on the package database.
+const maxWorkers = 8
+
+// lockingCommands are the per-package commands, by package manager and kind, that hold the
+// package database lock while they run, e.g. rpm queries take the rpmdb lock. Concurrent
+// invocations only wait on each other and burn CPU on lock contention, so they run one at
+// a time. The other commands only read files, e.g. dpkg-query reads /var/lib/dpkg/status
+// and apt-cache the package lists, and run on every worker.
+var lockingCommands = map[string]map[string]bool{
+	"rpm": {"license": true, "dependencies": true},
+}
+
+// defaultWorkers returns the default number of commands run in parallel for a package manager.
 //
 // Parameters:
-// - packageManager: the package manager to use for fetching dependencies.
-// - packageNames: a list of package names for which to fetch dependencies.
+// - packageManager: the package manager running the commands.
 //
 // Returns:
-// - a map of package names to their dependencies.
-// - an error if there was a problem fetching the dependencies.
-func GetDependencies(packageManager string, packageNames []string) (map[string][]string, error) {
-	type result struct {
-		packageName  string
-		dependencies []string
-		err          error
-	}
-
-	fmt.Fprintf(os.Stderr, "Fetching dependencies for %d packages using %s...\n", len(packageNames), packageManager)
-
-	numWorkers := 4
-	jobs := make(chan string, len(packageNames))
-	results := make(chan result, len(packageNames))
-
-	// Worker function
-	worker := func() {
-		for packageName := range jobs {
-			dependencies, err := fetchDependencies(packageManager, packageName)
-			results <- result{packageName, dependencies, err}
-		}
+// - int: the number of CPUs, capped by maxWorkers, and 1 for opkg, whose devices have too
+// little memory for several package manager processes at once.
+func defaultWorkers(packageManager string) int {
+	if packageManager == "opkg" {
+		return 1
 	}
+	return max(min(runtime.NumCPU(), maxWorkers), 1)
+}
 
-	// Start workers
-	for range numWorkers {
-		go worker()
+// commandParallelism returns how many commands of a kind run in parallel.
+//
+// Parameters:
+// - packageManager: the package manager running the commands.
+// - kind: what the commands fetch, e.g. license.
+// - workers: the number of workers.
+//
+// Returns:
+// - int: 1 for commands holding the package database lock, workers otherwise.
+func commandParallelism(packageManager, kind string, workers int) int {
+	if lockingCommands[packageManager][kind] {
+		return 1
 	}
+	return workers
+}
 
-	// Send jobs
-	for _, packageName := range packageNames {
-		jobs <- packageName
+// fetchDependencies fetches the dependencies of a package using the specified package manager.
+//
+// Parameters:
+// - ctx: the context, the command is killed when it is cancelled.
+// - runner: runs the command on the scanned system.
+// - packageManager: the package manager to use for fetching dependencies.
+// - packageName: the name of the package for which to fetch dependencies.
+// - maxLineSize: the longest line of output that is accepted, 0 for defaultMaxLineSize.
+//
+// Returns:
+// - a slice of strings representing the dependencies of the package.
+// - an error if there was a problem executing the command.
+func fetchDependencies(ctx context.Context, runner Runner, packageManager, packageName string, maxLineSize int) ([]string, error) {
+	switch packageManager {
+	case "zypper":
+		return fetchZypperDependencies(ctx, runner, packageName, maxLineSize)
+	case "tdnf":
+		return fetchTdnfDependencies(ctx, runner, packageName, maxLineSize)
+	}
+	args, err := dependencyCommand(packageManager, packageName)
+	if err != nil || args == nil {
+		return nil, err
 	}
-	close(jobs)
 
-	// Collect results
-	dependencyMap := make(map[string][]string)
-	for range packageNames {
-		res := <-results
-		if res.err != nil {
-			return nil, res.err
+	var dependencies []string
+	var info strings.Builder
+	err = streamCommand(ctx, runner, args, maxLineSize, func(line string) {
+		if packageManager == "pacman" {
+			info.WriteString(line + "\n")
+			return
+		}
+		line = strings.TrimSpace(line)
+		switch packageManager {
+		case "dpkg":
+			line = aptCacheDependencyName(line)
+		case "rpm":
+			if strings.HasPrefix(line, rpmUnprovided) {
+				return
+			}
+		case "dnf", "yum":
+			line = dnfDependencyName(line)
+		case "apk":
+			line = apkDependencyName(line)
+		case "opkg":
+			// libubox depends on:
+			if strings.HasSuffix(line, " depends on:") {
+				return
+			}
+		case "xbps":
+			line = xbpsDependencyName(line)
+		case "nix":
+			// Store paths reference themselves, e.g. through their rpath
+			if line == packageName {
+				return
+			}
+			name, version, _ := parseNixStorePath(line)
+			line = installedPackage{name: name, version: version, storePath: line}.key()
+		}
+		if line != "" {
+			dependencies = append(dependencies, line)
 		}
-		dependencyMap[res.packageName] = res.dependencies
+	})
+	if err != nil {
+		return nil, err
+	}
+	if packageManager == "pacman" {
+		return pacmanDependencies(pacmanInfoField(info.String(), "Depends On")), nil
 	}
 
-	return dependencyMap, nil
+	return dependencies, nil
 }
 
-/*************  ✨ Codeium AI Suggestion  *************/
-// fetchDependencies fetches the dependencies of a package using the specified package manager.
+// aptCacheDependencyName returns the package a line of apt-cache depends names as
+// dependency, e.g. libc6 for "PreDepends: libc6". Only Depends and PreDepends count, like
+// the Pre-Depends and Depends fields the native source reads. Every alternative of a group
+// is returned, " |Depends: mawk" marks all but the last, so that whichever is installed is
+// matched. Virtual packages, e.g. <debconf-2.0>, and the providers apt-cache lists below
+// them are skipped, except for <python3:any>, which apt-cache brackets although it names the
+// package itself. Architecture qualifiers are handled like parseDpkgDepends does.
+//
+// Parameters:
+// - line: a line of apt-cache depends in the C locale, without surrounding whitespace.
+//
+// Returns:
+// - string: the package name, empty for the package header, other relationships, virtual
+// packages and their providers.
+func aptCacheDependencyName(line string) string {
+	label, name, ok := strings.Cut(strings.TrimPrefix(line, "|"), ": ")
+	if !ok || (label != "Depends" && label != "PreDepends") {
+		return ""
+	}
+	name = strings.TrimSpace(name)
+	virtual := strings.HasPrefix(name, "<") && strings.HasSuffix(name, ">")
+	name, arch := splitPackageArch(strings.Trim(name, "<>"))
+	if name == "" || (virtual && arch != "any" && arch != "native") {
+		return ""
+	}
+	if arch != "" && arch != "any" && arch != "native" {
+		name += ":" + arch
+	}
+	return name
+}
+
+// rpmRequiresScript prints the installed packages providing the requirements of the package
+// in $1. rpm -qR lists capabilities, e.g. libc.so.6()(64bit) or /bin/sh, instead of the
+// packages providing them, so they are resolved against the rpm database like zypper and
+// dnf repoquery --requires --resolve do, in a single rpm call. Requirements on rpm features,
+// rpmlib(...), are skipped, and so are rich dependencies, e.g. (grub2 if efi-filesystem),
+// whose conditions rpm cannot evaluate for an installed package. The requirements are split
+// by line only, as rich dependencies contain spaces.
+const rpmRequiresScript = `set -f; nl=$(printf '\n_'); IFS=${nl%_}; ` +
+	`requires=$(rpm -q --qf '[%{REQUIRENAME}\n]' "$1") || exit 1; shift; ` +
+	`for r in $requires; do case $r in rpmlib\(*|\(*) ;; *) set -- "$@" "$r";; esac; done; ` +
+	`[ $# -eq 0 ] || rpm -q --qf '%{NAME}\n' --whatprovides "$@"; true`
+
+// rpmUnprovided is the line rpm prints for a requirement no installed package provides.
+const rpmUnprovided = "no package provides "
+
+// rpmDependencyResolvers are the package managers resolving the requirements of rpm packages
+// to the installed packages providing them, by distribution. The other rpm distributions
+// resolve them with rpmRequiresScript.
+var rpmDependencyResolvers = map[string]string{
+	"opensuse":    "zypper",
+	"sles":        "zypper",
+	"fedora":      "dnf",
+	"rhel":        "dnf",
+	"centos":      "dnf",
+	"rocky":       "dnf",
+	"almalinux":   "dnf",
+	"ol":          "dnf",
+	"eurolinux":   "dnf",
+	"amazonlinux": "dnf",
+	"photon":      "tdnf",
+}
+
+// rpmReleaseDependencyResolvers override rpmDependencyResolvers for older releases, by
+// distribution and major version. The releases that came before dnf have the repoquery of
+// yum-utils, the tdnf 2 of Photon OS 3 has no repoquery.
+var rpmReleaseDependencyResolvers = map[string]string{
+	"amazonlinux 2": "yum",
+	"rhel 7":        "yum",
+	"centos 7":      "yum",
+	"ol 7":          "yum",
+	"eurolinux 7":   "yum",
+	"photon 1":      "rpm",
+	"photon 2":      "rpm",
+	"photon 3":      "rpm",
+}
+
+// dependencyResolverFor returns the package manager fetching the dependencies of the packages
+// of a distribution when the package manager is run, zypper, dnf, yum or tdnf for most rpm
+// distributions and the package manager of the distribution otherwise.
+//
+// Parameters:
+// - distro: the name of the Linux distribution.
+// - version: the release of the distribution, the VERSION_ID of /etc/os-release.
+// - packageManager: the package manager of the distribution.
+//
+// Returns:
+// - string: the package manager passed to fetchDependencies and dependencyCommand.
+func dependencyResolverFor(distro, version, packageManager string) string {
+	if packageManager != "rpm" {
+		return packageManager
+	}
+	distro = strings.ToLower(upstreamDistro(distro))
+	major, _, _ := strings.Cut(version, ".")
+	if resolver, ok := rpmReleaseDependencyResolvers[distro+" "+major]; ok {
+		return resolver
+	}
+	if resolver, ok := rpmDependencyResolvers[distro]; ok {
+		return resolver
+	}
+	return packageManager
+}
+
+// dnfDependencyName returns the dependency of a package dnf repoquery --requires --resolve
+// prints, e.g. glibc:x86_64 for glibc-0:2.38-16.fc39.x86_64. dnf 4 and the repoquery of
+// yum-utils print the epoch of every package and dnf 5 only non-zero ones, all are parsed.
+//
+// Parameters:
+// - line: a line of dnf repoquery.
+//
+// Returns:
+// - string: the name qualified with the architecture, empty for lines that are no package.
+func dnfDependencyName(line string) string {
+	name, _, arch, ok := parseNEVRA(line)
+	if !ok || strings.ContainsAny(name, " :") {
+		return ""
+	}
+	return name + ":" + arch
+}
+
+// dependencyCommand returns the command listing the dependencies of a package.
 //
 // Parameters:
 // - packageManager: the package manager to use for fetching dependencies.
 // - packageName: the name of the package for which to fetch dependencies.
 //
 // Returns:
-// - a slice of strings representing the dependencies of the package.
-// - an error if there was a problem executing the command.
-/****  bot-606125c3-00c4-4551-9a52-eedb7516de21  *****/
-func fetchDependencies(packageManager, packageName string) ([]string, error) {
-	var cmd *exec.Cmd
+// - the command and its arguments, nil if the package manager records no dependencies.
+// - an error if the package manager is not supported.
+func dependencyCommand(packageManager, packageName string) ([]string, error) {
 	switch packageManager {
 	case "dpkg":
-		fmt.Println("Fetching dependencies for", packageName)
-		cmd = exec.Command("apt-cache", "depends", packageName)
+		return []string{"apt-cache", "depends", packageName}, nil
 	case "apk":
-		cmd = exec.Command("apk", "info", "-d", packageName)
+		return []string{"apk", "info", "-R", packageName}, nil
 	case "rpm":
-		cmd = exec.Command("rpm", "-qR", packageName)
+		return []string{"sh", "-c", rpmRequiresScript, "sh", packageName}, nil
+	case "dnf":
+		// Only the installed packages are queried, without loading the metadata of the repositories
+		return []string{"dnf", "--quiet", "--disablerepo=*", "repoquery", "--installed", "--requires", "--resolve", packageName}, nil
+	case "yum":
+		return []string{"repoquery", "--quiet", "--disablerepo=*", "--installed", "--requires", "--resolve", packageName}, nil
+	case "zypper":
+		return zypperRequiresCommand(packageName), nil
+	case "tdnf":
+		return tdnfRequiresCommand(packageName), nil
+	case "pacman":
+		return []string{"pacman", "-Qi", packageName}, nil
+	case "xbps":
+		return []string{"xbps-query", "-x", packageName}, nil
+	case "nix":
+		return []string{"nix-store", "--query", "--references", packageName}, nil
+	case "swupd":
+		return []string{"sh", "-c", swupdIncludesScript, "sh", packageName}, nil
+	case "pkgtools", "windows":
+		return nil, nil
+	case "pkg":
+		return []string{"pkg", "query", "%dn", packageName}, nil
+	case "opkg":
+		return []string{"opkg", "depends", packageName}, nil
 	default:
 		return nil, fmt.Errorf("unsupported package manager: %s", packageManager)
 	}
+}
 
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
+// componentIndex finds the bom-refs of the components dependencies name, by name and
+// architecture.
+type componentIndex struct {
+	// refs are the bom-refs by package key, name:arch or the name for packages without
+	// architecture.
+	refs map[string]string
+	// byName are the bom-refs of every architecture of a package name, in listing order.
+	byName map[string][]string
+	// providers are the names of the packages providing the capabilities dependencies
+	// name instead of a package, e.g. so:libz.so.1 of apk, nil if there are none.
+	providers map[string]string
+}
 
-	err := cmd.Run()
-	if err != nil {
-		return nil, fmt.Errorf("error executing dependency command: %v, stderr: %s", err, stderr.String())
+// newComponentIndex indexes the components of the packages.
+//
+// Parameters:
+// - items: the packages with their components.
+//
+// Returns:
+// - *componentIndex: the index.
+func newComponentIndex(items []*pipelineItem) *componentIndex {
+	index := &componentIndex{refs: make(map[string]string), byName: make(map[string][]string)}
+	for _, item := range items {
+		index.refs[item.key()] = item.component.BOMRef
+		index.byName[item.name] = append(index.byName[item.name], item.component.BOMRef)
 	}
+	return index
+}
 
-	var dependencies []string
-	scanner := bufio.NewScanner(strings.NewReader(out.String()))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			dependencies = append(dependencies, line)
+// resolve returns the bom-ref of a dependency of a package.
+//
+// A dependency qualified with an architecture, e.g. libssl3:i386, matches that
+// architecture or a package merged across architectures. Unqualified ones, and those qualified with the dpkg wildcards any and
+// native, match the architecture of the depending package first, then architecture all or
+// noarch, then any installed architecture.
+//
+// Parameters:
+// - dependency: the name of the dependency, optionally qualified with an architecture.
+// - arch: the architecture of the depending package, empty if unknown.
+//
+// Returns:
+// - string: the bom-ref of the dependency.
+// - bool: whether the dependency is installed.
+func (c *componentIndex) resolve(dependency, arch string) (string, bool) {
+	if provider, ok := c.providers[dependency]; ok {
+		dependency = provider
+	}
+	name, qualifier := splitPackageArch(dependency)
+	if qualifier != "" && qualifier != "any" && qualifier != "native" {
+		// Merged multi-arch packages are indexed by their name
+		for _, candidate := range []string{name + ":" + qualifier, name} {
+			if ref, ok := c.refs[candidate]; ok {
+				return ref, true
+			}
 		}
+		return "", false
 	}
-
-	return dependencies, nil
+	for _, candidate := range []string{name + ":" + arch, name + ":all", name + ":noarch", name} {
+		if ref, ok := c.refs[candidate]; ok {
+			return ref, true
+		}
+	}
+	if refs := c.byName[name]; len(refs) > 0 {
+		return refs[0], true
+	}
+	return "", false
 }
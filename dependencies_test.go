@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAptCacheDependencyName(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"dash", ""},
+		{"Depends: libc6", "libc6"},
+		{"PreDepends: libtinfo6", "libtinfo6"},
+		{"|Depends: gpgv", "gpgv"},
+		{"Depends: <debconf-2.0>", ""},
+		{"|PreDepends: <libc-dev>", ""},
+		{"cdebconf", ""},
+		{"Depends: libgcc-s1:i386", "libgcc-s1:i386"},
+		{"Depends: perl:any", "perl"},
+		{"Depends: <python3:any>", "python3"},
+		{"Depends: <libc-dev:amd64>", ""},
+		{"Recommends: apt-utils", ""},
+		{"Breaks: <firefox>", ""},
+		{"Hängt ab: libc6", ""},
+	}
+	for _, test := range tests {
+		if got := aptCacheDependencyName(test.line); got != test.want {
+			t.Errorf("aptCacheDependencyName(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestFetchDependenciesAptCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		want    []string
+	}{
+		{
+			name:    "C locale",
+			fixture: "apt-cache-depends.txt",
+			want:    []string{"debconf", "libc6", "libgcc-s1:amd64", "perl", "python3", "gpgv", "gpgv2", "gpgv1"},
+		},
+		{
+			// Translated labels are not recognized, which is why the commands run in the C locale
+			name:    "German locale",
+			fixture: "apt-cache-depends.de.txt",
+			want:    nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := &fixtureRunner{outputs: map[string]string{"apt-cache depends dash": test.fixture}}
+			got, err := fetchDependencies(context.Background(), runner, "dpkg", "dash", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("fetchDependencies() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDependencyResolverFor(t *testing.T) {
+	derivedDistros["navy"] = "rhel"
+	t.Cleanup(func() { delete(derivedDistros, "navy") })
+	tests := []struct {
+		distro, version, packageManager string
+		want                            string
+	}{
+		{"opensuse", "15.5", "rpm", "zypper"},
+		{"sles", "15.5", "rpm", "zypper"},
+		{"fedora", "39", "rpm", "dnf"},
+		{"RHEL", "9.3", "rpm", "dnf"},
+		{"rhel", "7.9", "rpm", "yum"},
+		{"centos", "7", "rpm", "yum"},
+		{"rocky", "9.3", "rpm", "dnf"},
+		{"navy", "9.3", "rpm", "dnf"},
+		{"amazonlinux", "2023", "rpm", "dnf"},
+		{"amazonlinux", "2", "rpm", "yum"},
+		{"photon", "5.0", "rpm", "tdnf"},
+		{"photon", "3.0", "rpm", "rpm"},
+		{"debian", "12", "dpkg", "dpkg"},
+	}
+	for _, test := range tests {
+		if got := dependencyResolverFor(test.distro, test.version, test.packageManager); got != test.want {
+			t.Errorf("dependencyResolverFor(%q, %q, %q) = %q, want %q", test.distro, test.version, test.packageManager, got, test.want)
+		}
+	}
+}
+
+func TestDnfDependencyName(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"glibc-0:2.38-16.fc39.x86_64", "glibc:x86_64"},
+		{"glibc-2.38-16.fc39.x86_64", "glibc:x86_64"},
+		{"ncurses-libs-0:6.4-7.20230520.fc39.x86_64", "ncurses-libs:x86_64"},
+		{"shadow-utils-2:4.14.0-2.fc39.x86_64", "shadow-utils:x86_64"},
+		{"tzdata-0:2024a-2.fc39.noarch", "tzdata:noarch"},
+		{"glibc-0:2.26-64.amzn2.0.2.x86_64", "glibc:x86_64"},
+		{"", ""},
+		{"Last metadata expiration check: 0:01:02 ago.", ""},
+	}
+	for _, test := range tests {
+		if got := dnfDependencyName(test.line); got != test.want {
+			t.Errorf("dnfDependencyName(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestFetchDependenciesDnf(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolver string
+		fixture  string
+		want     []string
+	}{
+		{
+			name:     "dnf 4",
+			resolver: "dnf",
+			fixture:  "dnf4-repoquery-requires.txt",
+			want:     []string{"bash:x86_64", "filesystem:x86_64", "glibc:x86_64", "glibc:i686", "ncurses-libs:x86_64"},
+		},
+		{
+			name:     "dnf 5",
+			resolver: "dnf",
+			fixture:  "dnf5-repoquery-requires.txt",
+			want:     []string{"filesystem:x86_64", "glibc:x86_64", "ncurses-libs:x86_64", "shadow-utils:x86_64"},
+		},
+		{
+			name:     "yum-utils",
+			resolver: "yum",
+			fixture:  "yum-repoquery-requires.txt",
+			want:     []string{"bash:x86_64", "filesystem:x86_64", "glibc:x86_64", "ncurses-libs:x86_64"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args, err := dependencyCommand(test.resolver, "bash.x86_64")
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner := &fixtureRunner{outputs: map[string]string{strings.Join(args, " "): test.fixture}}
+			got, err := fetchDependencies(context.Background(), runner, test.resolver, "bash.x86_64", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("fetchDependencies() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/CycloneDX/cyclonedx-go"
+	"github.com/google/uuid"
 )
 
 type Project struct {
@@ -21,36 +30,105 @@ type UUID struct {
 	UUID string `json:"uuid"`
 }
 
+type Team struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+type ACLMapping struct {
+	Team    string `json:"team"`
+	Project string `json:"project"`
+}
+
+type Permission struct {
+	Name string `json:"name"`
+}
+
+type TeamSelf struct {
+	Name        string       `json:"name"`
+	Permissions []Permission `json:"permissions"`
+}
+
 type SBOMUpload struct {
 	ProjectUUID string `json:"project"`
 	AutoCreate  bool   `json:"autoCreate"`
 	BOM         string `json:"bom"`
 }
 
+// DependencyTrack holds the connection settings for a Dependency-Track server.
+//
+// Timeout is applied to every individual API request, covering connection setup,
+// redirects and reading the response body. A zero Timeout disables the deadline.
+//
+// Teams lists the names or UUIDs of the teams that are granted access to the
+// projects created by the tool, which is needed when portfolio access control is enabled.
+type DependencyTrack struct {
+	APIURL    string
+	APIKey    string
+	TLSVerify bool
+	Timeout   time.Duration
+	Teams     []string
+
+	client *http.Client
+	// teamUUIDs maps the lower case names of the teams to their UUIDs, listed on first use.
+	teamUUIDs map[string]string
+}
+
+// httpClient returns the HTTP client used for all requests to the Dependency-Track API.
+//
+// The client is created on first use and reused for subsequent requests so that
+// connections can be kept alive between the project lookups and the BOM upload.
+func (dt *DependencyTrack) httpClient() *http.Client {
+	if dt.client == nil {
+		dt.client = newHTTPClient(dt.TLSVerify, dt.Timeout)
+	}
+	return dt.client
+}
+
+// newHTTPClient creates an HTTP client with the given TLS verification and request timeout.
+//
+// Parameters:
+// - tlsVerify: a boolean indicating whether to verify the TLS certificate.
+// - timeout: the deadline for a single request, or 0 for no deadline.
+//
+// Returns:
+// - *http.Client: the configured client.
+func newHTTPClient(tlsVerify bool, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: !tlsVerify},
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
+
 // getProjectUUID retrieves the UUID of a project from the Dependency-Track API.
 //
 // Parameters:
-// - apiURL: the URL of the Dependency-Track API.
-// - apiKey: the API key for authentication.
+// - ctx: the context controlling cancellation of the request.
 // - name: the name of the project.
-// - tlsVerify: a boolean indicating whether to verify the TLS certificate.
 //
 // Returns:
 // - *UUID: the UUID of the project.
 // - error: an error if the request fails or the response is not OK.
-func getProjectUUID(apiURL, apiKey, name string, tlsVerify bool) (*UUID, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/project?name=%s", apiURL, name), nil)
+func (dt *DependencyTrack) getProjectUUID(ctx context.Context, name string) (*UUID, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/v1/project?name=%s", dt.APIURL, url.QueryEscape(name)), nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
-	req.Header.Set("X-Api-Key", apiKey)
+	req.Header.Set("X-Api-Key", dt.APIKey)
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: !tlsVerify},
-		},
-	}
-	resp, err := client.Do(req)
+	resp, err := dt.httpClient().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %v", err)
 	}
@@ -73,21 +151,56 @@ func getProjectUUID(apiURL, apiKey, name string, tlsVerify bool) (*UUID, error)
 	return &projects[0], nil
 }
 
+// lookupProject retrieves the UUID of a project with a specific version from the Dependency-Track API.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the request.
+// - name: the name of the project.
+// - version: the version of the project.
+//
+// Returns:
+// - *UUID: the UUID of the project.
+// - error: an error if the request fails or the response is not OK.
+func (dt *DependencyTrack) lookupProject(ctx context.Context, name, version string) (*UUID, error) {
+	query := url.Values{"name": {name}, "version": {version}}
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/v1/project/lookup?%s", dt.APIURL, query.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("X-Api-Key", dt.APIKey)
+
+	resp, err := dt.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	var project UUID
+	if err := json.NewDecoder(resp.Body).Decode(&project); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	return &project, nil
+}
+
 // createProject creates a new project in the Dependency-Track API.
 //
 // Parameters:
-// - apiURL: the URL of the Dependency-Track API.
-// - apiKey: the API key for authentication.
+// - ctx: the context controlling cancellation of the request.
 // - name: the name of the project.
 // - version: the version of the project.
 // - classifier: the classifier of the project.
 // - parentUUID: the UUID of the parent project.
-// - tlsVerify: a boolean indicating whether to verify the TLS certificate.
 //
 // Returns:
 // - *UUID: the UUID of the created project.
 // - error: an error if the request fails or the response is not OK.
-func createProject(apiURL, apiKey, name, version, classifier string, parentUUID *UUID, tlsVerify bool) (*UUID, error) {
+func (dt *DependencyTrack) createProject(ctx context.Context, name, version, classifier string, parentUUID *UUID) (*UUID, error) {
 	project := Project{
 		Name:       name,
 		Version:    version,
@@ -100,19 +213,14 @@ func createProject(apiURL, apiKey, name, version, classifier string, parentUUID
 		return nil, fmt.Errorf("error marshaling project JSON: %v", err)
 	}
 
-	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/v1/project", apiURL), bytes.NewBuffer(projectJSON))
+	req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%s/api/v1/project", dt.APIURL), bytes.NewBuffer(projectJSON))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Api-Key", apiKey)
+	req.Header.Set("X-Api-Key", dt.APIKey)
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: !tlsVerify},
-		},
-	}
-	resp, err := client.Do(req)
+	resp, err := dt.httpClient().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %v", err)
 	}
@@ -120,7 +228,12 @@ func createProject(apiURL, apiKey, name, version, classifier string, parentUUID
 
 	if resp.StatusCode == http.StatusConflict {
 		// Project already exists, retrieve its UUID
-		existingUUID, err := getProjectUUID(apiURL, apiKey, name, tlsVerify)
+		var existingUUID *UUID
+		if version != "" {
+			existingUUID, err = dt.lookupProject(ctx, name, version)
+		} else {
+			existingUUID, err = dt.getProjectUUID(ctx, name)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("error retrieving existing project UUID: %v", err)
 		}
@@ -140,32 +253,165 @@ func createProject(apiURL, apiKey, name, version, classifier string, parentUUID
 	return &projectUUID, nil
 }
 
+// resolveTeamUUID returns the UUID of a Dependency-Track team.
+//
+// The teams are listed once and looked up by name afterwards, so that every project
+// the teams are assigned to costs no further request.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the request.
+// - team: the name or UUID of the team.
+//
+// Returns:
+// - string: the UUID of the team.
+// - error: an error if the request fails or no team with that name exists.
+func (dt *DependencyTrack) resolveTeamUUID(ctx context.Context, team string) (string, error) {
+	if _, err := uuid.Parse(team); err == nil {
+		return team, nil
+	}
+
+	if dt.teamUUIDs == nil {
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/v1/team", dt.APIURL), nil)
+		if err != nil {
+			return "", fmt.Errorf("error creating request: %v", err)
+		}
+		req.Header.Set("X-Api-Key", dt.APIKey)
+
+		resp, err := dt.httpClient().Do(req)
+		if err != nil {
+			return "", fmt.Errorf("error sending request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			return "", fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(body))
+		}
+
+		var teams []Team
+		if err := json.NewDecoder(resp.Body).Decode(&teams); err != nil {
+			return "", fmt.Errorf("error decoding response: %v", err)
+		}
+
+		dt.teamUUIDs = make(map[string]string, len(teams))
+		for _, t := range teams {
+			dt.teamUUIDs[strings.ToLower(t.Name)] = t.UUID
+		}
+	}
+
+	if teamUUID, ok := dt.teamUUIDs[strings.ToLower(team)]; ok {
+		return teamUUID, nil
+	}
+	return "", fmt.Errorf("team not found: %s", team)
+}
+
+// assignTeams grants the configured teams access to a project through an ACL mapping.
+//
+// Mappings that already exist are reported as a conflict by the API and are ignored,
+// so the function can be called for both new and existing projects.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the requests.
+// - projectUUID: the UUID of the project.
+//
+// Returns:
+// - error: an error if a team cannot be resolved or the mapping cannot be created.
+func (dt *DependencyTrack) assignTeams(ctx context.Context, projectUUID *UUID) error {
+	for _, team := range dt.Teams {
+		teamUUID, err := dt.resolveTeamUUID(ctx, team)
+		if err != nil {
+			return fmt.Errorf("error resolving team %s: %v", team, err)
+		}
+
+		mappingJSON, err := json.Marshal(ACLMapping{Team: teamUUID, Project: projectUUID.UUID})
+		if err != nil {
+			return fmt.Errorf("error marshaling ACL mapping JSON: %v", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%s/api/v1/acl/mapping", dt.APIURL), bytes.NewBuffer(mappingJSON))
+		if err != nil {
+			return fmt.Errorf("error creating request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Api-Key", dt.APIKey)
+
+		resp, err := dt.httpClient().Do(req)
+		if err != nil {
+			return fmt.Errorf("error sending request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusConflict {
+			return fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(body))
+		}
+	}
+
+	return nil
+}
+
 // uploadSBOM uploads a Software Bill of Materials (SBOM) to the Dependency-Track API.
 //
 // Parameters:
-// - apiURL: the URL of the Dependency-Track API.
-// - apiKey: the API key for authentication.
+// - ctx: the context controlling cancellation of the upload.
 // - distro: the name of the operating system distribution.
 // - hostname: the hostname of the system.
 // - osVersion: the version of the operating system.
 // - sbomJSON: the SBOM in JSON format.
-// - tlsVerify: a boolean indicating whether to verify the TLS certificate.
+// - containers: the SBOMs of container images on the host, uploaded as child projects of the host.
 //
 // Returns:
 // - error: an error if the upload fails.
-func uploadSBOM(apiURL, apiKey, distro, hostname, osVersion string, sbomJSON []byte, tlsVerify bool) error {
+func (dt *DependencyTrack) uploadSBOM(ctx context.Context, distro, hostname, osVersion string, sbomJSON []byte, containers []ContainerSBOM) error {
 	// Create or get the parent project for the distro
-	parentProjectUUID, err := createProject(apiURL, apiKey, distro, "", "OPERATING_SYSTEM", nil, tlsVerify)
+	parentProjectUUID, err := dt.createProject(ctx, distro, "", "OPERATING_SYSTEM", nil)
 	if err != nil {
 		return fmt.Errorf("error creating or getting parent project: %v", err)
 	}
+	if err := dt.assignTeams(ctx, parentProjectUUID); err != nil {
+		return fmt.Errorf("error assigning teams to parent project: %v", err)
+	}
 
 	// Create or get the project for the hostname
-	projectUUID, err := createProject(apiURL, apiKey, hostname, osVersion, "OPERATING_SYSTEM", parentProjectUUID, tlsVerify)
+	projectUUID, err := dt.createProject(ctx, hostname, osVersion, "OPERATING_SYSTEM", parentProjectUUID)
 	if err != nil {
 		return fmt.Errorf("error creating or getting project: %v", err)
 	}
+	if err := dt.assignTeams(ctx, projectUUID); err != nil {
+		return fmt.Errorf("error assigning teams to project: %v", err)
+	}
+
+	if err := dt.putBOM(ctx, projectUUID, sbomJSON); err != nil {
+		return err
+	}
+
+	// Create a child project per container image under the host project
+	for _, container := range containers {
+		containerUUID, err := dt.createProject(ctx, container.Name, container.Digest, "CONTAINER", projectUUID)
+		if err != nil {
+			return fmt.Errorf("error creating or getting project for container %s: %v", container.Name, err)
+		}
+		if err := dt.assignTeams(ctx, containerUUID); err != nil {
+			return fmt.Errorf("error assigning teams to container project %s: %v", container.Name, err)
+		}
+		if err := dt.putBOM(ctx, containerUUID, container.SBOM); err != nil {
+			return fmt.Errorf("error uploading SBOM for container %s: %v", container.Name, err)
+		}
+	}
+
+	return nil
+}
 
+// putBOM uploads an SBOM to an existing Dependency-Track project.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the upload.
+// - projectUUID: the UUID of the project receiving the SBOM.
+// - sbomJSON: the SBOM in JSON format.
+//
+// Returns:
+// - error: an error if the upload fails.
+func (dt *DependencyTrack) putBOM(ctx context.Context, projectUUID *UUID, sbomJSON []byte) error {
 	// Base64 encode the SBOM
 	sbomBase64 := base64.StdEncoding.EncodeToString(sbomJSON)
 
@@ -181,19 +427,14 @@ func uploadSBOM(apiURL, apiKey, distro, hostname, osVersion string, sbomJSON []b
 		return fmt.Errorf("error marshaling SBOM upload JSON: %v", err)
 	}
 
-	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/v1/bom", apiURL), bytes.NewBuffer(sbomUploadJSON))
+	req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%s/api/v1/bom", dt.APIURL), bytes.NewBuffer(sbomUploadJSON))
 	if err != nil {
 		return fmt.Errorf("error creating request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Api-Key", apiKey)
+	req.Header.Set("X-Api-Key", dt.APIKey)
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: !tlsVerify},
-		},
-	}
-	resp, err := client.Do(req)
+	resp, err := dt.httpClient().Do(req)
 	if err != nil {
 		return fmt.Errorf("error sending request: %v", err)
 	}
@@ -206,3 +447,119 @@ func uploadSBOM(apiURL, apiKey, distro, hostname, osVersion string, sbomJSON []b
 
 	return nil
 }
+
+// checkUpload verifies that an upload would succeed without creating projects or uploading the SBOM.
+//
+// It checks that the server is reachable, that the API key carries the permissions needed
+// for the upload, which of the projects already exist, and that the SBOM can be decoded as
+// CycloneDX. Dependency-Track has no dedicated BOM validation endpoint, so the document is
+// validated locally.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the requests.
+// - distro: the name of the operating system distribution.
+// - hostname: the hostname of the system.
+// - sbomJSON: the SBOM in JSON format.
+// - containers: the SBOMs of container images on the host.
+//
+// Returns:
+// - error: an error describing the first check that failed.
+func (dt *DependencyTrack) checkUpload(ctx context.Context, distro, hostname string, sbomJSON []byte, containers []ContainerSBOM) error {
+	// Connectivity, /api/version does not require authentication
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/version", dt.APIURL), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	resp, err := dt.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("error connecting to Dependency-Track: %v", err)
+	}
+	var about struct {
+		Version string `json:"version"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&about)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || err != nil {
+		return fmt.Errorf("unexpected response from %s/api/version: status %d", dt.APIURL, resp.StatusCode)
+	}
+	slog.Info("Connected to Dependency-Track", "version", about.Version, "url", dt.APIURL)
+
+	// API key permissions
+	req, err = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/v1/team/self", dt.APIURL), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("X-Api-Key", dt.APIKey)
+	resp, err = dt.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var self TeamSelf
+		if err := json.NewDecoder(resp.Body).Decode(&self); err != nil {
+			return fmt.Errorf("error decoding response: %v", err)
+		}
+		granted := make(map[string]struct{})
+		for _, p := range self.Permissions {
+			granted[p.Name] = struct{}{}
+		}
+		required := []string{"BOM_UPLOAD", "PORTFOLIO_MANAGEMENT", "VIEW_PORTFOLIO"}
+		if len(dt.Teams) > 0 {
+			required = append(required, "ACCESS_MANAGEMENT")
+		}
+		var missing []string
+		for _, p := range required {
+			if _, ok := granted[p]; !ok {
+				missing = append(missing, p)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("API key of team %s is missing permissions: %s", self.Name, strings.Join(missing, ", "))
+		}
+		slog.Info("API key has the required permissions", "team", self.Name)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("API key was rejected: status %d", resp.StatusCode)
+	case http.StatusNotFound:
+		slog.Warn("Server does not support permission checks, skipping")
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	// Projects that would be created
+	for _, name := range []string{distro, hostname} {
+		if _, err := dt.getProjectUUID(ctx, name); err != nil {
+			slog.Info("Project would be created", "project", name, "lookup", err)
+		} else {
+			slog.Info("Project exists", "project", name)
+		}
+	}
+	for _, container := range containers {
+		if _, err := dt.lookupProject(ctx, container.Name, container.Digest); err != nil {
+			slog.Info("Container project would be created", "project", container.Name, "digest", container.Digest)
+		} else {
+			slog.Info("Container project exists", "project", container.Name, "digest", container.Digest)
+		}
+	}
+	for _, team := range dt.Teams {
+		if _, err := dt.resolveTeamUUID(ctx, team); err != nil {
+			return fmt.Errorf("error resolving team %s: %v", team, err)
+		}
+	}
+
+	// BOM validation
+	var bom cyclonedx.BOM
+	if err := cyclonedx.NewBOMDecoder(bytes.NewReader(sbomJSON), cyclonedx.BOMFileFormatJSON).Decode(&bom); err != nil {
+		return fmt.Errorf("SBOM is not a valid CycloneDX document: %v", err)
+	}
+	componentCount := 0
+	if bom.Components != nil {
+		componentCount = len(*bom.Components)
+	}
+	slog.Info("SBOM is ready for upload", "components", componentCount)
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveTeamUUID(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/team" || r.Header.Get("X-Api-Key") != "key" {
+			http.NotFound(w, r)
+			return
+		}
+		requests++
+		json.NewEncoder(w).Encode([]Team{
+			{UUID: "5d0c8b4e-64f1-4d8b-9a43-0c8e36d3c4b1", Name: "Operations"},
+			{UUID: "0f2c6a8e-2b1e-4c5d-8f8a-7e3b1d9c6a52", Name: "Security"},
+		})
+	}))
+	defer server.Close()
+
+	dt := &DependencyTrack{APIURL: server.URL, APIKey: "key"}
+	tests := []struct {
+		team    string
+		want    string
+		wantErr bool
+	}{
+		{team: "Operations", want: "5d0c8b4e-64f1-4d8b-9a43-0c8e36d3c4b1"},
+		{team: "security", want: "0f2c6a8e-2b1e-4c5d-8f8a-7e3b1d9c6a52"},
+		{team: "6a1e0c3f-9d2b-4f7e-8c5a-1b3d5f7e9a2c", want: "6a1e0c3f-9d2b-4f7e-8c5a-1b3d5f7e9a2c"},
+		{team: "Auditors", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := dt.resolveTeamUUID(context.Background(), test.team)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("resolveTeamUUID(%q) = %q, %v, want %q", test.team, got, err, test.want)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("listed the teams %d times, want once", requests)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Defaults of the retries of a destination.
+const (
+	defaultDestinationRetries    = 2
+	defaultDestinationRetryDelay = 5 * time.Second
+)
+
+// DestinationConfig is an upload target in the destinations list of the configuration file,
+// delivered in addition to the targets given by flags, e.g.
+//
+//	destinations:
+//	  - name: dt-prod
+//	    type: dependency-track
+//	    api-url: https://dt.prod.example
+//	    api-key: ...
+//	  - name: dt-dr
+//	    type: dependency-track
+//	    api-url: https://dt.dr.example
+//	    api-key: ...
+//	    retries: 5
+//	  - name: archive
+//	    type: store
+//	    location: s3://sboms/hosts
+type DestinationConfig struct {
+	// Name identifies the destination in the logs and the run result.
+	Name string `mapstructure:"name"`
+	// Type is dependency-track, store or webhook.
+	Type string `mapstructure:"type"`
+
+	// dependency-track
+	APIURL string   `mapstructure:"api-url"`
+	APIKey string   `mapstructure:"api-key"`
+	Teams  []string `mapstructure:"teams"`
+
+	// store
+	Location string `mapstructure:"location"`
+	Key      string `mapstructure:"key"`
+
+	// webhook
+	URL     string   `mapstructure:"url"`
+	Method  string   `mapstructure:"method"`
+	Headers []string `mapstructure:"headers"`
+	Body    string   `mapstructure:"body"`
+
+	// TLSVerify overrides --tls-verify for the destination.
+	TLSVerify *bool `mapstructure:"tls-verify"`
+	// Retries is the number of retries after a failed attempt, default 2.
+	Retries *int `mapstructure:"retries"`
+	// RetryDelay is the delay before the first retry, doubled for every further one, default 5s.
+	RetryDelay time.Duration `mapstructure:"retry-delay"`
+}
+
+// UploadTarget holds the details of the run shared by every destination.
+type UploadTarget struct {
+	Hostname   string
+	Distro     string
+	OSVersion  string
+	TLSVerify  bool
+	Timeout    time.Duration
+	Containers []ContainerSBOM
+	// DryRun checks the Dependency-Track destinations instead of uploading and skips the others.
+	DryRun bool
+}
+
+// UploadResult is the outcome of the delivery to a destination, reported in the run result.
+type UploadResult struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Attempts int     `json:"attempts"`
+	Seconds  float64 `json:"durationSeconds"`
+	// Error is the error of the last attempt, empty if the delivery succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// loadDestinations reads the destinations list of the configuration file.
+//
+// Returns:
+// - []DestinationConfig: the destinations, empty if none are configured.
+// - error: an error if a destination has no unique name, an unknown type or misses a required setting.
+func loadDestinations() ([]DestinationConfig, error) {
+	var destinations []DestinationConfig
+	if err := viper.UnmarshalKey("destinations", &destinations); err != nil {
+		return nil, fmt.Errorf("error reading destinations: %v", err)
+	}
+	names := make(map[string]bool)
+	for i, destination := range destinations {
+		if destination.Name == "" {
+			return nil, fmt.Errorf("destination %d has no name", i+1)
+		}
+		if names[destination.Name] {
+			return nil, fmt.Errorf("destination %s is configured twice", destination.Name)
+		}
+		names[destination.Name] = true
+		var missing string
+		switch destination.Type {
+		case "dependency-track":
+			if destination.APIURL == "" || destination.APIKey == "" {
+				missing = "api-url and api-key"
+			}
+		case "store":
+			if destination.Location == "" {
+				missing = "location"
+			}
+		case "webhook":
+			if destination.URL == "" {
+				missing = "url"
+			}
+		default:
+			return nil, fmt.Errorf("destination %s has unknown type %q, expected dependency-track, store or webhook", destination.Name, destination.Type)
+		}
+		if missing != "" {
+			return nil, fmt.Errorf("destination %s needs %s", destination.Name, missing)
+		}
+		if destination.Retries != nil && *destination.Retries < 0 {
+			return nil, fmt.Errorf("destination %s has negative retries", destination.Name)
+		}
+	}
+	return destinations, nil
+}
+
+// describe returns the destination for the dry-run plan.
+func (d DestinationConfig) describe(target UploadTarget) string {
+	switch d.Type {
+	case "dependency-track":
+		if target.DryRun {
+			return fmt.Sprintf("%s: check connectivity and permissions at %s", d.Name, d.APIURL)
+		}
+		return fmt.Sprintf("%s: upload to Dependency-Track project %s below %s at %s", d.Name, target.Hostname, target.Distro, d.APIURL)
+	case "store":
+		return fmt.Sprintf("%s: store in %s", d.Name, d.Location)
+	default:
+		return fmt.Sprintf("%s: webhook %s", d.Name, redactURL(d.URL))
+	}
+}
+
+// deliver delivers the SBOM to the destination once.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the delivery.
+// - target: the details of the run.
+// - sbomJSON: the SBOM in JSON format.
+//
+// Returns:
+// - error: an error if the delivery fails.
+func (d DestinationConfig) deliver(ctx context.Context, target UploadTarget, sbomJSON []byte) error {
+	tlsVerify := target.TLSVerify
+	if d.TLSVerify != nil {
+		tlsVerify = *d.TLSVerify
+	}
+	switch d.Type {
+	case "dependency-track":
+		dt := &DependencyTrack{
+			APIURL:    d.APIURL,
+			APIKey:    d.APIKey,
+			TLSVerify: tlsVerify,
+			Timeout:   target.Timeout,
+			Teams:     d.Teams,
+		}
+		if target.DryRun {
+			return dt.checkUpload(ctx, target.Distro, target.Hostname, sbomJSON, target.Containers)
+		}
+		return dt.uploadSBOM(ctx, target.Distro, target.Hostname, target.OSVersion, sbomJSON, target.Containers)
+	case "store":
+		now := time.Now().UTC()
+		objectStore := &ObjectStore{
+			Location:    d.Location,
+			KeyTemplate: d.Key,
+			TLSVerify:   tlsVerify,
+			Timeout:     target.Timeout,
+		}
+		key, err := objectStore.upload(ctx, StoreKeyData{
+			Hostname:  target.Hostname,
+			Distro:    target.Distro,
+			Date:      now.Format("2006-01-02"),
+			Timestamp: now.Format("20060102T150405Z"),
+		}, sbomJSON)
+		if err == nil {
+			slog.Info("Stored SBOM", "destination", d.Name, "location", d.Location, "key", key)
+		}
+		return err
+	default:
+		webhook := &Webhook{
+			URL:       d.URL,
+			Method:    d.Method,
+			Headers:   d.Headers,
+			Body:      d.Body,
+			TLSVerify: tlsVerify,
+			Timeout:   target.Timeout,
+		}
+		return webhook.send(ctx, WebhookEnvelope{
+			Hostname:  target.Hostname,
+			Distro:    target.Distro,
+			OSVersion: target.OSVersion,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		}, sbomJSON)
+	}
+}
+
+// fanOut delivers the SBOM to every destination in parallel. Every destination is retried
+// on its own, so that a slow or failing destination neither delays nor fails the others.
+//
+// Parameters:
+// - ctx: the context, cancelling it stops the deliveries and their retries.
+// - destinations: the destinations.
+// - target: the details of the run.
+// - sbomJSON: the SBOM in JSON format.
+//
+// Returns:
+// - []UploadResult: the outcome of every destination, in configuration order.
+// - error: an error naming the failed destinations, nil if every delivery succeeded.
+func fanOut(ctx context.Context, destinations []DestinationConfig, target UploadTarget, sbomJSON []byte) ([]UploadResult, error) {
+	results := make([]UploadResult, len(destinations))
+	var wg sync.WaitGroup
+	for i, destination := range destinations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = destination.deliverWithRetries(ctx, target, sbomJSON)
+		}()
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, result := range results {
+		if result.Error != "" {
+			failed = append(failed, result.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("delivery to %d of %d destinations failed: %s", len(failed), len(destinations), strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// deliverWithRetries delivers the SBOM to the destination, retrying failed attempts with
+// an exponential backoff.
+func (d DestinationConfig) deliverWithRetries(ctx context.Context, target UploadTarget, sbomJSON []byte) (result UploadResult) {
+	result = UploadResult{Name: d.Name, Type: d.Type}
+	if target.DryRun && d.Type != "dependency-track" {
+		slog.Info("Skipping destination in upload dry-run", "destination", d.Name)
+		return result
+	}
+	retries := defaultDestinationRetries
+	if d.Retries != nil {
+		retries = *d.Retries
+	}
+	delay := d.RetryDelay
+	if delay <= 0 {
+		delay = defaultDestinationRetryDelay
+	}
+
+	start := time.Now()
+	defer func() { result.Seconds = time.Since(start).Seconds() }()
+	for {
+		result.Attempts++
+		err := d.deliver(ctx, target, sbomJSON)
+		if err == nil {
+			result.Error = ""
+			slog.Info("Delivered SBOM", "destination", d.Name, "type", d.Type, "attempts", result.Attempts)
+			return result
+		}
+		result.Error = err.Error()
+		if result.Attempts > retries || ctx.Err() != nil {
+			slog.Error("Delivering SBOM failed", "destination", d.Name, "type", d.Type, "attempts", result.Attempts, "error", err)
+			return result
+		}
+		slog.Warn("Delivering SBOM failed, retrying", "destination", d.Name, "type", d.Type, "attempt", result.Attempts, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
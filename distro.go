@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// derivedDistros maps distributions distro2sbom does not know to the known distribution they
+// are derived from according to the ID_LIKE of /etc/os-release, e.g. a RHEL clone to rhel.
+// It is filled by registerDerivedDistro before the packages are collected, the common Ubuntu
+// derivatives are known without it.
+var derivedDistros = map[string]string{
+	"linuxmint":  "ubuntu",
+	"pop":        "ubuntu",
+	"elementary": "ubuntu",
+}
+
+// parentDistro returns the known distribution an unknown distribution is derived from.
+//
+// Parameters:
+// - distro: the name of the Linux distribution.
+//
+// Returns:
+// - string: the distribution it is derived from, empty if it is not a registered derivative.
+func parentDistro(distro string) string {
+	return derivedDistros[strings.ToLower(distro)]
+}
+
+// readOSRelease reads the fields of /etc/os-release of the scanned system, with the quotes
+// of their values removed.
+//
+// Parameters:
+// - ctx: the context.
+// - runner: the runner of the scanned system.
+//
+// Returns:
+// - map[string]string: the fields, e.g. ID and ID_LIKE.
+// - error: an error if the file cannot be read.
+func readOSRelease(ctx context.Context, runner Runner) (map[string]string, error) {
+	file, err := runnerOrLocal(runner).Open(ctx, "/etc/os-release")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		fields[key] = strings.Trim(value, `"'`)
+	}
+	return fields, scanner.Err()
+}
+
+// upstreamDistro returns the distribution whose archive the packages of a distribution come
+// from, the parent of derivatives and the distribution itself otherwise.
+func upstreamDistro(distro string) string {
+	if parent := parentDistro(distro); parent != "" {
+		return parent
+	}
+	return distro
+}
+
+// osHomePage returns the home page of the scanned system, the HOME_URL of /etc/os-release
+// if it describes the distribution and https://www.<distro>.com/ otherwise.
+//
+// Parameters:
+// - ctx: the context.
+// - distro: the name of the Linux distribution.
+// - runner: the runner of the scanned system.
+//
+// Returns:
+// - string: the URL of the home page.
+func osHomePage(ctx context.Context, distro string, runner Runner) string {
+	if release, err := readOSRelease(ctx, runner); err == nil && strings.EqualFold(release["ID"], distro) && release["HOME_URL"] != "" {
+		return release["HOME_URL"]
+	}
+	return "https://www." + strings.ToLower(distro) + ".com/"
+}
+
+// registerDerivedDistro registers an unknown distribution as derivative of the first known
+// distribution of the ID_LIKE of the scanned system, e.g. "rhel centos fedora", so that RHEL
+// clones and other derivatives are collected with the package manager of their parent and
+// supplied by its supplier unless the suppliers of the configuration file name their own.
+// Known distributions and systems whose ID is another distribution are left alone.
+//
+// Parameters:
+// - ctx: the context.
+// - distro: the name of the Linux distribution given with --distro.
+// - runner: the runner of the scanned system.
+func registerDerivedDistro(ctx context.Context, distro string, runner Runner) {
+	if _, err := packageManagerFor(distro); err == nil {
+		return
+	}
+	release, err := readOSRelease(ctx, runner)
+	if err != nil {
+		slog.Debug("Error reading /etc/os-release", "error", err)
+		return
+	}
+	if !strings.EqualFold(release["ID"], distro) {
+		return
+	}
+	for _, like := range strings.Fields(strings.ToLower(release["ID_LIKE"])) {
+		if _, err := packageManagerFor(like); err == nil {
+			derivedDistros[strings.ToLower(distro)] = like
+			slog.Info("Treating distribution as derivative", "distro", distro, "parent", like)
+			return
+		}
+	}
+}
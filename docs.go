@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// newGenDocsCmd creates the hidden gen-docs subcommand.
+//
+// The command renders man pages and markdown reference documentation from the
+// command tree, for distribution packages that ship the manuals of the tool.
+//
+// Returns:
+// - *cobra.Command: the gen-docs command.
+func newGenDocsCmd() *cobra.Command {
+	var dir string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:    "gen-docs",
+		Short:  "Generate man pages and markdown reference documentation.",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			root.DisableAutoGenTag = true
+
+			if format == "man" || format == "all" {
+				manDir := filepath.Join(dir, "man")
+				if err := os.MkdirAll(manDir, 0755); err != nil {
+					return fmt.Errorf("error creating man page directory: %v", err)
+				}
+				header := &doc.GenManHeader{
+					Title:   "DISTRO2SBOM",
+					Section: "1",
+					Source:  "distro2sbom " + getBuildInfo().Version,
+					Manual:  "distro2sbom manual",
+				}
+				if err := doc.GenManTree(root, header, manDir); err != nil {
+					return fmt.Errorf("error generating man pages: %v", err)
+				}
+			}
+			if format == "markdown" || format == "all" {
+				markdownDir := filepath.Join(dir, "markdown")
+				if err := os.MkdirAll(markdownDir, 0755); err != nil {
+					return fmt.Errorf("error creating markdown directory: %v", err)
+				}
+				if err := doc.GenMarkdownTree(root, markdownDir); err != nil {
+					return fmt.Errorf("error generating markdown: %v", err)
+				}
+			}
+			if format != "man" && format != "markdown" && format != "all" {
+				return fmt.Errorf("unsupported docs format: %s", format)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dir, "dir", "docs", "Output directory, man pages and markdown are written to the man and markdown subdirectories")
+	cmd.Flags().StringVar(&format, "format", "all", "Documentation format (man, markdown, all)")
+
+	return cmd
+}
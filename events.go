@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journalSocket is the socket of the systemd journal's native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// RunEvent describes the outcome of a run, emitted when the run completes or fails.
+type RunEvent struct {
+	Result          string
+	ExitCode        int
+	Error           string
+	Hostname        string
+	Distro          string
+	Components      int
+	Dependencies    int
+	UnknownLicenses int
+	Duration        time.Duration
+	// Durations holds the duration of the phases of the run, e.g. collect and deliver.
+	Durations    map[string]time.Duration
+	Warnings     []string
+	Destinations []string
+	// Timings holds the timings of the phases and commands if --timings is set.
+	Timings *Timings
+	// Checksums holds the digests of the SBOM by algorithm if --checksum is set.
+	Checksums map[string]string
+	// Uploads holds the outcome of every destination of the configuration file.
+	Uploads []UploadResult
+	// Bundle holds the files of the --bundle directory until the result of the run is added.
+	Bundle *Bundle
+}
+
+// fields returns the event as ordered key/value pairs.
+func (e RunEvent) fields() [][2]string {
+	return [][2]string{
+		{"result", e.Result},
+		{"exit_code", strconv.Itoa(e.ExitCode)},
+		{"hostname", e.Hostname},
+		{"distro", e.Distro},
+		{"components", strconv.Itoa(e.Components)},
+		{"dependencies", strconv.Itoa(e.Dependencies)},
+		{"unknown_licenses", strconv.Itoa(e.UnknownLicenses)},
+		{"warnings", strconv.Itoa(len(e.Warnings))},
+		{"duration_seconds", strconv.FormatFloat(e.Duration.Seconds(), 'f', 3, 64)},
+		{"destinations", strings.Join(e.Destinations, ",")},
+		{"error", e.Error},
+	}
+}
+
+// message returns a human readable summary of the event.
+func (e RunEvent) message() string {
+	if e.Result == "success" {
+		return fmt.Sprintf("SBOM run succeeded with %d components in %s", e.Components, e.Duration.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("SBOM run failed after %s: %s", e.Duration.Round(time.Millisecond), e.Error)
+}
+
+// emitEvent sends a run event to syslog or the systemd journal.
+//
+// Syslog receives the summary followed by the fields in key=value form, the journal
+// receives each field as a DISTRO2SBOM_ prefixed journal field so it can be filtered
+// with journalctl DISTRO2SBOM_RESULT=failure.
+//
+// Parameters:
+// - target: "syslog" or "journald".
+// - event: the event to emit.
+//
+// Returns:
+// - error: an error if the target is unknown or the event cannot be delivered.
+func emitEvent(target string, event RunEvent) error {
+	switch target {
+	case "syslog":
+		var pairs []string
+		for _, field := range event.fields() {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", field[0], field[1]))
+		}
+		return writeSyslog(event.Result != "success", event.message()+" "+strings.Join(pairs, " "))
+	case "journald":
+		priority := "6"
+		if event.Result != "success" {
+			priority = "3"
+		}
+		var entry strings.Builder
+		entry.WriteString("MESSAGE=" + event.message() + "\n")
+		entry.WriteString("PRIORITY=" + priority + "\n")
+		entry.WriteString("SYSLOG_IDENTIFIER=distro2sbom\n")
+		for _, field := range event.fields() {
+			// Values must not contain newlines in the simple journal field format
+			value := strings.ReplaceAll(field[1], "\n", " ")
+			entry.WriteString("DISTRO2SBOM_" + strings.ToUpper(field[0]) + "=" + value + "\n")
+		}
+
+		conn, err := net.Dial("unixgram", journalSocket)
+		if err != nil {
+			return fmt.Errorf("error connecting to the journal: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte(entry.String())); err != nil {
+			return fmt.Errorf("error writing to the journal: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported event target: %s", target)
+	}
+
+	return nil
+}
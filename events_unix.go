@@ -0,0 +1,33 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// writeSyslog writes a message to the local syslog daemon with the daemon facility.
+//
+// Parameters:
+// - failure: whether the message reports a failure, logged as error instead of info.
+// - message: the message.
+//
+// Returns:
+// - error: an error if syslog cannot be reached.
+func writeSyslog(failure bool, message string) error {
+	priority := syslog.LOG_INFO
+	if failure {
+		priority = syslog.LOG_ERR
+	}
+	writer, err := syslog.New(priority|syslog.LOG_DAEMON, "distro2sbom")
+	if err != nil {
+		return fmt.Errorf("error connecting to syslog: %v", err)
+	}
+	defer writer.Close()
+
+	if _, err := writer.Write([]byte(message)); err != nil {
+		return fmt.Errorf("error writing to syslog: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package main
+
+import "errors"
+
+// writeSyslog fails on Windows, which has no syslog daemon.
+func writeSyslog(failure bool, message string) error {
+	return errors.New("syslog is not available on Windows")
+}
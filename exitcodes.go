@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// Exit codes of distro2sbom, so that wrappers and monitoring can tell failures apart.
+const (
+	// exitOK is returned when the run succeeded.
+	exitOK = 0
+	// exitError is returned for failures that do not fall into one of the other classes.
+	exitError = 1
+	// exitConfig is returned for invalid flags, configuration or input files.
+	exitConfig = 2
+	// exitCollection is returned when the installed packages could not be collected.
+	exitCollection = 3
+	// exitValidation is returned when the SBOM is not a valid CycloneDX document.
+	exitValidation = 4
+	// exitUpload is returned when the SBOM could not be delivered to a destination.
+	exitUpload = 5
+	// exitPolicy is returned when the SBOM violates a configured policy.
+	exitPolicy = 6
+	// exitLocked is returned when another run holds the lock file.
+	exitLocked = 7
+	// exitInterrupted is returned when the run was cancelled by SIGINT or SIGTERM, following the 128+signal convention.
+	exitInterrupted = 130
+)
+
+// RunError is a failed run with the exit code it maps to.
+type RunError struct {
+	Code int
+	Msg  string
+	Err  error
+}
+
+// Error implements the error interface.
+func (e *RunError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Msg, e.Err)
+	}
+	return e.Msg
+}
+
+// log logs the failure without exiting, for runs that are repeated.
+func (e *RunError) log() {
+	if e.Err != nil {
+		slog.Error(e.Msg, "error", e.Err)
+		return
+	}
+	slog.Error(e.Msg)
+}
+
+// exit logs the failure and exits with its exit code.
+func (e *RunError) exit() {
+	e.log()
+	os.Exit(e.Code)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// includeGem is the opt-in collector of --include adding the Ruby gems installed
+// system-wide.
+const includeGem = "gem"
+
+// gemListCommand prints the installed gems with their versions, licenses and installation
+// directories, nothing if RubyGems is not installed.
+var gemListCommand = []string{"sh", "-c", "command -v gem >/dev/null || exit 0; exec gem list --local --details"}
+
+// gemHeaderPattern matches the line starting the details of a gem, e.g.
+// "nokogiri (1.16.5 x86_64-linux, 1.15.6)".
+var gemHeaderPattern = regexp.MustCompile(`^(\S+) \((.+)\)$`)
+
+// gemVersion is an installed version of a gem.
+type gemVersion struct {
+	version   string
+	platform  string
+	dir       string
+	isDefault bool
+}
+
+// gemDetailsParser parses the output of gem list --details line by line.
+type gemDetailsParser struct {
+	name     string
+	versions []*gemVersion
+	licenses []string
+	// emit is called with every gem when its details are complete.
+	emit func(name string, versions []*gemVersion, licenses []string)
+}
+
+// parse processes a line of the output.
+func (p *gemDetailsParser) parse(line string) {
+	if match := gemHeaderPattern.FindStringSubmatch(line); match != nil {
+		p.flush()
+		p.name = match[1]
+		for _, version := range strings.Split(match[2], ", ") {
+			isDefault := false
+			if v, ok := strings.CutPrefix(version, "default: "); ok {
+				version, isDefault = v, true
+			}
+			version, platform, _ := strings.Cut(version, " ")
+			p.versions = append(p.versions, &gemVersion{version: version, platform: platform, isDefault: isDefault})
+		}
+		return
+	}
+	if p.name == "" {
+		return
+	}
+	trimmed := strings.TrimSpace(line)
+	if licenses, ok := strings.CutPrefix(trimmed, "License: "); ok {
+		p.licenses = []string{licenses}
+		return
+	}
+	if licenses, ok := strings.CutPrefix(trimmed, "Licenses: "); ok {
+		p.licenses = strings.Split(licenses, ", ")
+		return
+	}
+	// Installed at: /var/lib/gems/3.1.0 for a single version, otherwise a line per version
+	// "Installed at (13.0.6): /var/lib/gems/3.1.0" followed by "(13.0.3, default): ..."
+	label, ok := strings.CutPrefix(trimmed, "Installed at")
+	if !ok && !strings.HasPrefix(trimmed, "(") {
+		return
+	}
+	label, dir, ok := strings.Cut(label, ": ")
+	if !ok || !strings.HasPrefix(dir, "/") {
+		return
+	}
+	label = strings.Trim(strings.TrimSpace(label), "()")
+	version, _, _ := strings.Cut(label, ", ")
+	isDefault := strings.HasSuffix(label, "default")
+	for _, v := range p.versions {
+		if len(p.versions) == 1 || v.version == version {
+			v.dir = dir
+			v.isDefault = v.isDefault || isDefault
+		}
+	}
+}
+
+// flush emits the gem read so far, the last gem is emitted when the output ends.
+func (p *gemDetailsParser) flush() {
+	if p.name != "" {
+		p.emit(p.name, p.versions, p.licenses)
+	}
+	p.name, p.versions, p.licenses = "", nil, nil
+}
+
+// specPath returns the path of the specification of an installed gem version, e.g.
+// /var/lib/gems/3.1.0/specifications/rake-13.0.6.gemspec, empty if the installation
+// directory is unknown.
+func (v *gemVersion) specPath(name string) string {
+	if v.dir == "" {
+		return ""
+	}
+	file := name + "-" + v.version
+	if v.platform != "" {
+		file += "-" + v.platform
+	}
+	dir := path.Join(v.dir, "specifications")
+	if v.isDefault {
+		dir = path.Join(dir, "default")
+	}
+	return path.Join(dir, file+".gemspec")
+}
+
+// collectGem lists the Ruby gems installed system-wide, so that the Ruby tooling bundled in
+// appliance images next to the distribution is covered.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills gem.
+// - options: the runner and the maximum line size.
+// - index: the index of the last package, the gems are numbered after it.
+//
+// Returns:
+// - []*pipelineItem: a component for every installed version of every gem, none if RubyGems
+// is not installed.
+// - error: an error if gem fails.
+func collectGem(ctx context.Context, _ string, options CollectOptions, _ []*pipelineItem, index int) ([]*pipelineItem, error) {
+	var items []*pipelineItem
+	parser := &gemDetailsParser{emit: func(name string, versions []*gemVersion, licenses []string) {
+		for _, v := range versions {
+			purl := formatPURL("gem", "", name, v.version, map[string]string{"platform": v.platform})
+			properties := []cyclonedx.Property{{Name: "distro2sbom:collector", Value: includeGem}}
+			if spec := v.specPath(name); spec != "" {
+				properties = append(properties, cyclonedx.Property{Name: "distro2sbom:gem:spec", Value: spec})
+			}
+			index++
+			items = append(items, &pipelineItem{
+				index:            index,
+				installedPackage: installedPackage{name: name, version: v.version},
+				component: cyclonedx.Component{
+					Type:       cyclonedx.ComponentTypeLibrary,
+					Name:       name,
+					Version:    v.version,
+					BOMRef:     stableBOMRef(purl, name, v.version, ""),
+					PackageURL: purl,
+					Licenses:   declaredLicenses(licenses),
+					Properties: &properties,
+				},
+			})
+		}
+	}}
+	err := streamCommand(ctx, runnerOrLocal(options.Runner), gemListCommand, options.MaxLineSize, parser.parse)
+	if err != nil {
+		return nil, fmt.Errorf("error listing Ruby gems: %v", err)
+	}
+	parser.flush()
+	slog.Info("Listed Ruby gems", "components", len(items))
+	return items, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultGitPath is the path template of the SBOM inside the Git repository.
+const defaultGitPath = "hosts/{{.Hostname}}/sbom.json"
+
+// GitRepository commits SBOMs to a Git repository, keeping the SBOM history under version control.
+//
+// The repository is cloned into WorkDir on first use and reset to the remote branch on
+// later runs. Token is sent as HTTP basic authentication with Username for every git
+// command and never written to the repository configuration.
+type GitRepository struct {
+	URL          string
+	Branch       string
+	PathTemplate string
+	WorkDir      string
+	Username     string
+	Token        string
+}
+
+// commit writes the SBOM into the repository, commits it and pushes it to the remote branch.
+//
+// When another host pushed in the meantime, the commit is rebased onto the remote branch
+// and the push is retried.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the git commands.
+// - data: the values available to the path template.
+// - sbomJSON: the SBOM in JSON format.
+//
+// Returns:
+// - string: the path of the SBOM inside the repository.
+// - error: an error if a git command fails.
+func (g *GitRepository) commit(ctx context.Context, data StoreKeyData, sbomJSON []byte) (string, error) {
+	pathTemplate := g.PathTemplate
+	if pathTemplate == "" {
+		pathTemplate = defaultGitPath
+	}
+	sbomPath, err := renderPathTemplate(pathTemplate, data)
+	if err != nil {
+		return "", err
+	}
+	sbomPath = filepath.Clean(sbomPath)
+	if filepath.IsAbs(sbomPath) || strings.HasPrefix(sbomPath, "..") {
+		return "", fmt.Errorf("git path %s must be relative to the repository", sbomPath)
+	}
+
+	if _, err := os.Stat(filepath.Join(g.WorkDir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(g.WorkDir), 0755); err != nil {
+			return "", fmt.Errorf("error creating git work directory: %v", err)
+		}
+		if _, err := g.git(ctx, "", "clone", "--depth", "1", "--branch", g.Branch, g.URL, g.WorkDir); err != nil {
+			return "", err
+		}
+	} else {
+		if _, err := g.git(ctx, g.WorkDir, "fetch", "--depth", "1", "origin", g.Branch); err != nil {
+			return "", err
+		}
+		if _, err := g.git(ctx, g.WorkDir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	}
+
+	target := filepath.Join(g.WorkDir, sbomPath)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", fmt.Errorf("error creating SBOM directory: %v", err)
+	}
+	if err := os.WriteFile(target, sbomJSON, 0644); err != nil {
+		return "", fmt.Errorf("error writing SBOM to repository: %v", err)
+	}
+
+	if _, err := g.git(ctx, g.WorkDir, "add", "--", sbomPath); err != nil {
+		return "", err
+	}
+	// Nothing to commit when the SBOM is unchanged
+	if _, err := g.git(ctx, g.WorkDir, "diff", "--cached", "--quiet"); err == nil {
+		return sbomPath, nil
+	}
+	message := fmt.Sprintf("Update SBOM for %s", data.Hostname)
+	if _, err := g.git(ctx, g.WorkDir, "-c", "user.name=distro2sbom", "-c", "user.email=distro2sbom@"+data.Hostname, "commit", "-m", message); err != nil {
+		return "", err
+	}
+
+	for attempt := 1; ; attempt++ {
+		_, err := g.git(ctx, g.WorkDir, "push", "origin", "HEAD:"+g.Branch)
+		if err == nil {
+			return sbomPath, nil
+		}
+		if attempt == 3 {
+			return "", err
+		}
+		if _, err := g.git(ctx, g.WorkDir, "pull", "--rebase", "--depth", "1", "origin", g.Branch); err != nil {
+			return "", err
+		}
+	}
+}
+
+// git runs a git command with the token passed as an extra HTTP header.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the command.
+// - dir: the working directory, or empty for the current directory.
+// - args: the git arguments.
+//
+// Returns:
+// - string: the standard output of the command.
+// - error: an error including the standard error output if the command fails.
+func (g *GitRepository) git(ctx context.Context, dir string, args ...string) (string, error) {
+	if g.Token != "" {
+		username := g.Username
+		if username == "" {
+			username = "x-access-token"
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + g.Token))
+		args = append([]string{"-c", "http.extraHeader=Authorization: Basic " + credentials}, args...)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// Only the subcommand is reported, the arguments may contain the token
+		subcommand := args[len(args)-1]
+		for i, arg := range args {
+			if arg != "-c" && (i == 0 || args[i-1] != "-c") {
+				subcommand = arg
+				break
+			}
+		}
+		return "", fmt.Errorf("error executing git %s: %v, stderr: %s", subcommand, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out.String(), nil
+}
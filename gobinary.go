@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/buildinfo"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// includeGoBinaries is the opt-in collector of --include adding the Go binaries of the
+// --go-binary-path directories with the modules they were built from.
+const includeGoBinaries = "go"
+
+// defaultGoBinaryPaths are the directories searched for Go binaries by default, where
+// software installed outside the package manager usually ends up.
+var defaultGoBinaryPaths = []string{"/usr/local/bin", "/usr/local/sbin", "/opt"}
+
+// goBinaryFindCommand returns the command printing the executables of directories and
+// their subdirectories that are large enough to be Go binaries, missing directories are
+// skipped.
+func goBinaryFindCommand(paths []string) []string {
+	return append([]string{"sh", "-c", `find "$@" -type f -perm -u+x -size +512k 2>/dev/null; true`, "sh"}, paths...)
+}
+
+// elfMagic starts every ELF file.
+var elfMagic = []byte("\x7fELF")
+
+// readGoBuildInfo reads the build information Go embeds in the binaries it builds.
+//
+// Parameters:
+// - ctx: the context.
+// - runner: reads the file on the scanned system.
+// - file: the path of the executable.
+//
+// Returns:
+// - *buildinfo.BuildInfo: the build information, nil if the file is not a Go ELF binary.
+// - error: an error if the file cannot be read.
+func readGoBuildInfo(ctx context.Context, runner Runner, file string) (*buildinfo.BuildInfo, error) {
+	f, err := runner.Open(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(elfMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, elfMagic) {
+		return nil, nil
+	}
+	// Files of the local host and root file systems are read where the build information
+	// is, binaries of remote hosts are read whole
+	readerAt, ok := f.(io.ReaderAt)
+	if !ok {
+		rest, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		readerAt = bytes.NewReader(append(magic, rest...))
+	}
+	info, err := buildinfo.Read(readerAt)
+	if err != nil {
+		// Not built by Go, or without module information
+		return nil, nil
+	}
+	return info, nil
+}
+
+// goModuleComponent builds the component of a module a Go binary was built from.
+//
+// Parameters:
+// - module: the module, its replacement if it was replaced.
+//
+// Returns:
+// - cyclonedx.Component: the component, with the pkg:golang package URL of the module.
+func goModuleComponent(module *debug.Module) cyclonedx.Component {
+	if module.Replace != nil {
+		module = module.Replace
+	}
+	version := module.Version
+	if version == "(devel)" {
+		version = ""
+	}
+	purl := ""
+	if module.Path != "" && !strings.HasPrefix(module.Path, ".") && !strings.HasPrefix(module.Path, "/") {
+		namespace, name := path.Split(module.Path)
+		purl = formatPURL("golang", strings.TrimSuffix(namespace, "/"), name, version, nil)
+	}
+	return cyclonedx.Component{
+		Type:       cyclonedx.ComponentTypeLibrary,
+		Name:       module.Path,
+		Version:    version,
+		BOMRef:     stableBOMRef(purl, module.Path, version, ""),
+		PackageURL: purl,
+	}
+}
+
+// collectGoBinaries lists the Go binaries of the --go-binary-path directories and nests the
+// modules they were built from and the standard library of their Go version in their
+// components, so that vulnerable modules compiled into software installed outside the
+// package manager are found.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills find.
+// - options: the runner, the directories and the maximum line size.
+// - index: the index of the last package, the binaries are numbered after it.
+//
+// Returns:
+// - []*pipelineItem: a component per binary.
+// - error: an error if the directories cannot be searched.
+func collectGoBinaries(ctx context.Context, _ string, options CollectOptions, _ []*pipelineItem, index int) ([]*pipelineItem, error) {
+	runner := runnerOrLocal(options.Runner)
+	var files []string
+	err := streamCommand(ctx, runner, goBinaryFindCommand(options.GoBinaryPaths), options.MaxLineSize, func(line string) {
+		files = append(files, line)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching for Go binaries: %v", err)
+	}
+
+	var items []*pipelineItem
+	// Modules compiled into several binaries are nested in each of them
+	refs := make(map[string]bool)
+	uniqueRef := func(component cyclonedx.Component) cyclonedx.Component {
+		ref := component.BOMRef
+		for n := 2; refs[component.BOMRef]; n++ {
+			component.BOMRef = ref + "#" + strconv.Itoa(n)
+		}
+		refs[component.BOMRef] = true
+		return component
+	}
+	for _, file := range files {
+		info, err := readGoBuildInfo(ctx, runner, file)
+		if err != nil {
+			slog.Warn("Error reading executable", "path", file, "error", err)
+			continue
+		}
+		if info == nil {
+			continue
+		}
+
+		component := goModuleComponent(&info.Main)
+		component.Type = cyclonedx.ComponentTypeApplication
+		component.Name = path.Base(file)
+		component.Properties = &[]cyclonedx.Property{
+			{Name: "distro2sbom:collector", Value: includeGoBinaries},
+			{Name: "distro2sbom:go:path", Value: file},
+			{Name: "distro2sbom:go:module", Value: info.Main.Path},
+			{Name: "distro2sbom:go:toolchain", Value: info.GoVersion},
+		}
+		// go1.22.5, followed by the experiments the toolchain was built with, e.g. X:boringcrypto
+		goVersion, _, _ := strings.Cut(strings.TrimPrefix(info.GoVersion, "go"), " ")
+		stdlib := formatPURL("golang", "", "stdlib", goVersion, nil)
+		modules := []cyclonedx.Component{uniqueRef(cyclonedx.Component{
+			Type:       cyclonedx.ComponentTypeLibrary,
+			Name:       "stdlib",
+			Version:    goVersion,
+			BOMRef:     stdlib,
+			PackageURL: stdlib,
+		})}
+		for _, dep := range info.Deps {
+			modules = append(modules, uniqueRef(goModuleComponent(dep)))
+		}
+		component.Components = &modules
+
+		index++
+		items = append(items, &pipelineItem{
+			index:            index,
+			installedPackage: installedPackage{name: component.Name, version: component.Version},
+			component:        component,
+		})
+	}
+	slog.Info("Listed Go binaries", "executables", len(files), "components", len(items))
+	return items, nil
+}
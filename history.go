@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SBOMs of the history kept by --output-dir are named sbom-<timestamp>.json, so that their
+// names sort by age.
+const (
+	historyPrefix = "sbom-"
+	historySuffix = ".json"
+	// historyLatest is the symbolic link to the newest SBOM of the history.
+	historyLatest = "latest.json"
+)
+
+// newHistoryPath returns the path of a new SBOM in the history directory, creating the
+// directory if needed.
+//
+// Parameters:
+// - dir: the history directory.
+// - now: the time of the SBOM.
+//
+// Returns:
+// - string: the path, numbered if an SBOM of the same second exists already.
+// - error: an error if the directory cannot be created.
+func newHistoryPath(dir string, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	stamp := now.UTC().Format("20060102T150405Z")
+	name := historyPrefix + stamp
+	// Numbered after the last SBOM of the second, which may have been removed already
+	existing, err := filepath.Glob(filepath.Join(dir, name+"*"+historySuffix))
+	if err != nil {
+		return "", err
+	}
+	last := 0
+	for _, other := range existing {
+		if otherStamp, number := historyOrder(filepath.Base(other)); otherStamp == stamp && number > last {
+			last = number
+		}
+	}
+	if last == 0 {
+		return filepath.Join(dir, name+historySuffix), nil
+	}
+	return filepath.Join(dir, name+"-"+strconv.Itoa(last+1)+historySuffix), nil
+}
+
+// updateLatest points the latest link of the history directory to an SBOM, replacing the
+// link atomically so that readers never miss it.
+//
+// Parameters:
+// - dir: the history directory.
+// - path: the SBOM, linked by its name relative to the directory.
+//
+// Returns:
+// - error: an error if the link cannot be created.
+func updateLatest(dir, path string) error {
+	temp := filepath.Join(dir, "."+historyLatest+".tmp")
+	os.Remove(temp)
+	if err := os.Symlink(filepath.Base(path), temp); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, filepath.Join(dir, historyLatest)); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
+
+// pruneHistory removes the SBOMs of the history directory beyond the retention, with their
+// checksum files. The newest SBOM is always kept.
+//
+// Parameters:
+// - dir: the history directory.
+// - keep: the number of SBOMs kept, 0 for no limit.
+// - maxAge: the age of the oldest SBOM kept, 0 for no limit.
+// - now: the current time.
+//
+// Returns:
+// - error: an error if the directory cannot be read or an SBOM cannot be removed.
+func pruneHistory(dir string, keep int, maxAge time.Duration, now time.Time) error {
+	if keep <= 0 && maxAge <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var sboms []fs.DirEntry
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasPrefix(entry.Name(), historyPrefix) && strings.HasSuffix(entry.Name(), historySuffix) {
+			sboms = append(sboms, entry)
+		}
+	}
+	// Newest first, the names hold the time of the SBOM
+	sort.Slice(sboms, func(i, j int) bool {
+		timeI, numberI := historyOrder(sboms[i].Name())
+		timeJ, numberJ := historyOrder(sboms[j].Name())
+		if timeI != timeJ {
+			return timeI > timeJ
+		}
+		return numberI > numberJ
+	})
+
+	removed := 0
+	for i, entry := range sboms {
+		if i == 0 {
+			continue
+		}
+		expired := keep > 0 && i >= keep
+		if !expired && maxAge > 0 {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			expired = now.Sub(info.ModTime()) > maxAge
+		}
+		if !expired {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error removing %s: %v", path, err)
+		}
+		for algorithm := range checksumAlgorithms {
+			os.Remove(path + "." + algorithm)
+		}
+		removed++
+	}
+	if removed > 0 {
+		slog.Info("Removed SBOMs beyond the retention", "dir", dir, "count", removed)
+	}
+	return nil
+}
+
+// historyOrder returns the timestamp and the number of an SBOM of the history by its name,
+// the first SBOM of a second has number 1.
+func historyOrder(name string) (string, int) {
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, historyPrefix), historySuffix)
+	stamp, suffix, numbered := strings.Cut(stamp, "-")
+	number, err := strconv.Atoi(suffix)
+	if !numbered || err != nil {
+		number = 1
+	}
+	return stamp, number
+}
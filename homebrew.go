@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// includeHomebrew is the opt-in collector of --include adding the formulae installed with
+// Homebrew next to the packages of the distribution.
+const includeHomebrew = "homebrew"
+
+// homebrewScript runs brew with the arguments of the script, found on the PATH or in the
+// default prefixes of Linux, Apple silicon and Intel Macs. Hosts without Homebrew print
+// nothing.
+const homebrewScript = `for b in "$(command -v brew)" /home/linuxbrew/.linuxbrew/bin/brew /opt/homebrew/bin/brew /usr/local/bin/brew; do [ -x "$b" ] && exec "$b" "$@"; done; exit 0`
+
+// homebrewListCommand prints every installed formula with its installed versions, e.g.
+// "openssl@3 3.3.1 3.3.2".
+var homebrewListCommand = []string{"sh", "-c", homebrewScript, "sh", "list", "--formula", "--versions"}
+
+// homebrewDepsCommand prints the installed dependencies of every installed formula, e.g.
+// "curl: brotli openssl@3 zlib".
+var homebrewDepsCommand = []string{"sh", "-c", homebrewScript, "sh", "deps", "--installed", "--formula", "--for-each"}
+
+// parseHomebrewDeps parses a line of homebrewDepsCommand.
+//
+// Parameters:
+// - line: the line.
+//
+// Returns:
+// - string: the name of the formula.
+// - []string: the names of its dependencies.
+// - bool: whether the line names a formula.
+func parseHomebrewDeps(line string) (string, []string, bool) {
+	name, deps, ok := strings.Cut(line, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", nil, false
+	}
+	return name, strings.Fields(deps), true
+}
+
+// homebrewComponent builds the CycloneDX component of an installed formula.
+//
+// Parameters:
+// - name: the name of the formula.
+// - version: the installed version.
+//
+// Returns:
+// - cyclonedx.Component: the component, with Homebrew recorded as collector property.
+func homebrewComponent(name, version string) cyclonedx.Component {
+	purl := formatPURL("brew", "", name, version, nil)
+	return cyclonedx.Component{
+		Type:       cyclonedx.ComponentTypeLibrary,
+		Name:       name,
+		Version:    version,
+		BOMRef:     stableBOMRef(purl, name, version, ""),
+		PackageURL: purl,
+		Properties: &[]cyclonedx.Property{{Name: "distro2sbom:collector", Value: includeHomebrew}},
+	}
+}
+
+// collectHomebrew lists the formulae of the Homebrew cellar of the scanned system and the
+// dependencies between them, so that the tools developers install on workstations and
+// macOS servers next to the distribution are covered as well.
+//
+// Homebrew refuses to run as root, the collector therefore has to run as the owner of the
+// Homebrew installation.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills the running commands.
+// - options: the runner and the maximum line size.
+// - index: the index of the last package, formulae are numbered after it.
+//
+// The package manager and the packages of the distribution are not used.
+//
+// Returns:
+// - []*pipelineItem: a component for every installed version of every formula, none if
+// Homebrew is not installed.
+// - error: an error if brew fails.
+func collectHomebrew(ctx context.Context, _ string, options CollectOptions, _ []*pipelineItem, index int) ([]*pipelineItem, error) {
+	runner := runnerOrLocal(options.Runner)
+	var items []*pipelineItem
+	err := streamCommand(ctx, runner, homebrewListCommand, options.MaxLineSize, func(line string) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return
+		}
+		for _, version := range fields[1:] {
+			index++
+			items = append(items, &pipelineItem{
+				index:            index,
+				installedPackage: installedPackage{name: fields[0], version: version},
+				component:        homebrewComponent(fields[0], version),
+			})
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing Homebrew formulae: %v", err)
+	}
+	if len(items) == 0 {
+		slog.Info("No Homebrew formulae installed")
+		return nil, nil
+	}
+
+	// Formulae are resolved among themselves, a formula and a distribution package of the
+	// same name, e.g. zlib, are different components. Of several installed versions the
+	// last one listed, the newest, is the one formulae are linked against.
+	refs := make(map[string]string)
+	for _, item := range items {
+		refs[item.name] = item.component.BOMRef
+	}
+	deps := make(map[string][]string)
+	err = streamCommand(ctx, runner, homebrewDepsCommand, options.MaxLineSize, func(line string) {
+		if name, names, ok := parseHomebrewDeps(line); ok {
+			deps[name] = names
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the dependencies of Homebrew formulae: %v", err)
+	}
+	for _, item := range items {
+		for _, dep := range deps[item.name] {
+			if ref, ok := refs[dep]; ok {
+				item.dependencyRefs = append(item.dependencyRefs, ref)
+			}
+		}
+	}
+	slog.Info("Listed Homebrew formulae", "components", len(items))
+	return items, nil
+}
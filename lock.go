@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultLockFile is the lock file preventing overlapping runs when none is configured.
+var defaultLockFile = defaultLockPath()
+
+// errLocked is returned by acquireLock when another run holds the lock.
+var errLocked = errors.New("another run holds the lock")
+
+// errWouldBlock is returned by lockFile when another process holds the lock.
+var errWouldBlock = errors.New("lock is held")
+
+// acquireLock takes an exclusive lock on the lock file without waiting, a flock on Unix and
+// LockFileEx on Windows.
+//
+// The lock is released by the kernel when the process exits, so a crashed run never
+// leaves a stale lock behind. The PID of the holder is written to the file to help
+// finding it.
+//
+// Parameters:
+// - path: the lock file, created if it does not exist. On Unix it must not be a symbolic link
+// and must be owned by the current user.
+//
+// Returns:
+// - *os.File: the open lock file, which must stay open while the lock is needed.
+// - error: errLocked, wrapped with the PID of the holder, if another run holds the lock,
+// or an error if the file cannot be opened.
+func acquireLock(path string) (*os.File, error) {
+	file, err := openLockFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %v", err)
+	}
+
+	if err := lockFile(file); err != nil {
+		holder := make([]byte, 32)
+		n, _ := file.Read(holder)
+		file.Close()
+		if errors.Is(err, errWouldBlock) {
+			return nil, fmt.Errorf("%w (pid %s)", errLocked, strings.TrimSpace(string(holder[:n])))
+		}
+		return nil, fmt.Errorf("error locking %s: %v", path, err)
+	}
+
+	file.Truncate(0)
+	file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return file, nil
+}
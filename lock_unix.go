@@ -0,0 +1,73 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// defaultLockPath returns the lock file used when none is configured. Root uses /run/lock and
+// other users their runtime directory, so that the lock is not in the world-writable /tmp
+// where any user could hold it or plant a symbolic link in its place.
+//
+// Returns:
+// - string: the path of the lock file.
+func defaultLockPath() string {
+	if os.Geteuid() != 0 {
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+			return filepath.Join(dir, "distro2sbom.lock")
+		}
+	}
+	return "/run/lock/distro2sbom.lock"
+}
+
+// openLockFile opens or creates the lock file without following symbolic links and refuses
+// files owned by another user, who could otherwise hold the lock of every run or have the
+// file truncated.
+//
+// Parameters:
+// - path: the lock file.
+//
+// Returns:
+// - *os.File: the open lock file.
+// - error: an error if the file cannot be opened, is not a regular file or is owned by
+// another user.
+func openLockFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Geteuid() {
+		file.Close()
+		return nil, fmt.Errorf("%s is owned by uid %d instead of the current user", path, stat.Uid)
+	}
+	return file, nil
+}
+
+// lockFile takes an exclusive flock on an open file without waiting.
+//
+// Parameters:
+// - file: the lock file.
+//
+// Returns:
+// - error: errWouldBlock if another process holds the lock, or the error of flock.
+func lockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errWouldBlock
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// defaultLockPath returns the lock file used when none is configured, in the temporary
+// directory of the user.
+//
+// Returns:
+// - string: the path of the lock file.
+func defaultLockPath() string {
+	return filepath.Join(os.TempDir(), "distro2sbom.lock")
+}
+
+// openLockFile opens or creates the lock file.
+//
+// Parameters:
+// - path: the lock file.
+//
+// Returns:
+// - *os.File: the open lock file.
+// - error: an error if the file cannot be opened.
+func openLockFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+// lockFile takes an exclusive lock on an open file without waiting.
+//
+// The locked byte lies far beyond the PID written to the file, which Windows would otherwise
+// refuse to let the next run read.
+//
+// Parameters:
+// - file: the lock file.
+//
+// Returns:
+// - error: errWouldBlock if another process holds the lock, or the error of LockFileEx.
+func lockFile(file *os.File) error {
+	overlapped := &windows.Overlapped{OffsetHigh: 1}
+	err := windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errWouldBlock
+	}
+	return err
+}
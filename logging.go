@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// setupLogging configures the default slog logger.
+//
+// Diagnostics are always written to stderr, so that stdout only carries the SBOM
+// and can be piped safely into other tools.
+//
+// Parameters:
+// - level: the minimum level to log, one of debug, info, warn or error.
+// - format: the log format, text or json.
+//
+// Returns:
+// - error: an error if the level or format is unknown.
+func setupLogging(level, format string) error {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(strings.ToUpper(level))); err != nil {
+		return fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+
+	options := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text", "":
+		handler = slog.NewTextHandler(os.Stderr, options)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal logs an error and exits the program.
+//
+// Parameters:
+// - code: the exit code, one of the exit constants.
+// - msg: the log message.
+// - args: additional attributes as key/value pairs.
+func fatal(code int, msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(code)
+}
@@ -2,13 +2,22 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/CycloneDX/cyclonedx-go"
@@ -17,8 +26,9 @@ import (
 	"github.com/spf13/viper"
 )
 
-// Supplier information for each distribution
-var supplierInfo = map[string]cyclonedx.OrganizationalEntity{
+// Supplier information for each distribution, shared by the components of its packages.
+// The suppliers setting of the configuration file overrides and extends it.
+var supplierInfo = map[string]*cyclonedx.OrganizationalEntity{
 	"ubuntu": {
 		Name: "Ubuntu Developers",
 		Contact: &[]cyclonedx.OrganizationalContact{
@@ -31,6 +41,10 @@ var supplierInfo = map[string]cyclonedx.OrganizationalEntity{
 			{Email: "debian-devel@lists.debian.org"},
 		},
 	},
+	"raspbian": {
+		Name: "Raspberry Pi Ltd",
+		URL:  &[]string{"https://www.raspberrypi.com/software/"},
+	},
 	"alpine": {
 		Name: "Alpine Linux Developers",
 		Contact: &[]cyclonedx.OrganizationalContact{
@@ -67,6 +81,60 @@ var supplierInfo = map[string]cyclonedx.OrganizationalEntity{
 			{Email: "devel@lists.rockylinux.org"},
 		},
 	},
+	"almalinux": {
+		Name: "AlmaLinux OS Foundation",
+		URL:  &[]string{"https://almalinux.org/"},
+	},
+	"ol": {
+		Name: "Oracle Linux",
+		URL:  &[]string{"https://www.oracle.com/linux/"},
+	},
+	"eurolinux": {
+		Name: "EuroLinux",
+		URL:  &[]string{"https://euro-linux.com/"},
+	},
+	"amazonlinux": {
+		Name: "Amazon Web Services",
+		URL:  &[]string{"https://aws.amazon.com/linux/"},
+	},
+	"photon": {
+		Name: "VMware Photon OS",
+		URL:  &[]string{"https://vmware.github.io/photon/"},
+	},
+	"clearlinux": {
+		Name: "Clear Linux Project",
+		URL:  &[]string{"https://clearlinux.org/"},
+	},
+	"slackware": {
+		Name: "Slackware Linux Project",
+		URL:  &[]string{"http://www.slackware.com/"},
+	},
+	"freebsd": {
+		Name: "FreeBSD Ports Management Team",
+		Contact: &[]cyclonedx.OrganizationalContact{
+			{Email: "portmgr@FreeBSD.org"},
+		},
+	},
+	"openwrt": {
+		Name: "OpenWrt Developers",
+		Contact: &[]cyclonedx.OrganizationalContact{
+			{Email: "openwrt-devel@lists.openwrt.org"},
+		},
+	},
+	"arch": {
+		Name: "Arch Linux Developers",
+		Contact: &[]cyclonedx.OrganizationalContact{
+			{Email: "arch-dev-public@lists.archlinux.org"},
+		},
+	},
+	"void": {
+		Name: "Void Linux Developers",
+		URL:  &[]string{"https://voidlinux.org/"},
+	},
+	"nixos": {
+		Name: "NixOS Contributors",
+		URL:  &[]string{"https://nixos.org/"},
+	},
 }
 
 // main is the entry point of the program.
@@ -81,146 +149,586 @@ var supplierInfo = map[string]cyclonedx.OrganizationalEntity{
 // Returns:
 // - None.
 func main() {
-	viper.SetConfigName("dist02cyclonedx")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath("/etc/")
-	viper.AutomaticEnv()
-
-	// Read the config file if it exists
-	if err := viper.ReadInConfig(); err != nil {
-		fmt.Printf("Error reading config file: %v\n", err)
+	if err := newRootCmd().Execute(); err != nil {
+		fatal(exitConfig, "Error executing command", "error", err)
 	}
+}
 
-	var distro string
-	var output string
-	var apiURL string
-	var apiKey string
-	var tlsVerify bool
-	var spdxSchema string
+// newRootCmd creates the distro2sbom command with its flags, bound to viper, and its
+// subcommands.
+//
+// Returns:
+// - *cobra.Command: the root command.
+func newRootCmd() *cobra.Command {
+	// Settings can be given as DISTRO2SBOM_ prefixed environment variables, e.g. DISTRO2SBOM_API_URL
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
+
+	var settings runSettings
 
 	var rootCmd = &cobra.Command{
 		Use:   "distro2sbom",
 		Short: "Generate SBOM for a Linux distribution.",
 		Long:  `distro2sbom generates a Software Bill of Materials (SBOM) for a given Linux distribution using CycloneDX format.`,
+		// Errors are logged by main through the configured logger
+		SilenceErrors: true,
 		Run: func(cmd *cobra.Command, args []string) {
-			if !cmd.Flags().Changed("distro") {
-				distro = viper.GetString("distro")
-			} else {
-				distro, _ = cmd.Flags().GetString("distro")
+			settings.load()
+			r := &sbomRun{runSettings: &settings}
+			if r.workers < 0 {
+				fatal(exitConfig, "Invalid --workers, expected 0 or more", "workers", r.workers)
 			}
-			if !cmd.Flags().Changed("output") {
-				output = viper.GetString("output")
-			} else {
-				output, _ = cmd.Flags().GetString("output")
+			if r.source != sourceAuto && r.source != sourceNative && r.source != sourceExec {
+				fatal(exitConfig, "Invalid --source, expected auto, native or exec", "source", r.source)
 			}
-			if !cmd.Flags().Changed("api-url") {
-				apiURL = viper.GetString("api-url")
-			} else {
-				apiURL, _ = cmd.Flags().GetString("api-url")
+			if _, ok := checksumAlgorithms[r.checksumAlgorithm]; r.checksumAlgorithm != "" && !ok {
+				fatal(exitConfig, "Invalid --checksum, expected sha256 or sha512", "checksum", r.checksumAlgorithm)
 			}
-			if !cmd.Flags().Changed("api-key") {
-				apiKey = viper.GetString("api-key")
-			} else {
-				apiKey, _ = cmd.Flags().GetString("api-key")
+			if r.notifyFormat != notifyFormatSlack && r.notifyFormat != notifyFormatTeams && r.notifyFormat != notifyFormatJSON {
+				fatal(exitConfig, "Invalid --notify-format, expected slack, teams or json", "notifyFormat", r.notifyFormat)
 			}
-			if !cmd.Flags().Changed("tls-verify") {
-				tlsVerify = viper.GetBool("tls-verify")
-			} else {
-				tlsVerify, _ = cmd.Flags().GetBool("tls-verify")
+			if r.notifyOn != "always" && r.notifyOn != "failure" {
+				fatal(exitConfig, "Invalid --notify-on, expected always or failure", "notifyOn", r.notifyOn)
 			}
-			if !cmd.Flags().Changed("spdx-schema") {
-				spdxSchema = viper.GetString("spdx-schema")
-			} else {
-				spdxSchema, _ = cmd.Flags().GetString("spdx-schema")
+			if r.failOnDrift && r.baselinePath == "" {
+				fatal(exitConfig, "--fail-on-drift needs the approved SBOM as --baseline")
+			}
+			if r.outputFormat != outputFormatCycloneDX && r.outputFormat != outputFormatPURLs {
+				fatal(exitConfig, "Invalid --output-format, expected cyclonedx or purls", "outputFormat", r.outputFormat)
+			}
+			if r.outputFormat == outputFormatPURLs && r.outputDir != "" {
+				fatal(exitConfig, "--output-dir keeps CycloneDX SBOMs, --output-format purls needs --output or stdout")
+			}
+			if r.outputDir != "" && r.output != "" {
+				fatal(exitConfig, "--output and --output-dir are mutually exclusive")
+			}
+			if r.keepSBOMs < 0 || r.keepFor < 0 {
+				fatal(exitConfig, "Invalid --keep or --keep-for, expected 0 or more", "keep", r.keepSBOMs, "keepFor", r.keepFor)
+			}
+			if r.bundleFormat != bundleFormatDir && r.bundleFormat != bundleFormatTarGz {
+				fatal(exitConfig, "Invalid --bundle-format, expected dir or tar.gz", "bundleFormat", r.bundleFormat)
+			}
+			for _, collector := range r.include {
+				if _, ok := packageCollectors[collector]; collector != includeRuntime && !ok {
+					fatal(exitConfig, "Invalid --include, expected runtime, homebrew, winget, chocolatey, pip, npm, gem or go", "include", collector)
+				}
+				if collector == includeRuntime && r.rootfs != "" {
+					fatal(exitConfig, "--include runtime needs a running system, a root file system has no processes")
+				}
+			}
+			var err error
+			r.parsedSpecVersion, err = parseSpecVersion(r.specVersion)
+			if err != nil {
+				fatal(exitConfig, "Invalid --spec-version", "error", err)
+			}
+			if !validProfile(r.profile) {
+				fatal(exitConfig, "Invalid --profile, expected bsi", "profile", r.profile)
 			}
+			if r.dependencyRoot != dependencyRootOS && r.dependencyRoot != dependencyRootComponent {
+				fatal(exitConfig, "Invalid --dependency-root, expected os or component", "dependencyRoot", r.dependencyRoot)
+			}
+			if r.multiArch != multiArchSeparate && r.multiArch != multiArchMerge {
+				fatal(exitConfig, "Invalid --multi-arch, expected separate or merge", "multiArch", r.multiArch)
+			}
+			if r.maxLineSize < 0 {
+				fatal(exitConfig, "Invalid --max-line-size, expected 0 or more", "maxLineSize", r.maxLineSize)
+			}
+			if !validComponentType(r.componentType) {
+				fatal(exitConfig, "Invalid --component-type", "type", r.componentType)
+			}
+			r.metadata, err = loadMetadataConfig(r.authors, r.contacts)
+			if err != nil {
+				fatal(exitConfig, "Invalid SBOM metadata", "error", err)
+			}
+			r.metadata.Properties, err = loadComplianceProperties(r.complianceTags)
+			if err != nil {
+				fatal(exitConfig, "Invalid --compliance-tags", "error", err)
+			}
+			r.destinations, err = loadDestinations()
+			if err != nil {
+				fatal(exitConfig, "Invalid destinations", "error", err)
+			}
+			r.runner, err = newRunner(r.rootfs, r.sshTarget)
+			if err != nil {
+				fatal(exitConfig, "Invalid scan target", "error", err)
+			}
+			if r.watch && (r.rootfs != "" || r.sshTarget != "") {
+				fatal(exitConfig, "--watch only watches the package database of the local host, use --daemon to scan a root file system or remote host")
+			}
+
+			// Interrupts cancel the run, killing running package manager commands and
+			// outstanding requests, a second interrupt terminates immediately
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			go func() {
+				<-ctx.Done()
+				stop()
+			}()
 
-			if spdxSchema == "" {
-				log.Fatal("spdx-schema is not set. Please specify the location of spdx.schema.json using the --spdx-schema flag or in the configuration file.")
+			r.startTime = time.Now()
+			r.event = RunEvent{Distro: r.distro}
+			r.metrics = newMetrics()
+
+			r.hostname, err = scannedHostname(ctx, r.runner)
+			if err != nil {
+				r.fail(exitCollection, "Error getting hostname", err)
+			}
+			r.event.Hostname = r.hostname
+
+			if r.dryRun {
+				r.plan(ctx)
+				return
+			}
+
+			if r.spdxSchema == "" {
+				r.fail(exitConfig, "spdx-schema is not set. Please specify the location of spdx.schema.json using the --spdx-schema flag or in the configuration file", nil)
 			}
 
 			// Load the SPDX schema
-			err := loadSPDXSchema(spdxSchema)
+			err = loadSPDXSchema(r.spdxSchema)
 			if err != nil {
-				log.Fatalf("Error loading SPDX schema: %v", err)
+				r.fail(exitConfig, "Error loading SPDX schema", err)
 			}
 
-			if distro == "" {
-				fmt.Println("Please specify a distribution using the --distro flag.")
-				return
+			if r.distro == "" {
+				r.fail(exitConfig, "Please specify a distribution using the --distro flag", nil)
+			}
+			registerDerivedDistro(ctx, r.distro, r.runner)
+
+			// Runs started while a previous one is still running exit instead of doubling the load
+			if r.lockFile != "" {
+				lock, err := acquireLock(r.lockFile)
+				if errors.Is(err, errLocked) {
+					r.fail(exitLocked, "Another run is in progress, exiting", err)
+				} else if err != nil {
+					r.fail(exitConfig, "Error acquiring lock", err)
+				}
+				defer lock.Close()
 			}
 
 			// Set the spdx-schema value in viper for use in manage_licenses.go
 			// viper.Set("spdx-schema", spdxSchema)
 
-			sbom, err := generateSBOM(distro, "1.0")
-			if err != nil {
-				log.Fatalf("Error generating SBOM: %v", err)
+			// serveMetrics serves the metrics in the background while watching or running as daemon
+			serveMetrics := func(ctx context.Context) {
+				if r.metricsListen == "" {
+					return
+				}
+				go func() {
+					if err := r.metrics.serve(ctx, r.metricsListen); err != nil {
+						r.fail(exitConfig, "Error serving metrics", err)
+					}
+				}()
 			}
 
-			sbomJSON, err := json.MarshalIndent(sbom, "", "  ")
-			if err != nil {
-				log.Fatalf("Error marshaling SBOM to JSON: %v", err)
+			// servePprofProfiles serves the runtime profiles in the background while watching or
+			// running as daemon
+			servePprofProfiles := func(ctx context.Context) {
+				if r.pprofListen == "" {
+					return
+				}
+				go func() {
+					if err := servePprof(ctx, r.pprofListen); err != nil {
+						r.fail(exitConfig, "Error serving pprof", err)
+					}
+				}()
 			}
 
-			if output == "" {
-				fmt.Println(string(sbomJSON))
-			} else {
-				if err := os.WriteFile(output, sbomJSON, 0644); err != nil {
-					log.Fatalf("Error writing SBOM to file: %v", err)
+			// repeat runs deliver in watch and daemon mode, failed runs are reported and
+			// retried on the next trigger instead of exiting
+			repeat := func() {
+				startTime := time.Now()
+				event := RunEvent{Distro: r.distro, Hostname: r.hostname}
+				runErr := r.deliver(ctx, &event)
+				r.report(event, startTime, runErr)
+				if runErr != nil {
+					runErr.log()
 				}
 			}
 
-			if apiURL != "" && apiKey != "" {
-				hostname, err := os.Hostname()
+			if r.watch {
+				packageManager, err := packageManagerFor(r.distro)
 				if err != nil {
-					log.Fatalf("Error getting hostname: %v", err)
+					r.fail(exitConfig, "Error watching package database", err)
 				}
+				serveMetrics(ctx)
+				servePprofProfiles(ctx)
 
-				osVersion := getOSVersion()
+				if err := watchPackageDatabase(ctx, packageManager, r.watchDebounce, repeat); err != nil {
+					r.fail(exitConfig, "Error watching package database", err)
+				}
+				return
+			}
 
-				err = uploadSBOM(apiURL, apiKey, distro, hostname, osVersion, sbomJSON, tlsVerify)
-				if err != nil {
-					log.Fatalf("Error uploading SBOM: %v", err)
+			if r.daemon {
+				serveMetrics(ctx)
+				servePprofProfiles(ctx)
+
+				if err := runDaemon(ctx, r.schedule, repeat); err != nil {
+					r.fail(exitConfig, "Error running daemon", err)
 				}
-			} else if apiURL != "" || apiKey != "" {
-				fmt.Println("Both api-url and api-key must be provided to upload the SBOM.")
+				return
+			}
+
+			// Profiles of one-shot runs cover the collection and the delivery
+			stopProfiles, err := startProfiles(r.cpuProfile, r.memProfile)
+			if err != nil {
+				r.fail(exitConfig, "Error starting profiling", err)
+			}
+			runErr := r.deliver(ctx, &r.event)
+			stopProfiles()
+			r.report(r.event, r.startTime, runErr)
+			if runErr != nil {
+				runErr.exit()
 			}
 		},
 	}
 
-	rootCmd.Flags().StringVarP(&distro, "distro", "d", "", "Linux distribution (e.g., ubuntu, debian)")
-	rootCmd.Flags().StringVarP(&output, "output", "o", "", "Output file for SBOM (default: stdout)")
-	rootCmd.Flags().StringVar(&apiURL, "api-url", "", "Dependency-Track API URL")
-	rootCmd.Flags().StringVar(&apiKey, "api-key", "", "Dependency-Track API Key")
-	rootCmd.Flags().BoolVar(&tlsVerify, "tls-verify", true, "Verify TLS certificates")
-	rootCmd.Flags().StringVar(&spdxSchema, "spdx-schema", "", "Location of spdx.schema.json")
+	rootCmd.Flags().StringVarP(&settings.distro, "distro", "d", "", "Linux distribution (e.g., ubuntu, debian)")
+	rootCmd.Flags().StringVarP(&settings.output, "output", "o", "", "Output file for SBOM (default: stdout)")
+	rootCmd.Flags().StringVar(&settings.apiURL, "api-url", "", "Dependency-Track API URL")
+	rootCmd.Flags().StringVar(&settings.apiKey, "api-key", "", "Dependency-Track API Key")
+	rootCmd.Flags().BoolVar(&settings.tlsVerify, "tls-verify", true, "Verify TLS certificates")
+	rootCmd.Flags().StringVar(&settings.spdxSchema, "spdx-schema", "", "Location of spdx.schema.json")
+	rootCmd.Flags().DurationVar(&settings.httpTimeout, "http-timeout", 60*time.Second, "Timeout for each Dependency-Track API request (0 disables the timeout)")
+	rootCmd.Flags().StringSliceVar(&settings.projectTeams, "project-team", nil, "Dependency-Track team (name or UUID) granted access to created projects, may be repeated")
+	rootCmd.Flags().BoolVar(&settings.uploadDryRun, "upload-dry-run", false, "Check connectivity, permissions and the SBOM without creating projects or uploading")
+	rootCmd.Flags().StringSliceVar(&settings.containerSBOMs, "container-sbom", nil, "CycloneDX SBOM of a container image on the host, uploaded as a child project of the host, may be repeated")
+	rootCmd.Flags().StringVar(&settings.store, "store", "", "Object storage location for the SBOM (s3://bucket/prefix, gs://bucket/prefix or azblob://account/container/prefix)")
+	rootCmd.Flags().StringVar(&settings.storeKey, "store-key", defaultStoreKey, "Object key template below the store prefix ({{.Hostname}}, {{.Distro}}, {{.Date}}, {{.Timestamp}})")
+	rootCmd.Flags().StringVar(&settings.webhookURL, "webhook-url", "", "URL of an HTTP endpoint the SBOM is sent to")
+	rootCmd.Flags().StringVar(&settings.webhookMethod, "webhook-method", "POST", "HTTP method used for the webhook")
+	rootCmd.Flags().StringArrayVar(&settings.webhookHeaders, "webhook-header", nil, "Header sent to the webhook as \"Name: value\", the value is a template that can use {{env \"VAR\"}}, may be repeated")
+	rootCmd.Flags().StringVar(&settings.webhookBody, "webhook-body", "raw", "Webhook body, raw for the SBOM or envelope for a JSON object with host details and the SBOM")
+	rootCmd.Flags().StringVar(&settings.ociPush, "oci-push", "", "Push the SBOM as an OCI artifact to registry/repository[:tag] (default tag: hostname)")
+	rootCmd.Flags().StringVar(&settings.ociSubject, "oci-subject", "", "Digest of an image in the --oci-push repository the SBOM is attached to as a referrer")
+	rootCmd.Flags().StringVar(&settings.sw360URL, "sw360-url", "", "SW360 server URL, components and releases are created or updated from the SBOM")
+	rootCmd.Flags().StringVar(&settings.sw360Token, "sw360-token", "", "SW360 REST API token")
+	rootCmd.Flags().StringVar(&settings.anchoreURL, "anchore-url", "", "Anchore Enterprise API URL, the SBOM is imported as a source")
+	rootCmd.Flags().StringVar(&settings.anchoreUser, "anchore-user", "", "Anchore Enterprise username")
+	rootCmd.Flags().StringVar(&settings.anchorePassword, "anchore-password", "", "Anchore Enterprise password")
+	rootCmd.Flags().StringVar(&settings.anchoreAccount, "anchore-account", "", "Anchore Enterprise account to import into (default: the user's account)")
+	rootCmd.Flags().StringVar(&settings.eventLog, "event-log", "", "Emit a structured completion event to syslog or journald")
+	rootCmd.Flags().StringVar(&settings.publish, "publish", "", "Publish the SBOM to kafka://brokers/topic or nats://host:port/subject")
+	rootCmd.Flags().StringVar(&settings.publishPayload, "publish-payload", "sbom", "Published payload, sbom for the document or pointer for its digest and locations")
+	rootCmd.Flags().StringVar(&settings.gitRepo, "git-repo", "", "Git repository URL the SBOM is committed and pushed to")
+	rootCmd.Flags().StringVar(&settings.gitBranch, "git-branch", "main", "Branch of the Git repository")
+	rootCmd.Flags().StringVar(&settings.gitPath, "git-path", defaultGitPath, "Path template of the SBOM inside the Git repository")
+	rootCmd.Flags().StringVar(&settings.gitWorkDir, "git-workdir", "/var/lib/distro2sbom/git", "Local clone of the Git repository")
+	rootCmd.Flags().StringVar(&settings.gitUser, "git-user", "x-access-token", "Username sent with the Git token")
+	rootCmd.Flags().StringVar(&settings.gitToken, "git-token", "", "Token for HTTPS authentication to the Git repository")
+	rootCmd.Flags().BoolVar(&settings.watch, "watch", false, "Keep running and regenerate the SBOM whenever the package database changes")
+	rootCmd.Flags().DurationVar(&settings.watchDebounce, "watch-debounce", 10*time.Second, "Time without package database changes before the SBOM is regenerated")
+	rootCmd.Flags().BoolVar(&settings.daemon, "daemon", false, "Keep running and generate the SBOM on --schedule and on SIGHUP")
+	rootCmd.Flags().StringVar(&settings.schedule, "schedule", "@daily", "Cron expression of the daemon runs, e.g. \"30 2 * * *\" or @hourly")
+	rootCmd.MarkFlagsMutuallyExclusive("watch", "daemon")
+	rootCmd.Flags().StringVar(&settings.metricsListen, "metrics-listen", "", "Address Prometheus metrics are served on at /metrics in watch and daemon mode, e.g. :9142")
+	rootCmd.Flags().StringVar(&settings.pushgateway, "pushgateway", "", "Prometheus Pushgateway URL the metrics are pushed to after every run")
+	rootCmd.Flags().StringVar(&settings.lockFile, "lock-file", defaultLockFile, "Lock file preventing overlapping runs, empty to disable")
+	rootCmd.Flags().DurationVar(&settings.commandTimeout, "command-timeout", 60*time.Second, "Timeout for each per-package package manager command, timed out packages are reported instead of aborting the run (0 disables the timeout)")
+	rootCmd.Flags().IntVar(&settings.workers, "workers", 0, "Number of license and dependency commands run in parallel (default: the number of CPUs, at most 8, 2 for rpm)")
+	rootCmd.Flags().StringVar(&settings.pprofListen, "pprof", "", "Address the Go runtime profiles are served on at /debug/pprof/ in watch and daemon mode, e.g. localhost:6060")
+	rootCmd.Flags().StringVar(&settings.cpuProfile, "cpuprofile", "", "Write a CPU profile of a one-shot run to this file")
+	rootCmd.Flags().StringVar(&settings.memProfile, "memprofile", "", "Write a heap profile at the end of a one-shot run to this file")
+	rootCmd.Flags().StringVar(&settings.source, "source", sourceAuto, "How packages are collected: native reads the package database (dpkg), exec runs the package manager per package, auto prefers native")
+	rootCmd.Flags().StringVar(&settings.checksumAlgorithm, "checksum", "", "Write a checksum file <output>.<algorithm> next to the SBOM and add the digest to the result JSON: sha256 or sha512")
+	rootCmd.Flags().StringVar(&settings.specVersion, "spec-version", cyclonedx.SpecVersion1_6.String(), "CycloneDX spec version of the SBOM, 1.2 to 1.6. Fields the version does not support are left out")
+	rootCmd.Flags().StringVar(&settings.profile, "profile", "", "Compliance profile the SBOM is completed for and checked against: bsi for BSI TR-03183-2")
+	rootCmd.Flags().StringSliceVar(&settings.complianceTags, "compliance-tags", nil, "Compliance frameworks referenced in the SBOM metadata properties: ssdf, fedramp (system ID from the configuration file), may be repeated")
+	rootCmd.Flags().StringVar(&settings.annotationsPath, "annotations", "", "JSON file with reviewer notes on components by bom-ref or purl, added to the SBOM as annotations")
+	rootCmd.Flags().StringVar(&settings.notifyURL, "notify-url", "", "Webhook URL notified with a summary of every run, e.g. a Slack or Teams incoming webhook")
+	rootCmd.Flags().StringVar(&settings.notifyFormat, "notify-format", notifyFormatSlack, "Format of the notification: slack, teams or json for the run result")
+	rootCmd.Flags().StringVar(&settings.notifyOn, "notify-on", "always", "Runs that are notified: always or failure")
+	rootCmd.Flags().StringVar(&settings.outputFormat, "output-format", outputFormatCycloneDX, "Format of the output: cyclonedx for the SBOM, purls for the package URLs of the components, one per line")
+	rootCmd.Flags().StringVar(&settings.outputDir, "output-dir", "", "Directory keeping the SBOM of every run as sbom-<timestamp>.json with a latest.json link to the newest")
+	rootCmd.Flags().IntVar(&settings.keepSBOMs, "keep", 0, "Number of SBOMs kept in --output-dir, 0 for no limit")
+	rootCmd.Flags().DurationVar(&settings.keepFor, "keep-for", 0, "Age of the oldest SBOM kept in --output-dir, e.g. 720h, 0 for no limit")
+	rootCmd.Flags().StringVar(&settings.bundleDir, "bundle", "", "Directory the SBOM, CSV inventory, license report, run result and their checksums are bundled in per run")
+	rootCmd.Flags().StringVar(&settings.bundleFormat, "bundle-format", bundleFormatDir, "Format of the bundle: dir for a timestamped directory, tar.gz for an archive of it")
+	rootCmd.Flags().StringSliceVar(&settings.include, "include", nil, "Opt-in collectors: runtime marks the packages owning the executables of running processes and the ports they listen on, homebrew, winget and chocolatey add the packages installed with these package managers, pip the system-wide Python packages, npm the global npm packages, gem the Ruby gems, go the modules of Go binaries")
+	rootCmd.Flags().StringSliceVar(&settings.authors, "author", nil, "Author of the SBOM as \"Name <email>\", may be repeated")
+	rootCmd.Flags().StringSliceVar(&settings.contacts, "contact", nil, "Contact for questions about the SBOM as \"Name <email>\", added to the contacts of the configured supplier, may be repeated")
+	rootCmd.Flags().StringVar(&settings.dependencyRoot, "dependency-root", dependencyRootOS, "Shape of the dependency graph: os hangs every component off the operating system, component lists the root component next to the packages like earlier releases")
+	rootCmd.Flags().StringVar(&settings.multiArch, "multi-arch", multiArchSeparate, "How packages installed for several architectures are emitted: separate emits a component per architecture, merge one component per name and version")
+	rootCmd.Flags().StringVar(&settings.rootfs, "rootfs", "", "Scan the root file system at this path, e.g. an extracted container image or a mounted disk, instead of the local host (commands run with chroot)")
+	rootCmd.Flags().StringVar(&settings.sshTarget, "ssh", "", "Scan the remote host [user@]host over ssh instead of the local host, using the ssh configuration and keys of the local user")
+	rootCmd.MarkFlagsMutuallyExclusive("rootfs", "ssh")
+	rootCmd.Flags().IntVar(&settings.maxLineSize, "max-line-size", defaultMaxLineSize, "Longest line of package manager output in bytes that is accepted, e.g. a long Depends field")
+	rootCmd.Flags().StringVar(&settings.baselinePath, "baseline", "", "Previous SBOM whose licenses and dependencies are reused for packages that did not change since")
+	rootCmd.Flags().BoolVar(&settings.failOnDrift, "fail-on-drift", false, "Exit with code 6 if packages were added, removed or changed since the approved --baseline")
+	rootCmd.Flags().StringVar(&settings.cacheDir, "cache-dir", "", "Directory caching the licenses and dependencies of every package by name, version and architecture, empty to disable")
+	rootCmd.Flags().DurationVar(&settings.cacheTTL, "cache-ttl", defaultCacheTTL, "How long cached package data is used")
+	rootCmd.Flags().BoolVar(&settings.timings, "timings", false, "Print the wall time of every phase and package manager command class at the end of the run and include it in the result JSON")
+	rootCmd.Flags().StringVar(&settings.resultJSON, "result-json", "", "Write a JSON description of the run (result, exit code, counts, durations, warnings, destinations) to this file")
+	rootCmd.Flags().StringSliceVar(&settings.pluginPaths, "plugin-path", defaultPluginPaths, "Directory searched for distro2sbom-collector-* plugins, may be repeated")
+	rootCmd.Flags().StringSliceVar(&settings.goBinaryPaths, "go-binary-path", defaultGoBinaryPaths, "Directory searched with its subdirectories for Go binaries by --include go, may be repeated")
+	rootCmd.Flags().BoolVar(&settings.strict, "strict", false, "Fail the run on the first failed package manager command instead of reporting the package as incomplete")
+	rootCmd.Flags().StringVar(&settings.componentName, "component-name", defaultComponentName, "Name of the root component the packages belong to, e.g. the product or appliance the host is part of")
+	rootCmd.Flags().StringVar(&settings.componentVersion, "component-version", defaultComponentVersion, "Version of the root component")
+	rootCmd.Flags().StringVar(&settings.componentType, "component-type", string(cyclonedx.ComponentTypeApplication), "CycloneDX type of the root component, e.g. application, device or firmware")
+	rootCmd.Flags().StringVar(&settings.pushgatewayJob, "pushgateway-job", "distro2sbom", "Job label of the metrics pushed to the Pushgateway")
+	rootCmd.Flags().BoolVar(&settings.dryRun, "dry-run", false, "Print the commands, collectors and destinations of the run without running anything")
+
+	// Flags that are not given are read from the environment and the configuration file
+	viper.BindPFlags(rootCmd.Flags())
+
+	var configFile string
+	var logLevel string
+	var logFormat string
+	var quiet bool
+	var verbose bool
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Configuration file (default: dist02cyclonedx.yaml in the working directory, the XDG config directories or /etc)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Log format (text, json), logs are written to stderr")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only log errors, for cron jobs")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log per-package actions and timings")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+	viper.BindPFlags(rootCmd.PersistentFlags())
+
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// The flags are parsed at this point, later errors are not usage errors
+		cmd.SilenceUsage = true
+
+		// Read the config file before logging is set up so it can configure logging,
+		// errors are logged afterwards
+		if configFile == "" {
+			configFile = os.Getenv(envPrefix + "_CONFIG")
+		}
+		configErr := readConfig(configFile)
+
+		level := viper.GetString("log-level")
+		if viper.GetBool("quiet") {
+			level = "error"
+		} else if viper.GetBool("verbose") {
+			level = "debug"
+		}
+		if err := setupLogging(level, viper.GetString("log-format")); err != nil {
+			return err
+		}
+		if configErr != nil {
+			if configFile != "" {
+				return fmt.Errorf("error reading config file %s: %v", configFile, configErr)
+			}
+			if _, notFound := configErr.(viper.ConfigFileNotFoundError); notFound {
+				slog.Debug("No config file found", "paths", configSearchPaths())
+			} else {
+				slog.Warn("Error reading config file", "error", configErr)
+			}
+		} else {
+			slog.Debug("Using config file", "file", viper.ConfigFileUsed())
+		}
+		return nil
+	}
+
+	rootCmd.AddCommand(newAttestCmd())
+	rootCmd.AddCommand(newSignCmd())
+	rootCmd.AddCommand(newVerifyCmd())
+	rootCmd.AddCommand(newVersionCmd())
+	rootCmd.AddCommand(newGenDocsCmd())
+	rootCmd.AddCommand(newTuiCmd())
+	rootCmd.AddCommand(newInstallServiceCmd())
+	rootCmd.AddCommand(newValidateCmd())
+	rootCmd.AddCommand(newConvertCmd())
+	rootCmd.AddCommand(newUploadCmd())
+	rootCmd.AddCommand(newCacheCmd())
+
+	return rootCmd
+}
+
+// CollectOptions selects the collectors of a run and reports their progress.
+//
+// The zero value runs every collector without progress reporting.
+type CollectOptions struct {
+	// SkipLicenses disables the license lookup of every package.
+	SkipLicenses bool
+	// SkipDependencies disables the dependency lookup of every package.
+	SkipDependencies bool
+	// CommandTimeout limits every per-package command, packages whose command times
+	// out are reported and left incomplete instead of stalling the run. 0 disables it.
+	CommandTimeout time.Duration
+	// Baseline is a previous SBOM whose data is copied for packages that did not change
+	// since, instead of querying them again. nil queries every package.
+	Baseline *Baseline
+	// Cache stores the licenses and dependencies of every package, so that packages
+	// whose entry did not expire are not queried again. nil disables the cache.
+	Cache *Cache
+	// PluginPaths are the directories searched for collector plugins.
+	PluginPaths []string
+	// GoBinaryPaths are the directories searched for Go binaries by --include go.
+	GoBinaryPaths []string
+	// Strict fails the run on the first failed package manager command instead of
+	// continuing without the data of the package.
+	Strict bool
+	// Workers is the number of license and dependency commands run in parallel,
+	// 0 derives it from the CPUs and the package manager.
+	Workers int
+	// Component is the identity of the root component the packages belong to, empty
+	// fields default to the RootComponent placeholder.
+	Component ComponentIdentity
+	// Metadata is the SBOM metadata and package suppliers set in the configuration file.
+	Metadata MetadataConfig
+	// DependencyRoot is the shape of the dependency graph: os or component, empty for os.
+	DependencyRoot string
+	// Source selects whether the package database is read natively or the package manager
+	// is run: auto, native or exec, empty for auto.
+	Source string
+	// MaxLineSize is the longest line of package manager output that is accepted,
+	// 0 for defaultMaxLineSize.
+	MaxLineSize int
+	// MultiArch is how packages installed for several architectures are emitted:
+	// separate or merge, empty for separate.
+	MultiArch string
+	// Annotations are the reviewer notes added to the SBOM as annotations.
+	Annotations []ReviewerNote
+	// Include are the opt-in collectors to run, e.g. runtime.
+	Include []string
+	// SpecVersion is the CycloneDX spec version the SBOM is written in, 0 for 1.6.
+	SpecVersion cyclonedx.SpecVersion
+	// Profile is the compliance profile whose required fields are filled in, empty for none.
+	Profile string
+	// Runner runs the package manager and reads the files of the scanned system, nil
+	// scans the local host. Plugins always run on the local host.
+	Runner Runner
+	// Timings records the time of the phases and package manager commands if set.
+	Timings *Timings
+	// Progress is called with the phase (packages, licenses or dependencies) and the
+	// number of processed packages in it, if set.
+	Progress func(phase string, done, total int)
+}
+
+// Default identity of the root component.
+const (
+	defaultComponentName    = "RootComponent"
+	defaultComponentVersion = "1.0"
+)
+
+// Formats of the output, selected by --output-format.
+const (
+	// outputFormatCycloneDX writes the CycloneDX SBOM.
+	outputFormatCycloneDX = "cyclonedx"
+	// outputFormatPURLs writes only the package URLs of the components, one per line.
+	outputFormatPURLs = "purls"
+)
+
+// Shapes of the dependency graph, selected by --dependency-root.
+const (
+	// dependencyRootOS hangs every component off the operating system, the metadata
+	// component CDXRef-DOCUMENT. A configured root component is listed as depending on
+	// the operating system, the RootComponent placeholder is left out.
+	dependencyRootOS = "os"
+	// dependencyRootComponent lists the root component, placeholder or configured, as a
+	// component next to the packages like earlier releases did.
+	dependencyRootComponent = "component"
+)
 
-	viper.BindPFlag("distro", rootCmd.Flags().Lookup("distro"))
-	viper.BindPFlag("output", rootCmd.Flags().Lookup("output"))
-	viper.BindPFlag("api-url", rootCmd.Flags().Lookup("api-url"))
-	viper.BindPFlag("api-key", rootCmd.Flags().Lookup("api-key"))
-	viper.BindPFlag("tls-verify", rootCmd.Flags().Lookup("tls-verify"))
-	viper.BindPFlag("spdx-schema", rootCmd.Flags().Lookup("spdx-schema"))
+// ComponentIdentity is the name, version and CycloneDX type of the root component, so that
+// an SBOM can describe a product or appliance instead of a placeholder.
+type ComponentIdentity struct {
+	Name    string
+	Version string
+	Type    string
+}
+
+// validComponentType reports whether a type is a CycloneDX component type, empty
+// selects the default.
+func validComponentType(componentType string) bool {
+	switch cyclonedx.ComponentType(componentType) {
+	case "", cyclonedx.ComponentTypeApplication, cyclonedx.ComponentTypeContainer, cyclonedx.ComponentTypeData,
+		cyclonedx.ComponentTypeDevice, cyclonedx.ComponentTypeDeviceDriver, cyclonedx.ComponentTypeFile,
+		cyclonedx.ComponentTypeFirmware, cyclonedx.ComponentTypeFramework, cyclonedx.ComponentTypeLibrary,
+		cyclonedx.ComponentTypeMachineLearningModel, cyclonedx.ComponentTypeOS, cyclonedx.ComponentTypePlatform:
+		return true
+	}
+	return false
+}
+
+// progress reports the progress of a phase, if a progress function is set.
+func (o CollectOptions) progress(phase string, done, total int) {
+	if o.Progress != nil {
+		o.Progress(phase, done, total)
+	}
+}
+
+// commandContext returns the context of a single package manager command.
+//
+// Parameters:
+// - ctx: the context of the run.
+// - timeout: the timeout of the command, 0 for none.
+//
+// Returns:
+// - context.Context: the context of the command.
+// - context.CancelFunc: releases the context once the command finished.
+func commandContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// specVersions are the CycloneDX spec versions SBOMs can be written in, JSON needs 1.2 or later.
+var specVersions = []cyclonedx.SpecVersion{
+	cyclonedx.SpecVersion1_2,
+	cyclonedx.SpecVersion1_3,
+	cyclonedx.SpecVersion1_4,
+	cyclonedx.SpecVersion1_5,
+	cyclonedx.SpecVersion1_6,
+}
+
+// parseSpecVersion parses a CycloneDX spec version of --spec-version.
+//
+// Parameters:
+// - version: the spec version, e.g. 1.5.
+//
+// Returns:
+// - cyclonedx.SpecVersion: the spec version.
+// - error: an error if the spec version is unknown or cannot be written as JSON.
+func parseSpecVersion(version string) (cyclonedx.SpecVersion, error) {
+	for _, specVersion := range specVersions {
+		if specVersion.String() == version {
+			return specVersion, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported CycloneDX spec version %q, expected %s to %s", version, specVersions[0], specVersions[len(specVersions)-1])
+}
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+// encodeBOM encodes an SBOM as indented JSON in its spec version.
+//
+// The encoder of cyclonedx-go drops the fields and values the spec version does not
+// support, e.g. lifecycles before 1.5, so that the SBOM is valid against its schema.
+//
+// Parameters:
+// - bom: the SBOM, it is not modified.
+//
+// Returns:
+// - []byte: the JSON without trailing newline.
+// - error: an error if the SBOM cannot be encoded.
+func encodeBOM(bom *cyclonedx.BOM) ([]byte, error) {
+	var encoded bytes.Buffer
+	if err := cyclonedx.NewBOMEncoder(&encoded, cyclonedx.BOMFileFormatJSON).SetPretty(true).EncodeVersion(bom, bom.SpecVersion); err != nil {
+		return nil, err
 	}
+	return bytes.TrimSuffix(encoded.Bytes(), []byte("\n")), nil
 }
 
 // generateSBOM generates a Software Bill of Materials (SBOM) for a given Linux distribution.
 //
 // Parameters:
+// - ctx: the context, running package manager commands are killed when it is cancelled
 // - distro: the name of the Linux distribution (e.g., ubuntu, debian)
 // - version: the version of the Linux distribution
+// - options: the collectors to run and the progress function
 //
 // Returns:
 // - *cyclonedx.BOM: the generated SBOM, or nil if an error occurred
 // - error: an error if the SBOM generation failed
-func generateSBOM(distro string, version string) (*cyclonedx.BOM, error) {
+func generateSBOM(ctx context.Context, distro string, version string, options CollectOptions) (*cyclonedx.BOM, error) {
 	bom := cyclonedx.NewBOM()
 	bom.Version = 1
-	bom.SpecVersion = cyclonedx.SpecVersion1_6
+	bom.SpecVersion = options.SpecVersion
+	if bom.SpecVersion == 0 {
+		bom.SpecVersion = cyclonedx.SpecVersion1_6
+	}
 	bom.SerialNumber = uuid.New().URN()
 	bom.BOMFormat = "CycloneDX"
 
@@ -231,14 +739,11 @@ func generateSBOM(distro string, version string) (*cyclonedx.BOM, error) {
 			{Phase: "operations"},
 		},
 		Tools: &cyclonedx.ToolsChoice{
-			Components: &[]cyclonedx.Component{
-				{
-					Type:    cyclonedx.ComponentTypeApplication,
-					Name:    "distro2sbom",
-					Version: "0.5.2",
-				},
-			},
+			Components: &[]cyclonedx.Component{toolComponent()},
 		},
+		Authors:      options.Metadata.Authors,
+		Supplier:     options.Metadata.Supplier,
+		Manufacturer: options.Metadata.Manufacturer,
 		Component: &cyclonedx.Component{
 			Type:    cyclonedx.ComponentTypeOS,
 			Name:    distro,
@@ -246,7 +751,7 @@ func generateSBOM(distro string, version string) (*cyclonedx.BOM, error) {
 			BOMRef:  "CDXRef-DOCUMENT",
 			ExternalReferences: &[]cyclonedx.ExternalReference{
 				{
-					URL:     "https://www." + strings.ToLower(distro) + ".com/",
+					URL:     osHomePage(ctx, distro, options.Runner),
 					Type:    cyclonedx.ERTypeWebsite,
 					Comment: "Home page for project",
 				},
@@ -256,117 +761,175 @@ func generateSBOM(distro string, version string) (*cyclonedx.BOM, error) {
 
 	// Create a root component for the entire system or project
 	rootComponent := cyclonedx.Component{
-		Type:    cyclonedx.ComponentTypeApplication,
-		Name:    "RootComponent",
-		Version: version,
+		Type:    cyclonedx.ComponentType(options.Component.Type),
+		Name:    options.Component.Name,
+		Version: options.Component.Version,
 		BOMRef:  "CDXRef-RootComponent",
 	}
+	if rootComponent.Type == "" {
+		rootComponent.Type = cyclonedx.ComponentTypeApplication
+	}
+	if rootComponent.Name == "" {
+		rootComponent.Name = defaultComponentName
+	}
+	if rootComponent.Version == "" {
+		rootComponent.Version = defaultComponentVersion
+	}
 
 	// Determine package manager
-	var packageManager string
-	switch strings.ToLower(distro) {
-	case "ubuntu", "debian":
-		packageManager = "dpkg"
-	case "alpine":
-		packageManager = "apk"
-	case "centos", "fedora", "rhel", "opensuse", "rocky":
-		packageManager = "rpm"
-	default:
-		return nil, fmt.Errorf("unsupported distribution: %s", distro)
+	packageManager, err := packageManagerFor(distro)
+	if err != nil {
+		return nil, err
 	}
 
-	// Retrieve installed packages
-	packages, err := listPackages(packageManager)
+	source, err := resolveSource(ctx, options.Source, packageManager, runnerOrLocal(options.Runner))
 	if err != nil {
-		return nil, fmt.Errorf("error listing packages: %v", err)
+		return nil, err
 	}
 
-	components := []cyclonedx.Component{rootComponent}
-	componentMap := make(map[string]string)
-
-	for i, pkg := range packages {
-		bomRef := fmt.Sprintf("%d-%s", i+1, pkg.Name)
-		licenses := FetchPackageLicense(packageManager, pkg.Name)
-
-		// Construct CPE
-		cpe := fmt.Sprintf("cpe:2.3:a:%s:%s:%s:*:*:*:*:*:*:*", strings.ReplaceAll(distro, " ", "_"), pkg.Name, pkg.Version)
-
-		// Construct External References
-		externalRefs := []cyclonedx.ExternalReference{
-			{
-				URL:     "https://packages." + strings.ToLower(distro) + ".org/" + pkg.Name,
-				Type:    cyclonedx.ERTypeDistribution,
-				Comment: "Package distribution reference",
-			},
+	// Collect the packages in the order of the listing
+	p := newPipeline(ctx, distro, packageManager, source, options)
+	var items []*pipelineItem
+	for item := range p.run() {
+		items = append(items, item)
+	}
+	timedOut, warnings, err := p.wait()
+	if err != nil {
+		return nil, err
+	}
+	if options.Baseline != nil {
+		slog.Info("Copied unchanged packages from baseline", "packages", p.count("baseline"), "queried", len(items)-p.count("baseline"))
+	}
+	if options.Cache != nil {
+		slog.Info("Used cached package data", "licenses", p.count("cached licenses"), "dependencies", p.count("cached dependencies"))
+	}
+	if options.MultiArch == multiArchMerge {
+		var merged int
+		items, merged = mergeMultiArch(items, p.builder)
+		if merged > 0 {
+			slog.Info("Merged packages installed for several architectures", "packages", merged)
 		}
+	}
 
-		// Build License struct
-		licenseChoices := cyclonedx.Licenses{}
-		for _, license := range licenses {
-			if license != "UNKNOWN" {
-				licenseChoices = append(licenseChoices, cyclonedx.LicenseChoice{
-					License: &cyclonedx.License{
-						ID:              license,
-						URL:             "https://spdx.org/licenses/" + license + ".html",
-						Acknowledgement: cyclonedx.LicenseAcknowledgementConcluded,
-					},
-				})
+	var collectorWarnings []string
+	// Image based systems distinguish the packages of the image from those layered on it
+	var deploymentProperties []cyclonedx.Property
+	if packageManager == "rpm" {
+		deploymentProperties, err = collectRPMOSTree(ctx, options, items)
+		if err != nil {
+			if options.Strict {
+				return nil, err
 			}
+			slog.Warn("rpm-ostree collector failed, base and layered packages are not marked", "error", err)
+			collectorWarnings = append(collectorWarnings, "rpm-ostree: "+err.Error())
 		}
+	}
+	if slices.Contains(options.Include, includeRuntime) {
+		runtimeStart := time.Now()
+		if err := collectRuntime(ctx, packageManager, options, items); err != nil {
+			if options.Strict {
+				return nil, err
+			}
+			slog.Warn("Runtime collector failed, running packages are not marked", "error", err)
+			collectorWarnings = append(collectorWarnings, "runtime: "+err.Error())
+		}
+		options.Timings.phase("runtime", time.Since(runtimeStart))
+	}
 
-		// Get supplier information based on the distribution
-		supplier := supplierInfo[strings.ToLower(distro)]
+	// Plugin components follow the packages, so that they can depend on them
+	pluginStart := time.Now()
+	pluginItems, pluginWarnings, err := collectPlugins(ctx, distro, options, len(items))
+	if err != nil {
+		return nil, err
+	}
+	pluginWarnings = append(collectorWarnings, pluginWarnings...)
+	options.Timings.phase("plugins", time.Since(pluginStart))
+	items = append(items, pluginItems...)
 
-		component := cyclonedx.Component{
-			Type:               cyclonedx.ComponentTypeLibrary,
-			Name:               pkg.Name,
-			Version:            pkg.Version,
-			BOMRef:             bomRef,
-			Supplier:           &supplier,
-			PackageURL:         fmt.Sprintf("pkg:%s/%s@%s", packageManager, pkg.Name, pkg.Version),
-			CPE:                cpe,
-			ExternalReferences: &externalRefs,
-			Licenses:           &licenseChoices,
+	var collectorItems []*pipelineItem
+	for _, name := range options.Include {
+		collector, ok := packageCollectors[name]
+		if !ok {
+			continue
 		}
-
-		components = append(components, component)
-		componentMap[pkg.Name] = bomRef
+		collectorStart := time.Now()
+		collected, err := collector.collect(ctx, packageManager, options, items, len(items)+len(collectorItems))
+		if err != nil {
+			if options.Strict {
+				return nil, err
+			}
+			slog.Warn("Collector failed, continuing without its packages", "collector", name, "error", err)
+			pluginWarnings = append(pluginWarnings, name+": "+err.Error())
+		}
+		collectorItems = append(collectorItems, collected...)
+		options.Timings.phase(name, time.Since(collectorStart))
 	}
+	items = append(items, collectorItems...)
 
+	// Encode the components and their dependencies
+	encodeStart := time.Now()
+	defer func() { options.Timings.phase("encoding", time.Since(encodeStart)) }()
+	var components []cyclonedx.Component
+	product := ""
+	switch {
+	case options.DependencyRoot == dependencyRootComponent:
+		components = append(components, rootComponent)
+	case rootComponent.Name != defaultComponentName:
+		// The product or appliance the host is part of contains the operating system
+		components = append(components, rootComponent)
+		product = rootComponent.BOMRef
+	}
+	itemMap := make(map[string]*pipelineItem)
+	for _, item := range items {
+		// Components with the same identity, e.g. plugin components without purl
+		// reported twice, are numbered in listing order to keep their bom-refs unique
+		ref := item.component.BOMRef
+		for n := 2; itemMap[item.component.BOMRef] != nil; n++ {
+			item.component.BOMRef = ref + "#" + strconv.Itoa(n)
+		}
+		components = append(components, item.component)
+		itemMap[item.component.BOMRef] = item
+	}
 	bom.Components = &components
+	// Collected packages, e.g. Homebrew formulae, resolve their dependencies among
+	// themselves, packages and plugin components depending on e.g. zlib mean the package of
+	// the distribution
+	componentIndex := newComponentIndex(items[:len(items)-len(collectorItems)])
+	if packageManager == "apk" && !options.SkipDependencies {
+		providers, err := apkProviders(ctx, runnerOrLocal(options.Runner))
+		if err != nil {
+			slog.Warn("Error reading the capabilities of the apk packages, dependencies on shared libraries and commands are left out", "error", err)
+		}
+		componentIndex.providers = providers
+	}
 
-	// Process Dependencies
 	bomDependencies := []cyclonedx.Dependency{
 		{
 			Ref:          "CDXRef-DOCUMENT",
 			Dependencies: &[]string{},
 		},
 	}
-	packageNames := make([]string, len(components))
-	for i, comp := range components {
-		packageNames[i] = comp.Name
-	}
-
-	filteredPackageNames := []string{}
-	for _, pkg := range packageNames {
-		if pkg != "RootComponent" {
-			filteredPackageNames = append(filteredPackageNames, pkg)
-		}
-	}
-
-	dependencyMap, err := GetDependencies(packageManager, filteredPackageNames)
-	if err != nil {
-		log.Fatalf("Error getting dependencies: %v", err)
-		return nil, fmt.Errorf("error getting dependencies: %v", err)
+	if product != "" {
+		bomDependencies = append(bomDependencies, cyclonedx.Dependency{
+			Ref:          product,
+			Dependencies: &[]string{"CDXRef-DOCUMENT"},
+		})
 	}
-
 	for _, comp := range components {
-		deps := dependencyMap[comp.Name]
+		if comp.BOMRef == product {
+			continue
+		}
 		depSet := make(map[string]struct{})
-		for _, dep := range deps {
-			if ref, exists := componentMap[dep]; exists {
+		if item, ok := itemMap[comp.BOMRef]; ok {
+			for _, ref := range item.dependencyRefs {
 				depSet[ref] = struct{}{}
 			}
+			for _, dep := range item.dependencies {
+				// Packages providing their own requirements do not depend on themselves
+				if ref, exists := componentIndex.resolve(dep, item.arch); exists && ref != comp.BOMRef {
+					depSet[ref] = struct{}{}
+				}
+			}
 		}
 
 		depRefs := []string{}
@@ -381,17 +944,253 @@ func generateSBOM(distro string, version string) (*cyclonedx.BOM, error) {
 			})
 		}
 
-		// Link all components as dependencies of the root component
+		// Link all components as dependencies of the operating system
 		rootDeps := *bomDependencies[0].Dependencies
 		rootDeps = append(rootDeps, comp.BOMRef)
 		bomDependencies[0].Dependencies = &rootDeps
 	}
 
 	bom.Dependencies = &bomDependencies
+	annotate(bom, options.Annotations)
+	applyProfile(options.Profile, bom)
+
+	if len(timedOut) > 0 {
+		slog.Warn("Package manager commands timed out, these packages are incomplete in the SBOM", "timeout", options.CommandTimeout, "packages", timedOut)
+	}
+	// The summary travels with the SBOM, the affected components carry the warning themselves
+	// and failed plugins and collectors, which have no components, are listed in the metadata
+	if len(warnings) > 0 || len(pluginWarnings) > 0 {
+		if len(warnings) > 0 {
+			slog.Warn("Package manager commands failed, these packages are incomplete in the SBOM", "count", len(warnings), "packages", warnings)
+		}
+		properties := []cyclonedx.Property{
+			{Name: "distro2sbom:warnings", Value: strconv.Itoa(len(warnings) + len(pluginWarnings))},
+		}
+		for _, warning := range pluginWarnings {
+			properties = append(properties, cyclonedx.Property{Name: warningProperty, Value: warning})
+		}
+		bom.Metadata.Properties = &properties
+	}
+	if len(options.Metadata.Properties) > 0 || len(deploymentProperties) > 0 {
+		var properties []cyclonedx.Property
+		if bom.Metadata.Properties != nil {
+			properties = *bom.Metadata.Properties
+		}
+		properties = append(properties, deploymentProperties...)
+		properties = append(properties, options.Metadata.Properties...)
+		bom.Metadata.Properties = &properties
+	}
 
 	return bom, nil
 }
 
+// componentBuilder builds the components of the installed packages of a distribution.
+//
+// Every component references the same supplier and the strings repeated across packages,
+// e.g. license URLs and architectures, are interned, so that hosts with thousands of
+// packages do not hold a copy per component. It is safe for concurrent use.
+type componentBuilder struct {
+	// purlType is the package URL type of the packages, e.g. deb.
+	purlType string
+	// purlNamespace is the distribution as package URL namespace.
+	purlNamespace string
+	// cpeVendor is the CPE vendor of the distribution, e.g. canonical for Ubuntu, empty for
+	// packages without CPE.
+	cpeVendor string
+	// distributionURL is the URL the package name is appended to for its distribution reference,
+	// empty for packages without one.
+	distributionURL string
+	supplier        *cyclonedx.OrganizationalEntity
+
+	mu      sync.Mutex
+	strings map[string]string
+}
+
+// newComponentBuilder creates the builder of the components of a distribution.
+//
+// Parameters:
+// - distro: the name of the Linux distribution, derivatives get the CPE vendor and
+// distribution reference of their parent.
+// - packageManager: the package manager the packages are installed with.
+// - supplier: the supplier of the packages.
+//
+// Returns:
+// - *componentBuilder: the builder.
+func newComponentBuilder(distro, packageManager string, supplier *cyclonedx.OrganizationalEntity) *componentBuilder {
+	builder := &componentBuilder{
+		purlType:        purlTypeFor(packageManager),
+		purlNamespace:   purlNamespaceFor(distro),
+		cpeVendor:       cpeVendorFor(upstreamDistro(distro)),
+		distributionURL: "https://packages." + strings.ToLower(upstreamDistro(distro)) + ".org/",
+		supplier:        supplier,
+		strings:         make(map[string]string),
+	}
+	if packageManager == "windows" {
+		// Programs registered with Windows come from their publishers, not from Microsoft
+		builder.cpeVendor = ""
+		builder.distributionURL = ""
+	}
+	return builder
+}
+
+// intern returns the stored copy of a string, storing it on first use.
+func (b *componentBuilder) intern(value string) string {
+	if value == "" {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if interned, ok := b.strings[value]; ok {
+		return interned
+	}
+	b.strings[value] = value
+	return value
+}
+
+// component builds the component of an installed package.
+//
+// Parameters:
+// - pkg: the package as listed by the package manager.
+// - licenses: the SPDX license identifiers of the package.
+//
+// Returns:
+// - cyclonedx.Component: the component of the package.
+func (b *componentBuilder) component(pkg installedPackage, licenses []string) cyclonedx.Component {
+	name, version := pkg.name, pkg.version
+
+	// Construct CPE
+	var cpe string
+	if b.cpeVendor != "" {
+		cpe = formatCPE(cpePartApplication, b.cpeVendor, name, version)
+	}
+
+	// Construct External References
+	var externalRefs *[]cyclonedx.ExternalReference
+	if b.distributionURL != "" {
+		externalRefs = &[]cyclonedx.ExternalReference{
+			{
+				URL:     b.distributionURL + name,
+				Type:    cyclonedx.ERTypeDistribution,
+				Comment: "Package distribution reference",
+			},
+		}
+	}
+
+	// Build License struct
+	licenseChoices := cyclonedx.Licenses{}
+	for _, license := range licenses {
+		if license != "UNKNOWN" {
+			licenseChoices = append(licenseChoices, cyclonedx.LicenseChoice{
+				License: &cyclonedx.License{
+					ID:              b.intern(license),
+					URL:             b.intern("https://spdx.org/licenses/" + license + ".html"),
+					Acknowledgement: cyclonedx.LicenseAcknowledgementConcluded,
+				},
+			})
+		}
+	}
+
+	// Fields only some package managers list, e.g. rpm
+	var properties *[]cyclonedx.Property
+	if pkg.arch != "" || pkg.vendor != "" || pkg.sourcePackage != "" || !pkg.buildTime.IsZero() {
+		packageProperties := []cyclonedx.Property{}
+		if pkg.arch != "" {
+			packageProperties = append(packageProperties, cyclonedx.Property{Name: archProperty, Value: b.intern(pkg.arch)})
+		}
+		if pkg.vendor != "" {
+			packageProperties = append(packageProperties, cyclonedx.Property{Name: "distro2sbom:package:vendor", Value: b.intern(pkg.vendor)})
+		}
+		if pkg.sourcePackage != "" {
+			packageProperties = append(packageProperties, cyclonedx.Property{Name: "distro2sbom:package:source", Value: pkg.sourcePackage})
+		}
+		if !pkg.buildTime.IsZero() {
+			packageProperties = append(packageProperties, cyclonedx.Property{Name: "distro2sbom:package:buildtime", Value: pkg.buildTime.UTC().Format(time.RFC3339)})
+		}
+		properties = &packageProperties
+	}
+
+	purl := b.purl(pkg)
+	return cyclonedx.Component{
+		Type:               cyclonedx.ComponentTypeLibrary,
+		Name:               name,
+		Version:            version,
+		BOMRef:             purl,
+		Supplier:           b.supplier,
+		PackageURL:         purl,
+		CPE:                cpe,
+		ExternalReferences: externalRefs,
+		Licenses:           &licenseChoices,
+		Properties:         properties,
+	}
+}
+
+// purl returns the package URL of a package, with the architecture as qualifier if it is
+// known, so that the components of a multi-arch package stay distinct.
+func (b *componentBuilder) purl(pkg installedPackage) string {
+	return formatPURL(b.purlType, b.purlNamespace, pkg.name, pkg.version, map[string]string{"arch": pkg.arch})
+}
+
+// stableBOMRef returns the bom-ref of a component, which stays the same across SBOMs of
+// the same packages, so that other SBOMs and VEX documents can reference the component.
+//
+// Parameters:
+// - purl: the package URL of the component, the bom-ref if set.
+// - name: the name of the component.
+// - version: the version of the component.
+// - arch: the architecture of the component, empty if unknown.
+//
+// Returns:
+// - string: the purl, or a hash of name, version and architecture for components without purl.
+func stableBOMRef(purl, name, version, arch string) string {
+	if purl != "" {
+		return purl
+	}
+	sum := sha256.Sum256([]byte(name + "\x00" + version + "\x00" + arch))
+	return "ref-" + hex.EncodeToString(sum[:16])
+}
+
+// packageManagerFor returns the package manager of a distribution.
+//
+// Parameters:
+// - distro: the name of the Linux distribution (e.g., ubuntu, debian)
+//
+// Returns:
+// - string: the package manager, dpkg, apk, rpm, pacman, xbps, nix, swupd, pkgtools, pkg or opkg,
+// windows for the programs registered with Windows. Derivatives registered by
+// registerDerivedDistro use the package manager of their parent.
+// - error: an error if the distribution is not supported.
+func packageManagerFor(distro string) (string, error) {
+	switch strings.ToLower(distro) {
+	case "ubuntu", "debian", "raspbian":
+		return "dpkg", nil
+	case "alpine":
+		return "apk", nil
+	case "centos", "fedora", "rhel", "opensuse", "sles", "rocky", "almalinux", "ol", "eurolinux", "amazonlinux", "photon":
+		return "rpm", nil
+	case "arch", "manjaro":
+		return "pacman", nil
+	case "void":
+		return "xbps", nil
+	case "nixos":
+		return "nix", nil
+	case "clearlinux":
+		return "swupd", nil
+	case "slackware":
+		return "pkgtools", nil
+	case "freebsd":
+		return "pkg", nil
+	case "openwrt":
+		return "opkg", nil
+	case "windows":
+		return "windows", nil
+	default:
+		if parent := parentDistro(distro); parent != "" {
+			return packageManagerFor(parent)
+		}
+		return "", fmt.Errorf("unsupported distribution: %s", distro)
+	}
+}
+
 // parseLicenseInfo parses the output of a package manager command to extract the license information.
 //
 // output is the output of the package manager command.
@@ -407,65 +1206,338 @@ func parseLicenseInfo(output string) string {
 	return ""
 }
 
-// listPackages retrieves a list of packages and their versions.
+// installedPackage is a package as listed by the package manager.
+type installedPackage struct {
+	name    string
+	version string
+	// The remaining fields are only listed by some package managers, rpm lists them all
+	// in the single listing query instead of a query per package.
+	arch          string
+	license       string
+	hasLicense    bool
+	vendor        string
+	sourcePackage string
+	buildTime     time.Time
+	// depends are the names of the packages the package depends on, if hasDependencies is
+	// set, e.g. read from the dpkg status database.
+	depends         []string
+	hasDependencies bool
+	// storePath is the nix store path of the package, which nix queries packages by.
+	storePath string
+}
+
+// key identifies a package by name and architecture, as packages of the same name can be
+// installed for several architectures, e.g. libssl3:amd64 and libssl3:i386. Nix packages are
+// identified by name and version, as a closure holds several versions of a package.
+func (pkg installedPackage) key() string {
+	if pkg.storePath != "" {
+		return pkg.name + "@" + pkg.version
+	}
+	if pkg.arch == "" {
+		return pkg.name
+	}
+	return pkg.name + ":" + pkg.arch
+}
+
+// queryName returns the name the package manager is queried with for a package, qualified
+// with its architecture, so that the query matches the listed package on multi-arch systems.
+//
+// packageManager is the package manager used.
+// Returns name:arch for dpkg, name.arch for rpm, the store path for nix and the plain name
+// otherwise. Packages without architecture and dpkg packages of architecture all, which dpkg
+// does not accept qualified, are queried by their name.
+func (pkg installedPackage) queryName(packageManager string) string {
+	if packageManager == "nix" {
+		return pkg.storePath
+	}
+	if pkg.arch == "" {
+		return pkg.name
+	}
+	switch packageManager {
+	case "dpkg":
+		if pkg.arch == "all" {
+			return pkg.name
+		}
+		return pkg.name + ":" + pkg.arch
+	case "rpm", "dnf", "yum", "tdnf":
+		return pkg.name + "." + pkg.arch
+	default:
+		return pkg.name
+	}
+}
+
+// splitPackageArch splits the architecture qualifier off a dpkg package name, e.g.
+// libssl3:amd64 into libssl3 and amd64.
+//
+// name is the package name, with or without qualifier.
+// Returns the name and the architecture, empty if the name has no qualifier.
+func splitPackageArch(name string) (string, string) {
+	name, arch, _ := strings.Cut(name, ":")
+	return name, arch
+}
+
+// rpmListFormat is the query format of the rpm listing, the fields are separated by tabs.
+const rpmListFormat = "%{NAME}\t%{VERSION}-%{RELEASE}\t%{ARCH}\t%{LICENSE}\t%{VENDOR}\t%{SOURCERPM}\t%{BUILDTIME}\n"
+
+// listPackagesCommand returns the command listing the installed packages and their versions.
 //
 // packageManager is the package manager to use.
-// Returns a slice of structs containing the package name and version, and an error.
-func listPackages(packageManager string) ([]struct {
-	Name    string
-	Version string
-}, error) {
-	var cmd *exec.Cmd
+// Returns the command and its arguments, and an error if the package manager is not supported.
+func listPackagesCommand(packageManager string) ([]string, error) {
 	switch packageManager {
 	case "dpkg":
-		cmd = exec.Command("dpkg-query", "-W", "-f=${Package} ${Version}\n")
+		return []string{"dpkg-query", "-W", "-f=${Package} ${Version} ${Architecture}\n"}, nil
 	case "apk":
-		cmd = exec.Command("apk", "info", "-v")
+		return []string{"apk", "info", "-v"}, nil
 	case "rpm":
-		cmd = exec.Command("rpm", "-qa", "--qf", "%{NAME} %{VERSION}-%{RELEASE}\n")
+		return []string{"rpm", "-qa", "--qf", rpmListFormat}, nil
+	case "pacman":
+		return []string{"pacman", "-Qi"}, nil
+	case "xbps":
+		return []string{"xbps-query", "-l"}, nil
+	case "nix":
+		return []string{"nix-store", "--query", "--requisites", nixSystemProfile}, nil
+	case "swupd":
+		return []string{"sh", "-c", swupdBundlesScript}, nil
+	case "pkgtools":
+		return []string{"sh", "-c", pkgtoolsListScript}, nil
+	case "pkg":
+		return []string{"pkg", "query", "%n %v %q"}, nil
+	case "opkg":
+		return []string{"opkg", "list-installed"}, nil
+	case "windows":
+		return powershellCommand(windowsUninstallScript), nil
 	default:
 		return nil, fmt.Errorf("unsupported package manager: %s", packageManager)
 	}
+}
 
-	output, err := cmd.Output()
+// listPackages streams the installed packages.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills the package manager command.
+// - runner: runs the package manager on the scanned system.
+// - packageManager: the package manager to use.
+// - maxLineSize: the longest line of the listing that is accepted, 0 for defaultMaxLineSize.
+// - emit: called with every package as the package manager prints it.
+//
+// Returns:
+// - error: an error if the packages cannot be listed.
+func listPackages(ctx context.Context, runner Runner, packageManager string, maxLineSize int, emit func(pkg installedPackage)) error {
+	args, err := listPackagesCommand(packageManager)
 	if err != nil {
-		return nil, fmt.Errorf("error executing command: %v", err)
+		return err
 	}
 
-	var packages []struct {
-		Name    string
-		Version string
+	// pacman prints a block of fields per package with its licenses and dependencies
+	pacman := &pacmanInfoParser{emit: emit}
+	// The closure of a NixOS system holds the outputs of a package as separate store paths,
+	// e.g. -bin and -man, and paths of the system configuration without version
+	listed := make(map[string]bool)
+	err = streamCommand(ctx, runner, args, maxLineSize, func(line string) {
+		if packageManager == "nix" {
+			name, version, ok := parseNixStorePath(line)
+			pkg := installedPackage{name: name, version: version, storePath: line}
+			if ok && version != "" && !listed[pkg.key()] {
+				listed[pkg.key()] = true
+				emit(pkg)
+			}
+			return
+		}
+		if packageManager == "rpm" {
+			if pkg, ok := parseRPMListLine(line); ok {
+				emit(pkg)
+			}
+			return
+		}
+		if packageManager == "pacman" {
+			pacman.parse(line)
+			return
+		}
+		if packageManager == "windows" {
+			// Program names contain spaces, e.g. 7-Zip 23.01 (x64)
+			if pkg, ok := parseWindowsUninstallLine(line); ok {
+				emit(pkg)
+			}
+			return
+		}
+		parts := strings.Fields(line)
+		switch {
+		case packageManager == "dpkg" && len(parts) == 3:
+			// Multi-arch names may carry the qualifier already, e.g. ${binary:Package}
+			name, _ := splitPackageArch(parts[0])
+			emit(installedPackage{name: name, version: parts[1], arch: parts[2]})
+		case packageManager == "xbps" && len(parts) >= 2:
+			// ii bash-5.2.21_1 GNU Bourne Again Shell
+			if name, version, ok := splitPkgver(parts[1]); ok {
+				emit(installedPackage{name: name, version: version})
+			}
+		case packageManager == "apk" && len(parts) == 1:
+			// apk info -v prints name and version as one word, e.g. busybox-1.36.1-r5
+			if name, version, ok := splitAPKPackage(parts[0]); ok {
+				emit(installedPackage{name: name, version: version})
+			}
+		case packageManager == "pkg" && len(parts) == 3:
+			// The ABI of the package, e.g. FreeBSD:14:amd64, ends with the architecture, *
+			// for packages of every architecture
+			abi := strings.Split(parts[2], ":")
+			arch := abi[len(abi)-1]
+			if arch == "*" {
+				arch = ""
+			}
+			emit(installedPackage{name: parts[0], version: parts[1], arch: arch})
+		case packageManager == "opkg" && len(parts) == 3 && parts[1] == "-":
+			// busybox - 1.36.1-1
+			emit(installedPackage{name: parts[0], version: parts[2]})
+		case packageManager == "pkgtools" && len(parts) == 1:
+			if pkg, ok := parsePkgtoolsName(parts[0]); ok {
+				emit(pkg)
+			}
+		case len(parts) == 2:
+			emit(installedPackage{name: parts[0], version: parts[1]})
+		}
+	})
+	if err != nil {
+		return err
 	}
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	pacman.flush()
+	return nil
+}
+
+// defaultMaxLineSize is the longest line of command output accepted by default.
+const defaultMaxLineSize = 16 << 20
+
+// streamCommand runs a command and processes its output line by line while it runs, so
+// that huge outputs such as the listing of every package are never buffered whole.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills the command.
+// - runner: runs the command on the scanned system.
+// - args: the command and its arguments.
+// - maxLineSize: the longest line that is accepted, only as much of the buffer is
+// allocated as the longest line needs. 0 for defaultMaxLineSize.
+// - fn: called with every line of the output without the line ending.
+//
+// Returns:
+// - error: an error if the command fails, with its stderr, or a line exceeds maxLineSize.
+func streamCommand(ctx context.Context, runner Runner, args []string, maxLineSize int, fn func(line string)) error {
+	if maxLineSize <= 0 {
+		maxLineSize = defaultMaxLineSize
+	}
+	cmd := runner.Command(ctx, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error executing command: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error executing command: %v", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, min(64*1024, maxLineSize)), maxLineSize)
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		parts := strings.Fields(line)
-		if len(parts) == 2 {
-			packages = append(packages, struct {
-				Name    string
-				Version string
-			}{
-				Name:    parts[0],
-				Version: parts[1],
-			})
+		fn(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		// The rest of the output is not read, so the command would block writing it
+		cmd.Process.Kill()
+		cmd.Wait()
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("error reading command output: line longer than %d bytes, raise --max-line-size", maxLineSize)
+		}
+		return fmt.Errorf("error reading command output: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		if stderr.Len() > 0 {
+			return fmt.Errorf("error executing command: %w, stderr: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return fmt.Errorf("error executing command: %w", err)
+	}
+	return nil
+}
+
+// parseRPMListLine parses a line of the rpm listing in rpmListFormat.
+//
+// Parameters:
+// - line: the line printed by rpm.
+//
+// Returns:
+// - installedPackage: the package, rpm prints (none) for unset fields, which are left empty.
+// - bool: whether the line is a package.
+func parseRPMListLine(line string) (installedPackage, bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 7 || fields[0] == "" {
+		return installedPackage{}, false
+	}
+	for i, field := range fields {
+		if field == "(none)" {
+			fields[i] = ""
 		}
 	}
 
-	return packages, nil
+	pkg := installedPackage{
+		name:          fields[0],
+		version:       fields[1],
+		arch:          fields[2],
+		license:       fields[3],
+		hasLicense:    true,
+		vendor:        fields[4],
+		sourcePackage: fields[5],
+	}
+	if buildTime, err := strconv.ParseInt(fields[6], 10, 64); err == nil {
+		pkg.buildTime = time.Unix(buildTime, 0)
+	}
+	return pkg, true
+}
+
+// writeFileAtomic writes a file through a temporary file in the same directory that is
+// renamed over the target, so that an interrupted write never leaves a partial file.
+//
+// Parameters:
+// - path: the file to write.
+// - data: the content of the file.
+// - perm: the permissions of the file.
+//
+// Returns:
+// - error: an error if the file cannot be written.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(perm); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
 }
 
 // getOSVersion retrieves the version of the operating system.
 //
-// The function checks the runtime.GOOS to determine if the operating system is Linux.
-// If it is, it opens the /etc/os-release file and reads its contents.
+// The function checks the runtime.GOOS to determine if the operating system is Linux or
+// FreeBSD, systems scanned through a root file system or SSH are always taken to be.
+// If it is, it opens the /etc/os-release file of the scanned system and reads its contents.
 // It searches for a line that starts with "VERSION_ID=" and returns the version ID.
 // If the file cannot be opened, it executes the "uname -r" command and returns the output.
-// If the operating system is not Linux, it returns the concatenation of runtime.GOOS and runtime.GOARCH.
+// On Windows it returns the build number printed by ver, e.g. 10.0.22631.3880.
+// On other operating systems, it returns the concatenation of runtime.GOOS and runtime.GOARCH.
 //
 // Return type: string.
-func getOSVersion() string {
-	if runtime.GOOS == "linux" {
-		file, err := os.Open("/etc/os-release")
+func getOSVersion(ctx context.Context, runner Runner) string {
+	runner = runnerOrLocal(runner)
+	if _, local := runner.(localRunner); !local || runtime.GOOS == "linux" || runtime.GOOS == "freebsd" {
+		file, err := runner.Open(ctx, "/etc/os-release")
 		if err == nil {
 			defer file.Close()
 			scanner := bufio.NewScanner(file)
@@ -476,11 +1548,18 @@ func getOSVersion() string {
 				}
 			}
 		}
-		cmd := exec.Command("uname", "-r")
+		cmd := runner.Command(ctx, "uname", "-r")
 		output, err := cmd.Output()
 		if err == nil {
 			return strings.TrimSpace(string(output))
 		}
+	} else if runtime.GOOS == "windows" {
+		// Microsoft Windows [Version 10.0.22631.3880]
+		output, err := runner.Command(ctx, "cmd", "/c", "ver").Output()
+		if _, version, ok := strings.Cut(string(output), "[Version "); err == nil && ok {
+			version, _, _ = strings.Cut(version, "]")
+			return version
+		}
 	}
 	return runtime.GOOS + "/" + runtime.GOARCH
 }
@@ -2,11 +2,12 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
-	"os/exec"
 	"strings"
 )
 
@@ -49,6 +50,41 @@ var licenseCorrections = map[string]string{
 	"MIT-1":                    "MIT",
 	"BSD-3-clauses":            "BSD-3-Clause",
 
+	// License names of the FreeBSD ports framework
+	"BSD2CLAUSE": "BSD-2-Clause",
+	"BSD3CLAUSE": "BSD-3-Clause",
+	"BSD4CLAUSE": "BSD-4-Clause",
+	"APACHE10":   "Apache-1.0",
+	"APACHE11":   "Apache-1.1",
+	"APACHE20":   "Apache-2.0",
+	"ART10":      "Artistic-1.0",
+	"ART20":      "Artistic-2.0",
+	"GPLv1":      "GPL-1.0",
+	"GPLv1+":     "GPL-1.0+",
+	"GPLv2":      "GPL-2.0",
+	"GPLv2+":     "GPL-2.0+",
+	"GPLv3":      "GPL-3.0",
+	"GPLv3+":     "GPL-3.0+",
+	"GPLv3RLE":   "GPL-3.0-with-GCC-exception",
+	"AGPLv3":     "AGPL-3.0",
+	"AGPLv3+":    "AGPL-3.0-or-later",
+	"LGPL20":     "LGPL-2.0",
+	"LGPL20+":    "LGPL-2.0+",
+	"LGPL21":     "LGPL-2.1",
+	"LGPL21+":    "LGPL-2.1+",
+	"LGPL3":      "LGPL-3.0",
+	"LGPL3+":     "LGPL-3.0+",
+	"MPL10":      "MPL-1.0",
+	"MPL11":      "MPL-1.1",
+	"MPL20":      "MPL-2.0",
+	"CDDL":       "CDDL-1.0",
+	"ISCL":       "ISC",
+	"PSFL":       "PSF-2.0",
+	"PHP301":     "PHP-3.01",
+	"RUBY":       "Ruby",
+	"ZLIB":       "Zlib",
+	"UNLICENSE":  "Unlicense",
+
 	// Add more corrections as needed
 }
 
@@ -83,7 +119,7 @@ func loadSPDXSchema(schemaPath string) error {
 	}
 
 	spdxLicenses = make(map[string]struct{})
-	fmt.Println("Parsing SPDX schema...")
+	slog.Debug("Parsing SPDX schema", "path", schemaPath)
 
 	for _, license := range schema.Enum {
 		//fmt.Printf("Loaded license: %s\n", license)
@@ -91,45 +127,151 @@ func loadSPDXSchema(schemaPath string) error {
 	}
 
 	// Log the loaded SPDX licenses for debugging
-	fmt.Printf("Loaded %d SPDX licenses\n", len(spdxLicenses))
+	slog.Debug("Loaded SPDX licenses", "count", len(spdxLicenses))
 
 	return nil
 }
 
 // FetchPackageLicense retrieves the license of a package.
 //
+// ctx cancels the package manager query.
+// runner runs the query on the scanned system.
 // packageManager is the package manager used.
-// packageName is the name of the package.
+// pkg is the package, queried with its architecture.
 // Returns a slice of strings representing the licenses of the package.
-func FetchPackageLicense(packageManager, packageName string) []string {
-	var cmd *exec.Cmd
-	switch packageManager {
-	case "dpkg":
-		cmd = exec.Command("dpkg-query", "-W", "-f=${License}", packageName)
-	case "apk":
-		cmd = exec.Command("apk", "info", "-L", packageName)
-	case "rpm":
-		cmd = exec.Command("rpm", "-q", "--qf", "%{LICENSE}", packageName)
-	default:
-		return correctLicenses(fallbackFetchLicense(packageName))
+func FetchPackageLicense(ctx context.Context, runner Runner, packageManager string, pkg installedPackage) []string {
+	packageName := pkg.name
+	args := licenseCommand(packageManager, pkg.queryName(packageManager))
+	if args == nil {
+		return correctLicenses(fallbackFetchLicense(ctx, runner, packageName))
 	}
 
-	output, err := cmd.Output()
+	output, err := runner.Command(ctx, args...).Output()
 	if err != nil || len(output) == 0 {
 		// Fallback method
-		licenses := fallbackFetchLicense(packageName)
+		licenses := fallbackFetchLicense(ctx, runner, packageName)
 		return correctLicenses(licenses)
 	}
 
 	licenses := strings.TrimSpace(string(output))
+	if packageManager == "apk" {
+		licenses = apkLicense(licenses)
+		if licenses == "" {
+			return correctLicenses(fallbackFetchLicense(ctx, runner, packageName))
+		}
+	}
+	if packageManager == "opkg" {
+		licenses = parseLicenseInfo(licenses)
+		if licenses == "" {
+			return correctLicenses(fallbackFetchLicense(ctx, runner, packageName))
+		}
+	}
+	if packageManager == "pacman" {
+		// pacman has no query for a single field
+		licenses = pacmanInfoField(licenses, "Licenses")
+		if licenses == "" {
+			return correctLicenses(fallbackFetchLicense(ctx, runner, packageName))
+		}
+	}
 	return correctLicenses(licenses)
 }
 
+// bulkLicenseCommand returns the command querying the licenses of all installed packages
+// in a single invocation, printing the name, architecture and license of a package per
+// line separated by tabs.
+//
+// packageManager is the package manager used.
+// Returns the command and its arguments, or nil if the package manager has no bulk query.
+func bulkLicenseCommand(packageManager string) []string {
+	switch packageManager {
+	case "dpkg":
+		return []string{"dpkg-query", "-W", "-f=${Package}\t${Architecture}\t${License}\n"}
+	default:
+		// rpm and pacman list the licenses with the packages
+		return nil
+	}
+}
+
+// fetchLicenses queries the licenses of all installed packages in one package manager call,
+// so that only packages missing from the result are queried one by one.
+//
+// ctx cancels the package manager query.
+// runner runs the query on the scanned system.
+// packageManager is the package manager used.
+// maxLineSize is the longest line of output that is accepted, 0 for defaultMaxLineSize.
+// Returns the license field of every package by its key, name:arch, empty if the package has none, nil
+// if the package manager has no bulk query, and an error if the query fails.
+func fetchLicenses(ctx context.Context, runner Runner, packageManager string, maxLineSize int) (map[string]string, error) {
+	args := bulkLicenseCommand(packageManager)
+	if args == nil {
+		return nil, nil
+	}
+
+	licenses := make(map[string]string)
+	err := streamCommand(ctx, runner, args, maxLineSize, func(line string) {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 || fields[0] == "" {
+			return
+		}
+		pkg := installedPackage{name: fields[0], arch: fields[1]}
+		licenses[pkg.key()] = strings.TrimSpace(fields[2])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return licenses, nil
+}
+
+// listedLicense returns the licenses of a package whose license field is already known
+// from a bulk query or the package listing.
+//
+// Packages with an empty license field are looked up in the common license file locations
+// without querying the package manager again.
+//
+// ctx cancels reading the license files.
+// runner reads the license files of the scanned system.
+// packageName is the name of the package.
+// license is the license field of the package.
+// Returns the licenses of the package.
+func listedLicense(ctx context.Context, runner Runner, packageName, license string) []string {
+	if license == "" {
+		return correctLicenses(fallbackFetchLicense(ctx, runner, packageName))
+	}
+	return correctLicenses(license)
+}
+
+// licenseCommand returns the command querying the license of a package.
+//
+// packageManager is the package manager used.
+// packageName is the name of the package.
+// Returns the command and its arguments, or nil if the package manager has no license query.
+func licenseCommand(packageManager, packageName string) []string {
+	switch packageManager {
+	case "dpkg":
+		return []string{"dpkg-query", "-W", "-f=${License}", packageName}
+	case "apk":
+		return []string{"apk", "info", "--license", packageName}
+	case "rpm":
+		return []string{"rpm", "-q", "--qf", "%{LICENSE}", packageName}
+	case "pacman":
+		return []string{"pacman", "-Qi", packageName}
+	case "xbps":
+		return []string{"xbps-query", "-p", "license", packageName}
+	case "pkg":
+		return []string{"pkg", "query", "%L", packageName}
+	case "opkg":
+		return []string{"opkg", "info", packageName}
+	default:
+		return nil
+	}
+}
+
 // fallbackFetchLicense retrieves the license information of a package from common locations.
 //
-// It takes a package name as a parameter and returns the license information as a string.
+// It takes a package name as a parameter and returns the license information as a string,
+// the files are read from the scanned system through the runner.
 // If the license information is not found in the common locations, it returns "UNKNOWN".
-func fallbackFetchLicense(packageName string) string {
+func fallbackFetchLicense(ctx context.Context, runner Runner, packageName string) string {
 	// Check common locations for license files
 	licensePaths := []string{
 		fmt.Sprintf("/usr/share/doc/%s/copyright", packageName),
@@ -138,7 +280,7 @@ func fallbackFetchLicense(packageName string) string {
 	}
 
 	for _, licensePath := range licensePaths {
-		if content, err := os.ReadFile(licensePath); err == nil {
+		if content, err := readFile(ctx, runner, licensePath); err == nil {
 			scanner := bufio.NewScanner(strings.NewReader(string(content)))
 			for scanner.Scan() {
 				line := strings.TrimSpace(scanner.Text())
@@ -166,7 +308,7 @@ func fallbackFetchLicense(packageName string) string {
 func correctLicenses(licenses string) []string {
 	// Split licenses by common delimiters
 	licenseList := strings.FieldsFunc(licenses, func(r rune) bool {
-		return r == ',' || r == '|' || r == '/' || r == '&' || r == ' ' || r == ';'
+		return r == ',' || r == '|' || r == '/' || r == '&' || r == ' ' || r == ';' || r == '\n' || r == '\t'
 	})
 
 	// Filter out bind words and correct licenses
@@ -185,7 +327,7 @@ func correctLicenses(licenses string) []string {
 			if _, isValid := spdxLicenses[license]; isValid {
 				validLicenses = append(validLicenses, license)
 			} else {
-				fmt.Printf("Invalid license: %s\n", license)
+				slog.Debug("Invalid license", "license", license)
 			}
 		}
 	}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// Publisher publishes SBOMs to a Kafka topic or NATS subject.
+//
+// Target is kafka://broker[,broker...]/topic or nats://host:port/subject (tls:// for NATS
+// over TLS). Payload is "sbom" to publish the document itself, or "pointer" to publish
+// a small SBOMPointer message, for brokers whose message size limit is below the SBOM size.
+// Credentials are read from the user info of the target URL.
+type Publisher struct {
+	Target    string
+	Payload   string
+	TLSVerify bool
+	Timeout   time.Duration
+}
+
+// SBOMPointer is the message published instead of the SBOM in pointer mode.
+type SBOMPointer struct {
+	Hostname     string   `json:"hostname"`
+	Distro       string   `json:"distro"`
+	Timestamp    string   `json:"timestamp"`
+	SerialNumber string   `json:"serialNumber"`
+	SHA256       string   `json:"sha256"`
+	Size         int      `json:"size"`
+	Locations    []string `json:"locations,omitempty"`
+}
+
+// publish sends the SBOM, or a pointer to it, to the configured target.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the publish.
+// - pointer: the pointer message, its digest and size are filled from sbomJSON.
+// - sbomJSON: the SBOM in JSON format.
+//
+// Returns:
+// - error: an error if the target is invalid or the message cannot be published.
+func (p *Publisher) publish(ctx context.Context, pointer SBOMPointer, sbomJSON []byte) error {
+	target, err := url.Parse(p.Target)
+	if err != nil {
+		return fmt.Errorf("invalid publish target %s: %v", p.Target, err)
+	}
+	destination := strings.TrimPrefix(target.Path, "/")
+	if target.Host == "" || destination == "" {
+		return fmt.Errorf("invalid publish target %s, expected scheme://host/topic", p.Target)
+	}
+
+	message := sbomJSON
+	switch p.Payload {
+	case "", "sbom":
+	case "pointer":
+		sum := sha256.Sum256(sbomJSON)
+		pointer.SHA256 = hex.EncodeToString(sum[:])
+		pointer.Size = len(sbomJSON)
+		message, err = json.Marshal(pointer)
+		if err != nil {
+			return fmt.Errorf("error marshaling SBOM pointer: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported publish payload: %s", p.Payload)
+	}
+
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	switch target.Scheme {
+	case "kafka", "kafka+tls":
+		return p.publishKafka(ctx, target, destination, pointer.Hostname, message)
+	case "nats", "tls":
+		return p.publishNATS(ctx, target, destination, message)
+	default:
+		return fmt.Errorf("unsupported publish scheme: %s", target.Scheme)
+	}
+}
+
+// publishKafka writes a message keyed by hostname to a Kafka topic.
+func (p *Publisher) publishKafka(ctx context.Context, target *url.URL, topic, key string, message []byte) error {
+	transport := &kafka.Transport{}
+	if target.Scheme == "kafka+tls" {
+		transport.TLS = &tls.Config{InsecureSkipVerify: !p.TLSVerify}
+	}
+	if target.User != nil {
+		password, _ := target.User.Password()
+		transport.SASL = plain.Mechanism{Username: target.User.Username(), Password: password}
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(target.Host, ",")...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchBytes:   int64(len(message)) + 1024,
+		Transport:    transport,
+	}
+	defer writer.Close()
+
+	if err := writer.WriteMessages(ctx, kafka.Message{Key: []byte(key), Value: message}); err != nil {
+		return fmt.Errorf("error writing to Kafka topic %s: %v", topic, err)
+	}
+	return nil
+}
+
+// publishNATS publishes a message to a NATS subject using the NATS client protocol.
+func (p *Publisher) publishNATS(ctx context.Context, target *url.URL, subject string, message []byte) error {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", target.Host)
+	if err != nil {
+		return fmt.Errorf("error connecting to NATS: %v", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected NATS greeting: %q", line)
+	}
+	var info struct {
+		MaxPayload  int  `json:"max_payload"`
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+	if info.MaxPayload > 0 && len(message) > info.MaxPayload {
+		return fmt.Errorf("SBOM of %d bytes exceeds the NATS max_payload of %d bytes, publish a pointer instead", len(message), info.MaxPayload)
+	}
+
+	if target.Scheme == "tls" || info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: target.Hostname(), InsecureSkipVerify: !p.TLSVerify})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("error establishing TLS with NATS: %v", err)
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	connect := map[string]any{"verbose": false, "pedantic": false, "name": "distro2sbom", "lang": "go", "version": "1"}
+	if target.User != nil {
+		if password, ok := target.User.Password(); ok {
+			connect["user"] = target.User.Username()
+			connect["pass"] = password
+		} else {
+			connect["auth_token"] = target.User.Username()
+		}
+	} else if token := os.Getenv("NATS_TOKEN"); token != "" {
+		connect["auth_token"] = token
+	}
+	connectJSON, _ := json.Marshal(connect)
+
+	fmt.Fprintf(conn, "CONNECT %s\r\nPUB %s %d\r\n", connectJSON, subject, len(message))
+	conn.Write(message)
+	fmt.Fprint(conn, "\r\nPING\r\n")
+
+	// The server answers PING with PONG once all previous commands are processed
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("error reading NATS response: %v", err)
+		}
+		switch {
+		case strings.HasPrefix(line, "PONG"):
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+	"github.com/spf13/viper"
+)
+
+// OrganizationConfig is an organization in the configuration file, e.g.
+//
+//	name: Acme Corp
+//	url:
+//	  - https://acme.example
+//	contact:
+//	  - name: Product Security
+//	    email: psirt@acme.example
+type OrganizationConfig struct {
+	Name    string          `mapstructure:"name"`
+	URL     []string        `mapstructure:"url"`
+	Contact []ContactConfig `mapstructure:"contact"`
+}
+
+// ContactConfig is a person or mailbox in the configuration file.
+type ContactConfig struct {
+	Name  string `mapstructure:"name"`
+	Email string `mapstructure:"email"`
+	Phone string `mapstructure:"phone"`
+}
+
+// MetadataConfig is the SBOM metadata set in the configuration file.
+type MetadataConfig struct {
+	// Suppliers override or extend the suppliers of the packages of a distribution, by
+	// lowercase distribution name.
+	Suppliers map[string]*cyclonedx.OrganizationalEntity
+	// Supplier is the organization supplying the SBOM, usually the one running distro2sbom.
+	Supplier *cyclonedx.OrganizationalEntity
+	// Manufacturer is the organization that built the system the SBOM describes.
+	Manufacturer *cyclonedx.OrganizationalEntity
+	// Authors are the people or mailboxes responsible for the SBOM.
+	Authors *[]cyclonedx.OrganizationalContact
+	// Properties are added to the properties of the SBOM metadata, e.g. the compliance
+	// framework references of --compliance-tags.
+	Properties []cyclonedx.Property
+}
+
+// entity converts the organization to CycloneDX.
+//
+// Returns:
+// - *cyclonedx.OrganizationalEntity: the organization, nil if nothing is set.
+func (o OrganizationConfig) entity() *cyclonedx.OrganizationalEntity {
+	if o.Name == "" && len(o.URL) == 0 && len(o.Contact) == 0 {
+		return nil
+	}
+	entity := &cyclonedx.OrganizationalEntity{Name: o.Name}
+	if len(o.URL) > 0 {
+		urls := append([]string(nil), o.URL...)
+		entity.URL = &urls
+	}
+	if len(o.Contact) > 0 {
+		contacts := make([]cyclonedx.OrganizationalContact, len(o.Contact))
+		for i, contact := range o.Contact {
+			contacts[i] = cyclonedx.OrganizationalContact{Name: contact.Name, Email: contact.Email, Phone: contact.Phone}
+		}
+		entity.Contact = &contacts
+	}
+	return entity
+}
+
+// loadMetadataConfig reads the supplier, manufacturer and suppliers settings of the
+// configuration file and the authors and contacts of the SBOM.
+//
+// Parameters:
+// - authors: the authors of the SBOM, e.g. "Jane Doe <jane@acme.example>".
+// - contacts: the contacts of the supplier of the SBOM in the same form, added to the
+// contacts of the configured supplier.
+//
+// Returns:
+// - MetadataConfig: the configured metadata, empty if nothing is configured.
+// - error: an error if a setting does not have the shape of an organization.
+func loadMetadataConfig(authors, contacts []string) (MetadataConfig, error) {
+	var config MetadataConfig
+	var supplier, manufacturer OrganizationConfig
+	if err := viper.UnmarshalKey("supplier", &supplier); err != nil {
+		return config, fmt.Errorf("error reading supplier: %v", err)
+	}
+	if err := viper.UnmarshalKey("manufacturer", &manufacturer); err != nil {
+		return config, fmt.Errorf("error reading manufacturer: %v", err)
+	}
+	for _, value := range contacts {
+		contact, err := parseContact(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid contact %q: %v", value, err)
+		}
+		supplier.Contact = append(supplier.Contact, contact)
+	}
+	config.Supplier = supplier.entity()
+	config.Manufacturer = manufacturer.entity()
+	if len(authors) > 0 {
+		sbomAuthors := make([]cyclonedx.OrganizationalContact, 0, len(authors))
+		for _, value := range authors {
+			author, err := parseContact(value)
+			if err != nil {
+				return config, fmt.Errorf("invalid author %q: %v", value, err)
+			}
+			sbomAuthors = append(sbomAuthors, cyclonedx.OrganizationalContact{Name: author.Name, Email: author.Email})
+		}
+		config.Authors = &sbomAuthors
+	}
+
+	var suppliers map[string]OrganizationConfig
+	if err := viper.UnmarshalKey("suppliers", &suppliers); err != nil {
+		return config, fmt.Errorf("error reading suppliers: %v", err)
+	}
+	for distro, organization := range suppliers {
+		entity := organization.entity()
+		if entity == nil {
+			continue
+		}
+		if config.Suppliers == nil {
+			config.Suppliers = make(map[string]*cyclonedx.OrganizationalEntity)
+		}
+		config.Suppliers[strings.ToLower(distro)] = entity
+	}
+	return config, nil
+}
+
+// parseContact parses a contact given as "Name <email>", a bare email address or a name.
+//
+// Parameters:
+// - value: the contact.
+//
+// Returns:
+// - ContactConfig: the name and email of the contact.
+// - error: an error if the value contains an @ but is no valid address.
+func parseContact(value string) (ContactConfig, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ContactConfig{}, fmt.Errorf("empty contact")
+	}
+	if !strings.Contains(value, "@") {
+		return ContactConfig{Name: value}, nil
+	}
+	address, err := mail.ParseAddress(value)
+	if err != nil {
+		return ContactConfig{}, err
+	}
+	return ContactConfig{Name: address.Name, Email: address.Address}, nil
+}
+
+// packageSupplier returns the supplier of the packages of a distribution, the configured
+// one if set and the built-in one otherwise, that of the parent of derivatives without one.
+//
+// Parameters:
+// - distro: the name of the Linux distribution.
+//
+// Returns:
+// - *cyclonedx.OrganizationalEntity: the supplier, empty for unknown distributions.
+func (c MetadataConfig) packageSupplier(distro string) *cyclonedx.OrganizationalEntity {
+	if supplier, ok := c.Suppliers[strings.ToLower(distro)]; ok {
+		return supplier
+	}
+	if supplier, ok := supplierInfo[strings.ToLower(distro)]; ok {
+		return supplier
+	}
+	if parent := parentDistro(distro); parent != "" {
+		return c.packageSupplier(parent)
+	}
+	return &cyclonedx.OrganizationalEntity{}
+}
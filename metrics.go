@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics holds the Prometheus metrics of the runs of the process.
+//
+// The metrics are served on /metrics in watch and daemon mode, and pushed to a
+// Pushgateway after every run, so that hosts that stop producing SBOMs can be
+// alerted on through the last success timestamp.
+type Metrics struct {
+	mu              sync.Mutex
+	runs            map[string]int
+	duration        float64
+	packages        int
+	dependencies    int
+	unknownLicenses int
+	success         bool
+	lastRun         time.Time
+	lastSuccess     time.Time
+	destinations    []string
+}
+
+// newMetrics creates an empty metrics registry.
+func newMetrics() *Metrics {
+	return &Metrics{runs: make(map[string]int)}
+}
+
+// record updates the metrics with the outcome of a run.
+//
+// Parameters:
+// - event: the completion event of the run.
+func (m *Metrics) record(event RunEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runs[event.Result]++
+	m.duration = event.Duration.Seconds()
+	m.lastRun = time.Now()
+	m.success = event.Result == "success"
+	m.destinations = event.Destinations
+	if m.success {
+		m.lastSuccess = m.lastRun
+		m.packages = event.Components
+		m.dependencies = event.Dependencies
+		m.unknownLicenses = event.UnknownLicenses
+	}
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+//
+// Parameters:
+// - w: the writer the metrics are written to.
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+	}
+	timestamp := func(t time.Time) float64 {
+		if t.IsZero() {
+			return 0
+		}
+		return float64(t.UnixMilli()) / 1000
+	}
+	success := 0.0
+	if m.success {
+		success = 1
+	}
+
+	fmt.Fprintln(w, "# HELP distro2sbom_runs_total Number of runs by result.")
+	fmt.Fprintln(w, "# TYPE distro2sbom_runs_total counter")
+	for _, result := range []string{"success", "failure"} {
+		fmt.Fprintf(w, "distro2sbom_runs_total{result=%q} %d\n", result, m.runs[result])
+	}
+	gauge("distro2sbom_scan_duration_seconds", "Duration of the last run.", m.duration)
+	gauge("distro2sbom_packages", "Number of components in the last successful SBOM.", float64(m.packages))
+	gauge("distro2sbom_dependencies", "Number of dependency entries in the last successful SBOM.", float64(m.dependencies))
+	gauge("distro2sbom_unknown_licenses", "Number of packages without a known license in the last successful SBOM.", float64(m.unknownLicenses))
+	gauge("distro2sbom_upload_success", "Whether the last run delivered the SBOM to every destination.", success)
+	gauge("distro2sbom_last_run_timestamp_seconds", "Time of the last run.", timestamp(m.lastRun))
+	gauge("distro2sbom_last_success_timestamp_seconds", "Time of the last successful run.", timestamp(m.lastSuccess))
+
+	destinations := append([]string(nil), m.destinations...)
+	sort.Strings(destinations)
+	fmt.Fprintln(w, "# HELP distro2sbom_destination_delivered Destinations the SBOM was delivered to in the last run.")
+	fmt.Fprintln(w, "# TYPE distro2sbom_destination_delivered gauge")
+	for _, destination := range destinations {
+		fmt.Fprintf(w, "distro2sbom_destination_delivered{destination=%q} 1\n", destination)
+	}
+}
+
+// serve serves the metrics on /metrics until the context is cancelled.
+//
+// Parameters:
+// - ctx: the context, the server shuts down when it is cancelled.
+// - addr: the listen address, e.g. :9142.
+//
+// Returns:
+// - error: an error if the server cannot listen.
+func (m *Metrics) serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.write(w)
+	})
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	slog.Info("Serving metrics", "address", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving metrics: %v", err)
+	}
+	return nil
+}
+
+// push replaces the metrics of the host in a Prometheus Pushgateway.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the request.
+// - client: the HTTP client to use.
+// - gateway: the Pushgateway URL, credentials in the user info are sent as basic authentication.
+// - job: the job label of the metrics.
+// - instance: the instance label of the metrics, usually the hostname.
+//
+// Returns:
+// - error: an error if the push fails.
+func (m *Metrics) push(ctx context.Context, client *http.Client, gateway, job, instance string) error {
+	var body bytes.Buffer
+	m.write(&body)
+
+	target := strings.TrimSuffix(gateway, "/") + "/metrics/job/" + url.PathEscape(job) + "/instance/" + url.PathEscape(instance)
+	req, err := http.NewRequestWithContext(ctx, "PUT", target, &body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error pushing metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// Handling of packages installed for several architectures, selected by --multi-arch.
+const (
+	// multiArchSeparate emits a component per architecture, told apart by the arch
+	// qualifier of their purls and their arch property.
+	multiArchSeparate = "separate"
+	// multiArchMerge emits one component per package name and version, listing every
+	// installed architecture.
+	multiArchMerge = "merge"
+)
+
+// archProperty is the component property holding the architecture of a package.
+const archProperty = "distro2sbom:package:arch"
+
+// mergeMultiArch merges the packages installed for several architectures in the same
+// version into the first of them, e.g. libssl3:amd64 and libssl3:i386 into one libssl3.
+//
+// The merged component has an arch property per architecture, a purl without arch
+// qualifier, the warnings and the dependencies of every architecture. Packages whose
+// versions differ between architectures are kept apart.
+//
+// Parameters:
+// - items: the packages in listing order.
+// - builder: builds the purl of the merged packages.
+//
+// Returns:
+// - []*pipelineItem: the packages with the duplicates merged, in listing order.
+// - int: the number of packages merged into another.
+func mergeMultiArch(items []*pipelineItem, builder *componentBuilder) ([]*pipelineItem, int) {
+	first := make(map[string]*pipelineItem)
+	var merged []*pipelineItem
+	count := 0
+	for _, item := range items {
+		if item.arch == "" {
+			merged = append(merged, item)
+			continue
+		}
+		key := item.name + "@" + item.version
+		target, ok := first[key]
+		if !ok {
+			first[key] = item
+			merged = append(merged, item)
+			continue
+		}
+
+		// The merged package has no single architecture, dependencies are matched by name
+		target.arch = ""
+		target.component.PackageURL = builder.purl(target.installedPackage)
+		target.component.BOMRef = target.component.PackageURL
+		properties := []cyclonedx.Property{}
+		if target.component.Properties != nil {
+			properties = *target.component.Properties
+		}
+		if item.component.Properties != nil {
+			for _, property := range *item.component.Properties {
+				if property.Name == archProperty || property.Name == warningProperty {
+					properties = append(properties, property)
+				}
+			}
+		}
+		target.component.Properties = &properties
+		target.dependencies = append(target.dependencies, item.dependencies...)
+		count++
+	}
+	return merged, count
+}
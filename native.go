@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sources of the package data, selected by --source.
+const (
+	// sourceAuto reads the package database natively where a parser exists and runs the
+	// package manager otherwise.
+	sourceAuto = "auto"
+	// sourceNative only reads the package database natively.
+	sourceNative = "native"
+	// sourceExec runs the package manager for the listing and every package.
+	sourceExec = "exec"
+)
+
+// nativeDatabases are the package databases distro2sbom parses itself, by package manager.
+// A native database lists the packages with their licenses and dependencies in one read,
+// instead of a package manager process per package. The first readable one is used.
+var nativeDatabases = map[string][]string{
+	"dpkg": {"/var/lib/dpkg/status"},
+	// opkg keeps the installed packages in the format of the dpkg status database
+	"opkg": {"/usr/lib/opkg/status"},
+	"apk":  {apkInstalledDatabase},
+	"rpm":  rpmDatabases,
+}
+
+// nativeDatabase returns the native database of a package manager on the scanned system.
+//
+// Parameters:
+// - ctx: the context.
+// - runner: the runner of the scanned system.
+// - packageManager: the package manager of the distribution.
+//
+// Returns:
+// - string: the path of the database.
+// - error: an error if none of its databases can be read, or a SQLite database has changes
+// in its write-ahead log that were not written back, which only SQLite itself sees.
+func nativeDatabase(ctx context.Context, runner Runner, packageManager string) (string, error) {
+	databases, ok := nativeDatabases[packageManager]
+	if !ok {
+		return "", fmt.Errorf("no native parser for %s", packageManager)
+	}
+	err := fmt.Errorf("no package database of %s found", packageManager)
+	for _, database := range databases {
+		if err = databaseReadable(ctx, runner, database); err != nil {
+			continue
+		}
+		if strings.HasSuffix(database, ".sqlite") {
+			if wal, walErr := runner.Open(ctx, database+"-wal"); walErr == nil {
+				n, _ := wal.Read(make([]byte, 1))
+				wal.Close()
+				if n > 0 {
+					return "", fmt.Errorf("%s has uncheckpointed changes in %s-wal", database, database)
+				}
+			}
+		}
+		return database, nil
+	}
+	return "", err
+}
+
+// resolveSource decides how the packages of a package manager are collected.
+//
+// Parameters:
+// - source: auto, native or exec, empty for auto.
+// - packageManager: the package manager of the distribution.
+// - runner: the runner of the scanned system the database is read from.
+//
+// Returns:
+// - string: native or exec.
+// - error: an error if the source is unknown, or native is requested for a package manager
+// without native parser or whose database cannot be read.
+func resolveSource(ctx context.Context, source, packageManager string, runner Runner) (string, error) {
+	_, ok := nativeDatabases[packageManager]
+	switch source {
+	case "", sourceAuto:
+		if _, err := nativeDatabase(ctx, runner, packageManager); ok && err == nil {
+			return sourceNative, nil
+		}
+		return sourceExec, nil
+	case sourceNative:
+		if !ok {
+			return "", fmt.Errorf("no native parser for %s, use --source exec or auto", packageManager)
+		}
+		if _, err := nativeDatabase(ctx, runner, packageManager); err != nil {
+			return "", fmt.Errorf("error reading package database: %v", err)
+		}
+		return sourceNative, nil
+	case sourceExec:
+		return sourceExec, nil
+	default:
+		return "", fmt.Errorf("unsupported source %q, expected auto, native or exec", source)
+	}
+}
+
+// databaseReadable checks that a package database of the scanned system can be opened.
+func databaseReadable(ctx context.Context, runner Runner, path string) error {
+	file, err := runner.Open(ctx, path)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// listNativePackages streams the packages of the native database of a package manager.
+//
+// Parameters:
+// - ctx: the context, cancelling it stops reading.
+// - runner: the runner of the scanned system the database is read from.
+// - packageManager: the package manager whose database is read.
+// - maxLineSize: the longest line of the database that is accepted, 0 for defaultMaxLineSize.
+// - emit: called with every package in the order of the database.
+//
+// Returns:
+// - error: an error if the database cannot be read.
+func listNativePackages(ctx context.Context, runner Runner, packageManager string, maxLineSize int, emit func(pkg installedPackage)) error {
+	database, err := nativeDatabase(ctx, runner, packageManager)
+	if err != nil {
+		return fmt.Errorf("error reading package database: %v", err)
+	}
+	switch packageManager {
+	case "dpkg", "opkg":
+		return readDpkgStatus(ctx, runner, database, maxLineSize, emit)
+	case "apk":
+		return readAPKInstalled(ctx, runner, database, maxLineSize, emit)
+	case "rpm":
+		return readRPMDatabase(ctx, runner, database, emit)
+	default:
+		return fmt.Errorf("no native parser for %s", packageManager)
+	}
+}
+
+// readDpkgStatus streams the packages of the dpkg status database.
+//
+// Packages with the not-installed state are skipped, like dpkg-query -W does. The License
+// field is taken as the license of the package, the Pre-Depends and Depends fields as its
+// dependencies.
+//
+// Parameters:
+// - ctx: the context, cancelling it stops reading.
+// - runner: the runner of the scanned system the file is read from.
+// - path: the path to the status file, usually /var/lib/dpkg/status.
+// - maxLineSize: the longest line of the file that is accepted, 0 for defaultMaxLineSize.
+// - emit: called with every package in the order of the file.
+//
+// Returns:
+// - error: an error if the file cannot be read.
+func readDpkgStatus(ctx context.Context, runner Runner, path string, maxLineSize int, emit func(pkg installedPackage)) error {
+	if maxLineSize <= 0 {
+		maxLineSize = defaultMaxLineSize
+	}
+	file, err := runner.Open(ctx, path)
+	if err != nil {
+		return fmt.Errorf("error reading package database: %v", err)
+	}
+	defer file.Close()
+
+	var fields map[string]string
+	flush := func() {
+		if fields["Package"] == "" || strings.HasSuffix(fields["Status"], " not-installed") {
+			fields = nil
+			return
+		}
+		emit(installedPackage{
+			name:            fields["Package"],
+			version:         fields["Version"],
+			arch:            fields["Architecture"],
+			license:         fields["License"],
+			hasLicense:      true,
+			depends:         append(parseDpkgDepends(fields["Pre-Depends"]), parseDpkgDepends(fields["Depends"])...),
+			hasDependencies: true,
+		})
+		fields = nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, min(64*1024, maxLineSize)), maxLineSize)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		// Continuation lines, e.g. of the Description, are not needed
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		fields[name] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("error reading package database: line longer than %d bytes, raise --max-line-size", maxLineSize)
+		}
+		return fmt.Errorf("error reading package database: %v", err)
+	}
+	flush()
+	return nil
+}
+
+// parseDpkgDepends returns the names of the packages of a dpkg relationship field.
+//
+// Every alternative is returned, so that whichever is installed is matched. Version
+// constraints and the any and native architecture wildcards are dropped, while qualifiers
+// naming an architecture are kept, e.g. "libc6 (>= 2.34), awk | mawk:any, libgcc-s1:i386"
+// yields libc6, awk, mawk and libgcc-s1:i386.
+//
+// Parameters:
+// - field: the value of a Depends or Pre-Depends field.
+//
+// Returns:
+// - []string: the package names.
+func parseDpkgDepends(field string) []string {
+	var names []string
+	for _, relation := range strings.Split(field, ",") {
+		for _, alternative := range strings.Split(relation, "|") {
+			words := strings.Fields(alternative)
+			if len(words) == 0 {
+				continue
+			}
+			name, arch := splitPackageArch(words[0])
+			if arch != "" && arch != "any" && arch != "native" {
+				name += ":" + arch
+			}
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadDpkgStatus(t *testing.T) {
+	var packages []installedPackage
+	err := readDpkgStatus(context.Background(), &fixtureRunner{}, "dpkg/status", 0, func(pkg installedPackage) {
+		packages = append(packages, pkg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []installedPackage{
+		{name: "libc6", version: "2.36-9+deb12u4", arch: "amd64", depends: []string{"libgcc-s1"}},
+		{name: "bash", version: "5.2.15-2+b2", arch: "amd64", depends: []string{"libc6", "libtinfo6", "base-files", "debianutils"}},
+		{name: "libgcc-s1", version: "12.2.0-14", arch: "i386", depends: []string{"gcc-12-base:i386", "libc6:i386"}},
+		{name: "mawk", version: "1.3.4.20200120-3.1", arch: "amd64", license: "GPL-2.0", depends: []string{"libc6", "awk", "mawk"}},
+	}
+	if len(packages) != len(want) {
+		t.Fatalf("readDpkgStatus() read %d packages, want %d", len(packages), len(want))
+	}
+	for i, pkg := range packages {
+		if pkg.name != want[i].name || pkg.version != want[i].version || pkg.arch != want[i].arch || pkg.license != want[i].license {
+			t.Errorf("package %d = %s %s %s %q, want %s %s %s %q", i, pkg.name, pkg.version, pkg.arch, pkg.license, want[i].name, want[i].version, want[i].arch, want[i].license)
+		}
+		if !slices.Equal(pkg.depends, want[i].depends) {
+			t.Errorf("dependencies of %s = %q, want %q", pkg.name, pkg.depends, want[i].depends)
+		}
+		if !pkg.hasLicense || !pkg.hasDependencies {
+			t.Errorf("%s has hasLicense %t and hasDependencies %t, want both set", pkg.name, pkg.hasLicense, pkg.hasDependencies)
+		}
+	}
+}
+
+func TestReadDpkgStatusLineTooLong(t *testing.T) {
+	err := readDpkgStatus(context.Background(), &fixtureRunner{}, "dpkg/status", 64, func(installedPackage) {})
+	if err == nil || !strings.Contains(err.Error(), "--max-line-size") {
+		t.Errorf("readDpkgStatus() with lines longer than 64 bytes = %v, want an error naming --max-line-size", err)
+	}
+}
+
+func TestParseDpkgDepends(t *testing.T) {
+	tests := []struct {
+		field string
+		want  []string
+	}{
+		{"", nil},
+		{"libc6", []string{"libc6"}},
+		{"libc6 (>= 2.34), zlib1g (>= 1:1.1.4)", []string{"libc6", "zlib1g"}},
+		{"awk | mawk:any", []string{"awk", "mawk"}},
+		{"perl:native, libgcc-s1:i386", []string{"perl", "libgcc-s1:i386"}},
+		{"libc6 (>= 2.34),, ", []string{"libc6"}},
+	}
+	for _, test := range tests {
+		if got := parseDpkgDepends(test.field); !slices.Equal(got, test.want) {
+			t.Errorf("parseDpkgDepends(%q) = %q, want %q", test.field, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// nixSystemProfile is the current NixOS system, its closure are the installed packages.
+const nixSystemProfile = "/run/current-system"
+
+// parseNixStorePath parses a nix store path into the name and version of the package,
+// e.g. /nix/store/<hash>-openssl-3.0.13-bin into openssl and 3.0.13-bin. Like nix does,
+// the version starts at the first hyphen that is not followed by a letter.
+//
+// Parameters:
+// - storePath: the store path.
+//
+// Returns:
+// - string: the name of the package.
+// - string: the version of the package, empty for paths without version.
+// - bool: whether the line is a store path.
+func parseNixStorePath(storePath string) (string, string, bool) {
+	base := path.Base(strings.TrimSpace(storePath))
+	_, nameVersion, ok := strings.Cut(base, "-")
+	if !ok || !strings.HasPrefix(storePath, "/nix/store/") || nameVersion == "" {
+		return "", "", false
+	}
+	for i := 0; i < len(nameVersion)-1; i++ {
+		next := nameVersion[i+1]
+		if nameVersion[i] == '-' && !(next >= 'a' && next <= 'z' || next >= 'A' && next <= 'Z') {
+			return nameVersion[:i], nameVersion[i+1:], true
+		}
+	}
+	return nameVersion, "", true
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Payload formats of the completion notifications, selected by --notify-format.
+const (
+	notifyFormatSlack = "slack"
+	notifyFormatTeams = "teams"
+	// notifyFormatJSON posts the run result as written by --result-json.
+	notifyFormatJSON = "json"
+)
+
+// Notifier posts a summary of every run to a chat or HTTP webhook, so that operators learn
+// about broken scheduled scans without reading logs.
+//
+// Slack posts a message with text, Teams an Adaptive Card as accepted by Teams workflow
+// webhooks, and json the run result. OnFailure only notifies about failed runs.
+type Notifier struct {
+	URL       string
+	Format    string
+	OnFailure bool
+	TLSVerify bool
+	Timeout   time.Duration
+}
+
+// notificationText returns the summary of a run for chat messages.
+func notificationText(event RunEvent) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "distro2sbom on %s (%s): %s", event.Hostname, event.Distro, event.message())
+	if event.Result != "success" {
+		fmt.Fprintf(&text, " (exit code %d)", event.ExitCode)
+	}
+	if len(event.Warnings) > 0 {
+		fmt.Fprintf(&text, ", %d warnings", len(event.Warnings))
+	}
+	if len(event.Destinations) > 0 {
+		fmt.Fprintf(&text, ", delivered to %s", strings.Join(event.Destinations, ", "))
+	}
+	return text.String()
+}
+
+// payload encodes the notification of a run.
+//
+// Parameters:
+// - event: the completion event of the run.
+// - startTime: the time the run started.
+//
+// Returns:
+// - []byte: the request body.
+// - error: an error if the format is unknown.
+func (n *Notifier) payload(event RunEvent, startTime time.Time) ([]byte, error) {
+	switch n.Format {
+	case "", notifyFormatSlack:
+		return json.Marshal(map[string]string{"text": notificationText(event)})
+	case notifyFormatTeams:
+		color := "Good"
+		if event.Result != "success" {
+			color = "Attention"
+		}
+		card := map[string]any{
+			"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+			"type":    "AdaptiveCard",
+			"version": "1.4",
+			"body": []map[string]any{
+				{"type": "TextBlock", "text": "distro2sbom " + event.Result + " on " + event.Hostname, "weight": "Bolder", "size": "Medium", "color": color},
+				{"type": "TextBlock", "text": notificationText(event), "wrap": true},
+			},
+		}
+		return json.Marshal(map[string]any{
+			"type": "message",
+			"attachments": []map[string]any{
+				{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+			},
+		})
+	case notifyFormatJSON:
+		return runResultJSON(event, startTime)
+	default:
+		return nil, fmt.Errorf("unsupported notification format: %s", n.Format)
+	}
+}
+
+// notify posts the notification of a run, unless only failures are notified and it succeeded.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the request.
+// - event: the completion event of the run.
+// - startTime: the time the run started.
+//
+// Returns:
+// - error: an error if the request fails.
+func (n *Notifier) notify(ctx context.Context, event RunEvent, startTime time.Time) error {
+	if n.OnFailure && event.Result == "success" {
+		return nil
+	}
+	body, err := n.payload(event, startTime)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := newHTTPClient(n.TLSVerify, n.Timeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending notification: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// includeNpm is the opt-in collector of --include adding the Node.js packages installed
+// globally with npm.
+const includeNpm = "npm"
+
+// npmGlobalScript prints the package.json of every package in the global node_modules
+// directory of npm, including scoped packages, nothing if npm is not installed.
+const npmGlobalScript = `command -v npm >/dev/null || exit 0; root=$(npm root -g) || exit 1; ` +
+	`for p in "$root"/*/package.json "$root"/@*/*/package.json; do [ -f "$p" ] && echo "$p"; done; true`
+
+// npmGlobalCommand prints the manifests of the global npm packages.
+var npmGlobalCommand = []string{"sh", "-c", npmGlobalScript}
+
+// npmManifest holds the fields of a package.json the collector reads.
+type npmManifest struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// License is an SPDX expression, or an object with the license as type in manifests of
+	// older packages.
+	License json.RawMessage `json:"license"`
+}
+
+// license returns the license the manifest declares, empty if it declares none.
+func (m npmManifest) license() string {
+	var license string
+	if err := json.Unmarshal(m.License, &license); err == nil {
+		return license
+	}
+	var legacy struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(m.License, &legacy); err == nil {
+		return legacy.Type
+	}
+	return ""
+}
+
+// npmPURL returns the package URL of an npm package, with the scope of scoped packages as
+// namespace, e.g. pkg:npm/%40angular/cli@18.2.1.
+func npmPURL(name, version string) string {
+	namespace := ""
+	if scope, rest, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(scope, "@") {
+		namespace, name = scope, rest
+	}
+	return formatPURL("npm", namespace, name, version, nil)
+}
+
+// collectNpm lists the packages of the global node_modules directory of npm, so that the
+// Node.js tooling installed next to the distribution with npm install -g is covered. The
+// dependencies the packages bundle in their own node_modules are left out.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills npm.
+// - options: the runner and the maximum line size.
+// - index: the index of the last package, the packages are numbered after it.
+//
+// Returns:
+// - []*pipelineItem: the packages, none if npm is not installed.
+// - error: an error if npm fails.
+func collectNpm(ctx context.Context, _ string, options CollectOptions, _ []*pipelineItem, index int) ([]*pipelineItem, error) {
+	runner := runnerOrLocal(options.Runner)
+	var manifests []string
+	err := streamCommand(ctx, runner, npmGlobalCommand, options.MaxLineSize, func(line string) {
+		manifests = append(manifests, line)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing global npm packages: %v", err)
+	}
+
+	var items []*pipelineItem
+	for _, path := range manifests {
+		data, err := readFile(ctx, runner, path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		}
+		var manifest npmManifest
+		if err := json.Unmarshal(data, &manifest); err != nil || manifest.Name == "" {
+			slog.Warn("Skipping npm package with invalid package.json", "path", path, "error", err)
+			continue
+		}
+		purl := npmPURL(manifest.Name, manifest.Version)
+		component := cyclonedx.Component{
+			Type:       cyclonedx.ComponentTypeLibrary,
+			Name:       manifest.Name,
+			Version:    manifest.Version,
+			BOMRef:     stableBOMRef(purl, manifest.Name, manifest.Version, ""),
+			PackageURL: purl,
+			Properties: &[]cyclonedx.Property{{Name: "distro2sbom:collector", Value: includeNpm}},
+		}
+		if license := manifest.license(); license != "" {
+			component.Licenses = declaredLicenses([]string{license})
+		}
+		index++
+		items = append(items, &pipelineItem{
+			index:            index,
+			installedPackage: installedPackage{name: manifest.Name, version: manifest.Version},
+			component:        component,
+		})
+	}
+	slog.Info("Listed global npm packages", "components", len(items))
+	return items, nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociEmptyMediaType    = "application/vnd.oci.empty.v1+json"
+	cycloneDXMediaType   = "application/vnd.cyclonedx+json"
+)
+
+// OCIDescriptor describes a blob or manifest stored in an OCI registry.
+type OCIDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// OCIManifest is an OCI image manifest used to carry the SBOM as an artifact.
+type OCIManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType"`
+	Config        OCIDescriptor     `json:"config"`
+	Layers        []OCIDescriptor   `json:"layers"`
+	Subject       *OCIDescriptor    `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// OCIPush pushes SBOMs to an OCI registry as artifacts.
+//
+// Reference is registry/repository[:tag]. When Subject is set to the digest of an image
+// in the same repository, the SBOM is attached to that image and listed by the registry's
+// referrers API. Credentials are read from OCI_USERNAME and OCI_PASSWORD.
+type OCIPush struct {
+	Reference string
+	Subject   string
+	TLSVerify bool
+	Timeout   time.Duration
+
+	registry   string
+	repository string
+	tag        string
+	client     *http.Client
+	token      string
+}
+
+var ociTagInvalid = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// parseReference splits the reference into registry, repository and tag, e.g.
+// localhost:5000, sbom and latest for localhost:5000/sbom:latest. References by digest are
+// rejected, as the SBOM is pushed by tag.
+//
+// Parameters:
+// - defaultTag: the tag used when the reference has none.
+//
+// Returns:
+// - error: an error if the reference has no repository, an empty tag or a digest.
+func (o *OCIPush) parseReference(defaultTag string) error {
+	registry, repository, found := strings.Cut(o.Reference, "/")
+	if !found || repository == "" {
+		return fmt.Errorf("invalid OCI reference %s, expected registry/repository[:tag]", o.Reference)
+	}
+	if strings.Contains(repository, "@") {
+		return fmt.Errorf("invalid OCI reference %s, the SBOM is pushed by tag, not by digest", o.Reference)
+	}
+	o.registry = registry
+	o.repository = repository
+	o.tag = ociTagInvalid.ReplaceAllString(defaultTag, "_")
+	if i := strings.LastIndex(repository, ":"); i != -1 {
+		o.repository = repository[:i]
+		o.tag = repository[i+1:]
+	}
+	if o.repository == "" || o.tag == "" {
+		return fmt.Errorf("invalid OCI reference %s, expected registry/repository[:tag]", o.Reference)
+	}
+	return nil
+}
+
+// push uploads the SBOM and its manifest to the registry.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the requests.
+// - hostname: the hostname of the system, used as tag when the reference has none.
+// - sbomJSON: the SBOM in JSON format.
+//
+// Returns:
+// - string: the digest of the pushed manifest.
+// - error: an error if any of the uploads fails.
+func (o *OCIPush) push(ctx context.Context, hostname string, sbomJSON []byte) (string, error) {
+	if err := o.parseReference(hostname); err != nil {
+		return "", err
+	}
+	o.client = newHTTPClient(o.TLSVerify, o.Timeout)
+
+	emptyConfig := []byte("{}")
+	config := OCIDescriptor{MediaType: ociEmptyMediaType, Digest: ociDigest(emptyConfig), Size: int64(len(emptyConfig))}
+	if err := o.pushBlob(ctx, config.Digest, emptyConfig); err != nil {
+		return "", fmt.Errorf("error pushing config blob: %v", err)
+	}
+
+	layer := OCIDescriptor{
+		MediaType:   cycloneDXMediaType,
+		Digest:      ociDigest(sbomJSON),
+		Size:        int64(len(sbomJSON)),
+		Annotations: map[string]string{"org.opencontainers.image.title": "sbom.cdx.json"},
+	}
+	if err := o.pushBlob(ctx, layer.Digest, sbomJSON); err != nil {
+		return "", fmt.Errorf("error pushing SBOM blob: %v", err)
+	}
+
+	manifest := OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  cycloneDXMediaType,
+		Config:        config,
+		Layers:        []OCIDescriptor{layer},
+		Annotations: map[string]string{
+			"org.opencontainers.image.created": time.Now().UTC().Format(time.RFC3339),
+			"org.opencontainers.image.title":   hostname,
+		},
+	}
+	if o.Subject != "" {
+		subject, err := o.resolveManifest(ctx, o.Subject)
+		if err != nil {
+			return "", fmt.Errorf("error resolving subject %s: %v", o.Subject, err)
+		}
+		manifest.Subject = subject
+	}
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling manifest: %v", err)
+	}
+
+	resp, err := o.do(ctx, "PUT", o.url("manifests/"+o.tag), manifestJSON, ociManifestMediaType)
+	if err != nil {
+		return "", fmt.Errorf("error pushing manifest: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("unexpected status code pushing manifest: %d", resp.StatusCode)
+	}
+
+	return ociDigest(manifestJSON), nil
+}
+
+// pushBlob uploads a blob with a monolithic upload unless the registry already has it.
+func (o *OCIPush) pushBlob(ctx context.Context, digest string, blob []byte) error {
+	resp, err := o.do(ctx, "HEAD", o.url("blobs/"+digest), nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = o.do(ctx, "POST", o.url("blobs/uploads/"), nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unexpected status code starting upload: %d", resp.StatusCode)
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %v", err)
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = o.do(ctx, "PUT", location.String(), blob, "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code completing upload: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// resolveManifest returns the descriptor of an existing manifest in the repository.
+func (o *OCIPush) resolveManifest(ctx context.Context, digest string) (*OCIDescriptor, error) {
+	digest = digest[strings.LastIndex(digest, "@")+1:]
+	resp, err := o.do(ctx, "HEAD", o.url("manifests/"+digest), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	return &OCIDescriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    digest,
+		Size:      size,
+	}, nil
+}
+
+// url returns the registry API URL for a path below the repository.
+func (o *OCIPush) url(path string) string {
+	return fmt.Sprintf("https://%s/v2/%s/%s", o.registry, o.repository, path)
+}
+
+// do sends a request to the registry, authenticating with a bearer token or basic
+// credentials when the registry asks for it.
+func (o *OCIPush) do(ctx context.Context, method, target string, body []byte, contentType string) (*http.Response, error) {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %v", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Accept", ociManifestMediaType+", application/vnd.oci.image.index.v1+json, application/vnd.docker.distribution.manifest.v2+json")
+		if o.token != "" {
+			req.Header.Set("Authorization", "Bearer "+o.token)
+		} else if username := os.Getenv("OCI_USERNAME"); username != "" {
+			req.SetBasicAuth(username, os.Getenv("OCI_PASSWORD"))
+		}
+		return req, nil
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized || o.token != "" {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("registry rejected the credentials, set OCI_USERNAME and OCI_PASSWORD")
+	}
+	if err := o.fetchToken(ctx, challenge); err != nil {
+		return nil, err
+	}
+
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+	resp, err = o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	return resp, nil
+}
+
+// fetchToken requests a bearer token from the authorization server named in a challenge.
+func (o *OCIPush) fetchToken(ctx context.Context, challenge string) error {
+	params := make(map[string]string)
+	for _, match := range regexp.MustCompile(`(\w+)="([^"]*)"`).FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid authentication challenge: %s", challenge)
+	}
+
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull,push", o.repository))
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", realm.String(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	if username := os.Getenv("OCI_USERNAME"); username != "" {
+		req.SetBasicAuth(username, os.Getenv("OCI_PASSWORD"))
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error requesting registry token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code requesting registry token: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("error decoding registry token: %v", err)
+	}
+	o.token = token.Token
+	if o.token == "" {
+		o.token = token.AccessToken
+	}
+
+	return nil
+}
+
+// ociDigest returns the sha256 digest of content in OCI notation.
+func ociDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
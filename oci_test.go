@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestOCIPushParseReference(t *testing.T) {
+	tests := []struct {
+		reference                 string
+		registry, repository, tag string
+		wantErr                   bool
+	}{
+		{reference: "registry.example.com/sbom", registry: "registry.example.com", repository: "sbom", tag: "web01"},
+		{reference: "registry.example.com/sbom:v1.2", registry: "registry.example.com", repository: "sbom", tag: "v1.2"},
+		{reference: "registry.example.com/team/sboms/web:latest", registry: "registry.example.com", repository: "team/sboms/web", tag: "latest"},
+		{reference: "localhost:5000/sbom", registry: "localhost:5000", repository: "sbom", tag: "web01"},
+		{reference: "localhost:5000/team/sbom:nightly", registry: "localhost:5000", repository: "team/sbom", tag: "nightly"},
+		{reference: "registry.example.com", wantErr: true},
+		{reference: "registry.example.com/", wantErr: true},
+		{reference: "registry.example.com/sbom:", wantErr: true},
+		{reference: "registry.example.com/:v1", wantErr: true},
+		{reference: "registry.example.com/sbom@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", wantErr: true},
+		{reference: "localhost:5000/sbom:v1@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", wantErr: true},
+	}
+	for _, test := range tests {
+		push := &OCIPush{Reference: test.reference}
+		err := push.parseReference("web01")
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseReference(%q) = %s, %s, %s, want an error", test.reference, push.registry, push.repository, push.tag)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseReference(%q) failed: %v", test.reference, err)
+			continue
+		}
+		if push.registry != test.registry || push.repository != test.repository || push.tag != test.tag {
+			t.Errorf("parseReference(%q) = %s, %s, %s, want %s, %s, %s", test.reference, push.registry, push.repository, push.tag, test.registry, test.repository, test.tag)
+		}
+	}
+}
+
+func TestOCIPushParseReferenceSanitizesDefaultTag(t *testing.T) {
+	push := &OCIPush{Reference: "registry.example.com/sbom"}
+	if err := push.parseReference("web01.example.com:8080"); err != nil {
+		t.Fatal(err)
+	}
+	if push.tag != "web01.example.com_8080" {
+		t.Errorf("tag = %q, want %q", push.tag, "web01.example.com_8080")
+	}
+}
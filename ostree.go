@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// ostreeBootedFile exists on systems booted with OSTree.
+const ostreeBootedFile = "/run/ostree-booted"
+
+// rpmOSTreeStatusCommand prints the booted deployment of image based systems such as Fedora
+// Silverblue and CoreOS, nothing if rpm-ostree is not installed.
+var rpmOSTreeStatusCommand = []string{"sh", "-c", "command -v rpm-ostree >/dev/null || exit 0; exec rpm-ostree status --json --booted"}
+
+// rpmOSTreeLayerProperty marks whether an rpm package comes with the base image, was layered
+// on top of it with rpm-ostree install, or replaces a base package with rpm-ostree override
+// replace.
+const rpmOSTreeLayerProperty = "distro2sbom:rpm-ostree:layer"
+
+// rpmOSTreeStatus holds the fields of rpm-ostree status --json the collector reads.
+type rpmOSTreeStatus struct {
+	Deployments []rpmOSTreeDeployment `json:"deployments"`
+}
+
+// rpmOSTreeDeployment is a deployment of rpm-ostree status --json.
+type rpmOSTreeDeployment struct {
+	Booted   bool   `json:"booted"`
+	Checksum string `json:"checksum"`
+	// BaseChecksum is the commit of the base image, only set if packages were layered on
+	// top of it or base packages overridden.
+	BaseChecksum string `json:"base-checksum"`
+	Origin       string `json:"origin"`
+	// ContainerImageReference replaces the origin of systems booted from a container image.
+	ContainerImageReference string `json:"container-image-reference"`
+	Version                 string `json:"version"`
+}
+
+// parseNEVRA splits a package of rpm-ostree db list, e.g.
+// NetworkManager-1:1.44.2-1.fc39.x86_64, into name, version-release without epoch and
+// architecture.
+func parseNEVRA(nevra string) (name, version, arch string, ok bool) {
+	rest, arch, ok := cutLast(nevra, ".")
+	if !ok {
+		return "", "", "", false
+	}
+	rest, release, ok := cutLast(rest, "-")
+	if !ok {
+		return "", "", "", false
+	}
+	name, version, ok = cutLast(rest, "-")
+	if !ok {
+		return "", "", "", false
+	}
+	if _, v, hasEpoch := strings.Cut(version, ":"); hasEpoch {
+		version = v
+	}
+	return name, version + "-" + release, arch, true
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// collectRPMOSTree marks the rpm packages of image based systems as base or layered and
+// returns the deployment the system booted as metadata properties, so that packages
+// installed on a host can be told apart from those of the image it was deployed from.
+// Nothing is done on systems booted without OSTree.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills rpm-ostree.
+// - options: the runner and the maximum line size.
+// - items: the rpm packages, a property is added to their components.
+//
+// Returns:
+// - []cyclonedx.Property: the checksum, base checksum and origin of the booted deployment.
+// - error: an error if rpm-ostree fails or its output cannot be decoded.
+func collectRPMOSTree(ctx context.Context, options CollectOptions, items []*pipelineItem) ([]cyclonedx.Property, error) {
+	runner := runnerOrLocal(options.Runner)
+	// Checked without a command, so that root file systems of images without a shell pass
+	if databaseReadable(ctx, runner, ostreeBootedFile) != nil {
+		return nil, nil
+	}
+	output, err := runner.Command(ctx, rpmOSTreeStatusCommand...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("error querying rpm-ostree status: %v", err)
+	}
+	if len(bytes.TrimSpace(output)) == 0 {
+		return nil, nil
+	}
+	var status rpmOSTreeStatus
+	if err := json.Unmarshal(output, &status); err != nil {
+		return nil, fmt.Errorf("error decoding rpm-ostree status: %v", err)
+	}
+	var deployment *rpmOSTreeDeployment
+	for i := range status.Deployments {
+		if status.Deployments[i].Booted {
+			deployment = &status.Deployments[i]
+		}
+	}
+	if deployment == nil {
+		return nil, fmt.Errorf("rpm-ostree reports no booted deployment")
+	}
+
+	properties := []cyclonedx.Property{{Name: "distro2sbom:rpm-ostree:checksum", Value: deployment.Checksum}}
+	if deployment.Version != "" {
+		properties = append(properties, cyclonedx.Property{Name: "distro2sbom:rpm-ostree:version", Value: deployment.Version})
+	}
+	origin := deployment.ContainerImageReference
+	if origin == "" {
+		origin = deployment.Origin
+	}
+	if origin != "" {
+		properties = append(properties, cyclonedx.Property{Name: "distro2sbom:rpm-ostree:origin", Value: origin})
+	}
+
+	// Without a base checksum the deployment is the unmodified image
+	base := make(map[string]string)
+	if deployment.BaseChecksum != "" {
+		properties = append(properties, cyclonedx.Property{Name: "distro2sbom:rpm-ostree:base-checksum", Value: deployment.BaseChecksum})
+		args := []string{"rpm-ostree", "db", "list", deployment.BaseChecksum}
+		err := streamCommand(ctx, runner, args, options.MaxLineSize, func(line string) {
+			// The packages follow the "ostree commit:" header indented by a space
+			if !strings.HasPrefix(line, " ") {
+				return
+			}
+			if name, version, arch, ok := parseNEVRA(strings.TrimSpace(line)); ok {
+				base[name+"\x00"+arch] = version
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing the packages of the base image: %v", err)
+		}
+	}
+
+	var layered, replaced int
+	for _, item := range items {
+		layer := "base"
+		if deployment.BaseChecksum != "" {
+			version, ok := base[item.name+"\x00"+item.arch]
+			switch {
+			case !ok:
+				layer = "layered"
+				layered++
+			case version != item.version:
+				layer = "replaced"
+				replaced++
+			}
+		}
+		var componentProperties []cyclonedx.Property
+		if item.component.Properties != nil {
+			componentProperties = *item.component.Properties
+		}
+		componentProperties = append(componentProperties, cyclonedx.Property{Name: rpmOSTreeLayerProperty, Value: layer})
+		item.component.Properties = &componentProperties
+	}
+	slog.Info("Read rpm-ostree deployment", "checksum", deployment.Checksum, "layered", layered, "replaced", replaced)
+	return properties, nil
+}
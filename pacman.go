@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+)
+
+// pacmanNone is the value pacman prints for empty fields, e.g. a package without dependencies.
+const pacmanNone = "None"
+
+// pacmanInfoParser parses the output of pacman -Qi, a block of "Field : value" lines per
+// package separated by blank lines, line by line as the listing is streamed.
+type pacmanInfoParser struct {
+	fields map[string]string
+	last   string
+	// emit is called with every package when its block is complete.
+	emit func(pkg installedPackage)
+}
+
+// parse processes a line of the listing.
+//
+// Parameters:
+// - line: the line without the line ending.
+func (p *pacmanInfoParser) parse(line string) {
+	if strings.TrimSpace(line) == "" {
+		p.flush()
+		return
+	}
+	// Values wrapped on a terminal continue on indented lines
+	if line[0] == ' ' || line[0] == '\t' {
+		if p.last != "" {
+			p.fields[p.last] += " " + strings.TrimSpace(line)
+		}
+		return
+	}
+	field, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return
+	}
+	if p.fields == nil {
+		p.fields = make(map[string]string)
+	}
+	p.last = strings.TrimSpace(field)
+	p.fields[p.last] = strings.TrimSpace(value)
+}
+
+// flush emits the package of the block read so far, the last block of the listing is
+// emitted when the listing ends.
+func (p *pacmanInfoParser) flush() {
+	if p.fields["Name"] != "" {
+		license := p.fields["Licenses"]
+		if license == pacmanNone {
+			license = ""
+		}
+		p.emit(installedPackage{
+			name:            p.fields["Name"],
+			version:         p.fields["Version"],
+			arch:            p.fields["Architecture"],
+			license:         license,
+			hasLicense:      true,
+			depends:         pacmanDependencies(p.fields["Depends On"]),
+			hasDependencies: true,
+		})
+	}
+	p.fields = nil
+	p.last = ""
+}
+
+// pacmanInfoField returns a field of the pacman -Qi output of a single package.
+//
+// Parameters:
+// - output: the output of pacman -Qi.
+// - field: the name of the field, e.g. Licenses.
+//
+// Returns:
+// - string: the value of the field, empty if it is missing or None.
+func pacmanInfoField(output, field string) string {
+	var value string
+	parser := &pacmanInfoParser{emit: func(installedPackage) {}}
+	for _, line := range strings.Split(output, "\n") {
+		parser.parse(line)
+		if parser.last == field {
+			value = parser.fields[field]
+		}
+	}
+	if value == pacmanNone {
+		return ""
+	}
+	return value
+}
+
+// pacmanDependencies returns the names of the packages of a Depends On field, without
+// version constraints, e.g. glibc for glibc>=2.38.
+//
+// Parameters:
+// - dependsOn: the value of the field, None for a package without dependencies.
+//
+// Returns:
+// - []string: the names of the dependencies.
+func pacmanDependencies(dependsOn string) []string {
+	var names []string
+	for _, dependency := range strings.Fields(dependsOn) {
+		if dependency == pacmanNone {
+			continue
+		}
+		if i := strings.IndexAny(dependency, "<>="); i >= 0 {
+			dependency = dependency[:i]
+		}
+		names = append(names, dependency)
+	}
+	return names
+}
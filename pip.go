@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// includePip is the opt-in collector of --include adding the Python packages installed
+// system-wide, by the distribution or with pip.
+const includePip = "pip"
+
+// pipMetadataScript prints the name and version of every Python package of the system-wide
+// site directories as "directory\tname\tversion", read from the metadata pip reads itself,
+// so that neither pip nor a Python interpreter is needed.
+const pipMetadataScript = `for d in /usr/lib/python3/dist-packages /usr/lib/python3*/site-packages /usr/lib64/python3*/site-packages /usr/local/lib/python3*/dist-packages /usr/local/lib/python3*/site-packages; do ` +
+	`[ -d "$d" ] || continue; ` +
+	`for m in "$d"/*.dist-info/METADATA "$d"/*.egg-info/PKG-INFO "$d"/*.egg-info; do ` +
+	`[ -f "$m" ] || continue; ` +
+	`printf '%s\t%s\t%s\n' "$d" "$(sed -n '/^$/q; s/^Name: *//p' "$m")" "$(sed -n '/^$/q; s/^Version: *//p' "$m")"; ` +
+	`done; done`
+
+// pipMetadataCommand prints the Python packages of the system-wide site directories.
+var pipMetadataCommand = []string{"sh", "-c", pipMetadataScript}
+
+// pythonVersionPattern matches the Python version in the path of a site directory.
+var pythonVersionPattern = regexp.MustCompile(`/python(3(\.[0-9]+)?)/`)
+
+// pypiSeparators matches the runs of separators pypiName replaces.
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// pythonInterpreter returns the interpreter of the distribution a site directory belongs
+// to, e.g. /usr/bin/python3.11 for /usr/local/lib/python3.11/dist-packages and /usr/bin/python3
+// for /usr/lib/python3/dist-packages of Debian.
+func pythonInterpreter(siteDir string) string {
+	match := pythonVersionPattern.FindStringSubmatch(siteDir + "/")
+	if match == nil {
+		return ""
+	}
+	return "/usr/bin/python" + match[1]
+}
+
+// pypiName normalizes the name of a Python package for its package URL, lower case with
+// runs of hyphens, underscores and periods replaced by a hyphen, e.g. zope-interface for
+// zope.interface.
+func pypiName(name string) string {
+	return strings.ToLower(pypiSeparators.ReplaceAllString(name, "-"))
+}
+
+// collectPip lists the Python packages of the system-wide site directories and nests them
+// in the component of the Python package of the distribution whose interpreter loads them,
+// e.g. python3. Packages of an interpreter the distribution did not install, e.g. one built
+// in /usr/local, are top-level components.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills the running commands.
+// - packageManager: the package manager queried for the owner of the interpreters.
+// - options: the runner and the maximum line size.
+// - packages: the packages of the distribution, their components are changed in place.
+// - index: the index of the last package, top-level components are numbered after it.
+//
+// Returns:
+// - []*pipelineItem: the packages that are not nested.
+// - error: an error if the site directories cannot be read.
+func collectPip(ctx context.Context, packageManager string, options CollectOptions, packages []*pipelineItem, index int) ([]*pipelineItem, error) {
+	runner := runnerOrLocal(options.Runner)
+	type pythonPackage struct {
+		siteDir string
+		name    string
+		version string
+	}
+	var pythonPackages []pythonPackage
+	err := streamCommand(ctx, runner, pipMetadataCommand, options.MaxLineSize, func(line string) {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || fields[1] == "" {
+			return
+		}
+		pythonPackages = append(pythonPackages, pythonPackage{siteDir: fields[0], name: fields[1], version: fields[2]})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading the Python site directories: %v", err)
+	}
+
+	byKey := make(map[string]*pipelineItem)
+	for _, item := range packages {
+		byKey[item.key()] = item
+		if _, ok := byKey[item.name]; !ok {
+			byKey[item.name] = item
+		}
+	}
+	// The interpreters are few, so their owners are queried one by one to tell them apart
+	interpreters := make(map[string]*pipelineItem)
+	for _, pkg := range pythonPackages {
+		interpreter := pythonInterpreter(pkg.siteDir)
+		if _, queried := interpreters[interpreter]; queried || interpreter == "" {
+			continue
+		}
+		interpreters[interpreter] = nil
+		owners, err := fileOwners(ctx, runner, packageManager, []string{interpreter}, options.MaxLineSize)
+		if err != nil {
+			slog.Debug("Error querying the owner of the Python interpreter", "interpreter", interpreter, "error", err)
+			continue
+		}
+		for owner := range owners {
+			if item, ok := byKey[owner]; ok {
+				interpreters[interpreter] = item
+				break
+			}
+		}
+	}
+
+	var items []*pipelineItem
+	refs := make(map[string]bool)
+	nested := 0
+	for _, pkg := range pythonPackages {
+		purl := formatPURL("pypi", "", pypiName(pkg.name), pkg.version, nil)
+		component := cyclonedx.Component{
+			Type:       cyclonedx.ComponentTypeLibrary,
+			Name:       pkg.name,
+			Version:    pkg.version,
+			BOMRef:     stableBOMRef(purl, pkg.name, pkg.version, ""),
+			PackageURL: purl,
+			Properties: &[]cyclonedx.Property{
+				{Name: "distro2sbom:collector", Value: includePip},
+				{Name: "distro2sbom:pip:location", Value: path.Clean(pkg.siteDir)},
+			},
+		}
+		owner := interpreters[pythonInterpreter(pkg.siteDir)]
+		if owner == nil {
+			index++
+			items = append(items, &pipelineItem{
+				index:            index,
+				installedPackage: installedPackage{name: pkg.name, version: pkg.version},
+				component:        component,
+			})
+			continue
+		}
+		// A package installed for several interpreters is nested once per interpreter
+		ref := component.BOMRef
+		for n := 2; refs[component.BOMRef]; n++ {
+			component.BOMRef = ref + "#" + strconv.Itoa(n)
+		}
+		refs[component.BOMRef] = true
+		var components []cyclonedx.Component
+		if owner.component.Components != nil {
+			components = *owner.component.Components
+		}
+		components = append(components, component)
+		owner.component.Components = &components
+		nested++
+	}
+	slog.Info("Listed Python packages", "nested", nested, "components", len(items))
+	return items, nil
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CycloneDX/cyclonedx-go"
+	"golang.org/x/sync/errgroup"
+)
+
+// pipelineBuffer is the number of packages between listing and encoding, it bounds the
+// packages in flight independently of the number of installed packages. The encoded
+// components are kept until the SBOM is written.
+const pipelineBuffer = 64
+
+// warningProperty marks components whose data is incomplete because a command failed.
+const warningProperty = "distro2sbom:warning"
+
+// pipelineItem is a package flowing through the pipeline.
+type pipelineItem struct {
+	// index is the position of the package in the listing, starting at 1. It orders the
+	// components, which are enriched and resolved out of order.
+	index int
+	installedPackage
+	component    cyclonedx.Component
+	dependencies []string
+	// dependencyRefs are the bom-refs of dependencies the collector of the component resolved
+	// itself, e.g. among the Homebrew formulae.
+	dependencyRefs []string
+	// baseline is the data of the package in the baseline if it did not change since.
+	baseline *baselinePackage
+}
+
+// pipeline collects the packages of the host:
+//
+//	list → enrich and resolve → encode
+//
+// Listing streams the output of the package manager and every package is handed to a
+// single pool of options.Workers goroutines as soon as it is listed, which fetches its
+// license and then its dependencies. The licenses and dependencies of the first packages
+// are therefore fetched while the listing is still running, and at most options.Workers
+// package manager commands run at any time.
+type pipeline struct {
+	ctx            context.Context
+	cancel         context.CancelFunc
+	packageManager string
+	// dependencyResolver is the package manager fetching the dependencies of the packages,
+	// see dependencyResolverFor.
+	dependencyResolver string
+	// source is native if the package database is read natively, exec otherwise.
+	source  string
+	options CollectOptions
+	start   time.Time
+	// group runs the packages on at most options.Workers goroutines.
+	group *errgroup.Group
+	// locks holds a slot for the running command of every kind of command holding the
+	// package database lock, so that these run one at a time.
+	locks map[string]chan struct{}
+	// licenses holds the licenses of all packages from a single bulk query, nil if the
+	// package manager has none, lists them with the packages or the query failed.
+	licenses map[string]string
+	// builder builds the components, sharing the supplier and repeated strings.
+	builder *componentBuilder
+
+	mu     sync.Mutex
+	err    error
+	counts map[string]int
+	// finished holds the time the last package of a phase was processed.
+	finished map[string]time.Time
+	timedOut []string
+	warnings []string
+}
+
+// newPipeline creates the pipeline collecting the packages of a distribution.
+//
+// Parameters:
+// - ctx: the context, cancelling it stops the pipeline and kills running commands.
+// - distro: the name of the Linux distribution.
+// - packageManager: the package manager of the distribution.
+// - source: native to read the package database natively, exec to run the package manager.
+// - options: the collectors to run, the number of workers, the command timeout and the progress function.
+//
+// Returns:
+// - *pipeline: the pipeline, it is cancelled once the first package fails.
+func newPipeline(ctx context.Context, distro, packageManager, source string, options CollectOptions) *pipeline {
+	if options.Workers <= 0 {
+		options.Workers = defaultWorkers(packageManager)
+	}
+	options.Runner = runnerOrLocal(options.Runner)
+	ctx, cancel := context.WithCancel(ctx)
+	// The first error cancels ctx through fail, the context of errgroup.WithContext would
+	// also be cancelled once the group finished
+	group := &errgroup.Group{}
+	group.SetLimit(options.Workers)
+	locks := make(map[string]chan struct{})
+	for kind := range lockingCommands[packageManager] {
+		locks[kind] = make(chan struct{}, commandParallelism(packageManager, kind, options.Workers))
+	}
+	return &pipeline{
+		ctx:                ctx,
+		cancel:             cancel,
+		packageManager:     packageManager,
+		dependencyResolver: dependencyResolverFor(distro, getOSVersion(ctx, options.Runner), packageManager),
+		source:             source,
+		options:            options,
+		start:              time.Now(),
+		group:              group,
+		locks:              locks,
+		builder:            newComponentBuilder(distro, packageManager, options.Metadata.packageSupplier(distro)),
+		counts:             make(map[string]int),
+		finished:           make(map[string]time.Time),
+	}
+}
+
+// run lists the packages and fetches the licenses and dependencies of every package.
+//
+// The packages are handed on in the order of the listing. Packages finished ahead of an
+// earlier one wait in a reorder buffer, and listing pauses while pipelineBuffer packages are
+// listed but not handed on, so that a slow package holds up at most pipelineBuffer others.
+//
+// Returns:
+// - <-chan *pipelineItem: the resolved packages in the order of the listing, closed once
+// every package was processed or the pipeline failed.
+func (p *pipeline) run() <-chan *pipelineItem {
+	out := make(chan *pipelineItem, pipelineBuffer)
+	done := make(chan *pipelineItem, pipelineBuffer)
+	// slots holds a slot for every package listed but not handed on yet
+	slots := make(chan struct{}, pipelineBuffer)
+	go func() {
+		defer close(out)
+		pending := make(map[int]*pipelineItem)
+		next := 1
+		for item := range done {
+			pending[item.index] = item
+			for ; pending[next] != nil; next++ {
+				out <- pending[next]
+				delete(pending, next)
+				<-slots
+			}
+		}
+	}()
+	go func() {
+		defer close(done)
+		p.list(func(item *pipelineItem) {
+			select {
+			case slots <- struct{}{}:
+			case <-p.ctx.Done():
+				return
+			}
+			// Blocks while every worker is busy, so that the listing is not read ahead
+			p.group.Go(func() error {
+				if p.ctx.Err() != nil {
+					return nil
+				}
+				if err := p.enrich(item); err != nil {
+					p.fail(err)
+					return err
+				}
+				if err := p.resolve(item); err != nil {
+					p.fail(err)
+					return err
+				}
+				done <- item
+				return nil
+			})
+		})
+		if p.group.Wait() != nil || p.ctx.Err() != nil {
+			return
+		}
+
+		if !p.options.SkipLicenses {
+			p.options.Timings.phase("licenses", p.finishedAfter("licenses"))
+			slog.Info("Fetched licenses", "packages", p.count("licenses"), "workers", p.options.Workers, "duration", p.finishedAfter("licenses"))
+		}
+		if !p.options.SkipDependencies {
+			p.options.Timings.phase("dependencies", p.finishedAfter("dependencies"))
+			slog.Info("Fetched dependencies", "packages", p.count("dependencies"), "workers", p.options.Workers, "duration", p.finishedAfter("dependencies"))
+		}
+	}()
+	return out
+}
+
+// wait releases the pipeline once the channel returned by run is drained.
+//
+// Returns:
+// - []string: the packages whose commands timed out, with the timed out command.
+// - []string: the packages whose commands failed, with the error.
+// - error: the error of the listing or the first failed package, or the error of the context.
+func (p *pipeline) wait() ([]string, []string, error) {
+	p.mu.Lock()
+	err := p.err
+	timedOut := p.timedOut
+	warnings := p.warnings
+	p.mu.Unlock()
+	if err == nil {
+		err = p.ctx.Err()
+	}
+	p.cancel()
+	sort.Strings(timedOut)
+	sort.Strings(warnings)
+	return timedOut, warnings, err
+}
+
+// list streams the installed packages.
+//
+// Parameters:
+// - emit: called with every package as soon as it is listed.
+func (p *pipeline) list(emit func(item *pipelineItem)) {
+	// The licenses are known before the first package is enriched, the native databases
+	// carry them with the packages
+	if !p.options.SkipLicenses && p.source == sourceExec {
+		start := time.Now()
+		licenses, err := fetchLicenses(p.ctx, p.options.Runner, p.packageManager, p.options.MaxLineSize)
+		if licenses != nil {
+			p.options.Timings.command("bulk-licenses", time.Since(start))
+		}
+		if err != nil {
+			if p.ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Error querying the licenses of all packages, querying them one by one", "error", err)
+		} else if licenses != nil {
+			slog.Debug("Queried licenses of all packages", "packages", len(licenses), "duration", time.Since(start))
+		}
+		p.licenses = licenses
+	}
+
+	index := 0
+	listStart := time.Now()
+	list := listPackages
+	if p.source == sourceNative {
+		list = listNativePackages
+	}
+	err := list(p.ctx, p.options.Runner, p.packageManager, p.options.MaxLineSize, func(pkg installedPackage) {
+		index++
+		if license, ok := p.licenses[pkg.key()]; ok && !pkg.hasLicense {
+			pkg.license, pkg.hasLicense = license, true
+		}
+		p.advance("packages")
+		emit(&pipelineItem{index: index, installedPackage: pkg})
+	})
+	if err != nil {
+		p.fail(fmt.Errorf("error listing packages: %v", err))
+		return
+	}
+	if p.ctx.Err() != nil {
+		return
+	}
+	p.options.Timings.command("list", time.Since(listStart))
+	p.options.Timings.phase("listing", time.Since(p.start))
+	slog.Info("Listed packages", "packages", index, "packageManager", p.packageManager, "source", p.source, "duration", time.Since(p.start))
+}
+
+// enrich fetches the licenses of a package and builds its component.
+func (p *pipeline) enrich(item *pipelineItem) error {
+	if baseline, ok := p.options.Baseline.lookup(item.installedPackage); ok {
+		item.baseline = &baseline
+		p.advance("baseline")
+	}
+
+	var licenses []string
+	if !p.options.SkipLicenses {
+		if item.baseline != nil {
+			licenses = item.baseline.licenses
+		} else if item.hasLicense {
+			licenses = listedLicense(p.ctx, p.options.Runner, item.name, item.license)
+		} else if p.options.Cache.get("licenses", p.packageManager, item.installedPackage, &licenses) {
+			p.advance("cached licenses")
+		} else {
+			start := time.Now()
+			completed := false
+			p.command(item.name, "license", func(ctx context.Context) {
+				licenses = FetchPackageLicense(ctx, p.options.Runner, p.packageManager, item.installedPackage)
+				completed = ctx.Err() == nil
+			})
+			if completed {
+				p.options.Cache.put("licenses", p.packageManager, item.installedPackage, licenses)
+			}
+			slog.Debug("Fetched license", "package", item.name, "version", item.version, "licenses", licenses, "duration", time.Since(start))
+		}
+		p.advance("licenses")
+	}
+	item.component = p.builder.component(item.installedPackage, licenses)
+	return nil
+}
+
+// resolve fetches the dependencies of a package.
+func (p *pipeline) resolve(item *pipelineItem) error {
+	if p.options.SkipDependencies {
+		return nil
+	}
+	if item.baseline != nil {
+		item.dependencies = item.baseline.dependencies
+		p.advance("dependencies")
+		return nil
+	}
+	if item.hasDependencies {
+		item.dependencies = item.depends
+		p.advance("dependencies")
+		return nil
+	}
+	if p.options.Cache.get("dependencies", p.dependencyResolver, item.installedPackage, &item.dependencies) {
+		p.advance("cached dependencies")
+		p.advance("dependencies")
+		return nil
+	}
+	start := time.Now()
+	var err error
+	completed := false
+	p.command(item.name, "dependencies", func(ctx context.Context) {
+		item.dependencies, err = fetchDependencies(ctx, p.options.Runner, p.dependencyResolver, item.queryName(p.dependencyResolver), p.options.MaxLineSize)
+		if ctx.Err() == context.DeadlineExceeded {
+			err = nil
+		}
+		completed = ctx.Err() == nil && err == nil
+	})
+	if err != nil {
+		if p.options.Strict {
+			return fmt.Errorf("error getting dependencies of %s: %v", item.name, err)
+		}
+		p.warn(item, "dependencies", err)
+		return nil
+	}
+	if completed {
+		p.options.Cache.put("dependencies", p.dependencyResolver, item.installedPackage, item.dependencies)
+	}
+	slog.Debug("Fetched dependencies", "package", item.name, "dependencies", len(item.dependencies), "duration", time.Since(start))
+	p.advance("dependencies")
+	return nil
+}
+
+// command runs a package manager command of a package, applying the command timeout.
+// A timed out command is recorded instead of failing the pipeline. Commands holding the
+// package database lock wait until no other command of their kind runs.
+//
+// Parameters:
+// - name: the name of the package.
+// - kind: what the command fetches, e.g. license.
+// - run: runs the command with the context of the command.
+func (p *pipeline) command(name, kind string, run func(ctx context.Context)) {
+	if lock, ok := p.locks[kind]; ok {
+		start := time.Now()
+		select {
+		case lock <- struct{}{}:
+		case <-p.ctx.Done():
+			return
+		}
+		defer func() { <-lock }()
+		p.options.Timings.wait(kind, time.Since(start))
+	}
+
+	commandCtx, cancel := commandContext(p.ctx, p.options.CommandTimeout)
+	defer cancel()
+	start := time.Now()
+	run(commandCtx)
+	p.options.Timings.command(kind, time.Since(start))
+	if commandCtx.Err() == context.DeadlineExceeded {
+		slog.Warn("Command timed out", "package", name, "command", kind, "timeout", p.options.CommandTimeout)
+		p.mu.Lock()
+		p.timedOut = append(p.timedOut, name+" ("+kind+")")
+		p.mu.Unlock()
+	}
+}
+
+// warn records a failed command of a package instead of failing the pipeline, the
+// package is kept without the data of the command and marked with a warning property.
+//
+// Parameters:
+// - item: the package.
+// - kind: what the command fetches, e.g. dependencies.
+// - err: the error of the command.
+func (p *pipeline) warn(item *pipelineItem, kind string, err error) {
+	slog.Warn("Command failed, continuing without its data", "package", item.name, "command", kind, "error", err)
+	properties := []cyclonedx.Property{}
+	if item.component.Properties != nil {
+		properties = *item.component.Properties
+	}
+	properties = append(properties, cyclonedx.Property{Name: warningProperty, Value: kind + ": " + err.Error()})
+	item.component.Properties = &properties
+
+	p.mu.Lock()
+	p.warnings = append(p.warnings, item.name+" ("+kind+"): "+err.Error())
+	p.mu.Unlock()
+}
+
+// fail records the error of the listing or a package and cancels the pipeline. Only the
+// first error is kept, errors of commands killed because the pipeline was cancelled are
+// ignored.
+func (p *pipeline) fail(err error) {
+	p.mu.Lock()
+	if p.err == nil && p.ctx.Err() == nil {
+		p.err = err
+	}
+	p.mu.Unlock()
+	p.cancel()
+}
+
+// advance counts a processed package of a phase and reports the progress. The total is
+// the number of packages listed so far, it grows until the listing finished.
+func (p *pipeline) advance(phase string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[phase]++
+	p.finished[phase] = time.Now()
+	p.options.progress(phase, p.counts[phase], p.counts["packages"])
+}
+
+// count returns the number of processed packages of a phase.
+func (p *pipeline) count(phase string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.counts[phase]
+}
+
+// finishedAfter returns the time from the start of the pipeline until the last package
+// of a phase was processed.
+func (p *pipeline) finishedAfter(phase string) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished[phase].IsZero() {
+		return 0
+	}
+	return p.finished[phase].Sub(p.start)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+)
+
+// pkgtoolsListScript lists the installed Slackware packages, which pkgtools records as a file
+// per package named name-version-arch-build in /var/lib/pkgtools/packages, linked from
+// /var/log/packages on Slackware 15 and kept there by older releases.
+const pkgtoolsListScript = `for dir in /var/lib/pkgtools/packages /var/log/packages; do ` +
+	`[ -d "$dir" ] && exec ls -1 "$dir"; done; echo "no pkgtools package database found" >&2; exit 1`
+
+// parsePkgtoolsName parses the name of an installed Slackware package, e.g.
+// bash-5.2.015-x86_64-1 into bash, version 5.2.015-1 and architecture x86_64. The build
+// number is part of the version like the release of rpm packages.
+//
+// Parameters:
+// - name: the name of the package file.
+//
+// Returns:
+// - installedPackage: the package, pkgtools records no dependencies.
+// - bool: whether the name is a package.
+func parsePkgtoolsName(name string) (installedPackage, bool) {
+	parts := strings.Split(name, "-")
+	if len(parts) < 4 {
+		return installedPackage{}, false
+	}
+	n := len(parts)
+	return installedPackage{
+		name:            strings.Join(parts[:n-3], "-"),
+		version:         parts[n-3] + "-" + parts[n-1],
+		arch:            parts[n-2],
+		hasDependencies: true,
+	}, true
+}
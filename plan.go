@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// planPackage is the placeholder shown for the package name in per-package commands.
+const planPackage = "<package>"
+
+// RunPlan lists the actions a run would perform, printed by --dry-run instead of running them.
+type RunPlan struct {
+	Distro         string
+	PackageManager string
+	Commands       []string
+	Collectors     []string
+	Output         string
+	Destinations   []string
+}
+
+// planCollection plans the collection of the SBOM for a distribution.
+//
+// Parameters:
+// - ctx: the context, cancelling it stops checking the package database.
+// - distro: the name of the Linux distribution.
+// - spdxSchema: the location of the SPDX schema.
+// - containerSBOMs: the container SBOM files attached to the host.
+// - workers: the number of commands run in parallel, 0 for the default of the package manager.
+// - source: auto, native or exec, how the packages are collected.
+// - runner: the runner of the scanned system.
+//
+// Returns:
+// - *RunPlan: the plan with the commands and collectors filled in.
+// - error: an error if the distribution is not supported.
+func planCollection(ctx context.Context, distro, spdxSchema string, containerSBOMs []string, workers int, source string, runner Runner) (*RunPlan, error) {
+	packageManager, err := packageManagerFor(distro)
+	if err != nil {
+		return nil, err
+	}
+	source, err = resolveSource(ctx, source, packageManager, runner)
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = defaultWorkers(packageManager)
+	}
+	listArgs, err := listPackagesCommand(packageManager)
+	if err != nil {
+		return nil, err
+	}
+	dependencyResolver := dependencyResolverFor(distro, getOSVersion(ctx, runner), packageManager)
+	dependencyArgs, err := dependencyCommand(dependencyResolver, planPackage)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []string
+	if source == sourceNative {
+		database, err := nativeDatabase(ctx, runner, packageManager)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, "read "+database+" (packages, licenses and dependencies, no commands per package)")
+	} else {
+		commands = append(commands, shellJoin(listArgs))
+		if packageManager == "pacman" {
+			commands[0] += " (also lists the licenses and dependencies)"
+		} else if packageManager == "rpm" {
+			commands[0] += " (also lists the licenses)"
+		} else if bulkArgs := bulkLicenseCommand(packageManager); bulkArgs != nil {
+			commands = append(commands,
+				shellJoin(bulkArgs),
+				shellJoin(licenseCommand(packageManager, planPackage))+" (only for packages missing from the bulk query)")
+		} else if licenseArgs := licenseCommand(packageManager, planPackage); licenseArgs != nil {
+			commands = append(commands, shellJoin(licenseArgs)+parallelism(packageManager, "license", workers))
+		}
+		if packageManager != "pacman" && dependencyArgs != nil {
+			command := shellJoin(dependencyArgs)
+			if dependencyResolver == "zypper" {
+				command += " (followed by " + shellJoin(zypperProvidersCommand([]string{"<requirements>"})) + ")"
+			} else if dependencyResolver == "tdnf" {
+				command += " (followed by " + shellJoin(tdnfProvidersCommand([]string{"<requirements>"})) + ")"
+			}
+			commands = append(commands, command+parallelism(packageManager, "dependencies", workers))
+		}
+	}
+
+	plan := &RunPlan{
+		Distro:         distro,
+		PackageManager: packageManager,
+		Commands:       commands,
+		Collectors: []string{
+			"system: " + describeRunner(runner),
+			"packages: installed " + packageManager + " packages",
+			"licenses: package metadata, falling back to /usr/share/doc/" + planPackage + "/copyright and /usr/share/licenses/" + planPackage + "/LICENSE, validated against " + spdxSchema,
+			"dependencies: package dependencies",
+			"os: version from /etc/os-release",
+		},
+	}
+	if packageManager == "rpm" {
+		plan.Commands = append(plan.Commands, shellJoin(rpmOSTreeStatusCommand)+" (if "+ostreeBootedFile+" exists, followed by rpm-ostree db list of the base image if packages were layered)")
+		plan.Collectors = append(plan.Collectors, "rpm-ostree: base and layered packages and the booted deployment")
+	}
+	for _, path := range containerSBOMs {
+		plan.Collectors = append(plan.Collectors, "container: SBOM from "+path)
+	}
+	return plan, nil
+}
+
+// write prints the plan in a human readable form.
+//
+// Parameters:
+// - w: the writer the plan is printed to.
+func (p *RunPlan) write(w io.Writer) {
+	fmt.Fprintf(w, "Distribution: %s (package manager %s)\n", p.Distro, p.PackageManager)
+	fmt.Fprintln(w, "Commands:")
+	for _, command := range p.Commands {
+		fmt.Fprintf(w, "  %s\n", command)
+	}
+	fmt.Fprintln(w, "Collectors:")
+	for _, collector := range p.Collectors {
+		fmt.Fprintf(w, "  %s\n", collector)
+	}
+	fmt.Fprintf(w, "Output: %s\n", p.Output)
+	fmt.Fprintln(w, "Destinations:")
+	if len(p.Destinations) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, destination := range p.Destinations {
+		fmt.Fprintf(w, "  %s\n", destination)
+	}
+}
+
+// shellJoin joins a command and its arguments, quoting arguments the shell would split or expand.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case strings.ContainsAny(arg, "\t\n"):
+			// ANSI-C quoting keeps control characters on one line
+			arg = "$'" + strings.NewReplacer(`\`, `\\`, "'", `\'`, "\t", `\t`, "\n", `\n`).Replace(arg) + "'"
+		case strings.ContainsAny(arg, " $\\'\"*?{}"):
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// redactURL hides the password of a URL, so that plans can be shared without leaking credentials.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsed.Redacted()
+}
+
+// parallelism describes how many commands of a kind run in parallel.
+func parallelism(packageManager, kind string, workers int) string {
+	if lockingCommands[packageManager][kind] {
+		return " (once per package, one at a time as it holds the package database lock)"
+	}
+	return fmt.Sprintf(" (once per package, %d in parallel)", commandParallelism(packageManager, kind, workers))
+}
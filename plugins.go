@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// pluginPrefix is the file name prefix of collector plugins in the plugin directories.
+const pluginPrefix = "distro2sbom-collector-"
+
+// defaultPluginPaths are the directories searched for collector plugins by default.
+var defaultPluginPaths = []string{"/usr/lib/distro2sbom/plugins", "/etc/distro2sbom/plugins"}
+
+// packageCollector is an opt-in collector of --include adding the packages of another
+// package manager next to the packages of the distribution, e.g. Homebrew.
+type packageCollector struct {
+	// commands are the commands the collector runs, shown by --dry-run, nil if they depend on
+	// the configuration.
+	commands [][]string
+	// description is shown by --dry-run.
+	description string
+	// collect returns the components of the packages, numbered after index. Their
+	// dependencies are resolved by the collector into dependencyRefs. Collectors may nest
+	// components in the components of the packages of the distribution instead.
+	collect func(ctx context.Context, packageManager string, options CollectOptions, packages []*pipelineItem, index int) ([]*pipelineItem, error)
+}
+
+// packageCollectors are the package collectors of --include by name.
+var packageCollectors = map[string]packageCollector{
+	includeHomebrew: {
+		commands:    [][]string{homebrewListCommand, homebrewDepsCommand},
+		description: "formulae of the Homebrew cellar and their dependencies",
+		collect:     collectHomebrew,
+	},
+	includeWinget: {
+		commands:    [][]string{wingetExportCommand},
+		description: "packages installed with winget",
+		collect:     collectWinget,
+	},
+	includeChocolatey: {
+		commands:    [][]string{chocolateyListCommand},
+		description: "packages installed with Chocolatey",
+		collect:     collectChocolatey,
+	},
+	includePip: {
+		commands:    [][]string{pipMetadataCommand},
+		description: "Python packages of the system-wide site directories, nested in the Python package of the distribution",
+		collect:     collectPip,
+	},
+	includeNpm: {
+		commands:    [][]string{npmGlobalCommand},
+		description: "Node.js packages installed globally with npm",
+		collect:     collectNpm,
+	},
+	includeGem: {
+		commands:    [][]string{gemListCommand},
+		description: "Ruby gems installed system-wide",
+		collect:     collectGem,
+	},
+	includeGoBinaries: {
+		// The command depends on --go-binary-path, see goBinaryFindCommand
+		description: "modules and Go version of the Go binaries of the --go-binary-path directories, nested in the binaries",
+		collect:     collectGoBinaries,
+	},
+}
+
+// PluginOutput is the document a collector plugin writes to stdout.
+type PluginOutput struct {
+	Components []PluginComponent `json:"components"`
+}
+
+// PluginComponent is a component reported by a collector plugin.
+type PluginComponent struct {
+	// Name is required, the other fields are optional.
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Type is a CycloneDX component type, default application.
+	Type     string   `json:"type"`
+	PURL     string   `json:"purl"`
+	CPE      string   `json:"cpe"`
+	Supplier string   `json:"supplier"`
+	Licenses []string `json:"licenses"`
+	// DependsOn lists the names of packages or plugin components the component depends on.
+	DependsOn  []string          `json:"dependsOn"`
+	Properties map[string]string `json:"properties"`
+}
+
+// findPlugins returns the collector plugins in the plugin directories.
+//
+// Plugins are executable files named distro2sbom-collector-<name>. A plugin found in
+// several directories is only run from the first one.
+//
+// Parameters:
+// - paths: the plugin directories, missing directories are skipped.
+//
+// Returns:
+// - []string: the paths of the plugins, sorted by name within a directory.
+func findPlugins(paths []string) []string {
+	var plugins []string
+	seen := make(map[string]bool)
+	for _, dir := range paths {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		var names []string
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, pluginPrefix) || seen[name] {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(dir, name))
+			if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			plugins = append(plugins, filepath.Join(dir, name))
+		}
+	}
+	return plugins
+}
+
+// pluginName returns the name of a plugin, its file name without the prefix.
+func pluginName(path string) string {
+	return strings.TrimPrefix(filepath.Base(path), pluginPrefix)
+}
+
+// runPlugin runs a collector plugin and decodes the components it reports.
+//
+// The plugin gets the distribution in DISTRO2SBOM_DISTRO and must write a PluginOutput
+// document to stdout, its stderr is logged.
+//
+// Parameters:
+// - ctx: the context, the plugin is killed when it is cancelled.
+// - path: the path to the plugin.
+// - distro: the name of the Linux distribution.
+//
+// Returns:
+// - []PluginComponent: the components reported by the plugin.
+// - error: an error if the plugin fails or its output cannot be decoded.
+func runPlugin(ctx context.Context, path, distro string) ([]PluginComponent, error) {
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = append(localeSafeEnv(), envPrefix+"_DISTRO="+distro)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if stderr.Len() > 0 {
+		slog.Debug("Plugin output", "plugin", pluginName(path), "stderr", strings.TrimSpace(stderr.String()))
+	}
+	if err != nil && stderr.Len() > 0 {
+		return nil, fmt.Errorf("error running plugin: %v, stderr: %s", err, strings.TrimSpace(stderr.String()))
+	} else if err != nil {
+		return nil, fmt.Errorf("error running plugin: %v", err)
+	}
+
+	var output PluginOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("error decoding plugin output: %v", err)
+	}
+	for i, component := range output.Components {
+		if component.Name == "" {
+			return nil, fmt.Errorf("component %d has no name", i)
+		}
+		if !validComponentType(component.Type) {
+			return nil, fmt.Errorf("component %s has invalid type %q", component.Name, component.Type)
+		}
+	}
+	return output.Components, nil
+}
+
+// pluginComponent builds the CycloneDX component of a component reported by a plugin.
+//
+// Parameters:
+// - plugin: the name of the plugin.
+// - component: the component reported by the plugin.
+//
+// Returns:
+// - cyclonedx.Component: the component, with the plugin recorded as collector property.
+func pluginComponent(plugin string, component PluginComponent) cyclonedx.Component {
+	result := cyclonedx.Component{
+		Type:       cyclonedx.ComponentType(component.Type),
+		Name:       component.Name,
+		Version:    component.Version,
+		BOMRef:     stableBOMRef(component.PURL, component.Name, component.Version, ""),
+		PackageURL: component.PURL,
+		CPE:        component.CPE,
+	}
+	if result.Type == "" {
+		result.Type = cyclonedx.ComponentTypeApplication
+	}
+	if component.Supplier != "" {
+		result.Supplier = &cyclonedx.OrganizationalEntity{Name: component.Supplier}
+	}
+
+	result.Licenses = declaredLicenses(component.Licenses)
+
+	properties := []cyclonedx.Property{{Name: "distro2sbom:collector", Value: "plugin:" + plugin}}
+	keys := make([]string, 0, len(component.Properties))
+	for key := range component.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		properties = append(properties, cyclonedx.Property{Name: key, Value: component.Properties[key]})
+	}
+	result.Properties = &properties
+	return result
+}
+
+// declaredLicenses builds the licenses of a component from the licenses its package declares.
+//
+// Parameters:
+// - licenses: SPDX license identifiers or expressions, e.g. MIT or (MIT OR Apache-2.0).
+//
+// Returns:
+// - *cyclonedx.Licenses: the licenses, expressions for values with spaces or parentheses, nil
+// if there are none.
+func declaredLicenses(licenses []string) *cyclonedx.Licenses {
+	choices := cyclonedx.Licenses{}
+	for _, license := range licenses {
+		if strings.ContainsAny(license, " ()") {
+			choices = append(choices, cyclonedx.LicenseChoice{Expression: license})
+		} else {
+			choices = append(choices, cyclonedx.LicenseChoice{License: &cyclonedx.License{ID: license}})
+		}
+	}
+	if len(choices) == 0 {
+		return nil
+	}
+	return &choices
+}
+
+// collectPlugins runs the collector plugins and appends their components to the packages.
+//
+// A failing plugin is logged and skipped, or fails the run in strict mode.
+//
+// Parameters:
+// - ctx: the context, running plugins are killed when it is cancelled.
+// - distro: the name of the Linux distribution.
+// - options: the plugin directories, the command timeout and the strict mode.
+// - index: the index of the last package, plugin components are numbered after it.
+//
+// Returns:
+// - []*pipelineItem: the components of the plugins.
+// - []string: the plugins that failed, with the error.
+// - error: an error if a plugin failed in strict mode.
+func collectPlugins(ctx context.Context, distro string, options CollectOptions, index int) ([]*pipelineItem, []string, error) {
+	var items []*pipelineItem
+	var warnings []string
+	for _, path := range findPlugins(options.PluginPaths) {
+		name := pluginName(path)
+		start := time.Now()
+		pluginCtx, cancel := commandContext(ctx, options.CommandTimeout)
+		components, err := runPlugin(pluginCtx, path, distro)
+		cancel()
+		options.Timings.command("plugin", time.Since(start))
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			if options.Strict {
+				return nil, nil, fmt.Errorf("plugin %s failed: %v", name, err)
+			}
+			slog.Warn("Plugin failed, continuing without its components", "plugin", name, "error", err)
+			warnings = append(warnings, "plugin "+name+": "+err.Error())
+			continue
+		}
+		for _, component := range components {
+			index++
+			items = append(items, &pipelineItem{
+				index:            index,
+				installedPackage: installedPackage{name: component.Name, version: component.Version},
+				component:        pluginComponent(name, component),
+				dependencies:     component.DependsOn,
+			})
+		}
+		slog.Info("Ran collector plugin", "plugin", name, "components", len(components), "duration", time.Since(start))
+	}
+	return items, warnings, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"time"
+)
+
+// servePprof serves the Go runtime profiles at /debug/pprof/ until the context is cancelled,
+// so that slow hosts can be profiled in the field with go tool pprof.
+//
+// Parameters:
+// - ctx: the context, cancelling it shuts the server down.
+// - addr: the address to listen on, e.g. :6060 or 127.0.0.1:6060.
+//
+// Returns:
+// - error: an error if the server cannot listen.
+func servePprof(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	slog.Info("Serving pprof", "address", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving pprof: %v", err)
+	}
+	return nil
+}
+
+// startProfiles starts profiling a run.
+//
+// Parameters:
+// - cpuProfile: the file the CPU profile is written to, empty to disable it.
+// - memProfile: the file the heap profile is written to when profiling stops, empty to disable it.
+//
+// Returns:
+// - func(): stops profiling and writes the profiles, errors are logged.
+// - error: an error if the CPU profile cannot be started.
+func startProfiles(cpuProfile, memProfile string) (func(), error) {
+	var cpuFile *os.File
+	if cpuProfile != "" {
+		file, err := os.Create(cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("error creating CPU profile: %v", err)
+		}
+		if err := runtimepprof.StartCPUProfile(file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error starting CPU profile: %v", err)
+		}
+		cpuFile = file
+	}
+
+	return func() {
+		if cpuFile != nil {
+			runtimepprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				slog.Warn("Error writing CPU profile", "path", cpuProfile, "error", err)
+			} else {
+				slog.Info("Wrote CPU profile", "path", cpuProfile)
+			}
+		}
+		if memProfile != "" {
+			if err := writeHeapProfile(memProfile); err != nil {
+				slog.Warn("Error writing memory profile", "path", memProfile, "error", err)
+			} else {
+				slog.Info("Wrote memory profile", "path", memProfile)
+			}
+		}
+	}, nil
+}
+
+// writeHeapProfile writes the heap profile after a garbage collection, so that it shows
+// the live memory.
+func writeHeapProfile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := runtimepprof.WriteHeapProfile(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// purlTypes are the package URL types of the packages of a package manager.
+var purlTypes = map[string]string{
+	"dpkg":   "deb",
+	"apk":    "apk",
+	"rpm":    "rpm",
+	"pacman": "alpm",
+	"pkg":    "freebsd",
+}
+
+// purlTypeFor returns the package URL type of a package manager, its name if the
+// package URL specification has no type for it.
+func purlTypeFor(packageManager string) string {
+	if purlType, ok := purlTypes[packageManager]; ok {
+		return purlType
+	}
+	return packageManager
+}
+
+// purlNamespaces are the package URL namespaces of the distributions whose vulnerability
+// databases use another name than distro2sbom, distributions missing here use their name.
+var purlNamespaces = map[string]string{
+	"amazonlinux": "amazon",
+}
+
+// purlNamespaceFor returns the package URL namespace of the packages of a distribution.
+func purlNamespaceFor(distro string) string {
+	distro = strings.ToLower(distro)
+	if namespace, ok := purlNamespaces[distro]; ok {
+		return namespace
+	}
+	return distro
+}
+
+// formatPURL builds a package URL, percent-encoding the namespace, name, version and
+// qualifier values, e.g. pkg:deb/debian/libstdc%2B%2B6@12.2.0-14%2Bdeb12u1?arch=amd64.
+//
+// Parameters:
+// - purlType: the package URL type, e.g. deb.
+// - namespace: the namespace, e.g. the distribution, empty for none. Its segments are
+// separated by slashes, e.g. github.com/spf13 of a Go module.
+// - name: the name of the package.
+// - version: the version of the package, empty for none.
+// - qualifiers: the qualifiers, sorted by key and left out if their value is empty.
+//
+// Returns:
+// - string: the package URL.
+func formatPURL(purlType, namespace, name, version string, qualifiers map[string]string) string {
+	var purl strings.Builder
+	purl.WriteString("pkg:" + strings.ToLower(purlType) + "/")
+	if namespace != "" {
+		for _, segment := range strings.Split(namespace, "/") {
+			purl.WriteString(purlEscape(segment) + "/")
+		}
+	}
+	purl.WriteString(purlEscape(name))
+	if version != "" {
+		purl.WriteString("@" + purlEscape(version))
+	}
+
+	keys := make([]string, 0, len(qualifiers))
+	for key, value := range qualifiers {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		if i == 0 {
+			purl.WriteByte('?')
+		} else {
+			purl.WriteByte('&')
+		}
+		purl.WriteString(strings.ToLower(key) + "=" + purlEscape(qualifiers[key]))
+	}
+	return purl.String()
+}
+
+// purlEscape percent-encodes a component of a package URL. Only letters, digits, period,
+// hyphen and underscore are kept, so that the epoch colon, the tilde and plus of Debian
+// revisions and the like are unambiguous for every parser.
+func purlEscape(value string) string {
+	return percentEncode(value, ".-_")
+}
+
+// percentEncode percent-encodes every byte of a value other than letters, digits and the
+// unreserved characters given, as upper case hexadecimal.
+//
+// Parameters:
+// - value: the value to encode.
+// - unreserved: the characters besides letters and digits that are kept.
+//
+// Returns:
+// - string: the encoded value.
+func percentEncode(value, unreserved string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.IndexByte(unreserved, c) >= 0:
+			escaped.WriteByte(c)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+// validatePURL checks that a package URL has the form pkg:type/[namespace/]name[@version]
+// with a valid type and percent-encoding.
+//
+// Parameters:
+// - purl: the package URL.
+//
+// Returns:
+// - error: an error describing the first problem, nil if the package URL is valid.
+func validatePURL(purl string) error {
+	rest, ok := strings.CutPrefix(purl, "pkg:")
+	if !ok {
+		return fmt.Errorf("scheme is not pkg")
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, qualifiers, _ := strings.Cut(rest, "?")
+	purlType, path, ok := strings.Cut(strings.TrimLeft(rest, "/"), "/")
+	if !ok || purlType == "" {
+		return fmt.Errorf("type is missing")
+	}
+	for i := 0; i < len(purlType); i++ {
+		c := purlType[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && (c >= '0' && c <= '9' || c == '.' || c == '+' || c == '-')) {
+			return fmt.Errorf("invalid type %q", purlType)
+		}
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	name, _, _ := strings.Cut(segments[len(segments)-1], "@")
+	if name == "" {
+		return fmt.Errorf("name is missing")
+	}
+	for _, segment := range segments {
+		if _, err := url.PathUnescape(segment); err != nil {
+			return fmt.Errorf("invalid percent-encoding in %q", segment)
+		}
+	}
+	if qualifiers != "" {
+		for _, qualifier := range strings.Split(qualifiers, "&") {
+			key, value, ok := strings.Cut(qualifier, "=")
+			if !ok || key == "" || value == "" {
+				return fmt.Errorf("invalid qualifier %q", qualifier)
+			}
+			if _, err := url.QueryUnescape(value); err != nil {
+				return fmt.Errorf("invalid percent-encoding in qualifier %q", qualifier)
+			}
+		}
+	}
+	return nil
+}
+
+// purlList returns the package URLs of the components of an SBOM and the components nested
+// in them, one per line, sorted and without duplicates, as read by tools like osv-scanner.
+//
+// Parameters:
+// - bom: the SBOM.
+//
+// Returns:
+// - []byte: the package URLs, each followed by a newline. Components without package URL
+// are left out.
+func purlList(bom *cyclonedx.BOM) []byte {
+	var purls []string
+	var add func(components *[]cyclonedx.Component)
+	add = func(components *[]cyclonedx.Component) {
+		if components == nil {
+			return
+		}
+		for _, component := range *components {
+			if component.PackageURL != "" {
+				purls = append(purls, component.PackageURL)
+			}
+			add(component.Components)
+		}
+	}
+	add(bom.Components)
+	sort.Strings(purls)
+	purls = slices.Compact(purls)
+	var list strings.Builder
+	for _, purl := range purls {
+		list.WriteString(purl + "\n")
+	}
+	return []byte(list.String())
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestREADMEListsEveryEnvironmentVariable(t *testing.T) {
+	readme, err := os.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// | `DISTRO2SBOM_API_URL` | `--api-url` |
+	rows := regexp.MustCompile("(?m)^\\| `("+envPrefix+"_[A-Z0-9_]+)` \\| `--([a-z0-9-]+)` \\|$").FindAllStringSubmatch(string(readme), -1)
+	listed := make(map[string]string)
+	for _, row := range rows {
+		listed[row[2]] = row[1]
+	}
+
+	rootCmd := newRootCmd()
+	check := func(flag *pflag.Flag) {
+		want := envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(flag.Name, "-", "_"))
+		if variable, ok := listed[flag.Name]; !ok {
+			t.Errorf("README lists no environment variable for --%s, want %s", flag.Name, want)
+		} else if variable != want {
+			t.Errorf("README lists %s for --%s, want %s", variable, flag.Name, want)
+		}
+	}
+	rootCmd.Flags().VisitAll(check)
+	rootCmd.PersistentFlags().VisitAll(check)
+
+	for name, variable := range listed {
+		if rootCmd.Flags().Lookup(name) == nil && rootCmd.PersistentFlags().Lookup(name) == nil {
+			t.Errorf("README lists %s for --%s, which is no flag", variable, name)
+		}
+	}
+}
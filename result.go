@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RunResult is the machine-readable description of a run written by --result-json, so that
+// orchestration systems can evaluate runs without parsing logs.
+type RunResult struct {
+	Result          string             `json:"result"`
+	ExitCode        int                `json:"exitCode"`
+	Error           string             `json:"error,omitempty"`
+	Hostname        string             `json:"hostname"`
+	Distro          string             `json:"distro"`
+	Started         string             `json:"started"`
+	DurationSeconds float64            `json:"durationSeconds"`
+	Durations       map[string]float64 `json:"durations,omitempty"`
+	Components      int                `json:"components"`
+	Dependencies    int                `json:"dependencies"`
+	UnknownLicenses int                `json:"unknownLicenses"`
+	Warnings        []string           `json:"warnings"`
+	Destinations    []string           `json:"destinations"`
+	Timings         *TimingsReport     `json:"timings,omitempty"`
+	// Checksums are the digests of the SBOM file by algorithm, if --checksum is set.
+	Checksums map[string]string `json:"checksums,omitempty"`
+	// Uploads are the outcomes of the destinations of the configuration file.
+	Uploads []UploadResult `json:"uploads,omitempty"`
+}
+
+// writeRunResult writes the result of a run as JSON.
+//
+// Parameters:
+// - path: the file the result is written to.
+// - event: the completion event of the run.
+// - startTime: the time the run started.
+//
+// Returns:
+// - error: an error if the file cannot be written.
+func writeRunResult(path string, event RunEvent, startTime time.Time) error {
+	resultJSON, err := runResultJSON(event, startTime)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, resultJSON, 0644)
+}
+
+// runResultJSON encodes the result of a run as JSON.
+//
+// Parameters:
+// - event: the completion event of the run.
+// - startTime: the time the run started.
+//
+// Returns:
+// - []byte: the indented JSON with a trailing newline.
+// - error: an error if the result cannot be encoded.
+func runResultJSON(event RunEvent, startTime time.Time) ([]byte, error) {
+	result := RunResult{
+		Result:          event.Result,
+		ExitCode:        event.ExitCode,
+		Error:           event.Error,
+		Hostname:        event.Hostname,
+		Distro:          event.Distro,
+		Started:         startTime.UTC().Format(time.RFC3339),
+		DurationSeconds: event.Duration.Seconds(),
+		Components:      event.Components,
+		Dependencies:    event.Dependencies,
+		UnknownLicenses: event.UnknownLicenses,
+		Warnings:        event.Warnings,
+		Destinations:    event.Destinations,
+		Timings:         event.Timings.report(),
+		Checksums:       event.Checksums,
+		Uploads:         event.Uploads,
+	}
+	if len(event.Durations) > 0 {
+		result.Durations = make(map[string]float64)
+		for phase, duration := range event.Durations {
+			result.Durations[phase] = duration.Seconds()
+		}
+	}
+	// Empty lists are written as [], so that consumers need not handle null
+	if result.Warnings == nil {
+		result.Warnings = []string{}
+	}
+	if result.Destinations == nil {
+		result.Destinations = []string{}
+	}
+
+	resultJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(resultJSON, '\n'), nil
+}
@@ -0,0 +1,797 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// rpmDatabases are the rpm databases of the formats distro2sbom reads natively, newest format
+// first: SQLite of Fedora 33 and RHEL 9, ndb of openSUSE and SLES 15 and Berkeley DB of RHEL 8,
+// CentOS and Amazon Linux 2. Newer releases keep them in /usr/lib/sysimage/rpm.
+var rpmDatabases = []string{
+	"/var/lib/rpm/rpmdb.sqlite",
+	"/var/lib/rpm/Packages.db",
+	"/var/lib/rpm/Packages",
+	"/usr/lib/sysimage/rpm/rpmdb.sqlite",
+	"/usr/lib/sysimage/rpm/Packages.db",
+	"/usr/lib/sysimage/rpm/Packages",
+}
+
+// The tags of the rpm header entries the reader uses.
+const (
+	rpmTagName         = 1000
+	rpmTagVersion      = 1001
+	rpmTagRelease      = 1002
+	rpmTagBuildTime    = 1006
+	rpmTagVendor       = 1011
+	rpmTagLicense      = 1014
+	rpmTagArch         = 1022
+	rpmTagOldFilenames = 1027
+	rpmTagSourceRPM    = 1044
+	rpmTagProvideName  = 1047
+	rpmTagRequireName  = 1049
+	rpmTagDirIndexes   = 1116
+	rpmTagBaseNames    = 1117
+	rpmTagDirNames     = 1118
+)
+
+// The types of the rpm header entries the reader decodes.
+const (
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// rpmHeader is a package header of the rpm database, the header of the package file without
+// its lead and signature.
+type rpmHeader struct {
+	entries map[int32]rpmHeaderEntry
+	data    []byte
+}
+
+// rpmHeaderEntry locates the value of a tag in the data of a header.
+type rpmHeaderEntry struct {
+	typ    int32
+	offset int32
+	count  int32
+}
+
+// parseRPMHeader decodes the index of a header blob, the number of index entries and data
+// bytes followed by the entries and the data, all big-endian.
+//
+// Parameters:
+// - blob: the header blob stored in the rpm database.
+//
+// Returns:
+// - *rpmHeader: the header.
+// - error: an error if the blob is truncated.
+func parseRPMHeader(blob []byte) (*rpmHeader, error) {
+	if len(blob) < 8 {
+		return nil, errors.New("truncated rpm header")
+	}
+	indexLength := int64(binary.BigEndian.Uint32(blob[0:4]))
+	dataLength := int64(binary.BigEndian.Uint32(blob[4:8]))
+	dataStart := 8 + indexLength*16
+	if dataStart+dataLength > int64(len(blob)) {
+		return nil, errors.New("truncated rpm header")
+	}
+	header := &rpmHeader{
+		entries: make(map[int32]rpmHeaderEntry, indexLength),
+		data:    blob[dataStart : dataStart+dataLength],
+	}
+	for i := int64(0); i < indexLength; i++ {
+		entry := blob[8+i*16 : 8+i*16+16]
+		header.entries[int32(binary.BigEndian.Uint32(entry[0:4]))] = rpmHeaderEntry{
+			typ:    int32(binary.BigEndian.Uint32(entry[4:8])),
+			offset: int32(binary.BigEndian.Uint32(entry[8:12])),
+			count:  int32(binary.BigEndian.Uint32(entry[12:16])),
+		}
+	}
+	return header, nil
+}
+
+// strings returns the string values of a tag, none if the header lacks it.
+func (h *rpmHeader) strings(tag int32) []string {
+	entry, ok := h.entries[tag]
+	if !ok || entry.offset < 0 || int(entry.offset) >= len(h.data) {
+		return nil
+	}
+	count := 1
+	switch entry.typ {
+	case rpmTypeString:
+	case rpmTypeStringArray:
+		if entry.count < 0 {
+			return nil
+		}
+		count = int(entry.count)
+	case rpmTypeI18NString:
+		// The first of the translations is the untranslated value
+	default:
+		return nil
+	}
+	values := make([]string, 0, min(count, len(h.data)))
+	data := h.data[entry.offset:]
+	for i := 0; i < count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			break
+		}
+		values = append(values, string(data[:end]))
+		data = data[end+1:]
+	}
+	return values
+}
+
+// string returns the string value of a tag, empty if the header lacks it.
+func (h *rpmHeader) string(tag int32) string {
+	if values := h.strings(tag); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// int32s returns the integer values of a tag, none if the header lacks it.
+func (h *rpmHeader) int32s(tag int32) []int32 {
+	entry, ok := h.entries[tag]
+	if !ok || entry.typ != rpmTypeInt32 || entry.offset < 0 || entry.count < 0 ||
+		int64(entry.offset)+int64(entry.count)*4 > int64(len(h.data)) {
+		return nil
+	}
+	values := make([]int32, entry.count)
+	for i := range values {
+		values[i] = int32(binary.BigEndian.Uint32(h.data[int(entry.offset)+i*4:]))
+	}
+	return values
+}
+
+// files returns the paths of the files of a package, joined from their directories and base
+// names or listed whole by packages built before rpm 4.
+func (h *rpmHeader) files() []string {
+	baseNames := h.strings(rpmTagBaseNames)
+	if len(baseNames) == 0 {
+		return h.strings(rpmTagOldFilenames)
+	}
+	dirNames := h.strings(rpmTagDirNames)
+	dirIndexes := h.int32s(rpmTagDirIndexes)
+	files := make([]string, 0, len(baseNames))
+	for i, baseName := range baseNames {
+		if i < len(dirIndexes) && dirIndexes[i] >= 0 && int(dirIndexes[i]) < len(dirNames) {
+			files = append(files, dirNames[dirIndexes[i]]+baseName)
+		}
+	}
+	return files
+}
+
+// openRandomAccess opens a file of the scanned system for random access. Files of the local
+// host and root file systems are read where needed, files of remote hosts are read whole.
+//
+// Parameters:
+// - ctx: the context.
+// - runner: the runner of the scanned system.
+// - file: the path of the file.
+//
+// Returns:
+// - io.ReaderAt: the content of the file.
+// - int64: the size of the file.
+// - func() error: closes the file.
+// - error: an error if the file cannot be read.
+func openRandomAccess(ctx context.Context, runner Runner, file string) (io.ReaderAt, int64, func() error, error) {
+	f, err := runner.Open(ctx, file)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if osFile, ok := f.(*os.File); ok {
+		info, err := osFile.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, nil, err
+		}
+		return osFile, info.Size(), f.Close, nil
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return bytes.NewReader(data), int64(len(data)), func() error { return nil }, nil
+}
+
+// readRPMDatabase streams the packages of the rpm database without running rpm.
+//
+// The requirements of the packages are resolved to the installed packages providing them,
+// by capability or file, like the rpm queries of the exec source. Requirements on rpm
+// features and rich dependencies are skipped likewise.
+//
+// Parameters:
+// - ctx: the context, cancelling it stops reading.
+// - runner: the runner of the scanned system the database is read from.
+// - database: the path of the database, its name tells its format.
+// - emit: called with every package in the order of the database.
+//
+// Returns:
+// - error: an error if the database cannot be read.
+func readRPMDatabase(ctx context.Context, runner Runner, database string, emit func(pkg installedPackage)) error {
+	reader, size, closeDatabase, err := openRandomAccess(ctx, runner, database)
+	if err != nil {
+		return fmt.Errorf("error reading package database: %v", err)
+	}
+	defer closeDatabase()
+
+	var packages []installedPackage
+	var requires [][]string
+	providers := make(map[string][]string)
+	addProvider := func(capability, name string) {
+		for _, provider := range providers[capability] {
+			if provider == name {
+				return
+			}
+		}
+		providers[capability] = append(providers[capability], name)
+	}
+	readBlob := func(blob []byte) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		header, err := parseRPMHeader(blob)
+		if err != nil {
+			return err
+		}
+		name := header.string(rpmTagName)
+		if name == "" {
+			return nil
+		}
+		pkg := installedPackage{
+			name:            name,
+			version:         header.string(rpmTagVersion) + "-" + header.string(rpmTagRelease),
+			arch:            header.string(rpmTagArch),
+			license:         header.string(rpmTagLicense),
+			hasLicense:      true,
+			vendor:          header.string(rpmTagVendor),
+			sourcePackage:   header.string(rpmTagSourceRPM),
+			hasDependencies: true,
+		}
+		if buildTime := header.int32s(rpmTagBuildTime); len(buildTime) > 0 {
+			pkg.buildTime = time.Unix(int64(uint32(buildTime[0])), 0)
+		}
+		packages = append(packages, pkg)
+		requires = append(requires, header.strings(rpmTagRequireName))
+		for _, capability := range header.strings(rpmTagProvideName) {
+			addProvider(capability, name)
+		}
+		for _, file := range header.files() {
+			addProvider(file, name)
+		}
+		return nil
+	}
+
+	switch path.Base(database) {
+	case "rpmdb.sqlite":
+		err = readSQLiteRPMDatabase(reader, size, readBlob)
+	case "Packages.db":
+		err = readNDBRPMDatabase(reader, size, readBlob)
+	default:
+		err = readBDBRPMDatabase(reader, size, readBlob)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("error reading package database %s: %v", database, err)
+	}
+
+	for i, pkg := range packages {
+		seen := make(map[string]bool)
+		for _, requirement := range requires[i] {
+			if strings.HasPrefix(requirement, "rpmlib(") || strings.HasPrefix(requirement, "(") {
+				continue
+			}
+			for _, provider := range providers[requirement] {
+				if !seen[provider] {
+					seen[provider] = true
+					pkg.depends = append(pkg.depends, provider)
+				}
+			}
+		}
+		emit(pkg)
+	}
+	return nil
+}
+
+// readSQLiteRPMDatabase reads the header blobs of the Packages table of an rpmdb.sqlite,
+// walking the table b-tree of the SQLite file format.
+//
+// Parameters:
+// - reader: the database file.
+// - size: the size of the file.
+// - fn: called with every header blob.
+//
+// Returns:
+// - error: an error if the file is not a SQLite database with a Packages table, or fn fails.
+func readSQLiteRPMDatabase(reader io.ReaderAt, size int64, fn func(blob []byte) error) error {
+	header := make([]byte, 100)
+	if _, err := reader.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if string(header[:16]) != "SQLite format 3\x00" {
+		return errors.New("not a SQLite database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 {
+		return errors.New("invalid SQLite page size")
+	}
+	db := &sqliteFile{reader: reader, pages: uint32(size / int64(pageSize)), pageSize: pageSize, usableSize: pageSize - int(header[20])}
+
+	// The schema table on page 1 names the root page of every table
+	var root uint64
+	err := db.walkTable(1, func(payload []byte) error {
+		columns, err := sqliteRecord(payload)
+		if err != nil || len(columns) < 4 {
+			return err
+		}
+		if string(columns[0].value) == "table" && string(columns[1].value) == "Packages" {
+			root = columns[3].integer()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if root == 0 || root > uint64(db.pages) {
+		return errors.New("no Packages table")
+	}
+	// CREATE TABLE Packages (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)
+	return db.walkTable(uint32(root), func(payload []byte) error {
+		columns, err := sqliteRecord(payload)
+		if err != nil {
+			return err
+		}
+		if len(columns) < 2 {
+			return errors.New("invalid Packages row")
+		}
+		return fn(columns[1].value)
+	})
+}
+
+// sqliteFile reads the pages of a SQLite database file.
+type sqliteFile struct {
+	reader     io.ReaderAt
+	pages      uint32
+	pageSize   int
+	usableSize int
+}
+
+// page reads a page, numbered from 1.
+func (db *sqliteFile) page(number uint32) ([]byte, error) {
+	if number == 0 || number > db.pages {
+		return nil, fmt.Errorf("invalid SQLite page %d", number)
+	}
+	page := make([]byte, db.pageSize)
+	if _, err := db.reader.ReadAt(page, int64(number-1)*int64(db.pageSize)); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// walkTable calls fn with the payload of every row of the table b-tree rooted at a page, in
+// rowid order.
+func (db *sqliteFile) walkTable(root uint32, fn func(payload []byte) error) error {
+	visited := make(map[uint32]bool)
+	var walk func(number uint32) error
+	walk = func(number uint32) error {
+		if visited[number] {
+			return fmt.Errorf("SQLite page %d is referenced twice", number)
+		}
+		visited[number] = true
+		page, err := db.page(number)
+		if err != nil {
+			return err
+		}
+		// The first page starts with the database header
+		start := 0
+		if number == 1 {
+			start = 100
+		}
+		if start+12 > len(page) {
+			return fmt.Errorf("invalid SQLite page %d", number)
+		}
+		kind := page[start]
+		cells := int(binary.BigEndian.Uint16(page[start+3:]))
+		pointers := start + 8
+		if kind == 0x05 {
+			pointers = start + 12
+		}
+		if pointers+cells*2 > len(page) {
+			return fmt.Errorf("invalid SQLite page %d", number)
+		}
+		for i := 0; i < cells; i++ {
+			offset := int(binary.BigEndian.Uint16(page[pointers+i*2:]))
+			if offset+4 > len(page) {
+				return fmt.Errorf("invalid cell on SQLite page %d", number)
+			}
+			switch kind {
+			case 0x05:
+				// Interior page: the left child followed by the largest rowid in it
+				if err := walk(binary.BigEndian.Uint32(page[offset:])); err != nil {
+					return err
+				}
+			case 0x0d:
+				payload, err := db.payload(page, offset)
+				if err != nil {
+					return fmt.Errorf("invalid cell on SQLite page %d: %v", number, err)
+				}
+				if err := fn(payload); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("SQLite page %d is not a table page", number)
+			}
+		}
+		if kind == 0x05 {
+			return walk(binary.BigEndian.Uint32(page[start+8:]))
+		}
+		return nil
+	}
+	return walk(root)
+}
+
+// payload returns the payload of a cell of a table leaf page, joined with the overflow pages
+// of payloads larger than the page.
+func (db *sqliteFile) payload(page []byte, offset int) ([]byte, error) {
+	size, n := sqliteVarint(page[offset:])
+	if n == 0 {
+		return nil, errors.New("truncated payload size")
+	}
+	offset += n
+	// The rowid
+	if _, n = sqliteVarint(page[offset:]); n == 0 {
+		return nil, errors.New("truncated rowid")
+	}
+	offset += n
+
+	// The part of the payload stored on the page, as defined by the file format
+	usable := uint64(db.usableSize)
+	maxLocal := usable - 35
+	minLocal := (usable-12)*32/255 - 23
+	local := size
+	if size > maxLocal {
+		local = minLocal + (size-minLocal)%(usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if uint64(offset)+local > uint64(len(page)) {
+		return nil, errors.New("truncated payload")
+	}
+	payload := make([]byte, 0, size)
+	payload = append(payload, page[offset:offset+int(local)]...)
+	if local == size {
+		return payload, nil
+	}
+	if offset+int(local)+4 > len(page) {
+		return nil, errors.New("truncated overflow page number")
+	}
+	next := binary.BigEndian.Uint32(page[offset+int(local):])
+	for uint64(len(payload)) < size {
+		if next == 0 || len(payload) > int(db.pages)*db.usableSize {
+			return nil, errors.New("truncated overflow chain")
+		}
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = binary.BigEndian.Uint32(overflow)
+		chunk := overflow[4:db.usableSize]
+		if remaining := size - uint64(len(payload)); uint64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		payload = append(payload, chunk...)
+	}
+	return payload, nil
+}
+
+// sqliteVarint decodes a variable-length integer of the SQLite file format.
+//
+// Returns the value and the number of bytes read, 0 if the buffer is truncated.
+func sqliteVarint(buf []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < 9 && i < len(buf); i++ {
+		if i == 8 {
+			return value<<8 | uint64(buf[i]), 9
+		}
+		value = value<<7 | uint64(buf[i]&0x7f)
+		if buf[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// sqliteColumn is a value of a SQLite record.
+type sqliteColumn struct {
+	serialType uint64
+	value      []byte
+}
+
+// integer returns the value of an integer column, 0 for other types.
+func (c sqliteColumn) integer() uint64 {
+	switch {
+	case c.serialType >= 1 && c.serialType <= 6:
+		var value uint64
+		for _, b := range c.value {
+			value = value<<8 | uint64(b)
+		}
+		return value
+	case c.serialType == 9:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// sqliteRecord decodes the columns of a record of the SQLite file format.
+func sqliteRecord(payload []byte) ([]sqliteColumn, error) {
+	headerSize, n := sqliteVarint(payload)
+	if n == 0 || headerSize > uint64(len(payload)) {
+		return nil, errors.New("invalid SQLite record")
+	}
+	var columns []sqliteColumn
+	body := payload[headerSize:]
+	for position := n; position < int(headerSize); {
+		serialType, n := sqliteVarint(payload[position:headerSize])
+		if n == 0 {
+			return nil, errors.New("invalid SQLite record")
+		}
+		position += n
+		var length uint64
+		switch {
+		case serialType <= 4:
+			length = serialType
+		case serialType == 5:
+			length = 6
+		case serialType == 6 || serialType == 7:
+			length = 8
+		case serialType >= 12:
+			length = (serialType - 12) / 2
+		}
+		if length > uint64(len(body)) {
+			return nil, errors.New("truncated SQLite record")
+		}
+		columns = append(columns, sqliteColumn{serialType: serialType, value: body[:length]})
+		body = body[length:]
+	}
+	return columns, nil
+}
+
+// The layout of the ndb Packages.db of rpm, its integers are little-endian.
+const (
+	ndbHeaderMagic = 'R' | 'p'<<8 | 'm'<<16 | 'P'<<24
+	ndbSlotMagic   = 'S' | 'l'<<8 | 'o'<<16 | 't'<<24
+	ndbBlobMagic   = 'B' | 'l'<<8 | 'b'<<16 | 'S'<<24
+	ndbPageSize    = 4096
+	ndbHeaderSize  = 32
+	ndbSlotSize    = 16
+	ndbBlockSize   = 16
+)
+
+// readNDBRPMDatabase reads the header blobs of the ndb Packages.db of rpm. Its first pages
+// hold a slot per package locating its blob in the blocks after them.
+//
+// Parameters:
+// - reader: the database file.
+// - size: the size of the file.
+// - fn: called with every header blob.
+//
+// Returns:
+// - error: an error if the file is not an ndb database, or fn fails.
+func readNDBRPMDatabase(reader io.ReaderAt, size int64, fn func(blob []byte) error) error {
+	header := make([]byte, ndbHeaderSize)
+	if _, err := reader.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(header[0:]) != ndbHeaderMagic {
+		return errors.New("not an ndb database")
+	}
+	if version := binary.LittleEndian.Uint32(header[4:]); version != 0 {
+		return fmt.Errorf("unsupported ndb version %d", version)
+	}
+	slotsSize := int64(binary.LittleEndian.Uint32(header[12:])) * ndbPageSize
+	if slotsSize > size {
+		return errors.New("truncated ndb database")
+	}
+	slots := make([]byte, slotsSize)
+	if _, err := reader.ReadAt(slots, 0); err != nil {
+		return err
+	}
+	// The slots follow the header
+	for offset := ndbHeaderSize; offset+ndbSlotSize <= len(slots); offset += ndbSlotSize {
+		slot := slots[offset : offset+ndbSlotSize]
+		if binary.LittleEndian.Uint32(slot[0:]) != ndbSlotMagic {
+			return errors.New("invalid ndb slot")
+		}
+		packageIndex := binary.LittleEndian.Uint32(slot[4:])
+		if packageIndex == 0 {
+			continue
+		}
+		blobOffset := int64(binary.LittleEndian.Uint32(slot[8:])) * ndbBlockSize
+		blobHeader := make([]byte, 16)
+		if _, err := reader.ReadAt(blobHeader, blobOffset); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(blobHeader[0:]) != ndbBlobMagic || binary.LittleEndian.Uint32(blobHeader[4:]) != packageIndex {
+			return fmt.Errorf("invalid ndb blob of package %d", packageIndex)
+		}
+		blobLength := int64(binary.LittleEndian.Uint32(blobHeader[12:]))
+		if blobOffset+16+blobLength > size {
+			return fmt.Errorf("truncated ndb blob of package %d", packageIndex)
+		}
+		blob := make([]byte, blobLength)
+		if _, err := reader.ReadAt(blob, blobOffset+16); err != nil {
+			return err
+		}
+		if err := fn(blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The layout of the Berkeley DB hash database of rpm, its integers are in the byte order
+// of the host that wrote it.
+const (
+	bdbHashMagic      = 0x061561
+	bdbPageHeaderSize = 26
+	// Page types
+	bdbHashUnsortedPage = 2
+	bdbOverflowPage     = 7
+	bdbHashPage         = 13
+	// Item types of hash pages
+	bdbKeyData = 1
+	bdbOffPage = 3
+)
+
+// readBDBRPMDatabase reads the header blobs of the Berkeley DB hash Packages of rpm. The
+// hash pages hold pairs of the package number and its header, which is stored on a chain of
+// overflow pages unless it is small.
+//
+// Parameters:
+// - reader: the database file.
+// - size: the size of the file.
+// - fn: called with every header blob.
+//
+// Returns:
+// - error: an error if the file is not a Berkeley DB hash database, or fn fails.
+func readBDBRPMDatabase(reader io.ReaderAt, size int64, fn func(blob []byte) error) error {
+	meta := make([]byte, 72)
+	if _, err := reader.ReadAt(meta, 0); err != nil {
+		return err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if order.Uint32(meta[12:]) != bdbHashMagic {
+		order = binary.BigEndian
+		if order.Uint32(meta[12:]) != bdbHashMagic {
+			return errors.New("not a Berkeley DB hash database")
+		}
+	}
+	if meta[24] != 0 {
+		return errors.New("encrypted Berkeley DB databases are not supported")
+	}
+	pageSize := int64(order.Uint32(meta[20:]))
+	if pageSize < 512 || pageSize > 65536 {
+		return errors.New("invalid Berkeley DB page size")
+	}
+	lastPage := min(int64(order.Uint32(meta[32:])), size/pageSize-1)
+
+	readPage := func(number int64) ([]byte, error) {
+		if number <= 0 || number > lastPage {
+			return nil, fmt.Errorf("invalid Berkeley DB page %d", number)
+		}
+		page := make([]byte, pageSize)
+		_, err := reader.ReadAt(page, number*pageSize)
+		return page, err
+	}
+	// readOverflow joins the chain of overflow pages of an item stored off the hash page
+	readOverflow := func(number int64, length int64) ([]byte, error) {
+		data := make([]byte, 0, length)
+		for int64(len(data)) < length {
+			page, err := readPage(number)
+			if err != nil {
+				return nil, err
+			}
+			if page[25] != bdbOverflowPage {
+				return nil, fmt.Errorf("Berkeley DB page %d is not an overflow page", number)
+			}
+			// The used length of an overflow page is kept in its high free offset
+			used := int64(order.Uint16(page[22:]))
+			if bdbPageHeaderSize+used > pageSize {
+				return nil, fmt.Errorf("invalid Berkeley DB overflow page %d", number)
+			}
+			data = append(data, page[bdbPageHeaderSize:bdbPageHeaderSize+used]...)
+			number = int64(order.Uint32(page[16:]))
+			if number == 0 {
+				break
+			}
+		}
+		if int64(len(data)) < length {
+			return nil, errors.New("truncated Berkeley DB overflow chain")
+		}
+		return data[:length], nil
+	}
+
+	for number := int64(1); number <= lastPage; number++ {
+		page, err := readPage(number)
+		if err != nil {
+			return err
+		}
+		if page[25] != bdbHashPage && page[25] != bdbHashUnsortedPage {
+			continue
+		}
+		entries := int(order.Uint16(page[20:]))
+		if bdbPageHeaderSize+entries*2 > len(page) {
+			return fmt.Errorf("invalid Berkeley DB page %d", number)
+		}
+		offsets := make([]int, entries)
+		for i := range offsets {
+			offsets[i] = int(order.Uint16(page[bdbPageHeaderSize+i*2:]))
+			if offsets[i] >= len(page) {
+				return fmt.Errorf("invalid item on Berkeley DB page %d", number)
+			}
+		}
+		// item returns an item of the page, which ends where the item before it starts
+		item := func(i int) ([]byte, error) {
+			end := len(page)
+			if i > 0 {
+				end = offsets[i-1]
+			}
+			if end <= offsets[i] {
+				return nil, fmt.Errorf("invalid item on Berkeley DB page %d", number)
+			}
+			return page[offsets[i]:end], nil
+		}
+		// The items are pairs of key and data
+		for i := 0; i+1 < entries; i += 2 {
+			key, err := item(i)
+			if err != nil {
+				return err
+			}
+			// Package number 0 keeps the number of the next package instead of a header
+			if key[0] == bdbKeyData && len(key) == 5 && order.Uint32(key[1:]) == 0 {
+				continue
+			}
+			data, err := item(i + 1)
+			if err != nil {
+				return err
+			}
+			var blob []byte
+			switch data[0] {
+			case bdbKeyData:
+				blob = data[1:]
+			case bdbOffPage:
+				if len(data) < 12 {
+					return fmt.Errorf("invalid item on Berkeley DB page %d", number)
+				}
+				blob, err = readOverflow(int64(order.Uint32(data[4:])), int64(order.Uint32(data[8:])))
+				if err != nil {
+					return err
+				}
+			default:
+				continue
+			}
+			if err := fn(blob); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
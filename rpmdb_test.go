@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadRPMDatabase(t *testing.T) {
+	type want struct {
+		version, arch, license string
+		depends                []string
+	}
+	wants := map[string]want{
+		"glibc":     {"2.39-22.fc40", "x86_64", "LGPL-2.1-or-later", nil},
+		"bash":      {"5.2.26-3.fc40", "x86_64", "GPL-3.0-or-later", []string{"glibc", "bash"}},
+		"coreutils": {"9.4-6.fc40", "x86_64", "GPL-3.0-or-later", []string{"bash", "glibc"}},
+		"filler7":   {"1.0-1", "noarch", "MIT", []string{"bash"}},
+	}
+	// The headers of glibc are larger than a page of the SQLite and Berkeley DB fixtures
+	for _, database := range []string{"rpmdb/rpmdb.sqlite", "rpmdb/Packages.db", "rpmdb/Packages"} {
+		t.Run(filepath.Base(database), func(t *testing.T) {
+			var packages []installedPackage
+			err := readRPMDatabase(context.Background(), &fixtureRunner{}, database, func(pkg installedPackage) {
+				packages = append(packages, pkg)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(packages) != 11 {
+				t.Fatalf("readRPMDatabase() read %d packages, want 11", len(packages))
+			}
+			for _, pkg := range packages {
+				want, ok := wants[pkg.name]
+				if !ok {
+					continue
+				}
+				if pkg.version != want.version || pkg.arch != want.arch || pkg.license != want.license {
+					t.Errorf("%s = %s %s %s, want %s %s %s", pkg.name, pkg.version, pkg.arch, pkg.license, want.version, want.arch, want.license)
+				}
+				if !slices.Equal(pkg.depends, want.depends) {
+					t.Errorf("dependencies of %s = %q, want %q", pkg.name, pkg.depends, want.depends)
+				}
+				if pkg.vendor != "Fedora Project" || pkg.sourcePackage != pkg.name+"-"+pkg.version+".src.rpm" {
+					t.Errorf("%s has vendor %q and source package %q", pkg.name, pkg.vendor, pkg.sourcePackage)
+				}
+			}
+		})
+	}
+}
+
+func TestReadRPMDatabaseWrongFormat(t *testing.T) {
+	// The name of the database tells its format
+	dir := t.TempDir()
+	for _, name := range []string{"rpmdb.sqlite", "Packages.db", "Packages"} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, 8192), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := readRPMDatabase(context.Background(), localRunner{}, filepath.Join(dir, name), func(installedPackage) {})
+		if err == nil {
+			t.Errorf("readRPMDatabase(%s) of zeros succeeded", name)
+		}
+	}
+}
+
+// rpmHeaderBlob encodes a header blob with a single entry.
+func rpmHeaderBlob(tag, typ, offset, count int32, data []byte) []byte {
+	blob := binary.BigEndian.AppendUint32(nil, 1)
+	blob = binary.BigEndian.AppendUint32(blob, uint32(len(data)))
+	for _, value := range []int32{tag, typ, offset, count} {
+		blob = binary.BigEndian.AppendUint32(blob, uint32(value))
+	}
+	return append(blob, data...)
+}
+
+func TestRPMHeaderValues(t *testing.T) {
+	tests := []struct {
+		name        string
+		blob        []byte
+		wantStrings []string
+		wantInt32s  []int32
+	}{
+		{
+			name:        "string",
+			blob:        rpmHeaderBlob(rpmTagName, rpmTypeString, 0, 1, []byte("bash\x00")),
+			wantStrings: []string{"bash"},
+		},
+		{
+			name:        "string array",
+			blob:        rpmHeaderBlob(rpmTagName, rpmTypeStringArray, 0, 2, []byte("bash\x00sh\x00")),
+			wantStrings: []string{"bash", "sh"},
+		},
+		{
+			name:        "string array with a negative count",
+			blob:        rpmHeaderBlob(rpmTagName, rpmTypeStringArray, 0, -1, []byte("bash\x00")),
+			wantStrings: nil,
+		},
+		{
+			name:        "string array longer than the data",
+			blob:        rpmHeaderBlob(rpmTagName, rpmTypeStringArray, 0, 1000, []byte("bash\x00sh")),
+			wantStrings: []string{"bash"},
+		},
+		{
+			name:        "string out of the data",
+			blob:        rpmHeaderBlob(rpmTagName, rpmTypeString, 5, 1, []byte("bash\x00")),
+			wantStrings: nil,
+		},
+		{
+			name:       "int32",
+			blob:       rpmHeaderBlob(rpmTagName, rpmTypeInt32, 0, 1, []byte{0, 0, 0, 42}),
+			wantInt32s: []int32{42},
+		},
+		{
+			name:       "int32 with a negative count",
+			blob:       rpmHeaderBlob(rpmTagName, rpmTypeInt32, 0, -1, []byte{0, 0, 0, 42}),
+			wantInt32s: nil,
+		},
+		{
+			name:       "int32 longer than the data",
+			blob:       rpmHeaderBlob(rpmTagName, rpmTypeInt32, 0, 2, []byte{0, 0, 0, 42}),
+			wantInt32s: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header, err := parseRPMHeader(test.blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := header.strings(rpmTagName); !slices.Equal(got, test.wantStrings) {
+				t.Errorf("strings() = %q, want %q", got, test.wantStrings)
+			}
+			if got := header.int32s(rpmTagName); !slices.Equal(got, test.wantInt32s) {
+				t.Errorf("int32s() = %v, want %v", got, test.wantInt32s)
+			}
+		})
+	}
+}
+
+func TestParseRPMHeaderTruncated(t *testing.T) {
+	blob := rpmHeaderBlob(rpmTagName, rpmTypeString, 0, 1, []byte("bash\x00"))
+	for _, length := range []int{0, 7, 8, 23, len(blob) - 1} {
+		if _, err := parseRPMHeader(blob[:length]); err == nil {
+			t.Errorf("parseRPMHeader() of %d of %d bytes succeeded", length, len(blob))
+		}
+	}
+}
+
+func FuzzParseRPMHeader(f *testing.F) {
+	f.Add(rpmHeaderBlob(rpmTagName, rpmTypeString, 0, 1, []byte("bash\x00")))
+	f.Add(rpmHeaderBlob(rpmTagBaseNames, rpmTypeStringArray, 0, 2, []byte("bash\x00sh\x00")))
+	f.Add(rpmHeaderBlob(rpmTagDirIndexes, rpmTypeInt32, 0, 1, []byte{0, 0, 0, 0}))
+	database, err := os.ReadFile(filepath.Join("testdata", "rpmdb", "Packages.db"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	err = readNDBRPMDatabase(bytes.NewReader(database), int64(len(database)), func(blob []byte) error {
+		f.Add(blob)
+		return nil
+	})
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, blob []byte) {
+		header, err := parseRPMHeader(blob)
+		if err != nil {
+			return
+		}
+		for tag := range header.entries {
+			header.strings(tag)
+			header.int32s(tag)
+		}
+		header.files()
+	})
+}
@@ -0,0 +1,838 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/CycloneDX/cyclonedx-go"
+	"github.com/spf13/viper"
+)
+
+// runSettings are the settings of the root command, given as flags, environment variables
+// or in the configuration file.
+type runSettings struct {
+	distro            string
+	output            string
+	apiURL            string
+	apiKey            string
+	tlsVerify         bool
+	spdxSchema        string
+	httpTimeout       time.Duration
+	projectTeams      []string
+	uploadDryRun      bool
+	containerSBOMs    []string
+	store             string
+	storeKey          string
+	webhookURL        string
+	webhookMethod     string
+	webhookHeaders    []string
+	webhookBody       string
+	ociPush           string
+	ociSubject        string
+	sw360URL          string
+	sw360Token        string
+	anchoreURL        string
+	anchoreUser       string
+	anchorePassword   string
+	anchoreAccount    string
+	eventLog          string
+	publish           string
+	publishPayload    string
+	gitRepo           string
+	gitBranch         string
+	gitPath           string
+	gitWorkDir        string
+	gitUser           string
+	gitToken          string
+	dryRun            bool
+	watch             bool
+	watchDebounce     time.Duration
+	daemon            bool
+	schedule          string
+	metricsListen     string
+	pushgateway       string
+	pushgatewayJob    string
+	lockFile          string
+	commandTimeout    time.Duration
+	workers           int
+	baselinePath      string
+	failOnDrift       bool
+	cacheDir          string
+	cacheTTL          time.Duration
+	componentName     string
+	componentVersion  string
+	componentType     string
+	strict            bool
+	resultJSON        string
+	timings           bool
+	maxLineSize       int
+	source            string
+	pprofListen       string
+	cpuProfile        string
+	memProfile        string
+	multiArch         string
+	dependencyRoot    string
+	checksumAlgorithm string
+	profile           string
+	specVersion       string
+	complianceTags    []string
+	annotationsPath   string
+	bundleDir         string
+	outputDir         string
+	outputFormat      string
+	notifyURL         string
+	notifyFormat      string
+	notifyOn          string
+	keepSBOMs         int
+	keepFor           time.Duration
+	include           []string
+	bundleFormat      string
+	authors           []string
+	contacts          []string
+	rootfs            string
+	sshTarget         string
+	pluginPaths       []string
+	goBinaryPaths     []string
+}
+
+// load reads the settings from viper, which holds the flags and falls back to the
+// environment and the configuration file for flags that are not given.
+func (s *runSettings) load() {
+	s.distro = viper.GetString("distro")
+	s.output = viper.GetString("output")
+	s.apiURL = viper.GetString("api-url")
+	s.apiKey = viper.GetString("api-key")
+	s.tlsVerify = viper.GetBool("tls-verify")
+	s.spdxSchema = viper.GetString("spdx-schema")
+	s.httpTimeout = viper.GetDuration("http-timeout")
+	s.projectTeams = viper.GetStringSlice("project-team")
+	s.uploadDryRun = viper.GetBool("upload-dry-run")
+	s.containerSBOMs = viper.GetStringSlice("container-sbom")
+	s.store = viper.GetString("store")
+	s.storeKey = viper.GetString("store-key")
+	s.webhookURL = viper.GetString("webhook-url")
+	s.webhookMethod = viper.GetString("webhook-method")
+	s.webhookHeaders = viper.GetStringSlice("webhook-header")
+	s.webhookBody = viper.GetString("webhook-body")
+	s.ociPush = viper.GetString("oci-push")
+	s.ociSubject = viper.GetString("oci-subject")
+	s.sw360URL = viper.GetString("sw360-url")
+	s.sw360Token = viper.GetString("sw360-token")
+	s.anchoreURL = viper.GetString("anchore-url")
+	s.anchoreUser = viper.GetString("anchore-user")
+	s.anchorePassword = viper.GetString("anchore-password")
+	s.anchoreAccount = viper.GetString("anchore-account")
+	s.eventLog = viper.GetString("event-log")
+	s.publish = viper.GetString("publish")
+	s.publishPayload = viper.GetString("publish-payload")
+	s.gitRepo = viper.GetString("git-repo")
+	s.gitBranch = viper.GetString("git-branch")
+	s.gitPath = viper.GetString("git-path")
+	s.gitWorkDir = viper.GetString("git-workdir")
+	s.gitUser = viper.GetString("git-user")
+	s.gitToken = viper.GetString("git-token")
+	s.dryRun = viper.GetBool("dry-run")
+	s.watch = viper.GetBool("watch")
+	s.watchDebounce = viper.GetDuration("watch-debounce")
+	s.daemon = viper.GetBool("daemon")
+	s.schedule = viper.GetString("schedule")
+	s.metricsListen = viper.GetString("metrics-listen")
+	s.pushgateway = viper.GetString("pushgateway")
+	s.pushgatewayJob = viper.GetString("pushgateway-job")
+	s.lockFile = viper.GetString("lock-file")
+	s.commandTimeout = viper.GetDuration("command-timeout")
+	s.workers = viper.GetInt("workers")
+	s.baselinePath = viper.GetString("baseline")
+	s.timings = viper.GetBool("timings")
+	s.pprofListen = viper.GetString("pprof")
+	s.cpuProfile = viper.GetString("cpuprofile")
+	s.memProfile = viper.GetString("memprofile")
+	s.source = viper.GetString("source")
+	s.checksumAlgorithm = viper.GetString("checksum")
+	s.profile = viper.GetString("profile")
+	s.complianceTags = viper.GetStringSlice("compliance-tags")
+	s.annotationsPath = viper.GetString("annotations")
+	s.bundleDir = viper.GetString("bundle")
+	s.bundleFormat = viper.GetString("bundle-format")
+	s.include = viper.GetStringSlice("include")
+	s.outputDir = viper.GetString("output-dir")
+	s.keepSBOMs = viper.GetInt("keep")
+	s.keepFor = viper.GetDuration("keep-for")
+	s.notifyURL = viper.GetString("notify-url")
+	s.notifyFormat = viper.GetString("notify-format")
+	s.notifyOn = viper.GetString("notify-on")
+	s.failOnDrift = viper.GetBool("fail-on-drift")
+	s.outputFormat = viper.GetString("output-format")
+	s.specVersion = viper.GetString("spec-version")
+	s.authors = viper.GetStringSlice("author")
+	s.contacts = viper.GetStringSlice("contact")
+	s.dependencyRoot = viper.GetString("dependency-root")
+	s.multiArch = viper.GetString("multi-arch")
+	s.rootfs = viper.GetString("rootfs")
+	s.sshTarget = viper.GetString("ssh")
+	s.maxLineSize = viper.GetInt("max-line-size")
+	s.cacheDir = viper.GetString("cache-dir")
+	s.cacheTTL = viper.GetDuration("cache-ttl")
+	s.componentName = viper.GetString("component-name")
+	s.componentVersion = viper.GetString("component-version")
+	s.componentType = viper.GetString("component-type")
+	s.resultJSON = viper.GetString("result-json")
+	s.goBinaryPaths = viper.GetStringSlice("go-binary-path")
+	s.pluginPaths = viper.GetStringSlice("plugin-path")
+	s.strict = viper.GetBool("strict")
+}
+
+// sbomRun generates the SBOM of the scanned system and delivers it, once or on every
+// trigger in watch and daemon mode.
+type sbomRun struct {
+	*runSettings
+	parsedSpecVersion cyclonedx.SpecVersion
+	metadata          MetadataConfig
+	destinations      []DestinationConfig
+	runner            Runner
+	hostname          string
+	metrics           *Metrics
+	// event and startTime are those of the one-shot run, which fail reports.
+	event     RunEvent
+	startTime time.Time
+}
+
+// report records the outcome of a run in the metrics and emits its completion event, so
+// that monitoring and SIEMs can alert on failed or missing runs.
+//
+// Parameters:
+// - event: the event of the run.
+// - startTime: the time the run started.
+// - runErr: the error the run failed with, nil if it succeeded.
+func (r *sbomRun) report(event RunEvent, startTime time.Time, runErr *RunError) {
+	event.Result = "success"
+	if runErr != nil {
+		event.Result = "failure"
+		event.ExitCode = runErr.Code
+		event.Error = runErr.Error()
+	}
+	event.Duration = time.Since(startTime)
+
+	// The bundle holds the result of the run, so it is written once that is known
+	if event.Bundle != nil {
+		event.Destinations = append(event.Destinations, "bundle")
+		resultBody, err := runResultJSON(event, startTime)
+		if err == nil {
+			event.Bundle.add("result.json", resultBody)
+			var path string
+			path, err = event.Bundle.write()
+			if err == nil {
+				slog.Info("Wrote bundle", "path", path)
+			}
+		}
+		if err != nil {
+			slog.Warn("Error writing bundle", "error", err)
+		}
+	}
+
+	r.metrics.record(event)
+	if r.pushgateway != "" {
+		// Pushed with a fresh context, so that interrupted runs are reported as well
+		err := r.metrics.push(context.Background(), newHTTPClient(r.tlsVerify, r.httpTimeout), r.pushgateway, r.pushgatewayJob, event.Hostname)
+		if err != nil {
+			slog.Warn("Error pushing metrics", "error", err)
+		}
+	}
+	if r.eventLog != "" {
+		if err := emitEvent(r.eventLog, event); err != nil {
+			slog.Warn("Error emitting event", "error", err)
+		}
+	}
+	if r.notifyURL != "" {
+		notifier := &Notifier{
+			URL:       r.notifyURL,
+			Format:    r.notifyFormat,
+			OnFailure: r.notifyOn == "failure",
+			TLSVerify: r.tlsVerify,
+			Timeout:   r.httpTimeout,
+		}
+		// Sent with a fresh context, so that interrupted runs are notified as well
+		if err := notifier.notify(context.Background(), event, startTime); err != nil {
+			slog.Warn("Error sending notification", "error", err)
+		}
+	}
+	if r.timings && event.Timings != nil {
+		event.Timings.print(os.Stderr)
+	}
+	if r.resultJSON != "" {
+		if err := writeRunResult(r.resultJSON, event, startTime); err != nil {
+			slog.Warn("Error writing result JSON", "error", err)
+		}
+	}
+}
+
+// fail reports the one-shot run as failed and exits.
+//
+// Parameters:
+// - code: the exit code.
+// - msg: the message logged with the error.
+// - err: the error, nil if msg tells it all.
+func (r *sbomRun) fail(code int, msg string, err error) {
+	runErr := &RunError{Code: code, Msg: msg, Err: err}
+	r.report(r.event, r.startTime, runErr)
+	runErr.exit()
+}
+
+// plan prints the commands, collectors and destinations of the run without running them.
+//
+// Parameters:
+// - ctx: the context.
+func (r *sbomRun) plan(ctx context.Context) {
+	if r.distro == "" {
+		r.fail(exitConfig, "Please specify a distribution using the --distro flag", nil)
+	}
+	registerDerivedDistro(ctx, r.distro, r.runner)
+	plan, err := planCollection(ctx, r.distro, r.spdxSchema, r.containerSBOMs, r.workers, r.source, r.runner)
+	if err != nil {
+		r.fail(exitConfig, "Error planning run", err)
+	}
+	for _, plugin := range findPlugins(r.pluginPaths) {
+		plan.Commands = append(plan.Commands, shellJoin([]string{plugin}))
+		plan.Collectors = append(plan.Collectors, "plugin: components from "+pluginName(plugin))
+	}
+	if r.baselinePath != "" {
+		plan.Collectors = append(plan.Collectors, "baseline: licenses and dependencies of packages unchanged since "+r.baselinePath)
+	}
+	if r.failOnDrift {
+		plan.Collectors = append(plan.Collectors, "drift: fail if packages were added, removed or changed since "+r.baselinePath)
+	}
+	if r.multiArch == multiArchMerge {
+		plan.Collectors = append(plan.Collectors, "multi-arch: packages installed for several architectures in the same version merged into one component")
+	}
+	if slices.Contains(r.include, includeRuntime) {
+		plan.Commands = append(plan.Commands, shellJoin(runningProcessesCommand))
+		plan.Collectors = append(plan.Collectors, "runtime: packages owning the executables of running processes marked with "+runtimeActiveProperty+", the ports they listen on with "+exposedPortProperty)
+	}
+	for _, name := range r.include {
+		if collector, ok := packageCollectors[name]; ok {
+			for _, command := range collector.commands {
+				plan.Commands = append(plan.Commands, shellJoin(command))
+			}
+			if name == includeGoBinaries {
+				plan.Commands = append(plan.Commands, shellJoin(goBinaryFindCommand(r.goBinaryPaths)))
+			}
+			plan.Collectors = append(plan.Collectors, name+": "+collector.description)
+		}
+	}
+	if r.annotationsPath != "" {
+		plan.Collectors = append(plan.Collectors, "annotations: reviewer notes from "+r.annotationsPath)
+	}
+	if r.profile != "" {
+		plan.Collectors = append(plan.Collectors, "profile: SBOM creator and component creators filled in and checked against the "+r.profile+" profile")
+	}
+	if r.cacheDir != "" {
+		plan.Collectors = append(plan.Collectors, fmt.Sprintf("cache: licenses and dependencies cached in %s for %s", r.cacheDir, r.cacheTTL))
+	}
+
+	now := time.Now().UTC()
+	keyData := StoreKeyData{
+		Hostname:  r.hostname,
+		Distro:    r.distro,
+		Date:      now.Format("2006-01-02"),
+		Timestamp: now.Format("20060102T150405Z"),
+	}
+	plan.Output = "stdout"
+	if r.output != "" {
+		plan.Output = r.output
+	}
+	if r.outputDir != "" {
+		plan.Output = fmt.Sprintf("%s, linked as %s", filepath.Join(r.outputDir, historyPrefix+now.Format("20060102T150405Z")+historySuffix), historyLatest)
+		if r.keepSBOMs > 0 || r.keepFor > 0 {
+			plan.Output += fmt.Sprintf(", keeping %d SBOMs for %s (0 for no limit)", r.keepSBOMs, r.keepFor)
+		}
+	}
+	if r.store != "" {
+		key, err := renderPathTemplate(r.storeKey, keyData)
+		if err != nil {
+			r.fail(exitConfig, "Error planning run", err)
+		}
+		plan.Destinations = append(plan.Destinations, "store: "+strings.TrimSuffix(r.store, "/")+"/"+key)
+	}
+	if r.webhookURL != "" {
+		plan.Destinations = append(plan.Destinations, fmt.Sprintf("webhook: %s %s with %s body", r.webhookMethod, redactURL(r.webhookURL), r.webhookBody))
+	}
+	if r.ociPush != "" {
+		destination := "oci: push to " + r.ociPush
+		if r.ociSubject != "" {
+			destination += " as referrer of " + r.ociSubject
+		}
+		plan.Destinations = append(plan.Destinations, destination)
+	}
+	if r.gitRepo != "" {
+		sbomPath, err := renderPathTemplate(r.gitPath, keyData)
+		if err != nil {
+			r.fail(exitConfig, "Error planning run", err)
+		}
+		plan.Destinations = append(plan.Destinations, fmt.Sprintf("git: commit %s to %s branch %s", sbomPath, redactURL(r.gitRepo), r.gitBranch))
+	}
+	if r.publish != "" {
+		plan.Destinations = append(plan.Destinations, fmt.Sprintf("publish: %s to %s", r.publishPayload, redactURL(r.publish)))
+	}
+	if r.sw360URL != "" && r.sw360Token != "" {
+		plan.Destinations = append(plan.Destinations, "sw360: export components to "+r.sw360URL)
+	}
+	if r.anchoreURL != "" {
+		plan.Destinations = append(plan.Destinations, "anchore: import source "+r.hostname+" into "+r.anchoreURL)
+	}
+	if r.apiURL != "" && r.apiKey != "" {
+		if r.uploadDryRun {
+			plan.Destinations = append(plan.Destinations, "dependency-track: check connectivity and permissions at "+r.apiURL)
+		} else {
+			plan.Destinations = append(plan.Destinations, fmt.Sprintf("dependency-track: upload to project %s below %s at %s", r.hostname, r.distro, r.apiURL))
+		}
+	}
+	for _, destination := range r.destinations {
+		plan.Destinations = append(plan.Destinations, destination.describe(UploadTarget{Hostname: r.hostname, Distro: r.distro, DryRun: r.uploadDryRun}))
+	}
+	if r.bundleDir != "" {
+		plan.Destinations = append(plan.Destinations, fmt.Sprintf("bundle: SBOM, inventory, license report, result and checksums as %s in %s", r.bundleFormat, r.bundleDir))
+	}
+	if r.notifyURL != "" {
+		plan.Destinations = append(plan.Destinations, fmt.Sprintf("notify: %s notification on %s to %s", r.notifyFormat, r.notifyOn, redactURL(r.notifyURL)))
+	}
+	if r.eventLog != "" {
+		plan.Destinations = append(plan.Destinations, "event: completion event to "+r.eventLog)
+	}
+	if r.resultJSON != "" {
+		plan.Destinations = append(plan.Destinations, "result: run result to "+r.resultJSON)
+	}
+
+	plan.write(os.Stdout)
+}
+
+// deliver generates the SBOM and delivers it to every configured destination.
+//
+// Parameters:
+// - ctx: the context, cancelling it interrupts the run.
+// - event: the event of the run, filled in with its outcome.
+//
+// Returns:
+// - *RunError: the error the run failed with, nil if it succeeded.
+func (r *sbomRun) deliver(ctx context.Context, event *RunEvent) (runErr *RunError) {
+	// Failures caused by an interrupt are reported as such
+	defer func() {
+		if runErr != nil && ctx.Err() != nil {
+			runErr.Code = exitInterrupted
+		}
+	}()
+
+	options := CollectOptions{
+		CommandTimeout: r.commandTimeout,
+		Workers:        r.workers,
+		MaxLineSize:    r.maxLineSize,
+		Source:         r.source,
+		MultiArch:      r.multiArch,
+		Profile:        r.profile,
+		SpecVersion:    r.parsedSpecVersion,
+		Include:        r.include,
+		DependencyRoot: r.dependencyRoot,
+		Metadata:       r.metadata,
+		Runner:         r.runner,
+		Strict:         r.strict,
+		PluginPaths:    r.pluginPaths,
+		GoBinaryPaths:  r.goBinaryPaths,
+		Component:      ComponentIdentity{Name: r.componentName, Version: r.componentVersion, Type: r.componentType},
+	}
+	if r.timings {
+		event.Timings = newTimings()
+		options.Timings = event.Timings
+	}
+	if r.baselinePath != "" {
+		baseline, err := loadBaseline(r.baselinePath)
+		if err != nil {
+			return &RunError{Code: exitConfig, Msg: "Error loading baseline", Err: err}
+		}
+		if r.failOnDrift && baseline == nil {
+			return &RunError{Code: exitConfig, Msg: "Approved baseline does not exist", Err: fmt.Errorf("%s not found", r.baselinePath)}
+		}
+		options.Baseline = baseline
+	}
+	if r.annotationsPath != "" {
+		notes, err := loadReviewerNotes(r.annotationsPath)
+		if err != nil {
+			return &RunError{Code: exitConfig, Msg: "Error loading annotations", Err: err}
+		}
+		options.Annotations = notes
+	}
+	if r.cacheDir != "" {
+		cache, err := openCache(r.cacheDir, r.cacheTTL)
+		if err != nil {
+			return &RunError{Code: exitConfig, Msg: "Error opening cache", Err: err}
+		}
+		options.Cache = cache
+	}
+
+	collectStart := time.Now()
+	sbom, err := generateSBOM(ctx, r.distro, "1.0", options)
+	if err != nil {
+		return &RunError{Code: exitCollection, Msg: "Error generating SBOM", Err: err}
+	}
+	deliverStart := time.Now()
+	event.Durations = map[string]time.Duration{"collect": deliverStart.Sub(collectStart)}
+	defer func() {
+		event.Durations["deliver"] = time.Since(deliverStart)
+	}()
+
+	marshalStart := time.Now()
+	sbomJSON, err := encodeBOM(sbom)
+	if err != nil {
+		return &RunError{Code: exitError, Msg: "Error encoding SBOM as CycloneDX " + sbom.SpecVersion.String(), Err: err}
+	}
+	options.Timings.phase("encoding", time.Since(marshalStart))
+	event.Components = len(*sbom.Components)
+	event.Dependencies = len(*sbom.Dependencies)
+	if sbom.Metadata.Properties != nil {
+		for _, property := range *sbom.Metadata.Properties {
+			if property.Name == warningProperty {
+				event.Warnings = append(event.Warnings, property.Value)
+			}
+		}
+	}
+	for _, component := range *sbom.Components {
+		if component.Type == cyclonedx.ComponentTypeLibrary && (component.Licenses == nil || len(*component.Licenses) == 0) {
+			event.UnknownLicenses++
+		}
+		if component.Properties != nil {
+			for _, property := range *component.Properties {
+				if property.Name == warningProperty {
+					event.Warnings = append(event.Warnings, component.Name+" ("+property.Value+")")
+				}
+			}
+		}
+	}
+
+	// Every run writing to the history directory gets its own file
+	output := r.output
+	if r.outputDir != "" {
+		output, err = newHistoryPath(r.outputDir, time.Now())
+		if err != nil {
+			return &RunError{Code: exitError, Msg: "Error creating output directory", Err: err}
+		}
+	}
+
+	// An invalid SBOM is neither written nor delivered anywhere, it is only kept
+	// next to the output file for inspection
+	validateStart := time.Now()
+	err = checkSBOM(sbomJSON)
+	options.Timings.phase("validation", time.Since(validateStart))
+	if err != nil {
+		if output != "" {
+			if writeErr := writeFileAtomic(output+".invalid", sbomJSON, 0644); writeErr != nil {
+				slog.Warn("Error writing invalid SBOM", "path", output+".invalid", "error", writeErr)
+			} else {
+				slog.Info("Wrote invalid SBOM for inspection", "path", output+".invalid")
+			}
+		}
+		return &RunError{Code: exitValidation, Msg: "SBOM is not valid against the CycloneDX schema", Err: err}
+	}
+	// A drifted SBOM is still written and delivered, so that the inventory shows
+	// the drift, the run fails once it is done
+	if r.failOnDrift {
+		if drift := options.Baseline.drift(sbom); !drift.empty() {
+			for _, pkg := range drift.Added {
+				slog.Error("Package added since baseline", "package", pkg)
+			}
+			for _, pkg := range drift.Removed {
+				slog.Error("Package removed since baseline", "package", pkg)
+			}
+			for _, pkg := range drift.Changed {
+				slog.Error("Package changed since baseline", "package", pkg)
+			}
+			driftErr := fmt.Errorf("%d added, %d removed, %d changed packages", len(drift.Added), len(drift.Removed), len(drift.Changed))
+			defer func() {
+				if runErr == nil {
+					runErr = &RunError{Code: exitPolicy, Msg: "SBOM drifted from baseline " + r.baselinePath, Err: driftErr}
+				}
+			}()
+		}
+	}
+
+	// Requirements the data of the host cannot meet, e.g. archive hashes, are
+	// reported without failing the run, validate --profile checks them strictly
+	if violations := checkProfile(r.profile, sbom); len(violations) > 0 {
+		logProfileViolations(r.profile, violations)
+	}
+
+	// Only the output is reduced to the package URLs, the other destinations
+	// receive the SBOM
+	outputData := sbomJSON
+	if r.outputFormat == outputFormatPURLs {
+		outputData = purlList(sbom)
+	}
+	if output == "" {
+		if r.outputFormat == outputFormatPURLs {
+			fmt.Print(string(outputData))
+		} else {
+			fmt.Println(string(outputData))
+		}
+		event.Destinations = append(event.Destinations, "stdout")
+	} else {
+		if err := writeFileAtomic(output, outputData, 0644); err != nil {
+			return &RunError{Code: exitError, Msg: "Error writing SBOM to file", Err: err}
+		}
+		event.Destinations = append(event.Destinations, "file")
+	}
+	if r.checksumAlgorithm != "" {
+		digest, err := fileChecksum(r.checksumAlgorithm, outputData)
+		if err != nil {
+			return &RunError{Code: exitConfig, Msg: "Error computing checksum", Err: err}
+		}
+		event.Checksums = map[string]string{r.checksumAlgorithm: digest}
+		// The SBOM printed to stdout has no file to put the checksum next to
+		if output != "" {
+			if err := writeChecksumFile(output+"."+r.checksumAlgorithm, output, digest); err != nil {
+				return &RunError{Code: exitError, Msg: "Error writing checksum file", Err: err}
+			}
+			slog.Info("Wrote checksum file", "path", output+"."+r.checksumAlgorithm)
+		}
+	}
+	if r.outputDir != "" {
+		if err := updateLatest(r.outputDir, output); err != nil {
+			return &RunError{Code: exitError, Msg: "Error linking latest SBOM", Err: err}
+		}
+		if err := pruneHistory(r.outputDir, r.keepSBOMs, r.keepFor, time.Now()); err != nil {
+			slog.Warn("Error removing SBOMs beyond the retention", "dir", r.outputDir, "error", err)
+		}
+	}
+
+	if r.bundleDir != "" {
+		bundle := newBundle(r.bundleDir, r.bundleFormat, r.hostname, time.Now())
+		if err := bundle.addSBOM(sbom, sbomJSON); err != nil {
+			return &RunError{Code: exitError, Msg: "Error creating bundle", Err: err}
+		}
+		event.Bundle = bundle
+	}
+
+	uploadStart := time.Now()
+	defer func() { options.Timings.phase("upload", time.Since(uploadStart)) }()
+	return r.upload(ctx, event, sbom, sbomJSON)
+}
+
+// upload delivers the SBOM to the object store, webhook, registry, repositories and servers
+// that are configured.
+//
+// Parameters:
+// - ctx: the context.
+// - event: the event of the run, the destinations are added to.
+// - sbom: the SBOM.
+// - sbomJSON: the encoded SBOM.
+//
+// Returns:
+// - *RunError: the error of the first failed destination.
+func (r *sbomRun) upload(ctx context.Context, event *RunEvent, sbom *cyclonedx.BOM, sbomJSON []byte) *RunError {
+	// Locations the SBOM can be retrieved from, referenced by published pointers
+	var locations []string
+
+	if r.store != "" {
+		now := time.Now().UTC()
+		objectStore := &ObjectStore{
+			Location:    r.store,
+			KeyTemplate: r.storeKey,
+			TLSVerify:   r.tlsVerify,
+			Timeout:     r.httpTimeout,
+		}
+		key, err := objectStore.upload(ctx, StoreKeyData{
+			Hostname:  r.hostname,
+			Distro:    r.distro,
+			Date:      now.Format("2006-01-02"),
+			Timestamp: now.Format("20060102T150405Z"),
+		}, sbomJSON)
+		if err != nil {
+			return &RunError{Code: exitUpload, Msg: "Error storing SBOM", Err: err}
+		}
+		slog.Info("Stored SBOM", "location", r.store, "key", key)
+		event.Destinations = append(event.Destinations, "store")
+		locations = append(locations, strings.TrimSuffix(r.store, "/")+"/"+key)
+	}
+
+	if r.webhookURL != "" {
+		webhook := &Webhook{
+			URL:       r.webhookURL,
+			Method:    r.webhookMethod,
+			Headers:   r.webhookHeaders,
+			Body:      r.webhookBody,
+			TLSVerify: r.tlsVerify,
+			Timeout:   r.httpTimeout,
+		}
+		err := webhook.send(ctx, WebhookEnvelope{
+			Hostname:  r.hostname,
+			Distro:    r.distro,
+			OSVersion: getOSVersion(ctx, r.runner),
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		}, sbomJSON)
+		if err != nil {
+			return &RunError{Code: exitUpload, Msg: "Error sending SBOM to webhook", Err: err}
+		}
+		event.Destinations = append(event.Destinations, "webhook")
+	}
+
+	if r.ociPush != "" {
+		push := &OCIPush{
+			Reference: r.ociPush,
+			Subject:   r.ociSubject,
+			TLSVerify: r.tlsVerify,
+			Timeout:   r.httpTimeout,
+		}
+		digest, err := push.push(ctx, r.hostname, sbomJSON)
+		if err != nil {
+			return &RunError{Code: exitUpload, Msg: "Error pushing SBOM to OCI registry", Err: err}
+		}
+		slog.Info("Pushed SBOM to OCI registry", "reference", r.ociPush, "digest", digest)
+		event.Destinations = append(event.Destinations, "oci")
+		locations = append(locations, r.ociPush+"@"+digest)
+	}
+
+	if r.gitRepo != "" {
+		now := time.Now().UTC()
+		repository := &GitRepository{
+			URL:          r.gitRepo,
+			Branch:       r.gitBranch,
+			PathTemplate: r.gitPath,
+			WorkDir:      r.gitWorkDir,
+			Username:     r.gitUser,
+			Token:        r.gitToken,
+		}
+		sbomPath, err := repository.commit(ctx, StoreKeyData{
+			Hostname:  r.hostname,
+			Distro:    r.distro,
+			Date:      now.Format("2006-01-02"),
+			Timestamp: now.Format("20060102T150405Z"),
+		}, sbomJSON)
+		if err != nil {
+			return &RunError{Code: exitUpload, Msg: "Error committing SBOM to Git repository", Err: err}
+		}
+		slog.Info("Committed SBOM to Git repository", "repository", r.gitRepo, "path", sbomPath)
+		event.Destinations = append(event.Destinations, "git")
+		locations = append(locations, r.gitRepo+"#"+r.gitBranch+":"+sbomPath)
+	}
+
+	if r.publish != "" {
+		publisher := &Publisher{
+			Target:    r.publish,
+			Payload:   r.publishPayload,
+			TLSVerify: r.tlsVerify,
+			Timeout:   r.httpTimeout,
+		}
+		err := publisher.publish(ctx, SBOMPointer{
+			Hostname:     r.hostname,
+			Distro:       r.distro,
+			Timestamp:    sbom.Metadata.Timestamp,
+			SerialNumber: sbom.SerialNumber,
+			Locations:    locations,
+		}, sbomJSON)
+		if err != nil {
+			return &RunError{Code: exitUpload, Msg: "Error publishing SBOM", Err: err}
+		}
+		event.Destinations = append(event.Destinations, "publish")
+	}
+
+	if r.sw360URL != "" && r.sw360Token != "" {
+		sw360 := &SW360{
+			URL:       r.sw360URL,
+			Token:     r.sw360Token,
+			TLSVerify: r.tlsVerify,
+			Timeout:   r.httpTimeout,
+		}
+		exported, err := sw360.export(ctx, sbom)
+		if err != nil {
+			return &RunError{Code: exitUpload, Msg: "Error exporting SBOM to SW360", Err: err}
+		}
+		slog.Info("Exported SBOM to SW360", "releases", exported)
+		event.Destinations = append(event.Destinations, "sw360")
+	} else if r.sw360URL != "" || r.sw360Token != "" {
+		slog.Warn("Both sw360-url and sw360-token must be provided to export to SW360")
+	}
+
+	if r.anchoreURL != "" {
+		anchore := &Anchore{
+			URL:       r.anchoreURL,
+			Username:  r.anchoreUser,
+			Password:  r.anchorePassword,
+			Account:   r.anchoreAccount,
+			TLSVerify: r.tlsVerify,
+			Timeout:   r.httpTimeout,
+		}
+		operation, err := anchore.importSBOM(ctx, anchoreSource(sbom, r.hostname), sbomJSON)
+		if err != nil {
+			return &RunError{Code: exitUpload, Msg: "Error importing SBOM into Anchore", Err: err}
+		}
+		slog.Info("Imported SBOM into Anchore", "operation", operation)
+		event.Destinations = append(event.Destinations, "anchore")
+	}
+
+	// Container SBOMs are uploaded as child projects to every Dependency-Track
+	var containers []ContainerSBOM
+	if r.apiURL != "" && r.apiKey != "" || len(r.destinations) > 0 {
+		for _, path := range r.containerSBOMs {
+			container, err := loadContainerSBOM(path)
+			if err != nil {
+				return &RunError{Code: exitConfig, Msg: "Error loading container SBOM", Err: err}
+			}
+			containers = append(containers, container)
+		}
+	}
+
+	// The destinations of the configuration file are delivered alongside the
+	// flag targets, every one of them even if another fails
+	var fanOutErr error
+	if len(r.destinations) > 0 {
+		event.Uploads, fanOutErr = fanOut(ctx, r.destinations, UploadTarget{
+			Hostname:   r.hostname,
+			Distro:     r.distro,
+			OSVersion:  getOSVersion(ctx, r.runner),
+			TLSVerify:  r.tlsVerify,
+			Timeout:    r.httpTimeout,
+			Containers: containers,
+			DryRun:     r.uploadDryRun,
+		}, sbomJSON)
+		for _, upload := range event.Uploads {
+			if upload.Error == "" && upload.Attempts > 0 && !r.uploadDryRun {
+				event.Destinations = append(event.Destinations, upload.Name)
+			}
+		}
+	}
+
+	if r.apiURL != "" && r.apiKey != "" {
+		osVersion := getOSVersion(ctx, r.runner)
+
+		dt := &DependencyTrack{
+			APIURL:    r.apiURL,
+			APIKey:    r.apiKey,
+			TLSVerify: r.tlsVerify,
+			Timeout:   r.httpTimeout,
+			Teams:     r.projectTeams,
+		}
+		if r.uploadDryRun {
+			if err := dt.checkUpload(ctx, r.distro, r.hostname, sbomJSON, containers); err != nil {
+				return &RunError{Code: exitUpload, Msg: "Upload dry-run failed", Err: err}
+			}
+			if fanOutErr != nil {
+				return &RunError{Code: exitUpload, Msg: "Upload dry-run failed", Err: fanOutErr}
+			}
+			return nil
+		}
+		err := dt.uploadSBOM(ctx, r.distro, r.hostname, osVersion, sbomJSON, containers)
+		if err != nil {
+			return &RunError{Code: exitUpload, Msg: "Error uploading SBOM", Err: err}
+		}
+		event.Destinations = append(event.Destinations, "dependency-track")
+	} else if r.apiURL != "" || r.apiKey != "" {
+		slog.Warn("Both api-url and api-key must be provided to upload the SBOM")
+	}
+
+	if fanOutErr != nil {
+		return &RunError{Code: exitUpload, Msg: "Error delivering SBOM to destinations", Err: fanOutErr}
+	}
+	return nil
+}
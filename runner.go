@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Runner runs the commands and reads the files of the collectors on the scanned system,
+// so that the same collectors scan the local host, a root file system or a remote host.
+type Runner interface {
+	// Command returns the command running args on the scanned system.
+	Command(ctx context.Context, args ...string) *exec.Cmd
+	// Open opens a file of the scanned system for reading, the error wraps fs.ErrNotExist
+	// if the file does not exist.
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+}
+
+// newRunner returns the runner of the scanned system.
+//
+// Parameters:
+// - rootfs: the root file system to scan, empty for the local host.
+// - sshTarget: the [user@]host to scan over SSH, empty for the local host.
+//
+// Returns:
+// - Runner: the runner.
+// - error: an error if both are set or the root file system is not a directory.
+func newRunner(rootfs, sshTarget string) (Runner, error) {
+	switch {
+	case rootfs != "" && sshTarget != "":
+		return nil, errors.New("--rootfs and --ssh cannot be combined")
+	case rootfs != "":
+		info, err := os.Stat(rootfs)
+		if err != nil {
+			return nil, fmt.Errorf("error reading root file system: %v", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("root file system %s is not a directory", rootfs)
+		}
+		return chrootRunner{root: rootfs}, nil
+	case sshTarget != "":
+		return sshRunner{target: sshTarget}, nil
+	default:
+		return localRunner{}, nil
+	}
+}
+
+// cLocale is the locale the commands of the collectors run with, so that headers such as
+// the Depends: of apt-cache and dates are not translated and the output parses the same on
+// every host.
+var cLocale = []string{"LANG=C", "LC_ALL=C"}
+
+// localeSafeEnv returns the environment of the current process with the C locale, the
+// later entries override the locale settings of the environment.
+func localeSafeEnv() []string {
+	return append(os.Environ(), cLocale...)
+}
+
+// runnerOrLocal returns the runner, or the local runner if it is nil.
+func runnerOrLocal(runner Runner) Runner {
+	if runner == nil {
+		return localRunner{}
+	}
+	return runner
+}
+
+// localRunner runs the commands and reads the files of the local host.
+type localRunner struct{}
+
+// Command returns the command running args on the local host in the C locale.
+func (localRunner) Command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = localeSafeEnv()
+	return cmd
+}
+
+// Open opens a file of the local host.
+func (localRunner) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// chrootRunner scans a root file system, e.g. an extracted container image or a mounted
+// disk. Commands run chrooted into it, which needs root privileges, files are read
+// without running anything.
+type chrootRunner struct {
+	root string
+}
+
+// Command returns the command running args chrooted into the root file system in the C locale.
+func (r chrootRunner) Command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "chroot", append([]string{r.root}, args...)...)
+	cmd.Env = localeSafeEnv()
+	return cmd
+}
+
+// Open opens a file of the root file system, symbolic links are resolved within it.
+func (r chrootRunner) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	resolved, err := resolveInRoot(r.root, path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(resolved)
+}
+
+// maxSymlinks is the number of symbolic links followed when resolving a path, like the
+// limit of the Linux kernel.
+const maxSymlinks = 40
+
+// resolveInRoot resolves a path as if root was /, so that absolute symbolic links in a
+// root file system point into it instead of to the host.
+//
+// Parameters:
+// - root: the root file system.
+// - path: the absolute path within the root file system.
+//
+// Returns:
+// - string: the path on the host.
+// - error: an error wrapping fs.ErrNotExist if an element does not exist, or if the path
+// has too many symbolic links.
+func resolveInRoot(root, path string) (string, error) {
+	resolved := "/"
+	remaining := strings.Split(strings.TrimPrefix(filepath.Clean("/"+path), "/"), "/")
+	links := 0
+	for len(remaining) > 0 {
+		element := remaining[0]
+		remaining = remaining[1:]
+		if element == "" || element == "." {
+			continue
+		}
+		if element == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, element)
+		info, err := os.Lstat(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many symbolic links in %s", path)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		remaining = append(strings.Split(target, "/"), remaining...)
+	}
+	return filepath.Join(root, resolved), nil
+}
+
+// sshRunner scans a remote host over SSH. The ssh client of the host is used, with its
+// configuration, keys and agent, in batch mode so that it never prompts.
+type sshRunner struct {
+	target string
+}
+
+// Command returns the command running args on the remote host in the C locale. The locale
+// is set with env on the remote host, as ssh only forwards the variables the server accepts.
+func (r sshRunner) Command(ctx context.Context, args ...string) *exec.Cmd {
+	remote := append(append([]string{"env"}, cLocale...), args...)
+	return exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", r.target, "--", posixShellJoin(remote))
+}
+
+// Open reads a file of the remote host, missing files are reported as fs.ErrNotExist.
+func (r sshRunner) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	cmd := r.Command(ctx, "sh", "-c", `test -e "$1" || exit 3; cat -- "$1"`, "sh", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 3 {
+		return nil, &fs.PathError{Op: "open", Path: r.target + ":" + path, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s:%s: %v, stderr: %s", r.target, path, err, strings.TrimSpace(stderr.String()))
+	}
+	return io.NopCloser(bytes.NewReader(output)), nil
+}
+
+// posixShellJoin quotes a command for a POSIX shell, e.g. the login shell of a remote host.
+func posixShellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// readFile reads a whole file of the scanned system.
+func readFile(ctx context.Context, runner Runner, path string) ([]byte, error) {
+	file, err := runner.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// describeRunner describes the system a runner scans, e.g. for the plan of a dry run.
+func describeRunner(runner Runner) string {
+	switch r := runner.(type) {
+	case chrootRunner:
+		return "root file system " + r.root + ", commands run with chroot"
+	case sshRunner:
+		return "host " + r.target + " over ssh"
+	default:
+		return "local host"
+	}
+}
+
+// scannedHostname returns the hostname of the scanned system. Root file systems report the
+// hostname of their /etc/hostname, or of the local host if they have none.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills the remote command.
+// - runner: the runner of the scanned system.
+//
+// Returns:
+// - string: the hostname.
+// - error: an error if the hostname cannot be determined.
+func scannedHostname(ctx context.Context, runner Runner) (string, error) {
+	switch runner.(type) {
+	case sshRunner:
+		output, err := runner.Command(ctx, "hostname").Output()
+		if err != nil {
+			return "", fmt.Errorf("error running hostname: %v", err)
+		}
+		return strings.TrimSpace(string(output)), nil
+	case chrootRunner:
+		if content, err := readFile(ctx, runner, "/etc/hostname"); err == nil && strings.TrimSpace(string(content)) != "" {
+			return strings.TrimSpace(string(content)), nil
+		}
+	}
+	return os.Hostname()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fixtureRunner is a Runner printing the output of commands from files of testdata.
+type fixtureRunner struct {
+	// outputs are the fixture files by command line, the arguments joined by spaces.
+	outputs map[string]string
+	// exitCode is the exit code of commands without fixture, 1 if it is 0.
+	exitCode int
+	// commands are the command lines that were run.
+	commands []string
+}
+
+// Command returns a command printing the fixture of args, a failing command for commands
+// without fixture.
+func (r *fixtureRunner) Command(ctx context.Context, args ...string) *exec.Cmd {
+	line := strings.Join(args, " ")
+	r.commands = append(r.commands, line)
+	fixture, ok := r.outputs[line]
+	if !ok {
+		return exec.CommandContext(ctx, "sh", "-c", "exit "+strconv.Itoa(max(r.exitCode, 1)))
+	}
+	return exec.CommandContext(ctx, "cat", filepath.Join("testdata", fixture))
+}
+
+// Open opens a file of testdata.
+func (r *fixtureRunner) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join("testdata", path))
+}
+
+func TestLocalRunnerCommandsRunInCLocale(t *testing.T) {
+	t.Setenv("LANG", "de_DE.UTF-8")
+	t.Setenv("LC_ALL", "de_DE.UTF-8")
+	t.Setenv("LC_MESSAGES", "de_DE.UTF-8")
+
+	output, err := localRunner{}.Command(context.Background(), "sh", "-c", `echo "$LANG $LC_ALL"`).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(output)); got != "C C" {
+		t.Errorf("locale = %q, want %q", got, "C C")
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// includeRuntime is the opt-in collector of --include marking the packages that own the
+// executables of running processes.
+const includeRuntime = "runtime"
+
+// runtimeActiveProperty marks components owning the executable of a running process.
+const runtimeActiveProperty = "distro2sbom:runtime:active"
+
+// runningProcessesCommand prints the executable of every process, followed by the executable
+// and the socket of every socket the process holds, separated by a tab. Processes of other
+// users, which cannot be read without root, are left out.
+var runningProcessesCommand = []string{"sh", "-c", `for p in /proc/[0-9]*; do exe=$(readlink "$p/exe") || continue; echo "$exe"; for fd in "$p"/fd/*; do link=$(readlink "$fd") || continue; case "$link" in socket:*) printf '%s\t%s\n' "$exe" "$link";; esac; done; done 2>/dev/null; true`}
+
+// socketTables are the kernel tables of the sockets of the scanned system, by protocol.
+var socketTables = []struct {
+	protocol string
+	path     string
+}{
+	{"tcp", "/proc/net/tcp"},
+	{"tcp", "/proc/net/tcp6"},
+	{"udp", "/proc/net/udp"},
+	{"udp", "/proc/net/udp6"},
+}
+
+// exposedPortProperty lists a port a package listens on from other hosts, e.g. tcp/22.
+const exposedPortProperty = "distro2sbom:runtime:exposed-port"
+
+// ownerQueryBatch is the number of paths passed to a single package manager query.
+const ownerQueryBatch = 200
+
+// runningProcesses returns the executables of the running processes of the scanned system
+// and the sockets they hold.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills the command.
+// - runner: runs the command on the scanned system.
+// - maxLineSize: the longest line of output that is accepted, 0 for defaultMaxLineSize.
+//
+// Returns:
+// - []string: the sorted paths of the executables, each once. Executables replaced since
+// their process started, e.g. by an upgrade, are listed by their path.
+// - map[string][]string: the socket inodes held by the processes of every executable.
+// - error: an error if the processes cannot be listed.
+func runningProcesses(ctx context.Context, runner Runner, maxLineSize int) ([]string, map[string][]string, error) {
+	seen := make(map[string]bool)
+	sockets := make(map[string][]string)
+	err := streamCommand(ctx, runner, runningProcessesCommand, maxLineSize, func(line string) {
+		exe, socket, hasSocket := strings.Cut(line, "\t")
+		exe = strings.TrimSuffix(strings.TrimSpace(exe), " (deleted)")
+		if !strings.HasPrefix(exe, "/") {
+			return
+		}
+		seen[exe] = true
+		if inode, ok := strings.CutPrefix(socket, "socket:["); hasSocket && ok {
+			sockets[exe] = append(sockets[exe], strings.TrimSuffix(inode, "]"))
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, sockets, nil
+}
+
+// listeningPorts reads the sockets listening on addresses other than loopback from the
+// kernel socket tables: TCP sockets in the listen state and unconnected UDP sockets.
+//
+// Parameters:
+// - ctx: the context, cancelling it stops reading.
+// - runner: reads the files of the scanned system.
+//
+// Returns:
+// - map[string]string: the port of every listening socket by inode, e.g. tcp/22.
+// - error: an error if no socket table can be read.
+func listeningPorts(ctx context.Context, runner Runner) (map[string]string, error) {
+	ports := make(map[string]string)
+	var lastErr error
+	read := 0
+	for _, table := range socketTables {
+		data, err := readFile(ctx, runner, table.path)
+		if err != nil {
+			// Systems without IPv6 have no tcp6 and udp6 tables
+			lastErr = err
+			continue
+		}
+		read++
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) < 10 {
+				continue
+			}
+			local, state, inode := fields[1], fields[3], fields[9]
+			if table.protocol == "tcp" && state != "0A" || table.protocol == "udp" && state != "07" {
+				continue
+			}
+			address, port, ok := strings.Cut(local, ":")
+			if !ok || loopbackAddress(address) {
+				continue
+			}
+			number, err := strconv.ParseUint(port, 16, 16)
+			if err != nil || number == 0 {
+				continue
+			}
+			ports[inode] = table.protocol + "/" + strconv.FormatUint(number, 10)
+		}
+	}
+	if read == 0 {
+		return nil, lastErr
+	}
+	return ports, nil
+}
+
+// loopbackAddress reports whether a hexadecimal address of the kernel socket tables is a
+// loopback address: 127.0.0.0/8, ::1 or an IPv4-mapped loopback address. The words of the
+// addresses are in host byte order, which is little endian on every supported architecture.
+func loopbackAddress(address string) bool {
+	switch len(address) {
+	case 8:
+		return strings.HasSuffix(address, "7F")
+	case 32:
+		return address == "00000000000000000000000001000000" ||
+			strings.HasPrefix(address, "0000000000000000FFFF0000") && strings.HasSuffix(address, "7F")
+	}
+	return false
+}
+
+// ownerQueryCommand returns the command printing the packages owning files.
+func ownerQueryCommand(packageManager string, paths []string) ([]string, error) {
+	switch packageManager {
+	case "dpkg":
+		return append([]string{"dpkg-query", "-S"}, paths...), nil
+	case "rpm":
+		return append([]string{"rpm", "-qf", "--qf", "%{NAME}\t%{ARCH}\t\n"}, paths...), nil
+	case "apk":
+		return append([]string{"apk", "info", "--who-owns"}, paths...), nil
+	case "pacman":
+		return append([]string{"pacman", "-Qo"}, paths...), nil
+	default:
+		return nil, fmt.Errorf("unsupported package manager: %s", packageManager)
+	}
+}
+
+// parseOwnerLine parses a line of the owner query.
+//
+// Parameters:
+// - packageManager: the package manager that printed the line.
+// - line: the line.
+//
+// Returns:
+// - []string: the keys of the owning packages, name or name:arch, none for unowned files.
+// - string: the file, empty if the package manager does not print it.
+func parseOwnerLine(packageManager, line string) ([]string, string) {
+	switch packageManager {
+	case "dpkg":
+		// libc6:amd64: /lib/x86_64-linux-gnu/libc.so.6, or several packages separated by
+		// commas for shared directories. Diversions are reported as "diversion by ..."
+		owners, path, ok := strings.Cut(line, ": /")
+		if !ok || strings.HasPrefix(owners, "diversion ") {
+			return nil, ""
+		}
+		var keys []string
+		for _, owner := range strings.Split(owners, ", ") {
+			keys = append(keys, strings.TrimSpace(owner))
+		}
+		return keys, "/" + path
+	case "rpm":
+		// Unowned files print "file ... is not owned by any package" instead
+		name, arch, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, ""
+		}
+		return []string{name + ":" + strings.TrimSuffix(arch, "\t")}, ""
+	case "apk":
+		// /bin/busybox is owned by busybox-1.36.1-r5
+		path, owner, ok := strings.Cut(line, " is owned by ")
+		if !ok {
+			return nil, ""
+		}
+		name, _, ok := splitAPKPackage(strings.TrimSpace(owner))
+		if !ok {
+			return nil, ""
+		}
+		return []string{name}, path
+	case "pacman":
+		// /usr/bin/bash is owned by bash 5.2.026-2
+		path, owner, ok := strings.Cut(line, " is owned by ")
+		if !ok {
+			return nil, ""
+		}
+		name, _, _ := strings.Cut(owner, " ")
+		return []string{name}, path
+	}
+	return nil, ""
+}
+
+// fileOwners returns the packages owning files, querying the package manager in batches.
+//
+// dpkg registers the files of packages predating the merged /usr under their old path,
+// e.g. /bin/bash, so files under /usr it finds no owner for are looked up without /usr.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills the package manager.
+// - runner: runs the package manager on the scanned system.
+// - packageManager: the package manager.
+// - paths: the files, each queried once.
+// - maxLineSize: the longest line of output that is accepted, 0 for defaultMaxLineSize.
+//
+// Returns:
+// - map[string]bool: the keys of the owning packages, name or name:arch.
+// - error: an error if the package manager fails without printing any owner.
+func fileOwners(ctx context.Context, runner Runner, packageManager string, paths []string, maxLineSize int) (map[string]bool, error) {
+	owners := make(map[string]bool)
+	owned := make(map[string]bool)
+	query := func(paths []string) error {
+		for start := 0; start < len(paths); start += ownerQueryBatch {
+			args, err := ownerQueryCommand(packageManager, paths[start:min(start+ownerQueryBatch, len(paths))])
+			if err != nil {
+				return err
+			}
+			answered := 0
+			// The query fails if any file has no owner, the owners of the others are printed
+			err = streamCommand(ctx, runner, args, maxLineSize, func(line string) {
+				keys, path := parseOwnerLine(packageManager, line)
+				for _, key := range keys {
+					owners[key] = true
+				}
+				if path != "" && len(keys) > 0 {
+					owned[path] = true
+				}
+				if len(keys) > 0 || strings.Contains(line, unownedMessage(packageManager)) {
+					answered++
+				}
+			})
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil && answered == 0 && !strings.Contains(err.Error(), unownedMessage(packageManager)) {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := query(paths); err != nil {
+		return nil, err
+	}
+
+	if packageManager == "dpkg" {
+		var legacy []string
+		for _, path := range paths {
+			if !owned[path] && strings.HasPrefix(path, "/usr/") {
+				legacy = append(legacy, strings.TrimPrefix(path, "/usr"))
+			}
+		}
+		if len(legacy) > 0 {
+			if err := query(legacy); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return owners, nil
+}
+
+// unownedMessage returns the message the owner query of a package manager prints for a
+// file without owner, on stdout for rpm and on stderr for the others.
+func unownedMessage(packageManager string) string {
+	switch packageManager {
+	case "dpkg":
+		return "no path found matching pattern"
+	case "apk":
+		return "Could not find owner package"
+	case "pacman":
+		return "No package owns"
+	default:
+		return "is not owned by any package"
+	}
+}
+
+// markRuntimeActive marks the components of the packages owning a running executable.
+//
+// Parameters:
+// - items: the packages.
+// - owners: the keys of the owning packages, name or name:arch.
+//
+// Returns:
+// - int: the number of marked packages.
+func markRuntimeActive(items []*pipelineItem, owners map[string]bool) int {
+	marked := 0
+	for _, item := range items {
+		if !owners[item.key()] && !owners[item.name] {
+			continue
+		}
+		properties := []cyclonedx.Property{}
+		if item.component.Properties != nil {
+			properties = *item.component.Properties
+		}
+		properties = append(properties, cyclonedx.Property{Name: runtimeActiveProperty, Value: "true"})
+		item.component.Properties = &properties
+		marked++
+	}
+	return marked
+}
+
+// collectRuntime marks the packages owning the executable of a running process of the
+// scanned system, and lists the ports they listen on from other hosts, so that vulnerable
+// packages that are actually running and network facing can be prioritized.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills the running commands.
+// - packageManager: the package manager of the distribution.
+// - options: the runner and the maximum line size.
+// - items: the packages, their components are changed in place.
+//
+// Returns:
+// - error: an error if the processes or their owners cannot be queried.
+func collectRuntime(ctx context.Context, packageManager string, options CollectOptions, items []*pipelineItem) error {
+	runner := runnerOrLocal(options.Runner)
+	paths, sockets, err := runningProcesses(ctx, runner, options.MaxLineSize)
+	if err != nil {
+		return fmt.Errorf("error listing running processes: %v", err)
+	}
+	owners, err := fileOwners(ctx, runner, packageManager, paths, options.MaxLineSize)
+	if err != nil {
+		return fmt.Errorf("error querying the owners of running executables: %v", err)
+	}
+	marked := markRuntimeActive(items, owners)
+
+	ports, err := listeningPorts(ctx, runner)
+	if err != nil {
+		return fmt.Errorf("error reading the socket tables: %v", err)
+	}
+	// Few executables listen, so their owners are queried one by one to tell them apart
+	exposed := make(map[string][]string)
+	for _, exe := range paths {
+		var exePorts []string
+		for _, inode := range sockets[exe] {
+			if port, ok := ports[inode]; ok && !slices.Contains(exePorts, port) {
+				exePorts = append(exePorts, port)
+			}
+		}
+		if len(exePorts) == 0 {
+			continue
+		}
+		exeOwners, err := fileOwners(ctx, runner, packageManager, []string{exe}, options.MaxLineSize)
+		if err != nil {
+			return fmt.Errorf("error querying the owner of %s: %v", exe, err)
+		}
+		for owner := range exeOwners {
+			exposed[owner] = append(exposed[owner], exePorts...)
+		}
+	}
+	exposedPackages := markExposedPorts(items, exposed)
+	slog.Info("Marked packages of running processes", "executables", len(paths), "packages", marked, "listening", exposedPackages)
+	return nil
+}
+
+// markExposedPorts lists the ports the packages listen on in their components.
+//
+// Parameters:
+// - items: the packages.
+// - exposed: the ports by key of the owning package, name or name:arch.
+//
+// Returns:
+// - int: the number of packages listening on a port.
+func markExposedPorts(items []*pipelineItem, exposed map[string][]string) int {
+	marked := 0
+	for _, item := range items {
+		ports := append(append([]string(nil), exposed[item.key()]...), exposed[item.name]...)
+		if len(ports) == 0 {
+			continue
+		}
+		sort.Strings(ports)
+		ports = slices.Compact(ports)
+		properties := []cyclonedx.Property{}
+		if item.component.Properties != nil {
+			properties = *item.component.Properties
+		}
+		for _, port := range ports {
+			properties = append(properties, cyclonedx.Property{Name: exposedPortProperty, Value: port})
+		}
+		item.component.Properties = &properties
+		marked++
+	}
+	return marked
+}
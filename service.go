@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// serviceCredentials are the settings written to the environment file of the service
+// instead of the unit, so that credentials are only readable by root.
+var serviceCredentials = []string{"api-url", "api-key", "sw360-token", "anchore-password", "git-token", "notify-url"}
+
+// serviceLockDir is the directory of the runtime directories holding the lock file of the
+// service, /tmp is private to every run of the service.
+const serviceLockDir = "/run/lock"
+
+// serviceFileFlags are the flags naming a file the service writes, the directory holding it
+// must be writable.
+var serviceFileFlags = []string{"output", "result-json", "lock-file"}
+
+// serviceDirFlags are the flags naming a directory the service writes to.
+var serviceDirFlags = []string{"output-dir", "bundle", "cache-dir"}
+
+// ServiceUnit holds the values of the systemd unit templates.
+type ServiceUnit struct {
+	Name            string
+	ExecStart       string
+	EnvironmentFile string
+	ReadWritePaths  []string
+	// LockDirectory is the runtime directory of the lock file relative to /run, created for
+	// the user of the service.
+	LockDirectory   string
+	Schedule        string
+	RandomizedDelay string
+	// Runtime runs the service as root with the capabilities --include runtime needs to read
+	// the processes of other users, instead of as a dynamic user.
+	Runtime bool
+}
+
+var serviceTemplate = template.Must(template.New("service").Parse(`[Unit]
+Description=Generate and upload the SBOM of this host
+Documentation=https://github.com/jansyren/dist02cyclonedx
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+EnvironmentFile=-{{.EnvironmentFile}}
+ExecStart={{.ExecStart}}
+Nice=10
+IOSchedulingClass=idle
+{{- if not .Runtime}}
+DynamicUser=yes
+{{- end}}
+StateDirectory={{.Name}}
+{{- if .LockDirectory}}
+RuntimeDirectory={{.LockDirectory}}
+{{- end}}
+{{- range .ReadWritePaths}}
+ReadWritePaths={{.}}
+{{- end}}
+NoNewPrivileges=yes
+{{- if .Runtime}}
+CapabilityBoundingSet=CAP_SYS_PTRACE CAP_DAC_READ_SEARCH
+{{- else}}
+CapabilityBoundingSet=
+{{- end}}
+ProtectSystem=strict
+ProtectHome=yes
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+ProtectHostname=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+SystemCallFilter=@system-service
+`))
+
+var timerTemplate = template.Must(template.New("timer").Parse(`[Unit]
+Description=Periodically generate and upload the SBOM of this host
+
+[Timer]
+OnCalendar={{.Schedule}}
+RandomizedDelaySec={{.RandomizedDelay}}
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`))
+
+// newInstallServiceCmd creates the install-service subcommand.
+//
+// The command writes a hardened systemd service and a timer running it on a schedule,
+// and an environment file with the credentials of the current configuration. Arguments
+// after -- are passed to distro2sbom by the service.
+//
+// Returns:
+// - *cobra.Command: the install-service command.
+func newInstallServiceCmd() *cobra.Command {
+	var name string
+	var unitDir string
+	var envFile string
+	var schedule string
+	var randomizedDelay string
+	var binary string
+	var env []string
+	var force bool
+	var enable bool
+
+	cmd := &cobra.Command{
+		Use:   "install-service [-- distro2sbom flags]",
+		Short: "Install a systemd service and timer running distro2sbom on a schedule.",
+		Long: `install-service writes a hardened systemd service and a timer that runs it on a schedule with a
+randomized delay, so that a fleet does not upload at the same moment. Credentials of the current
+configuration (api-url, api-key, sw360-token, anchore-password, git-token) and --env values are
+written to an environment file readable only by root.`,
+		Example: `  distro2sbom install-service --schedule daily --enable -- --distro ubuntu --api-url https://dtrack.example.com`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if binary == "" {
+				executable, err := os.Executable()
+				if err != nil {
+					fatal(exitConfig, "Error locating the distro2sbom binary, use --binary", "error", err)
+				}
+				binary = executable
+			}
+
+			execArgs := []string{binary, "--quiet"}
+			if configFile := viper.ConfigFileUsed(); configFile != "" {
+				absolute, err := filepath.Abs(configFile)
+				if err == nil {
+					configFile = absolute
+				}
+				execArgs = append(execArgs, "--config", configFile)
+			}
+			execArgs = append(execArgs, args...)
+
+			unit := ServiceUnit{
+				Name:            name,
+				EnvironmentFile: envFile,
+				Schedule:        schedule,
+				RandomizedDelay: randomizedDelay,
+			}
+			flags := serviceFlags(args)
+			if !flags.Changed("lock-file") && viper.GetString("lock-file") == defaultLockFile {
+				// The dynamic user cannot create files in /run/lock on every distribution
+				lockFile := filepath.Join(serviceLockDir, name, name+".lock")
+				flags.Set("lock-file", lockFile)
+				execArgs = append(execArgs, "--lock-file", lockFile)
+				unit.LockDirectory = filepath.Join(filepath.Base(serviceLockDir), name)
+			}
+			unit.ExecStart = systemdJoin(execArgs)
+			unit.ReadWritePaths = serviceWritablePaths(flags)
+			if include, err := flags.GetStringSlice("include"); err == nil && slices.Contains(include, includeRuntime) {
+				unit.Runtime = true
+				slog.Info("Running the service as root, --include runtime reads the processes of every user")
+			}
+
+			if err := os.MkdirAll(unitDir, 0755); err != nil {
+				fatal(exitError, "Error creating unit directory", "error", err)
+			}
+			for _, file := range []struct {
+				path     string
+				template *template.Template
+			}{
+				{filepath.Join(unitDir, name+".service"), serviceTemplate},
+				{filepath.Join(unitDir, name+".timer"), timerTemplate},
+			} {
+				var content bytes.Buffer
+				if err := file.template.Execute(&content, unit); err != nil {
+					fatal(exitError, "Error rendering unit", "unit", file.path, "error", err)
+				}
+				if err := os.WriteFile(file.path, content.Bytes(), 0644); err != nil {
+					fatal(exitError, "Error writing unit", "unit", file.path, "error", err)
+				}
+				slog.Info("Wrote unit", "path", file.path)
+			}
+
+			if _, err := os.Stat(envFile); err == nil && !force {
+				slog.Info("Keeping existing environment file, use --force to replace it", "path", envFile)
+			} else {
+				var content strings.Builder
+				content.WriteString("# Credentials of the " + name + " service\n")
+				for _, key := range serviceCredentials {
+					if value := viper.GetString(key); value != "" {
+						fmt.Fprintf(&content, "%s_%s=%s\n", envPrefix, strings.ToUpper(strings.ReplaceAll(key, "-", "_")), value)
+					}
+				}
+				for _, variable := range env {
+					if !strings.Contains(variable, "=") {
+						fatal(exitConfig, "Invalid --env value, expected NAME=value", "env", variable)
+					}
+					content.WriteString(variable + "\n")
+				}
+				if err := os.MkdirAll(filepath.Dir(envFile), 0755); err != nil {
+					fatal(exitError, "Error creating environment file directory", "error", err)
+				}
+				if err := os.WriteFile(envFile, []byte(content.String()), 0600); err != nil {
+					fatal(exitError, "Error writing environment file", "error", err)
+				}
+				slog.Info("Wrote environment file", "path", envFile)
+			}
+
+			if enable {
+				for _, systemctl := range [][]string{
+					{"systemctl", "daemon-reload"},
+					{"systemctl", "enable", "--now", name + ".timer"},
+				} {
+					if output, err := exec.Command(systemctl[0], systemctl[1:]...).CombinedOutput(); err != nil {
+						fatal(exitError, "Error enabling timer", "command", strings.Join(systemctl, " "), "error", err, "output", strings.TrimSpace(string(output)))
+					}
+				}
+				slog.Info("Enabled timer", "timer", name+".timer")
+			} else {
+				slog.Info("Enable the timer with systemctl daemon-reload && systemctl enable --now " + name + ".timer")
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "distro2sbom", "Name of the service and timer units")
+	cmd.Flags().StringVar(&unitDir, "unit-dir", "/etc/systemd/system", "Directory the units are written to")
+	cmd.Flags().StringVar(&envFile, "env-file", "/etc/distro2sbom/distro2sbom.env", "Environment file with the credentials of the service")
+	cmd.Flags().StringVar(&schedule, "schedule", "daily", "When the timer runs, as a systemd OnCalendar expression")
+	cmd.Flags().StringVar(&randomizedDelay, "randomized-delay", "1h", "Maximum random delay added to every run, spreading a fleet's uploads")
+	cmd.Flags().StringVar(&binary, "binary", "", "Path of the distro2sbom binary run by the service (default: the running binary)")
+	cmd.Flags().StringArrayVar(&env, "env", nil, "Additional NAME=value written to the environment file, e.g. AWS_ACCESS_KEY_ID, may be repeated")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace an existing environment file")
+	cmd.Flags().BoolVar(&enable, "enable", false, "Reload systemd and enable and start the timer")
+
+	return cmd
+}
+
+// serviceFlags parses the distro2sbom flags after -- the unit depends on, the values of the
+// configuration file are the defaults of flags that are not given.
+//
+// Parameters:
+// - args: the arguments passed to distro2sbom by the service.
+//
+// Returns:
+// - *pflag.FlagSet: the flags of serviceFileFlags, serviceDirFlags and include.
+func serviceFlags(args []string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("service", pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(io.Discard)
+	for _, key := range append(slices.Clone(serviceFileFlags), serviceDirFlags...) {
+		shorthand := ""
+		if key == "output" {
+			shorthand = "o"
+		}
+		flags.StringP(key, shorthand, viper.GetString(key), "")
+	}
+	flags.StringSlice("include", viper.GetStringSlice("include"), "")
+	// Errors of the other flags are reported by distro2sbom when the service runs
+	flags.Parse(args)
+	return flags
+}
+
+// serviceWritablePaths returns the ReadWritePaths of the service, the directories of the files
+// and the directories it writes to, everything else is read-only with ProtectSystem=strict.
+// Relative paths are resolved against /, the working directory of the service.
+//
+// Parameters:
+// - flags: the flags returned by serviceFlags.
+//
+// Returns:
+// - []string: the paths, without duplicates.
+func serviceWritablePaths(flags *pflag.FlagSet) []string {
+	var paths []string
+	add := func(path string) {
+		path = filepath.Join("/", path)
+		if !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	for _, key := range serviceFileFlags {
+		if file, _ := flags.GetString(key); file != "" && file != "-" {
+			add(filepath.Dir(file))
+		}
+	}
+	for _, key := range serviceDirFlags {
+		if dir, _ := flags.GetString(key); dir != "" {
+			add(dir)
+		}
+	}
+	return paths
+}
+
+// systemdJoin joins a command line for ExecStart, quoting arguments systemd would split.
+func systemdJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'\\") {
+			arg = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+		}
+		// Specifiers and variables are expanded by systemd
+		quoted[i] = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// newSignCmd creates the sign subcommand.
+//
+// The command writes a detached signature of an SBOM file next to it, leaving the SBOM
+// unchanged, and a SHA-256 checksum file, for consumers that verify artifacts out-of-band.
+//
+// Returns:
+// - *cobra.Command: the sign command.
+func newSignCmd() *cobra.Command {
+	var keyPath string
+	var format string
+	var output string
+	var checksumFile string
+
+	cmd := &cobra.Command{
+		Use:   "sign <sbom.json>",
+		Short: "Create a detached signature and checksum file of an SBOM.",
+		Long: `sign writes a detached signature of an SBOM file and a SHA-256 checksum file in sha256sum format.
+The raw format is a base64 encoded signature of the file that can be verified with
+cosign verify-blob --key key.pub --signature sbom.json.sig sbom.json, the dsse format is a
+DSSE envelope with the SBOM as payload.`,
+		Example: `  distro2sbom sign sbom.json --key cosign.key
+  distro2sbom sign sbom.json --key key.pem --format dsse -o sbom.dsse.json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			sbomPath := args[0]
+			sbomJSON, err := os.ReadFile(sbomPath)
+			if err != nil {
+				fatal(exitConfig, "Error reading SBOM", "error", err)
+			}
+			if keyPath == "" {
+				fatal(exitConfig, "--key is required")
+			}
+			signer, err := loadSigningKey(keyPath, os.Getenv("COSIGN_PASSWORD"))
+			if err != nil {
+				fatal(exitConfig, "Error loading signing key", "error", err)
+			}
+
+			var signature []byte
+			switch format {
+			case "raw":
+				sig, err := signBytes(signer, sbomJSON)
+				if err != nil {
+					fatal(exitError, "Error signing SBOM", "error", err)
+				}
+				signature = []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+				if output == "" {
+					output = sbomPath + ".sig"
+				}
+			case "dsse":
+				envelope, err := signDSSE(signer, cycloneDXMediaType, sbomJSON)
+				if err != nil {
+					fatal(exitError, "Error signing SBOM", "error", err)
+				}
+				envelopeJSON, err := json.Marshal(envelope)
+				if err != nil {
+					fatal(exitError, "Error marshaling envelope", "error", err)
+				}
+				signature = append(envelopeJSON, '\n')
+				if output == "" {
+					output = sbomPath + ".dsse.json"
+				}
+			default:
+				fatal(exitConfig, "Invalid --format, expected raw or dsse", "format", format)
+			}
+
+			if err := os.WriteFile(output, signature, 0644); err != nil {
+				fatal(exitError, "Error writing signature", "error", err)
+			}
+			slog.Info("Wrote signature", "path", output, "format", format)
+
+			if checksumFile != "-" {
+				if checksumFile == "" {
+					checksumFile = sbomPath + ".sha256"
+				}
+				digest, _ := fileChecksum("sha256", sbomJSON)
+				if err := writeChecksumFile(checksumFile, sbomPath, digest); err != nil {
+					fatal(exitError, "Error writing checksum file", "error", err)
+				}
+				slog.Info("Wrote checksum file", "path", checksumFile)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&keyPath, "key", "", "Private key in PEM format, cosign encrypted keys use COSIGN_PASSWORD")
+	cmd.Flags().StringVar(&format, "format", "raw", "Signature format, raw or dsse")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file for the signature (default: <sbom>.sig, or <sbom>.dsse.json for dsse)")
+	cmd.Flags().StringVar(&checksumFile, "checksum-file", "", "Output file for the SHA-256 checksum (default: <sbom>.sha256, - to skip)")
+
+	return cmd
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultStoreKey is the object key template used when none is configured.
+const defaultStoreKey = "{{.Hostname}}/{{.Date}}/sbom.json"
+
+// ObjectStore uploads SBOMs to an object storage bucket.
+//
+// Location is a URL of the form s3://bucket/prefix, gs://bucket/prefix or
+// azblob://account/container/prefix. KeyTemplate is a text/template rendered with
+// StoreKeyData and appended to the prefix to form the object key.
+//
+// Credentials are read from the environment:
+// - s3: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION and AWS_ENDPOINT_URL for S3 compatible servers.
+// - gs: GOOGLE_OAUTH_ACCESS_TOKEN, or the GCE metadata server when it is not set.
+// - azblob: AZURE_STORAGE_SAS_TOKEN.
+type ObjectStore struct {
+	Location    string
+	KeyTemplate string
+	TLSVerify   bool
+	Timeout     time.Duration
+}
+
+// StoreKeyData holds the values available to the object key template.
+type StoreKeyData struct {
+	Hostname  string
+	Distro    string
+	Date      string
+	Timestamp string
+}
+
+// objectKey renders the object key for an SBOM below the given prefix.
+//
+// Parameters:
+// - prefix: the prefix from the store location.
+// - data: the values available to the template.
+//
+// Returns:
+// - string: the object key without a leading slash.
+// - error: an error if the template is invalid.
+func (s *ObjectStore) objectKey(prefix string, data StoreKeyData) (string, error) {
+	keyTemplate := s.KeyTemplate
+	if keyTemplate == "" {
+		keyTemplate = defaultStoreKey
+	}
+	key, err := renderPathTemplate(keyTemplate, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(path.Join(prefix, key), "/"), nil
+}
+
+// renderPathTemplate renders a path template such as an object key with the host details.
+//
+// Parameters:
+// - pathTemplate: the text/template to render.
+// - data: the values available to the template.
+//
+// Returns:
+// - string: the rendered path.
+// - error: an error if the template is invalid or refers to an unknown value.
+func renderPathTemplate(pathTemplate string, data StoreKeyData) (string, error) {
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(pathTemplate)
+	if err != nil {
+		return "", fmt.Errorf("error parsing path template: %v", err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("error rendering path template: %v", err)
+	}
+	return rendered.String(), nil
+}
+
+// upload stores an SBOM in the configured bucket.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the upload.
+// - data: the values available to the object key template.
+// - sbomJSON: the SBOM in JSON format.
+//
+// Returns:
+// - string: the key of the stored object.
+// - error: an error if the location is invalid or the upload fails.
+func (s *ObjectStore) upload(ctx context.Context, data StoreKeyData, sbomJSON []byte) (string, error) {
+	location, err := url.Parse(s.Location)
+	if err != nil {
+		return "", fmt.Errorf("invalid store location %s: %v", s.Location, err)
+	}
+	if location.Host == "" {
+		return "", fmt.Errorf("invalid store location %s: missing bucket", s.Location)
+	}
+
+	client := newHTTPClient(s.TLSVerify, s.Timeout)
+
+	switch location.Scheme {
+	case "s3":
+		key, err := s.objectKey(location.Path, data)
+		if err != nil {
+			return "", err
+		}
+		return key, putS3Object(ctx, client, location.Host, key, sbomJSON)
+	case "gs":
+		key, err := s.objectKey(location.Path, data)
+		if err != nil {
+			return "", err
+		}
+		return key, putGCSObject(ctx, client, location.Host, key, sbomJSON)
+	case "azblob":
+		parts := strings.SplitN(strings.TrimPrefix(location.Path, "/"), "/", 2)
+		if parts[0] == "" {
+			return "", fmt.Errorf("invalid store location %s: missing container", s.Location)
+		}
+		prefix := ""
+		if len(parts) == 2 {
+			prefix = parts[1]
+		}
+		key, err := s.objectKey(prefix, data)
+		if err != nil {
+			return "", err
+		}
+		return key, putAzureBlob(ctx, client, location.Host, parts[0], key, sbomJSON)
+	default:
+		return "", fmt.Errorf("unsupported store scheme: %s", location.Scheme)
+	}
+}
+
+// putS3Object uploads an object to Amazon S3 or an S3 compatible server using Signature Version 4.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the upload.
+// - client: the HTTP client to use.
+// - bucket: the name of the bucket.
+// - key: the object key.
+// - body: the object content.
+//
+// Returns:
+// - error: an error if credentials are missing or the upload fails.
+func putS3Object(ctx context.Context, client *http.Client, bucket, key string, body []byte) error {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to store SBOMs in S3")
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	// Path style addressing for custom endpoints, virtual hosted style for AWS
+	var objectURL string
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		objectURL = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(endpoint, "/"), bucket, escapeObjectKey(key))
+	} else {
+		objectURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, escapeObjectKey(key))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", objectURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.cyclonedx+json")
+	// S3 requires the hash of the payload as header
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signAWSv4(req, body, accessKey, secretKey, region, "s3", time.Now().UTC())
+
+	return doStoreRequest(client, req)
+}
+
+// signAWSv4 adds an AWS Signature Version 4 Authorization header to a request.
+//
+// Parameters:
+// - req: the request to sign, all headers must be set before signing.
+// - body: the request body.
+// - accessKey: the AWS access key ID.
+// - secretKey: the AWS secret access key.
+// - region: the AWS region.
+// - service: the AWS service name.
+// - now: the signing time.
+func signAWSv4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	hmacSHA256 := func(key []byte, data string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		return mac.Sum(nil)
+	}
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+// putGCSObject uploads an object to Google Cloud Storage using the JSON API.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the upload.
+// - client: the HTTP client to use.
+// - bucket: the name of the bucket.
+// - key: the object name.
+// - body: the object content.
+//
+// Returns:
+// - error: an error if no access token is available or the upload fails.
+func putGCSObject(ctx context.Context, client *http.Client, bucket, key string, body []byte) error {
+	token, err := gcsAccessToken(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	uploadURL := fmt.Sprintf("https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s", url.PathEscape(bucket), url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.cyclonedx+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return doStoreRequest(client, req)
+}
+
+// gcsAccessToken returns an OAuth access token for Google Cloud Storage.
+//
+// The token is read from GOOGLE_OAUTH_ACCESS_TOKEN, or requested from the metadata
+// server of the Compute Engine instance the tool runs on.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the request.
+// - client: the HTTP client to use.
+//
+// Returns:
+// - string: the access token.
+// - error: an error if no token can be obtained.
+func gcsAccessToken(ctx context.Context, client *http.Client) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("GOOGLE_OAUTH_ACCESS_TOKEN is not set and the metadata server is unavailable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("unexpected status code from metadata server: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error decoding metadata server response: %v", err)
+	}
+
+	return token.AccessToken, nil
+}
+
+// putAzureBlob uploads a block blob to Azure Blob Storage using a shared access signature.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the upload.
+// - client: the HTTP client to use.
+// - account: the storage account name.
+// - container: the blob container name.
+// - key: the blob name.
+// - body: the blob content.
+//
+// Returns:
+// - error: an error if no SAS token is set or the upload fails.
+func putAzureBlob(ctx context.Context, client *http.Client, account, container, key string, body []byte) error {
+	sas := strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?")
+	if sas == "" {
+		return fmt.Errorf("AZURE_STORAGE_SAS_TOKEN must be set to store SBOMs in Azure Blob Storage")
+	}
+
+	blobURL := fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s?%s", account, container, escapeObjectKey(key), sas)
+	req, err := http.NewRequestWithContext(ctx, "PUT", blobURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.cyclonedx+json")
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-version", "2021-08-06")
+
+	return doStoreRequest(client, req)
+}
+
+// escapeObjectKey escapes an object key for use in a URL path the way the canonical URI of
+// AWS Signature Version 4 encodes it: every byte other than A-Z, a-z, 0-9, -, ., _ and ~ is
+// percent-encoded, except the slashes between the segments. url.PathEscape leaves characters
+// such as : @ + = & $ as they are, which S3 encodes before checking the signature.
+func escapeObjectKey(key string) string {
+	return percentEncode(key, "-._~/")
+}
+
+// doStoreRequest sends an upload request and checks the response status.
+func doStoreRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
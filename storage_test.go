@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEscapeObjectKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"host/2024-01-02/sbom.json", "host/2024-01-02/sbom.json"},
+		{"a-b_c.d~e", "a-b_c.d~e"},
+		{"host:8080/sbom.json", "host%3A8080/sbom.json"},
+		{"user@host/a+b=c&d$e", "user%40host/a%2Bb%3Dc%26d%24e"},
+		{"example space/", "example%20space/"},
+		{"ሴ", "%E1%88%B4"},
+		{"100%/x?y#z", "100%25/x%3Fy%23z"},
+	}
+	for _, test := range tests {
+		if got := escapeObjectKey(test.key); got != test.want {
+			t.Errorf("escapeObjectKey(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+// TestSignAWSv4 checks the signatures of requests of the AWS Signature Version 4 test suite.
+func TestSignAWSv4(t *testing.T) {
+	const (
+		accessKey = "AKIDEXAMPLE"
+		secretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"get-vanilla", "", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-utf8", "ሴ", "8318018e0b0f223aa2bbf98705b62bb787dc9c0e678f255a891fd03141be5d85"},
+		{"get-space", "example space/", "652487583200325589f1fba4c7e578f72c47cb61beeca81406b39ddec1366741"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "https://example.amazonaws.com/"+escapeObjectKey(test.path), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signAWSv4(req, nil, accessKey, secretKey, "us-east-1", "service", now)
+			want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + test.want
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("Authorization = %q, want %q", got, want)
+			}
+		})
+	}
+}
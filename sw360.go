@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// SW360 exports the components of an SBOM to an Eclipse SW360 server.
+//
+// Every package becomes an SW360 component with a release per version. Existing
+// components and releases are reused and the package URL and licenses of the
+// release are updated, so repeated exports do not create duplicates.
+type SW360 struct {
+	URL       string
+	Token     string
+	TLSVerify bool
+	Timeout   time.Duration
+
+	client *http.Client
+}
+
+// SW360Link is a HAL link as returned by the SW360 REST API.
+type SW360Link struct {
+	Href string `json:"href"`
+}
+
+// SW360Resource is the common shape of SW360 components and releases.
+type SW360Resource struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Links   struct {
+		Self SW360Link `json:"self"`
+	} `json:"_links"`
+}
+
+// id returns the SW360 identifier of the resource, the last segment of its self link.
+func (r SW360Resource) id() string {
+	return path.Base(r.Links.Self.Href)
+}
+
+// export creates or updates a component and release in SW360 for every component of the SBOM.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the requests.
+// - bom: the SBOM to export.
+//
+// Returns:
+// - int: the number of exported releases.
+// - error: an error if a request fails.
+func (s *SW360) export(ctx context.Context, bom *cyclonedx.BOM) (int, error) {
+	s.client = newHTTPClient(s.TLSVerify, s.Timeout)
+	if bom.Components == nil {
+		return 0, nil
+	}
+
+	exported := 0
+	for _, component := range *bom.Components {
+		if component.Type != cyclonedx.ComponentTypeLibrary {
+			continue
+		}
+
+		componentID, err := s.ensureComponent(ctx, component.Name)
+		if err != nil {
+			return exported, fmt.Errorf("error exporting component %s: %v", component.Name, err)
+		}
+
+		release := map[string]any{
+			"name":        component.Name,
+			"version":     component.Version,
+			"externalIds": map[string]string{"package-url": component.PackageURL},
+		}
+		if component.CPE != "" {
+			release["cpeId"] = component.CPE
+		}
+		if component.Licenses != nil {
+			var licenseIDs []string
+			for _, license := range *component.Licenses {
+				if license.License != nil && license.License.ID != "" {
+					licenseIDs = append(licenseIDs, license.License.ID)
+				}
+			}
+			if len(licenseIDs) > 0 {
+				release["mainLicenseIds"] = licenseIDs
+			}
+		}
+
+		releaseID, err := s.findRelease(ctx, componentID, component.Version)
+		if err != nil {
+			return exported, fmt.Errorf("error looking up release %s %s: %v", component.Name, component.Version, err)
+		}
+		if releaseID == "" {
+			release["componentId"] = componentID
+			_, err = s.request(ctx, "POST", "/resource/api/releases", release, nil)
+		} else {
+			_, err = s.request(ctx, "PATCH", "/resource/api/releases/"+releaseID, release, nil)
+		}
+		if err != nil {
+			return exported, fmt.Errorf("error exporting release %s %s: %v", component.Name, component.Version, err)
+		}
+		exported++
+	}
+
+	return exported, nil
+}
+
+// ensureComponent returns the ID of the SW360 component with the given name, creating it if needed.
+func (s *SW360) ensureComponent(ctx context.Context, name string) (string, error) {
+	var found struct {
+		Embedded struct {
+			Components []SW360Resource `json:"sw360:components"`
+		} `json:"_embedded"`
+	}
+	if _, err := s.request(ctx, "GET", "/resource/api/components?name="+url.QueryEscape(name), nil, &found); err != nil {
+		return "", err
+	}
+	for _, component := range found.Embedded.Components {
+		if component.Name == name {
+			return component.id(), nil
+		}
+	}
+
+	var created SW360Resource
+	component := map[string]string{
+		"name":          name,
+		"componentType": "OSS",
+		"description":   "Operating system package imported by distro2sbom",
+	}
+	if _, err := s.request(ctx, "POST", "/resource/api/components", component, &created); err != nil {
+		return "", err
+	}
+	return created.id(), nil
+}
+
+// findRelease returns the ID of the release of a component with the given version, or an empty string.
+func (s *SW360) findRelease(ctx context.Context, componentID, version string) (string, error) {
+	var component struct {
+		Embedded struct {
+			Releases []SW360Resource `json:"sw360:releases"`
+		} `json:"_embedded"`
+	}
+	if _, err := s.request(ctx, "GET", "/resource/api/components/"+componentID, nil, &component); err != nil {
+		return "", err
+	}
+	for _, release := range component.Embedded.Releases {
+		if release.Version == version {
+			return release.id(), nil
+		}
+	}
+	return "", nil
+}
+
+// request sends a JSON request to the SW360 REST API and decodes the response into result.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the request.
+// - method: the HTTP method.
+// - endpoint: the path of the endpoint, including any query.
+// - body: the request body, marshaled to JSON, or nil.
+// - result: the value the response is decoded into, or nil to discard it.
+//
+// Returns:
+// - int: the HTTP status code.
+// - error: an error if the request fails or the response is not successful.
+func (s *SW360) request(ctx context.Context, method, endpoint string, body any, result any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		bodyJSON, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("error marshaling request: %v", err)
+		}
+		reader = bytes.NewReader(bodyJSON)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.URL, "/")+endpoint, reader)
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Accept", "application/hal+json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+s.Token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// An empty search result is reported as 204 No Content
+	if resp.StatusCode == http.StatusNoContent {
+		return resp.StatusCode, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(respBody))
+	}
+
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return resp.StatusCode, fmt.Errorf("error decoding response: %v", err)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
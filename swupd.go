@@ -0,0 +1,16 @@
+package main
+
+// Clear Linux installs bundles with swupd instead of packages. swupd keeps no record of the
+// packages a bundle was built from, so the bundles are the components, versioned with the
+// release of the operating system they are part of.
+
+// swupdBundlesScript lists the installed bundles, which swupd tracks as files named after
+// them in /usr/share/clear/bundles, with the release of the operating system.
+const swupdBundlesScript = `. /usr/lib/os-release && for bundle in /usr/share/clear/bundles/*; do ` +
+	`[ -f "$bundle" ] && echo "${bundle##*/} $VERSION_ID"; done; true`
+
+// swupdIncludesScript prints the bundles the bundle in $1 includes, read from the includes:
+// header of its manifest in the swupd state directory, which update and bundle-add keep for
+// the current release. Bundles whose manifest was removed by swupd clean have no dependencies.
+const swupdIncludesScript = `. /usr/lib/os-release && manifest="/var/lib/swupd/$VERSION_ID/Manifest.$1" && ` +
+	`if [ -f "$manifest" ]; then sed -n 's/^includes:[[:space:]]*//p' "$manifest"; fi`
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// tdnfOptions are the global options of the tdnf commands, which only query the installed
+// packages, so that the metadata of the repositories is neither loaded nor refreshed.
+var tdnfOptions = []string{"tdnf", "--quiet", "--disablerepo=*", "repoquery", "--installed"}
+
+// tdnfRequiresCommand returns the command listing the requirements of an installed package.
+// repoquery came with tdnf 3.
+//
+// Parameters:
+// - packageName: the name of the package.
+//
+// Returns:
+// - []string: the command and its arguments.
+func tdnfRequiresCommand(packageName string) []string {
+	return append(append([]string{}, tdnfOptions...), "--requires", packageName)
+}
+
+// tdnfProvidersCommand returns the command listing the installed packages providing
+// capabilities. tdnf takes the capabilities of --whatprovides separated by commas.
+//
+// Parameters:
+// - capabilities: the capabilities, e.g. libc.so.6()(64bit).
+//
+// Returns:
+// - []string: the command and its arguments.
+func tdnfProvidersCommand(capabilities []string) []string {
+	return append(append([]string{}, tdnfOptions...), "--whatprovides", strings.Join(capabilities, ","))
+}
+
+// tdnfRequirement returns the capability of a line of tdnf repoquery --requires, e.g.
+// glibc for "glibc >= 2.36".
+//
+// Requirements on rpm features, rpmlib(...), rich dependencies, e.g. (grub2 if
+// efi-filesystem), and capabilities containing commas, which --whatprovides would split,
+// are skipped.
+//
+// Parameters:
+// - line: a line of tdnf repoquery --requires.
+//
+// Returns:
+// - string: the capability, empty for skipped lines.
+func tdnfRequirement(line string) string {
+	requirement := strings.TrimSpace(line)
+	if requirement == "" || strings.HasPrefix(requirement, "rpmlib(") || strings.HasPrefix(requirement, "(") {
+		return ""
+	}
+	capability, _, _ := strings.Cut(requirement, " ")
+	if strings.Contains(capability, ",") {
+		return ""
+	}
+	return capability
+}
+
+// fetchTdnfDependencies fetches the dependencies of a package of Photon OS with tdnf.
+// tdnf repoquery --requires lists capabilities, e.g. libc.so.6()(64bit) or /bin/sh, which
+// are resolved to the installed packages providing them with a single tdnf repoquery
+// --whatprovides, as tdnf has no --resolve.
+//
+// Parameters:
+// - ctx: the context, the commands are killed when it is cancelled.
+// - runner: runs the commands on the scanned system.
+// - packageName: the name of the package.
+// - maxLineSize: the longest line of output that is accepted, 0 for defaultMaxLineSize.
+//
+// Returns:
+// - []string: the packages providing the requirements, qualified with their architecture.
+// - error: an error if tdnf fails.
+func fetchTdnfDependencies(ctx context.Context, runner Runner, packageName string, maxLineSize int) ([]string, error) {
+	var capabilities []string
+	err := streamCommand(ctx, runner, tdnfRequiresCommand(packageName), maxLineSize, func(line string) {
+		if capability := tdnfRequirement(line); capability != "" {
+			capabilities = append(capabilities, capability)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(capabilities) == 0 {
+		return nil, nil
+	}
+
+	var dependencies []string
+	seen := make(map[string]bool)
+	err = streamCommand(ctx, runner, tdnfProvidersCommand(capabilities), maxLineSize, func(line string) {
+		// glibc-2.36-5.ph5.x86_64
+		if dependency := dnfDependencyName(strings.TrimSpace(line)); dependency != "" && !seen[dependency] {
+			seen[dependency] = true
+			dependencies = append(dependencies, dependency)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dependencies, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTdnfRequirement(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"/bin/sh", "/bin/sh"},
+		{"glibc >= 2.36", "glibc"},
+		{"libc.so.6(GLIBC_2.34)(64bit)", "libc.so.6(GLIBC_2.34)(64bit)"},
+		{"rpmlib(CompressedFileNames) <= 3.0.4-1", ""},
+		{"(bash-completion if bash)", ""},
+		{"perl(Foo,Bar)", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := tdnfRequirement(test.line); got != test.want {
+			t.Errorf("tdnfRequirement(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestFetchDependenciesTdnf(t *testing.T) {
+	capabilities := []string{"/bin/sh", "glibc", "libc.so.6()(64bit)", "libc.so.6(GLIBC_2.34)(64bit)", "libreadline.so.8()(64bit)", "ncurses-libs"}
+	runner := &fixtureRunner{outputs: map[string]string{
+		strings.Join(tdnfRequiresCommand("bash.x86_64"), " "): "tdnf-repoquery-requires.txt",
+		strings.Join(tdnfProvidersCommand(capabilities), " "): "tdnf-repoquery-whatprovides.txt",
+	}}
+	got, err := fetchDependencies(context.Background(), runner, "tdnf", "bash.x86_64", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"bash:x86_64", "glibc:x86_64", "ncurses-libs:x86_64", "readline:x86_64"}
+	if !slices.Equal(got, want) {
+		t.Errorf("fetchDependencies() = %q, want %q", got, want)
+	}
+	if len(runner.commands) != 2 {
+		t.Errorf("ran %d commands, want tdnf repoquery --requires and --whatprovides", len(runner.commands))
+	}
+}
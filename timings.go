@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Timings records the wall time of the phases of a run and of the package manager commands
+// by class, so that slow hosts can be analysed. A nil Timings records nothing.
+//
+// The listing, licenses and dependencies phases overlap as packages are streamed through
+// the pipeline, each is measured from the start of the collection until it finished.
+type Timings struct {
+	mu       sync.Mutex
+	phases   map[string]time.Duration
+	order    []string
+	commands map[string]*CommandTiming
+}
+
+// CommandTiming is the time spent in the package manager commands of a class, e.g. license.
+type CommandTiming struct {
+	Count int
+	Total time.Duration
+	Max   time.Duration
+	// Wait is the time the commands waited for the package database lock.
+	Wait time.Duration
+}
+
+// newTimings creates an empty Timings.
+func newTimings() *Timings {
+	return &Timings{
+		phases:   make(map[string]time.Duration),
+		commands: make(map[string]*CommandTiming),
+	}
+}
+
+// phase adds the wall time of a phase, phases are reported in the order they were first added.
+func (t *Timings) phase(name string, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.phases[name]; !ok {
+		t.order = append(t.order, name)
+	}
+	t.phases[name] += duration
+}
+
+// command adds the duration of a package manager command of a class.
+func (t *Timings) command(class string, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timing := t.commandTiming(class)
+	timing.Count++
+	timing.Total += duration
+	timing.Max = max(timing.Max, duration)
+}
+
+// wait adds the time a package manager command of a class waited for the package database lock.
+func (t *Timings) wait(class string, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.commandTiming(class).Wait += duration
+}
+
+// commandTiming returns the timing of a command class, the lock must be held.
+func (t *Timings) commandTiming(class string) *CommandTiming {
+	timing, ok := t.commands[class]
+	if !ok {
+		timing = &CommandTiming{}
+		t.commands[class] = timing
+	}
+	return timing
+}
+
+// TimingsReport is the timings of a run in the result JSON, in seconds.
+type TimingsReport struct {
+	Phases   map[string]float64              `json:"phases"`
+	Commands map[string]CommandTimingsReport `json:"commands"`
+}
+
+// CommandTimingsReport is the time spent in the commands of a class in the result JSON.
+type CommandTimingsReport struct {
+	Count        int     `json:"count"`
+	TotalSeconds float64 `json:"totalSeconds"`
+	MaxSeconds   float64 `json:"maxSeconds"`
+	WaitSeconds  float64 `json:"waitSeconds"`
+}
+
+// report returns the timings for the result JSON.
+func (t *Timings) report() *TimingsReport {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report := &TimingsReport{
+		Phases:   make(map[string]float64),
+		Commands: make(map[string]CommandTimingsReport),
+	}
+	for name, duration := range t.phases {
+		report.Phases[name] = duration.Seconds()
+	}
+	for class, timing := range t.commands {
+		report.Commands[class] = CommandTimingsReport{
+			Count:        timing.Count,
+			TotalSeconds: timing.Total.Seconds(),
+			MaxSeconds:   timing.Max.Seconds(),
+			WaitSeconds:  timing.Wait.Seconds(),
+		}
+	}
+	return report
+}
+
+// print writes the timings as a table, the command classes sorted by their total time.
+func (t *Timings) print(w io.Writer) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fmt.Fprintln(w, "Phases:")
+	for _, name := range t.order {
+		fmt.Fprintf(w, "  %-14s %s\n", name, t.phases[name].Round(time.Millisecond))
+	}
+
+	classes := make([]string, 0, len(t.commands))
+	for class := range t.commands {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool { return t.commands[classes[i]].Total > t.commands[classes[j]].Total })
+	if len(classes) > 0 {
+		fmt.Fprintln(w, "Commands:")
+	}
+	for _, class := range classes {
+		timing := t.commands[class]
+		average := timing.Total / time.Duration(max(timing.Count, 1))
+		fmt.Fprintf(w, "  %-14s %6d calls, total %s, average %s, max %s", class, timing.Count,
+			timing.Total.Round(time.Millisecond), average.Round(time.Millisecond), timing.Max.Round(time.Millisecond))
+		if timing.Wait > 0 {
+			fmt.Fprintf(w, ", waited %s for the lock", timing.Wait.Round(time.Millisecond))
+		}
+		fmt.Fprintln(w)
+	}
+}
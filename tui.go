@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// tuiState is the screen shown by the TUI.
+type tuiState int
+
+const (
+	tuiOptions tuiState = iota
+	tuiCollecting
+	tuiPreview
+	tuiConfirm
+	tuiUploading
+)
+
+// tuiProgressMsg reports the progress of a collection phase.
+type tuiProgressMsg struct {
+	phase string
+	done  int
+	total int
+}
+
+// tuiCollectedMsg is sent when the collection finished.
+type tuiCollectedMsg struct {
+	bom *cyclonedx.BOM
+	err error
+}
+
+// tuiUploadedMsg is sent when the upload finished.
+type tuiUploadedMsg struct {
+	err error
+}
+
+// tuiModel is the bubbletea model of the TUI.
+type tuiModel struct {
+	ctx      context.Context
+	distro   string
+	hostname string
+	output   string
+	dt       *DependencyTrack
+
+	state    tuiState
+	cursor   int
+	options  CollectOptions
+	filter   string
+	editing  bool
+	progress map[string]tuiProgressMsg
+	updates  chan tea.Msg
+
+	bom    *cyclonedx.BOM
+	shown  []cyclonedx.Component
+	offset int
+	height int
+	status string
+}
+
+// newTuiCmd creates the tui subcommand.
+//
+// The command collects the SBOM with live progress, lets the operator toggle the license
+// and dependency collectors, filter and preview the components, and write or upload the
+// result after confirmation. Upload settings are taken from the configuration file and
+// DISTRO2SBOM_ environment variables.
+//
+// Returns:
+// - *cobra.Command: the tui command.
+func newTuiCmd() *cobra.Command {
+	var distro string
+	var spdxSchema string
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "tui",
+		Short: "Collect, preview and upload an SBOM interactively.",
+		Long: `tui shows live collection progress, lets the operator toggle collectors and filter components,
+previews the component list and writes or uploads the SBOM after confirmation.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !cmd.Flags().Changed("distro") {
+				distro = viper.GetString("distro")
+			}
+			if !cmd.Flags().Changed("spdx-schema") {
+				spdxSchema = viper.GetString("spdx-schema")
+			}
+			if !cmd.Flags().Changed("output") {
+				output = viper.GetString("output")
+			}
+
+			if distro == "" {
+				fatal(exitConfig, "Please specify a distribution using the --distro flag")
+			}
+			if spdxSchema == "" {
+				fatal(exitConfig, "spdx-schema is not set. Please specify the location of spdx.schema.json using the --spdx-schema flag or in the configuration file")
+			}
+			if err := loadSPDXSchema(spdxSchema); err != nil {
+				fatal(exitConfig, "Error loading SPDX schema", "error", err)
+			}
+			runner, err := newRunner(viper.GetString("rootfs"), viper.GetString("ssh"))
+			if err != nil {
+				fatal(exitConfig, "Invalid scan target", "error", err)
+			}
+			specVersion, err := parseSpecVersion(viper.GetString("spec-version"))
+			if err != nil {
+				fatal(exitConfig, "Invalid --spec-version", "error", err)
+			}
+			metadata, err := loadMetadataConfig(viper.GetStringSlice("author"), viper.GetStringSlice("contact"))
+			if err != nil {
+				fatal(exitConfig, "Invalid SBOM metadata", "error", err)
+			}
+			metadata.Properties, err = loadComplianceProperties(viper.GetStringSlice("compliance-tags"))
+			if err != nil {
+				fatal(exitConfig, "Invalid --compliance-tags", "error", err)
+			}
+
+			// Quitting cancels a running collection or upload
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			hostname, err := scannedHostname(ctx, runner)
+			if err != nil {
+				fatal(exitCollection, "Error getting hostname", "error", err)
+			}
+
+			model := &tuiModel{
+				ctx:      ctx,
+				distro:   distro,
+				hostname: hostname,
+				output:   output,
+				options: CollectOptions{
+					CommandTimeout: viper.GetDuration("command-timeout"),
+					Workers:        viper.GetInt("workers"),
+					MaxLineSize:    viper.GetInt("max-line-size"),
+					Source:         viper.GetString("source"),
+					MultiArch:      viper.GetString("multi-arch"),
+					Profile:        viper.GetString("profile"),
+					SpecVersion:    specVersion,
+					Include:        viper.GetStringSlice("include"),
+					DependencyRoot: viper.GetString("dependency-root"),
+					Metadata:       metadata,
+					Runner:         runner,
+					Strict:         viper.GetBool("strict"),
+					PluginPaths:    viper.GetStringSlice("plugin-path"),
+					Component: ComponentIdentity{
+						Name:    viper.GetString("component-name"),
+						Version: viper.GetString("component-version"),
+						Type:    viper.GetString("component-type"),
+					},
+				},
+				progress: make(map[string]tuiProgressMsg),
+				updates:  make(chan tea.Msg, 64),
+				height:   24,
+			}
+			if annotationsPath := viper.GetString("annotations"); annotationsPath != "" {
+				notes, err := loadReviewerNotes(annotationsPath)
+				if err != nil {
+					fatal(exitConfig, "Error loading annotations", "error", err)
+				}
+				model.options.Annotations = notes
+			}
+			if cacheDir := viper.GetString("cache-dir"); cacheDir != "" {
+				cache, err := openCache(cacheDir, viper.GetDuration("cache-ttl"))
+				if err != nil {
+					fatal(exitConfig, "Error opening cache", "error", err)
+				}
+				model.options.Cache = cache
+			}
+			if viper.GetString("api-url") != "" && viper.GetString("api-key") != "" {
+				model.dt = &DependencyTrack{
+					APIURL:    viper.GetString("api-url"),
+					APIKey:    viper.GetString("api-key"),
+					TLSVerify: viper.GetBool("tls-verify"),
+					Timeout:   viper.GetDuration("http-timeout"),
+					Teams:     viper.GetStringSlice("project-team"),
+				}
+			}
+
+			// Log lines would corrupt the screen, errors are shown in the status line instead
+			logger := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+			_, err = tea.NewProgram(model, tea.WithAltScreen()).Run()
+			cancel()
+			slog.SetDefault(logger)
+			if err != nil {
+				fatal(exitError, "Error running TUI", "error", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&distro, "distro", "d", "", "Linux distribution (e.g., ubuntu, debian)")
+	cmd.Flags().StringVar(&spdxSchema, "spdx-schema", "", "Location of spdx.schema.json")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File the SBOM is written to when requested")
+
+	return cmd
+}
+
+// Init implements tea.Model.
+func (m *tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model.
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+		return m, nil
+	case tuiProgressMsg:
+		m.progress[msg.phase] = msg
+		return m, m.waitForUpdate()
+	case tuiCollectedMsg:
+		if msg.err != nil {
+			m.state = tuiOptions
+			m.status = "Collection failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.bom = msg.bom
+		m.state = tuiPreview
+		m.applyFilter()
+		return m, nil
+	case tuiUploadedMsg:
+		m.state = tuiPreview
+		if msg.err != nil {
+			m.status = "Upload failed: " + msg.err.Error()
+		} else {
+			m.status = fmt.Sprintf("Uploaded %d components to %s", len(m.shown), m.dt.APIURL)
+		}
+		return m, nil
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+		if m.editing {
+			m.editFilter(msg)
+			return m, nil
+		}
+		// Keys typed faster than they are read arrive as one message, handle them one by one
+		if msg.Type == tea.KeyRunes && len(msg.Runes) > 1 {
+			var cmds []tea.Cmd
+			for _, r := range msg.Runes {
+				_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+				cmds = append(cmds, cmd)
+			}
+			return m, tea.Batch(cmds...)
+		}
+		return m.handleKey(msg.String())
+	}
+	return m, nil
+}
+
+// handleKey handles a key press outside of filter editing.
+func (m *tuiModel) handleKey(key string) (tea.Model, tea.Cmd) {
+	switch m.state {
+	case tuiOptions:
+		switch key {
+		case "q":
+			return m, tea.Quit
+		case "up", "k":
+			m.cursor = max(m.cursor-1, 0)
+		case "down", "j":
+			m.cursor = min(m.cursor+1, 2)
+		case " ", "x":
+			switch m.cursor {
+			case 0:
+				m.options.SkipLicenses = !m.options.SkipLicenses
+			case 1:
+				m.options.SkipDependencies = !m.options.SkipDependencies
+			case 2:
+				m.editing = true
+			}
+		case "/":
+			m.cursor = 2
+			m.editing = true
+		case "enter":
+			m.state = tuiCollecting
+			m.status = ""
+			return m, tea.Batch(m.collect(), m.waitForUpdate())
+		}
+	case tuiPreview:
+		switch key {
+		case "q":
+			return m, tea.Quit
+		case "up", "k":
+			m.offset = max(m.offset-1, 0)
+		case "down", "j":
+			m.offset = max(min(m.offset+1, len(m.shown)-m.listHeight()), 0)
+		case "pgup":
+			m.offset = max(m.offset-m.listHeight(), 0)
+		case "pgdown", " ":
+			m.offset = max(min(m.offset+m.listHeight(), len(m.shown)-m.listHeight()), 0)
+		case "/":
+			m.editing = true
+		case "w":
+			if m.output == "" {
+				m.status = "No output file configured, use --output"
+				break
+			}
+			sbomJSON, err := encodeBOM(m.filteredBOM())
+			if err == nil {
+				err = tuiValidate(sbomJSON)
+			}
+			if err == nil {
+				err = writeFileAtomic(m.output, sbomJSON, 0644)
+			}
+			if err != nil {
+				m.status = "Writing SBOM failed: " + err.Error()
+			} else {
+				m.status = fmt.Sprintf("Wrote %d components to %s", len(m.shown), m.output)
+			}
+		case "u":
+			if m.dt == nil {
+				m.status = "No Dependency-Track configured, set api-url and api-key in the configuration file"
+				break
+			}
+			m.state = tuiConfirm
+		}
+	case tuiConfirm:
+		switch key {
+		case "y":
+			m.state = tuiUploading
+			return m, m.upload()
+		default:
+			m.state = tuiPreview
+			m.status = "Upload cancelled"
+		}
+	}
+	return m, nil
+}
+
+// editFilter edits the component filter while it has focus.
+func (m *tuiModel) editFilter(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyEnter, tea.KeyEsc:
+		m.editing = false
+	case tea.KeyBackspace:
+		if len(m.filter) > 0 {
+			m.filter = m.filter[:len(m.filter)-1]
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.filter += string(msg.Runes)
+	}
+	if m.state == tuiPreview {
+		m.applyFilter()
+	}
+}
+
+// collect starts the collection in the background, progress is delivered through updates.
+func (m *tuiModel) collect() tea.Cmd {
+	options := m.options
+	options.Progress = func(phase string, done, total int) {
+		m.updates <- tuiProgressMsg{phase: phase, done: done, total: total}
+	}
+	return func() tea.Msg {
+		bom, err := generateSBOM(m.ctx, m.distro, "1.0", options)
+		return tuiCollectedMsg{bom: bom, err: err}
+	}
+}
+
+// waitForUpdate waits for the next progress update of the collection.
+func (m *tuiModel) waitForUpdate() tea.Cmd {
+	return func() tea.Msg {
+		return <-m.updates
+	}
+}
+
+// upload uploads the filtered SBOM to Dependency-Track.
+func (m *tuiModel) upload() tea.Cmd {
+	bom := m.filteredBOM()
+	return func() tea.Msg {
+		sbomJSON, err := encodeBOM(bom)
+		if err != nil {
+			return tuiUploadedMsg{err: err}
+		}
+		if err := tuiValidate(sbomJSON); err != nil {
+			return tuiUploadedMsg{err: err}
+		}
+		return tuiUploadedMsg{err: m.dt.uploadSBOM(m.ctx, m.distro, m.hostname, getOSVersion(m.ctx, m.options.Runner), sbomJSON, nil)}
+	}
+}
+
+// tuiValidate validates the SBOM before it is written or uploaded, the first violation is
+// returned for the status line instead of logging over the screen.
+func tuiValidate(sbomJSON []byte) error {
+	_, schemaErrors, err := validateSBOM(sbomJSON)
+	if err != nil {
+		return err
+	}
+	if len(schemaErrors) > 0 {
+		return fmt.Errorf("SBOM is not valid against the CycloneDX schema, %d violations, first %s", len(schemaErrors), schemaErrors[0])
+	}
+	return nil
+}
+
+// applyFilter selects the library components matching the filter for the preview.
+func (m *tuiModel) applyFilter() {
+	m.shown = m.shown[:0]
+	m.offset = 0
+	if m.bom == nil || m.bom.Components == nil {
+		return
+	}
+	for _, component := range *m.bom.Components {
+		if component.Type != cyclonedx.ComponentTypeLibrary {
+			continue
+		}
+		if m.filter != "" {
+			if matched, _ := path.Match(m.filter, component.Name); !matched {
+				continue
+			}
+		}
+		m.shown = append(m.shown, component)
+	}
+}
+
+// filteredBOM returns a copy of the SBOM with only the components shown in the preview.
+func (m *tuiModel) filteredBOM() *cyclonedx.BOM {
+	bom := *m.bom
+	kept := make(map[string]bool)
+	var components []cyclonedx.Component
+	for _, component := range *m.bom.Components {
+		if component.Type != cyclonedx.ComponentTypeLibrary {
+			components = append(components, component)
+			kept[component.BOMRef] = true
+		}
+	}
+	for _, component := range m.shown {
+		components = append(components, component)
+		kept[component.BOMRef] = true
+	}
+	bom.Components = &components
+
+	kept["CDXRef-DOCUMENT"] = true
+	if m.bom.Dependencies != nil {
+		var dependencies []cyclonedx.Dependency
+		for _, dependency := range *m.bom.Dependencies {
+			if !kept[dependency.Ref] {
+				continue
+			}
+			var refs []string
+			if dependency.Dependencies != nil {
+				for _, ref := range *dependency.Dependencies {
+					if kept[ref] {
+						refs = append(refs, ref)
+					}
+				}
+			}
+			dependency.Dependencies = &refs
+			dependencies = append(dependencies, dependency)
+		}
+		bom.Dependencies = &dependencies
+	}
+	return &bom
+}
+
+// listHeight returns the number of components that fit on the preview screen.
+func (m *tuiModel) listHeight() int {
+	return max(m.height-6, 1)
+}
+
+// View implements tea.Model.
+func (m *tuiModel) View() string {
+	var view strings.Builder
+	fmt.Fprintf(&view, "distro2sbom - %s on %s\n\n", m.distro, m.hostname)
+
+	switch m.state {
+	case tuiOptions:
+		checkbox := func(enabled bool) string {
+			if enabled {
+				return "[x]"
+			}
+			return "[ ]"
+		}
+		lines := []string{
+			checkbox(!m.options.SkipLicenses) + " licenses",
+			checkbox(!m.options.SkipDependencies) + " dependencies",
+			"filter: " + m.filter,
+		}
+		for i, line := range lines {
+			pointer := "  "
+			if i == m.cursor {
+				pointer = "> "
+			}
+			view.WriteString(pointer + line)
+			if i == 2 && m.editing {
+				view.WriteString("_")
+			}
+			view.WriteString("\n")
+		}
+		view.WriteString("\nup/down move, space toggle or edit filter (glob on package names), enter collect, q quit\n")
+	case tuiCollecting:
+		for _, phase := range []string{"packages", "licenses", "dependencies"} {
+			progress, ok := m.progress[phase]
+			switch {
+			case !ok:
+				fmt.Fprintf(&view, "  %-13s waiting\n", phase)
+			default:
+				fmt.Fprintf(&view, "  %-13s %s %d/%d\n", phase, progressBar(progress.done, progress.total, 30), progress.done, progress.total)
+			}
+		}
+	case tuiPreview, tuiConfirm, tuiUploading:
+		total := 0
+		for _, component := range *m.bom.Components {
+			if component.Type == cyclonedx.ComponentTypeLibrary {
+				total++
+			}
+		}
+		filter := m.filter
+		if m.editing {
+			filter += "_"
+		}
+		fmt.Fprintf(&view, "%d of %d components, filter: %s\n", len(m.shown), total, filter)
+		end := min(m.offset+m.listHeight(), len(m.shown))
+		for _, component := range m.shown[m.offset:end] {
+			var licenses []string
+			if component.Licenses != nil {
+				for _, license := range *component.Licenses {
+					if license.License != nil {
+						licenses = append(licenses, license.License.ID)
+					}
+				}
+			}
+			fmt.Fprintf(&view, "  %-40s %-30s %s\n", component.Name, component.Version, strings.Join(licenses, ", "))
+		}
+		view.WriteString("\n")
+		switch m.state {
+		case tuiConfirm:
+			fmt.Fprintf(&view, "Upload %d components to %s as project %s? (y/n)\n", len(m.shown), m.dt.APIURL, m.hostname)
+		case tuiUploading:
+			view.WriteString("Uploading...\n")
+		default:
+			view.WriteString("up/down scroll, / filter, w write, u upload, q quit\n")
+		}
+	}
+
+	if m.status != "" {
+		view.WriteString(m.status + "\n")
+	}
+	return view.String()
+}
+
+// progressBar renders a text progress bar of the given width.
+func progressBar(done, total, width int) string {
+	filled := width
+	if total > 0 {
+		filled = done * width / total
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
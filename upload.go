@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/CycloneDX/cyclonedx-go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newUploadCmd creates the upload subcommand.
+//
+// The command uploads an existing CycloneDX document to Dependency-Track without collecting
+// anything, so that SBOMs produced elsewhere or kept in archives end up in the same projects
+// as the SBOMs of the hosts.
+//
+// Returns:
+// - *cobra.Command: the upload command.
+func newUploadCmd() *cobra.Command {
+	var file string
+	var distro string
+	var hostname string
+	var osVersion string
+	var apiURL string
+	var apiKey string
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "upload --file <sbom.json|->",
+		Short: "Upload an existing SBOM to Dependency-Track.",
+		Long: `upload validates a CycloneDX JSON document against the schema of its spec version and uploads it
+to Dependency-Track like a run does: the project of the host is created below the project of the
+distribution if it does not exist, and the configured teams are granted access to both.
+
+The distribution defaults to the operating system the SBOM describes, the host has to be given
+with --hostname. The connection settings are read from the configuration file and environment
+like those of a run.`,
+		Example: `  distro2sbom upload --file sbom.json --hostname web01
+  distro2sbom upload --file archive/db01.json --hostname db01 --distro debian --os-version 12`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !cmd.Flags().Changed("distro") {
+				distro = viper.GetString("distro")
+			}
+			if !cmd.Flags().Changed("api-url") {
+				apiURL = viper.GetString("api-url")
+			}
+			if !cmd.Flags().Changed("api-key") {
+				apiKey = viper.GetString("api-key")
+			}
+
+			if file == "" {
+				fatal(exitConfig, "--file is required")
+			}
+			if hostname == "" {
+				fatal(exitConfig, "--hostname is required, it names the project of the SBOM")
+			}
+			if apiURL == "" || apiKey == "" {
+				fatal(exitConfig, "Both api-url and api-key must be provided to upload the SBOM")
+			}
+
+			var sbomJSON []byte
+			var err error
+			if file == "-" {
+				sbomJSON, err = io.ReadAll(os.Stdin)
+			} else {
+				sbomJSON, err = os.ReadFile(file)
+			}
+			if err != nil {
+				fatal(exitConfig, "Error reading SBOM", "error", err)
+			}
+
+			// A document Dependency-Track would reject or misread is not uploaded
+			if err := checkSBOM(sbomJSON); err != nil {
+				fatal(exitValidation, "SBOM is not valid against the CycloneDX schema", "sbom", file, "error", err)
+			}
+			if distro == "" {
+				var bom cyclonedx.BOM
+				if err := cyclonedx.NewBOMDecoder(bytes.NewReader(sbomJSON), cyclonedx.BOMFileFormatJSON).Decode(&bom); err != nil {
+					fatal(exitValidation, "Error decoding CycloneDX document", "error", err)
+				}
+				distro = describedOS(&bom)
+			}
+			if distro == "" {
+				fatal(exitConfig, "The SBOM does not describe an operating system, please specify a distribution using the --distro flag")
+			}
+
+			dt := &DependencyTrack{
+				APIURL:    apiURL,
+				APIKey:    apiKey,
+				TLSVerify: viper.GetBool("tls-verify"),
+				Timeout:   viper.GetDuration("http-timeout"),
+				Teams:     viper.GetStringSlice("project-team"),
+			}
+			ctx := context.Background()
+			if dryRun {
+				if err := dt.checkUpload(ctx, distro, hostname, sbomJSON, nil); err != nil {
+					fatal(exitUpload, "Upload dry-run failed", "error", err)
+				}
+				slog.Info("Upload dry-run succeeded", "sbom", file, "distro", distro, "hostname", hostname)
+				return
+			}
+			if err := dt.uploadSBOM(ctx, distro, hostname, osVersion, sbomJSON, nil); err != nil {
+				fatal(exitUpload, "Error uploading SBOM", "error", err)
+			}
+			slog.Info("Uploaded SBOM", "sbom", file, "distro", distro, "hostname", hostname)
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "CycloneDX JSON document to upload, - for stdin")
+	cmd.Flags().StringVar(&hostname, "hostname", "", "Host the SBOM describes, the name of its project")
+	cmd.Flags().StringVarP(&distro, "distro", "d", "", "Linux distribution, the name of the parent project (default: the operating system of the SBOM)")
+	cmd.Flags().StringVar(&osVersion, "os-version", "", "Version of the operating system, the version of the project")
+	cmd.Flags().StringVar(&apiURL, "api-url", "", "Dependency-Track API URL (default: api-url of the configuration)")
+	cmd.Flags().StringVar(&apiKey, "api-key", "", "Dependency-Track API key (default: api-key of the configuration)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Check the API key, permissions and document without uploading")
+
+	return cmd
+}
+
+// describedOS returns the name of the operating system an SBOM describes.
+//
+// Parameters:
+// - bom: the SBOM.
+//
+// Returns:
+// - string: the name of the operating system metadata component, or the first operating
+// system component, empty if there is none.
+func describedOS(bom *cyclonedx.BOM) string {
+	if bom.Metadata != nil && bom.Metadata.Component != nil && bom.Metadata.Component.Type == cyclonedx.ComponentTypeOS {
+		return bom.Metadata.Component.Name
+	}
+	if bom.Components != nil {
+		for _, component := range *bom.Components {
+			if component.Type == cyclonedx.ComponentTypeOS {
+				return component.Name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+	"github.com/spf13/cobra"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// schemas holds the CycloneDX JSON schemas of every supported spec version and the SPDX
+// and JSF schemas they reference, so that validation works offline.
+//
+//go:embed schema/*.json
+var schemas embed.FS
+
+// referencedSchemas are the schemas referenced by the CycloneDX schemas, resolved
+// relative to http://cyclonedx.org/schema/.
+var referencedSchemas = []string{"spdx.schema.json", "jsf-0.82.schema.json"}
+
+// SchemaError is a violation of the CycloneDX schema at a location in the document.
+type SchemaError struct {
+	// Path is the JSON pointer of the invalid value, e.g. /components/3/licenses/0.
+	Path string
+	// Component is the name and version of the component the invalid value belongs to,
+	// empty for values outside the components.
+	Component   string
+	Description string
+}
+
+// String returns the error in the form path (component): description.
+func (e SchemaError) String() string {
+	if e.Component != "" {
+		return e.Path + " (" + e.Component + "): " + e.Description
+	}
+	return e.Path + ": " + e.Description
+}
+
+// validateSBOM validates a CycloneDX JSON document against the embedded schema of its spec version.
+//
+// Parameters:
+// - sbomJSON: the CycloneDX JSON document.
+//
+// Returns:
+// - string: the spec version of the document.
+// - []SchemaError: the schema violations, empty if the document is valid.
+// - error: an error if the document is not JSON or its spec version is not supported.
+func validateSBOM(sbomJSON []byte) (string, []SchemaError, error) {
+	var header struct {
+		BOMFormat   string `json:"bomFormat"`
+		SpecVersion string `json:"specVersion"`
+		Components  []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(sbomJSON, &header); err != nil {
+		return "", nil, fmt.Errorf("error decoding SBOM: %v", err)
+	}
+	if header.BOMFormat != "CycloneDX" {
+		return "", nil, fmt.Errorf("not a CycloneDX document, bomFormat is %q", header.BOMFormat)
+	}
+
+	bomSchema, err := schemas.ReadFile("schema/bom-" + header.SpecVersion + ".schema.json")
+	if err != nil {
+		return header.SpecVersion, nil, fmt.Errorf("unsupported CycloneDX spec version %q", header.SpecVersion)
+	}
+	loader := gojsonschema.NewSchemaLoader()
+	loader.Draft = gojsonschema.Draft7
+	for _, name := range referencedSchemas {
+		referenced, err := schemas.ReadFile("schema/" + name)
+		if err != nil {
+			return header.SpecVersion, nil, err
+		}
+		if err := loader.AddSchemas(gojsonschema.NewBytesLoader(referenced)); err != nil {
+			return header.SpecVersion, nil, fmt.Errorf("error loading schema %s: %v", name, err)
+		}
+	}
+	schema, err := loader.Compile(gojsonschema.NewBytesLoader(bomSchema))
+	if err != nil {
+		return header.SpecVersion, nil, fmt.Errorf("error compiling schema of spec version %s: %v", header.SpecVersion, err)
+	}
+
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(sbomJSON))
+	if err != nil {
+		return header.SpecVersion, nil, fmt.Errorf("error validating SBOM: %v", err)
+	}
+
+	var schemaErrors []SchemaError
+	for _, resultError := range result.Errors() {
+		path := strings.TrimPrefix(resultError.Context().String("/"), "(root)")
+		if path == "" {
+			path = "/"
+		}
+		description := resultError.Description()
+		// The enums of license identifiers have thousands of values
+		if resultError.Type() == "enum" {
+			description = fmt.Sprintf("%v is not one of the allowed values", resultError.Value())
+		}
+		schemaError := SchemaError{Path: path, Description: description}
+		// Paths into a component name it, so that the package can be found in large SBOMs
+		var index int
+		if _, err := fmt.Sscanf(path, "/components/%d", &index); err == nil && index >= 0 && index < len(header.Components) {
+			schemaError.Component = header.Components[index].Name + "@" + header.Components[index].Version
+		}
+		schemaErrors = append(schemaErrors, schemaError)
+	}
+	return header.SpecVersion, schemaErrors, nil
+}
+
+// checkSBOM validates a generated SBOM before it is written or delivered, logging every
+// schema violation.
+//
+// Parameters:
+// - sbomJSON: the CycloneDX JSON document.
+//
+// Returns:
+// - error: an error naming the first violation if the document is invalid, nil if it is valid.
+func checkSBOM(sbomJSON []byte) error {
+	_, schemaErrors, err := validateSBOM(sbomJSON)
+	if err != nil {
+		return err
+	}
+	for _, schemaError := range schemaErrors {
+		slog.Error("SBOM schema violation", "path", schemaError.Path, "component", schemaError.Component, "error", schemaError.Description)
+	}
+	if len(schemaErrors) > 0 {
+		return fmt.Errorf("%d schema violations, first %s", len(schemaErrors), schemaErrors[0])
+	}
+	return nil
+}
+
+// newValidateCmd creates the validate subcommand.
+//
+// Returns:
+// - *cobra.Command: the validate command.
+func newValidateCmd() *cobra.Command {
+	var profile string
+
+	cmd := &cobra.Command{
+		Use:   "validate <sbom.json|->...",
+		Short: "Validate SBOMs against the CycloneDX JSON schema.",
+		Long: `validate checks CycloneDX JSON documents against the schema of their spec version (1.2 to 1.6),
+which is built into distro2sbom. Every violation is printed with the JSON pointer of the invalid value.
+
+With --profile bsi valid documents are also checked against the requirements of BSI TR-03183-2,
+e.g. the creator of the SBOM and the licenses, SHA-512 hashes and package URLs of the components.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !validProfile(profile) {
+				fatal(exitConfig, "Invalid --profile, expected bsi", "profile", profile)
+			}
+			invalid := 0
+			violating := 0
+			for _, path := range args {
+				var sbomJSON []byte
+				var err error
+				if path == "-" {
+					sbomJSON, err = io.ReadAll(os.Stdin)
+				} else {
+					sbomJSON, err = os.ReadFile(path)
+				}
+				if err != nil {
+					fatal(exitConfig, "Error reading SBOM", "error", err)
+				}
+
+				specVersion, schemaErrors, err := validateSBOM(sbomJSON)
+				if err != nil {
+					slog.Error("SBOM is invalid", "sbom", path, "error", err)
+					invalid++
+					continue
+				}
+				if len(schemaErrors) > 0 {
+					for _, schemaError := range schemaErrors {
+						fmt.Printf("%s: %s\n", path, schemaError)
+					}
+					slog.Error("SBOM is invalid", "sbom", path, "specVersion", specVersion, "errors", len(schemaErrors))
+					invalid++
+					continue
+				}
+				slog.Info("SBOM is valid", "sbom", path, "specVersion", specVersion)
+
+				if profile == "" {
+					continue
+				}
+				var bom cyclonedx.BOM
+				if err := json.Unmarshal(sbomJSON, &bom); err != nil {
+					slog.Error("SBOM is invalid", "sbom", path, "error", err)
+					invalid++
+					continue
+				}
+				violations := checkProfile(profile, &bom)
+				for _, violation := range violations {
+					fmt.Printf("%s: %s\n", path, violation)
+				}
+				if len(violations) > 0 {
+					slog.Error("SBOM does not meet the profile", "sbom", path, "profile", profile, "violations", len(violations))
+					violating++
+					continue
+				}
+				slog.Info("SBOM meets the profile", "sbom", path, "profile", profile)
+			}
+			if invalid > 0 {
+				os.Exit(exitValidation)
+			}
+			if violating > 0 {
+				os.Exit(exitPolicy)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&profile, "profile", "", "Also check the SBOMs against a compliance profile: bsi for BSI TR-03183-2")
+
+	return cmd
+}
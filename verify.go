@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// errChecksumMissing is returned when no checksum file exists for an SBOM.
+var errChecksumMissing = errors.New("checksum file not found")
+
+// newVerifyCmd creates the verify subcommand.
+//
+// The command checks the signatures written by sign and attest, the payload and subject
+// digest embedded in DSSE envelopes and the checksum file, so that receivers of an SBOM
+// can check its integrity with the tool that produced it.
+//
+// Returns:
+// - *cobra.Command: the verify command.
+func newVerifyCmd() *cobra.Command {
+	var sigPath string
+	var keyPath string
+	var checksumFile string
+
+	cmd := &cobra.Command{
+		Use:   "verify <sbom.json>",
+		Short: "Verify the signature and checksum of an SBOM.",
+		Long: `verify checks a signature of an SBOM file with a public key. The signature can be a base64 encoded
+detached signature or a DSSE envelope written by sign, or an in-toto attestation written by attest. The
+payload of an envelope must be the SBOM, and the subject digest of an attestation its SHA-256 digest.
+A checksum file in sha256sum format is checked as well.`,
+		Example: `  distro2sbom verify sbom.json --sig sbom.json.sig --key cosign.pub
+  distro2sbom verify sbom.json --sig sbom.intoto.json --key pub.pem --checksum-file -`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			sbomPath := args[0]
+			sbomJSON, err := os.ReadFile(sbomPath)
+			if err != nil {
+				fatal(exitConfig, "Error reading SBOM", "error", err)
+			}
+			if sigPath == "" || keyPath == "" {
+				fatal(exitConfig, "--sig and --key are required")
+			}
+			signature, err := os.ReadFile(sigPath)
+			if err != nil {
+				fatal(exitConfig, "Error reading signature", "error", err)
+			}
+			publicKey, err := loadVerificationKey(keyPath)
+			if err != nil {
+				fatal(exitConfig, "Error loading public key", "error", err)
+			}
+
+			format, err := verifySignature(publicKey, sbomJSON, signature)
+			if err != nil {
+				fatal(exitValidation, "Signature verification failed", "sbom", sbomPath, "error", err)
+			}
+			slog.Info("Signature is valid", "sbom", sbomPath, "format", format)
+
+			if checksumFile != "-" {
+				explicit := checksumFile != ""
+				if !explicit {
+					checksumFile = sbomPath + ".sha256"
+				}
+				err := verifyChecksumFile(checksumFile, filepath.Base(sbomPath), sbomJSON)
+				if errors.Is(err, errChecksumMissing) && !explicit {
+					slog.Debug("No checksum file found", "path", checksumFile)
+				} else if err != nil {
+					fatal(exitValidation, "Checksum verification failed", "sbom", sbomPath, "error", err)
+				} else {
+					slog.Info("Checksum is valid", "sbom", sbomPath, "checksumFile", checksumFile)
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&sigPath, "sig", "", "Detached signature, DSSE envelope or in-toto attestation of the SBOM")
+	cmd.Flags().StringVar(&keyPath, "key", "", "Public key or certificate in PEM format")
+	cmd.Flags().StringVar(&checksumFile, "checksum-file", "", "SHA-256 checksum file of the SBOM (default: <sbom>.sha256 if it exists, - to skip)")
+
+	return cmd
+}
+
+// loadVerificationKey reads a public key from a PEM file.
+//
+// PKIX public keys, as written by cosign generate-key-pair and openssl pkey -pubout, and
+// certificates, as obtained by attest --keyless, are supported.
+//
+// Parameters:
+// - path: the path to the PEM file.
+//
+// Returns:
+// - crypto.PublicKey: the Ed25519, ECDSA or RSA public key.
+// - error: an error if the file cannot be read or parsed.
+func loadVerificationKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing public key: %v", err)
+		}
+		return key, nil
+	case "CERTIFICATE":
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate: %v", err)
+		}
+		return certificate.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
+
+// verifyBytes verifies a signature created by signBytes.
+//
+// Parameters:
+// - publicKey: the Ed25519, ECDSA or RSA public key.
+// - message: the signed message.
+// - sig: the signature, ASN.1 encoded for ECDSA.
+//
+// Returns:
+// - error: an error if the signature does not match the message.
+func verifyBytes(publicKey crypto.PublicKey, message, sig []byte) error {
+	digest := sha256.Sum256(message)
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, message, sig) {
+			return fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], sig) {
+			return fmt.Errorf("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	return nil
+}
+
+// verifySignature verifies a signature of an SBOM.
+//
+// The signature is either a DSSE envelope, whose payload must be the SBOM or an in-toto
+// statement about it, or a base64 encoded detached signature of the SBOM file.
+//
+// Parameters:
+// - publicKey: the public key of the signer.
+// - sbomJSON: the SBOM file.
+// - signature: the content of the signature file.
+//
+// Returns:
+// - string: the format of the signature, raw, dsse or in-toto.
+// - error: an error if the signature or the embedded payload does not match the SBOM.
+func verifySignature(publicKey crypto.PublicKey, sbomJSON, signature []byte) (string, error) {
+	var envelope DSSEEnvelope
+	if json.Unmarshal(signature, &envelope) != nil || envelope.PayloadType == "" {
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return "raw", fmt.Errorf("signature is neither a DSSE envelope nor base64 encoded: %v", err)
+		}
+		return "raw", verifyBytes(publicKey, sbomJSON, sig)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return "dsse", fmt.Errorf("error decoding envelope payload: %v", err)
+	}
+	// Any signature of the envelope by the key is sufficient
+	verifyErr := fmt.Errorf("envelope has no signatures")
+	for _, envelopeSignature := range envelope.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(envelopeSignature.Sig)
+		if err != nil {
+			verifyErr = fmt.Errorf("error decoding envelope signature: %v", err)
+			continue
+		}
+		if verifyErr = verifyBytes(publicKey, dssePAE(envelope.PayloadType, payload), sig); verifyErr == nil {
+			break
+		}
+	}
+	if verifyErr != nil {
+		return "dsse", verifyErr
+	}
+
+	switch envelope.PayloadType {
+	case inTotoPayloadType:
+		return "in-toto", verifyStatement(payload, sbomJSON)
+	case cycloneDXMediaType:
+		if !bytes.Equal(payload, sbomJSON) {
+			return "dsse", fmt.Errorf("envelope payload does not match the SBOM")
+		}
+		return "dsse", nil
+	default:
+		return "dsse", fmt.Errorf("unsupported payload type %s", envelope.PayloadType)
+	}
+}
+
+// verifyStatement checks that an in-toto statement written by attest is about an SBOM.
+//
+// The predicate must be the SBOM, and a subject digest, if the statement is about the
+// SBOM document itself, its SHA-256 digest.
+//
+// Parameters:
+// - statementJSON: the in-toto statement.
+// - sbomJSON: the SBOM file.
+//
+// Returns:
+// - error: an error if the statement does not carry the SBOM.
+func verifyStatement(statementJSON, sbomJSON []byte) error {
+	var statement InTotoStatement
+	if err := json.Unmarshal(statementJSON, &statement); err != nil {
+		return fmt.Errorf("error decoding in-toto statement: %v", err)
+	}
+	if statement.PredicateType != cycloneDXPredicate {
+		return fmt.Errorf("unexpected predicate type %s", statement.PredicateType)
+	}
+
+	// The predicate is compared decoded, as encoders escape differently, e.g. the & of
+	// package URLs as \u0026
+	predicate, err := decodeJSONValue(statement.Predicate)
+	if err != nil {
+		return fmt.Errorf("error decoding predicate: %v", err)
+	}
+	sbom, err := decodeJSONValue(sbomJSON)
+	if err != nil {
+		return fmt.Errorf("SBOM is not valid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(predicate, sbom) {
+		return fmt.Errorf("attested predicate does not match the SBOM")
+	}
+
+	// Statements about another artifact (attest --subject) carry that artifact's digest
+	sum := sha256.Sum256(sbomJSON)
+	digest := hex.EncodeToString(sum[:])
+	for _, subject := range statement.Subject {
+		if subject.Digest["sha256"] == digest {
+			return nil
+		}
+	}
+	slog.Warn("No subject of the attestation has the digest of the SBOM, it attests another artifact", "sha256", digest)
+	return nil
+}
+
+// decodeJSONValue decodes a JSON document, keeping numbers as written.
+//
+// Parameters:
+// - data: the JSON document.
+//
+// Returns:
+// - any: the decoded value.
+// - error: an error if the document is not valid JSON.
+func decodeJSONValue(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+// verifyChecksumFile checks an SBOM against a checksum file in sha256sum format.
+//
+// Parameters:
+// - path: the checksum file.
+// - name: the file name of the SBOM in the checksum file.
+// - sbomJSON: the SBOM file.
+//
+// Returns:
+// - error: errChecksumMissing if the file does not exist, or an error if it has no entry
+// for the SBOM or the digest does not match.
+func verifyChecksumFile(path, name string, sbomJSON []byte) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", errChecksumMissing, path)
+	} else if err != nil {
+		return fmt.Errorf("error reading checksum file: %v", err)
+	}
+	defer file.Close()
+
+	sum := sha256.Sum256(sbomJSON)
+	digest := hex.EncodeToString(sum[:])
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		expected, fileName, found := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !found || strings.TrimLeft(fileName, " *") != name {
+			continue
+		}
+		if !strings.EqualFold(expected, digest) {
+			return fmt.Errorf("SHA-256 digest %s does not match %s in %s", digest, expected, path)
+		}
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading checksum file: %v", err)
+	}
+	return fmt.Errorf("no checksum for %s in %s", name, path)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The fixtures of testdata/verify were written by sign and attest with an ECDSA P-256 key,
+// whose public key is key.pub. other.pub is an unrelated Ed25519 key.
+
+func readVerifyFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "verify", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestVerifySignature(t *testing.T) {
+	publicKey, err := loadVerificationKey(filepath.Join("testdata", "verify", "key.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := loadVerificationKey(filepath.Join("testdata", "verify", "other.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbomJSON := readVerifyFixture(t, "sbom.json")
+	// The SBOM with another version of bash
+	tampered := bytes.ReplaceAll(sbomJSON, []byte("5.2.15-2+b2"), []byte("5.2.15-2+b3"))
+
+	tests := []struct {
+		signature  string
+		wantFormat string
+	}{
+		{signature: "sbom.json.sig", wantFormat: "raw"},
+		{signature: "sbom.json.dsse.json", wantFormat: "dsse"},
+		{signature: "sbom.intoto.json", wantFormat: "in-toto"},
+	}
+	for _, test := range tests {
+		signature := readVerifyFixture(t, test.signature)
+
+		format, err := verifySignature(publicKey, sbomJSON, signature)
+		if err != nil || format != test.wantFormat {
+			t.Errorf("verifySignature(%s) = %s, %v, want %s", test.signature, format, err, test.wantFormat)
+		}
+		if _, err := verifySignature(publicKey, tampered, signature); err == nil {
+			t.Errorf("verifySignature(%s) of a modified SBOM succeeded", test.signature)
+		}
+		if _, err := verifySignature(otherKey, sbomJSON, signature); err == nil {
+			t.Errorf("verifySignature(%s) with another key succeeded", test.signature)
+		}
+	}
+}
+
+func TestVerifySignatureMalformed(t *testing.T) {
+	publicKey, err := loadVerificationKey(filepath.Join("testdata", "verify", "key.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbomJSON := readVerifyFixture(t, "sbom.json")
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{name: "not base64", signature: "not a signature!"},
+		{name: "empty", signature: ""},
+		{name: "envelope without signatures", signature: `{"payloadType":"application/vnd.cyclonedx+json","payload":"e30=","signatures":[]}`},
+		{name: "envelope with an invalid payload", signature: `{"payloadType":"application/vnd.cyclonedx+json","payload":"%%%","signatures":[]}`},
+	}
+	for _, test := range tests {
+		if _, err := verifySignature(publicKey, sbomJSON, []byte(test.signature)); err == nil {
+			t.Errorf("verifySignature() of a signature %s succeeded", test.name)
+		}
+	}
+}
+
+func TestVerifyStatementEscaping(t *testing.T) {
+	// attest embeds the SBOM as json.RawMessage, which escapes the & of package URLs
+	sbomJSON := []byte(`{"components":[{"purl":"pkg:deb/debian/bash@5.2?arch=amd64&distro=debian-12","version":1.10}]}`)
+	statement := []byte(`{"predicateType":"https://cyclonedx.org/bom","predicate":{"components":[{"purl":"pkg:deb/debian/bash@5.2?arch=amd64\u0026distro=debian-12","version":1.10}]}}`)
+	if err := verifyStatement(statement, sbomJSON); err != nil {
+		t.Errorf("verifyStatement() = %v", err)
+	}
+	// Numbers are compared as written
+	if err := verifyStatement(bytes.Replace(statement, []byte("1.10"), []byte("1.1"), 1), sbomJSON); err == nil {
+		t.Errorf("verifyStatement() of another number succeeded")
+	}
+}
+
+func TestVerifyChecksumFile(t *testing.T) {
+	sbomJSON := readVerifyFixture(t, "sbom.json")
+	dir := t.TempDir()
+	writeChecksums := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "fixture", path: filepath.Join("testdata", "verify", "sbom.json.sha256")},
+		{name: "binary mode and other files", path: writeChecksums("binary.sha256",
+			"0000000000000000000000000000000000000000000000000000000000000000  other.json\n"+
+				"93CD19C73D55F4DBAD7406A012177D81ABEDF56F2319E018807F579A0D5641E6 *sbom.json\n")},
+		{name: "mismatch", path: writeChecksums("mismatch.sha256",
+			"0000000000000000000000000000000000000000000000000000000000000000  sbom.json\n"), wantErr: true},
+		{name: "no entry", path: writeChecksums("other.sha256",
+			"93cd19c73d55f4dbad7406a012177d81abedf56f2319e018807f579a0d5641e6  other.json\n"), wantErr: true},
+	}
+	for _, test := range tests {
+		if err := verifyChecksumFile(test.path, "sbom.json", sbomJSON); (err != nil) != test.wantErr {
+			t.Errorf("verifyChecksumFile() of %s = %v, want error %t", test.name, err, test.wantErr)
+		}
+	}
+
+	err := verifyChecksumFile(filepath.Join(dir, "missing.sha256"), "sbom.json", sbomJSON)
+	if !errors.Is(err, errChecksumMissing) {
+		t.Errorf("verifyChecksumFile() of a missing file = %v, want errChecksumMissing", err)
+	}
+}
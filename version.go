@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/CycloneDX/cyclonedx-go"
+	"github.com/spf13/cobra"
+)
+
+// Build information, set at build time with
+// -ldflags "-X main.version=1.2.3 -X main.commit=abc123 -X main.date=2024-01-01T00:00:00Z".
+// Values that are not set are taken from the build information embedded by the Go toolchain.
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+// BuildInfo describes the build of the running binary.
+type BuildInfo struct {
+	Version string
+	Commit  string
+	Date    string
+	// Modified is set for builds from a working tree with uncommitted changes.
+	Modified  bool
+	GoVersion string
+}
+
+// getBuildInfo returns the version, commit and build date of the running binary.
+//
+// Values set with ldflags take precedence. Otherwise the module version and the VCS
+// revision and time recorded by the Go toolchain are used, and the version falls back
+// to "dev" for untagged builds.
+//
+// Returns:
+// - BuildInfo: the build information.
+func getBuildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version()}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+			info.Version = buildInfo.Main.Version
+		}
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// toolComponent describes the running binary as the tool that generated an SBOM.
+//
+// The version is the version of the build, the commit, dirty flag and Go version are
+// recorded as properties, so that consumers can trace a document to the exact build.
+//
+// Returns:
+// - cyclonedx.Component: the tool component of the SBOM metadata.
+func toolComponent() cyclonedx.Component {
+	info := getBuildInfo()
+	properties := []cyclonedx.Property{
+		{Name: "distro2sbom:build:modified", Value: strconv.FormatBool(info.Modified)},
+		{Name: "distro2sbom:build:go-version", Value: info.GoVersion},
+	}
+	if info.Commit != "" {
+		properties = append(properties, cyclonedx.Property{Name: "distro2sbom:build:commit", Value: info.Commit})
+	}
+	if info.Date != "" {
+		properties = append(properties, cyclonedx.Property{Name: "distro2sbom:build:date", Value: info.Date})
+	}
+
+	repository := "https://github.com/jansyren/dist02cyclonedx"
+	if info.Commit != "" {
+		repository += "/tree/" + info.Commit
+	}
+
+	return cyclonedx.Component{
+		Type:       cyclonedx.ComponentTypeApplication,
+		Name:       "distro2sbom",
+		Version:    info.Version,
+		Properties: &properties,
+		ExternalReferences: &[]cyclonedx.ExternalReference{
+			{URL: repository, Type: cyclonedx.ERTypeVCS},
+		},
+	}
+}
+
+// newVersionCmd creates the version subcommand.
+//
+// Returns:
+// - *cobra.Command: the version command.
+func newVersionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version of distro2sbom.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			info := getBuildInfo()
+			fmt.Printf("distro2sbom %s\n", info.Version)
+			if info.Commit != "" {
+				fmt.Printf("commit: %s\n", info.Commit)
+			}
+			if info.Date != "" {
+				fmt.Printf("built: %s\n", info.Date)
+			}
+			if info.Modified {
+				fmt.Println("modified: true")
+			}
+			fmt.Printf("go: %s\n", info.GoVersion)
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// packageDatabases lists the files each package manager rewrites when packages change.
+var packageDatabases = map[string][]string{
+	"dpkg": {"/var/lib/dpkg/status"},
+	"apk":  {apkInstalledDatabase},
+	"pkg":  {"/var/db/pkg/local.sqlite"},
+	"opkg": {"/usr/lib/opkg/status"},
+	"rpm":  rpmDatabases,
+}
+
+// watchPackageDatabase runs run once and again whenever the package database changes.
+//
+// The directories of the database files are watched rather than the files themselves,
+// because package managers replace the files by renaming a new copy over them. Changes
+// are debounced, so that an upgrade touching the database many times triggers one run
+// after it settled.
+//
+// Parameters:
+// - ctx: the context, watching stops when it is cancelled.
+// - packageManager: the package manager whose database is watched.
+// - debounce: the time without changes before run is called.
+// - run: the function generating and delivering the SBOM.
+//
+// Returns:
+// - error: an error if the database cannot be watched.
+func watchPackageDatabase(ctx context.Context, packageManager string, debounce time.Duration, run func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	databases := make(map[string]bool)
+	for _, database := range packageDatabases[packageManager] {
+		if err := watcher.Add(filepath.Dir(database)); err != nil {
+			slog.Debug("Not watching package database", "path", database, "error", err)
+			continue
+		}
+		databases[database] = true
+		slog.Info("Watching package database", "path", database)
+	}
+	if len(databases) == 0 {
+		return fmt.Errorf("no package database of %s found to watch", packageManager)
+	}
+
+	run()
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !databases[event.Name] || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) {
+				continue
+			}
+			slog.Debug("Package database changed", "path", event.Name, "op", event.Op.String())
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("Error watching package database", "error", err)
+		case <-timer.C:
+			slog.Info("Packages changed, regenerating SBOM")
+			run()
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Webhook pushes SBOMs to a generic HTTP endpoint.
+//
+// Headers are "Name: value" pairs whose values are text/template strings, with an env
+// function to read secrets from the environment, e.g. "Authorization: Bearer {{env \"TOKEN\"}}".
+// Body selects whether the raw SBOM ("raw") or a JSON envelope with host details ("envelope") is sent.
+type Webhook struct {
+	URL       string
+	Method    string
+	Headers   []string
+	Body      string
+	TLSVerify bool
+	Timeout   time.Duration
+}
+
+// WebhookEnvelope wraps the SBOM together with details about the host it describes.
+type WebhookEnvelope struct {
+	Hostname  string          `json:"hostname"`
+	Distro    string          `json:"distro"`
+	OSVersion string          `json:"osVersion"`
+	Timestamp string          `json:"timestamp"`
+	BOM       json.RawMessage `json:"bom"`
+}
+
+// send pushes an SBOM to the webhook.
+//
+// Parameters:
+// - ctx: the context controlling cancellation of the request.
+// - envelope: the host details, the BOM field is filled from sbomJSON.
+// - sbomJSON: the SBOM in JSON format.
+//
+// Returns:
+// - error: an error if the configuration is invalid or the request fails.
+func (w *Webhook) send(ctx context.Context, envelope WebhookEnvelope, sbomJSON []byte) error {
+	var body []byte
+	contentType := "application/vnd.cyclonedx+json"
+	switch w.Body {
+	case "", "raw":
+		body = sbomJSON
+	case "envelope":
+		envelope.BOM = sbomJSON
+		var err error
+		body, err = json.Marshal(envelope)
+		if err != nil {
+			return fmt.Errorf("error marshaling webhook envelope: %v", err)
+		}
+		contentType = "application/json"
+	default:
+		return fmt.Errorf("unsupported webhook body: %s", w.Body)
+	}
+
+	method := w.Method
+	if method == "" {
+		method = "POST"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	funcs := template.FuncMap{"env": os.Getenv}
+	for _, header := range w.Headers {
+		name, value, found := strings.Cut(header, ":")
+		if !found {
+			return fmt.Errorf("invalid webhook header %q, expected \"Name: value\"", header)
+		}
+		tmpl, err := template.New("header").Funcs(funcs).Parse(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("error parsing webhook header %s: %v", name, err)
+		}
+		var rendered bytes.Buffer
+		if err := tmpl.Execute(&rendered, envelope); err != nil {
+			return fmt.Errorf("error rendering webhook header %s: %v", name, err)
+		}
+		req.Header.Set(strings.TrimSpace(name), rendered.String())
+	}
+
+	resp, err := newHTTPClient(w.TLSVerify, w.Timeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
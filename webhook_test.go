@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookSendHeaders(t *testing.T) {
+	t.Setenv("WEBHOOK_TOKEN", "s3cret")
+
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		header     string
+		name, want string
+	}{
+		{header: "X-Static: value", name: "X-Static", want: "value"},
+		{header: `Authorization: Bearer {{env "WEBHOOK_TOKEN"}}`, name: "Authorization", want: "Bearer s3cret"},
+		{header: `X-Missing:{{env "WEBHOOK_UNSET"}}`, name: "X-Missing", want: ""},
+		{header: "X-Host: {{.Hostname}} {{.Distro}} {{.OSVersion}}", name: "X-Host", want: "web01 debian 12"},
+		{header: "  X-Spaced  :  a:b:c  ", name: "X-Spaced", want: "a:b:c"},
+	}
+	for _, test := range tests {
+		got = nil
+		webhook := &Webhook{URL: server.URL, Headers: []string{test.header}}
+		envelope := WebhookEnvelope{Hostname: "web01", Distro: "debian", OSVersion: "12"}
+		if err := webhook.send(context.Background(), envelope, []byte(`{}`)); err != nil {
+			t.Errorf("send() with header %q failed: %v", test.header, err)
+			continue
+		}
+		if value := got.Get(test.name); value != test.want {
+			t.Errorf("header %q sent %s: %q, want %q", test.header, test.name, value, test.want)
+		}
+	}
+}
+
+func TestWebhookSendInvalidHeader(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		header  string
+		wantErr string
+	}{
+		{header: "Authorization Bearer token", wantErr: "invalid webhook header"},
+		{header: "X-Broken: {{.Hostname", wantErr: "error parsing webhook header X-Broken"},
+		{header: "X-Unknown: {{.Unknown}}", wantErr: "error rendering webhook header X-Unknown"},
+	}
+	for _, test := range tests {
+		webhook := &Webhook{URL: server.URL, Headers: []string{test.header}}
+		err := webhook.send(context.Background(), WebhookEnvelope{}, []byte(`{}`))
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("send() with header %q = %v, want %q", test.header, err, test.wantErr)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("sent %d requests with invalid headers, want none", requests)
+	}
+}
+
+func TestWebhookSendBody(t *testing.T) {
+	sbomJSON := []byte(`{"bomFormat":"CycloneDX"}`)
+	tests := []struct {
+		body        string
+		contentType string
+	}{
+		{body: "", contentType: "application/vnd.cyclonedx+json"},
+		{body: "raw", contentType: "application/vnd.cyclonedx+json"},
+		{body: "envelope", contentType: "application/json"},
+	}
+	for _, test := range tests {
+		var method, contentType string
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, contentType = r.Method, r.Header.Get("Content-Type")
+			body, _ = io.ReadAll(r.Body)
+		}))
+
+		webhook := &Webhook{URL: server.URL, Body: test.body}
+		err := webhook.send(context.Background(), WebhookEnvelope{Hostname: "web01"}, sbomJSON)
+		server.Close()
+		if err != nil {
+			t.Errorf("send() with body %q failed: %v", test.body, err)
+			continue
+		}
+		if method != "POST" || contentType != test.contentType {
+			t.Errorf("send() with body %q = %s %s, want POST %s", test.body, method, contentType, test.contentType)
+		}
+		if test.body != "envelope" {
+			if string(body) != string(sbomJSON) {
+				t.Errorf("send() with body %q sent %s, want %s", test.body, body, sbomJSON)
+			}
+			continue
+		}
+		var envelope WebhookEnvelope
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if envelope.Hostname != "web01" || string(envelope.BOM) != string(sbomJSON) {
+			t.Errorf("send() sent the envelope %s", body)
+		}
+	}
+}
+
+func TestWebhookSendStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{URL: server.URL, Method: "put"}
+	err := webhook.send(context.Background(), WebhookEnvelope{}, []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "429") || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("send() = %v, want an error with the status code and response", err)
+	}
+}
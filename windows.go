@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/CycloneDX/cyclonedx-go"
+)
+
+// includeWinget is the opt-in collector of --include adding the packages installed with
+// winget on Windows.
+const includeWinget = "winget"
+
+// includeChocolatey is the opt-in collector of --include adding the packages installed with
+// Chocolatey on Windows.
+const includeChocolatey = "chocolatey"
+
+// windowsUninstallScript prints the programs of Apps & Features, the uninstall entries of
+// the machine, its 32-bit programs and the current user, as "name\tversion\tpublisher".
+// Updates and components of other programs, which Windows hides there as well, are left out.
+const windowsUninstallScript = `[Console]::OutputEncoding = [Text.Encoding]::UTF8
+Get-ItemProperty -ErrorAction SilentlyContinue 'HKLM:\SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\*', 'HKLM:\SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall\*', 'HKCU:\SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\*' |
+  Where-Object { $_.DisplayName -and $_.SystemComponent -ne 1 -and -not $_.ParentKeyName } |
+  ForEach-Object { "$($_.DisplayName)` + "`t" + `$($_.DisplayVersion)` + "`t" + `$($_.Publisher)" }`
+
+// wingetExportScript prints the packages installed with winget as the JSON document of
+// winget export, nothing if winget is not installed.
+const wingetExportScript = `if (-not (Get-Command winget -ErrorAction SilentlyContinue)) { exit 0 }
+$file = [IO.Path]::GetTempFileName()
+winget export --output $file --include-versions --accept-source-agreements --disable-interactivity | Out-Null
+[Console]::OutputEncoding = [Text.Encoding]::UTF8
+Get-Content -Raw $file
+Remove-Item $file`
+
+// chocolateyListScript prints the packages installed with Chocolatey as "name|version",
+// nothing if Chocolatey is not installed. Chocolatey 1 lists the packages of the community
+// repository unless --local-only is given, which Chocolatey 2 no longer accepts.
+const chocolateyListScript = `if (-not (Get-Command choco -ErrorAction SilentlyContinue)) { exit 0 }
+if ([int](choco --version).Split('.')[0] -lt 2) { choco list --local-only --limit-output } else { choco list --limit-output }`
+
+// powershellCommand returns the command running a PowerShell script.
+func powershellCommand(script string) []string {
+	return []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", script}
+}
+
+// wingetExportCommand prints the packages installed with winget.
+var wingetExportCommand = powershellCommand(wingetExportScript)
+
+// chocolateyListCommand prints the packages installed with Chocolatey.
+var chocolateyListCommand = powershellCommand(chocolateyListScript)
+
+// wingetExport is the document written by winget export.
+type wingetExport struct {
+	Sources []struct {
+		Packages []struct {
+			PackageIdentifier string `json:"PackageIdentifier"`
+			Version           string `json:"Version"`
+		} `json:"Packages"`
+		SourceDetails struct {
+			Name string `json:"Name"`
+		} `json:"SourceDetails"`
+	} `json:"Sources"`
+}
+
+// parseWindowsUninstallLine parses a line of windowsUninstallScript.
+//
+// Parameters:
+// - line: the line.
+//
+// Returns:
+// - installedPackage: the program, with the publisher as vendor. Programs have neither
+// licenses nor dependencies in the registry.
+// - bool: whether the line names a program.
+func parseWindowsUninstallLine(line string) (installedPackage, bool) {
+	fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+	if len(fields) != 3 || strings.TrimSpace(fields[0]) == "" {
+		return installedPackage{}, false
+	}
+	return installedPackage{
+		name:            strings.TrimSpace(fields[0]),
+		version:         strings.TrimSpace(fields[1]),
+		vendor:          strings.TrimSpace(fields[2]),
+		hasLicense:      true,
+		hasDependencies: true,
+	}, true
+}
+
+// windowsComponent builds the CycloneDX component of a package collected on Windows.
+//
+// Parameters:
+// - collector: the collector, the package URL type of the package.
+// - name: the name of the package.
+// - version: the version of the package.
+//
+// Returns:
+// - cyclonedx.Component: the component, with the collector recorded as property.
+func windowsComponent(collector, name, version string) cyclonedx.Component {
+	purl := formatPURL(collector, "", name, version, nil)
+	return cyclonedx.Component{
+		Type:       cyclonedx.ComponentTypeApplication,
+		Name:       name,
+		Version:    version,
+		BOMRef:     stableBOMRef(purl, name, version, ""),
+		PackageURL: purl,
+		Properties: &[]cyclonedx.Property{{Name: "distro2sbom:collector", Value: collector}},
+	}
+}
+
+// collectWinget lists the packages installed with winget.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills winget.
+// - options: the runner.
+// - index: the index of the last package, the packages are numbered after it.
+//
+// Returns:
+// - []*pipelineItem: the packages, none if winget is not installed.
+// - error: an error if winget fails or its export cannot be decoded.
+func collectWinget(ctx context.Context, _ string, options CollectOptions, _ []*pipelineItem, index int) ([]*pipelineItem, error) {
+	output, err := runnerOrLocal(options.Runner).Command(ctx, wingetExportCommand...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("error exporting winget packages: %v", err)
+	}
+	output = bytes.TrimSpace(bytes.TrimPrefix(output, []byte("\xef\xbb\xbf")))
+	if len(output) == 0 {
+		slog.Info("No winget packages installed")
+		return nil, nil
+	}
+	var export wingetExport
+	if err := json.Unmarshal(output, &export); err != nil {
+		return nil, fmt.Errorf("error decoding winget export: %v", err)
+	}
+
+	var items []*pipelineItem
+	for _, source := range export.Sources {
+		for _, pkg := range source.Packages {
+			index++
+			component := windowsComponent(includeWinget, pkg.PackageIdentifier, pkg.Version)
+			// Packages of the Microsoft Store are listed by their store ID
+			*component.Properties = append(*component.Properties, cyclonedx.Property{Name: "distro2sbom:winget:source", Value: source.SourceDetails.Name})
+			items = append(items, &pipelineItem{
+				index:            index,
+				installedPackage: installedPackage{name: pkg.PackageIdentifier, version: pkg.Version},
+				component:        component,
+			})
+		}
+	}
+	slog.Info("Listed winget packages", "components", len(items))
+	return items, nil
+}
+
+// collectChocolatey lists the packages installed with Chocolatey.
+//
+// Parameters:
+// - ctx: the context, cancelling it kills choco.
+// - options: the runner and the maximum line size.
+// - index: the index of the last package, the packages are numbered after it.
+//
+// Returns:
+// - []*pipelineItem: the packages, none if Chocolatey is not installed.
+// - error: an error if choco fails.
+func collectChocolatey(ctx context.Context, _ string, options CollectOptions, _ []*pipelineItem, index int) ([]*pipelineItem, error) {
+	var items []*pipelineItem
+	err := streamCommand(ctx, runnerOrLocal(options.Runner), chocolateyListCommand, options.MaxLineSize, func(line string) {
+		// git.install|2.45.1
+		name, version, ok := strings.Cut(strings.TrimRight(line, "\r"), "|")
+		if !ok || name == "" {
+			return
+		}
+		index++
+		items = append(items, &pipelineItem{
+			index:            index,
+			installedPackage: installedPackage{name: name, version: version},
+			component:        windowsComponent(includeChocolatey, name, version),
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing Chocolatey packages: %v", err)
+	}
+	slog.Info("Listed Chocolatey packages", "components", len(items))
+	return items, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+)
+
+// splitPkgver splits an xbps package name and version, e.g. bash-5.2.21_1 into bash and
+// 5.2.21_1. The version follows the last hyphen and always ends with the _revision.
+//
+// Parameters:
+// - pkgver: the name and version as xbps prints them.
+//
+// Returns:
+// - string: the name of the package.
+// - string: the version with revision.
+// - bool: whether pkgver is a name and version.
+func splitPkgver(pkgver string) (string, string, bool) {
+	i := strings.LastIndex(pkgver, "-")
+	if i <= 0 || !strings.Contains(pkgver[i+1:], "_") {
+		return "", "", false
+	}
+	return pkgver[:i], pkgver[i+1:], true
+}
+
+// xbpsDependencyName returns the name of the package a dependency of xbps-query -x refers
+// to. Dependencies are version patterns, e.g. glibc>=2.36_1, or exact versions, e.g.
+// ncurses-libs-6.4_1.
+//
+// Parameters:
+// - dependency: the dependency as xbps prints it.
+//
+// Returns:
+// - string: the name of the package.
+func xbpsDependencyName(dependency string) string {
+	if i := strings.IndexAny(dependency, "<>="); i >= 0 {
+		return dependency[:i]
+	}
+	if name, _, ok := splitPkgver(dependency); ok {
+		return name
+	}
+	return dependency
+}
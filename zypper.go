@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// zypperExitCapNotFound is the exit code of zypper search when nothing matches.
+const zypperExitCapNotFound = 104
+
+// zypperOptions are the global options of the zypper commands, which only read the installed
+// packages, so that neither repositories are refreshed nor the network is used.
+var zypperOptions = []string{"zypper", "--quiet", "--non-interactive", "--no-refresh", "--disable-repositories"}
+
+// zypperRequiresCommand returns the command listing the requirements of an installed package.
+//
+// Parameters:
+// - packageName: the name of the package.
+//
+// Returns:
+// - []string: the command and its arguments.
+func zypperRequiresCommand(packageName string) []string {
+	return append(append([]string{}, zypperOptions...), "info", "--requires", packageName)
+}
+
+// zypperProvidersCommand returns the command listing the installed packages providing
+// capabilities.
+//
+// Parameters:
+// - capabilities: the capabilities, e.g. libc.so.6()(64bit).
+//
+// Returns:
+// - []string: the command and its arguments.
+func zypperProvidersCommand(capabilities []string) []string {
+	args := append(append([]string{}, zypperOptions...), "search", "--provides", "--match-exact", "--installed-only", "--type", "package")
+	return append(args, capabilities...)
+}
+
+// zypperRequirements collects the requirements of zypper info --requires, the indented lines
+// following "Requires : [n]". Feed it every line of the output.
+type zypperRequirements struct {
+	// inRequires is set while the lines of the Requires field are read.
+	inRequires bool
+	// capabilities are the names of the required capabilities, without version constraint.
+	capabilities []string
+}
+
+// add reads a line of zypper info --requires.
+//
+// Requirements on rpm features, rpmlib(...), and rich dependencies, e.g. (grub2 if
+// efi-filesystem), are skipped like rpmRequiresScript does.
+//
+// Parameters:
+// - line: the line, with its indentation.
+func (r *zypperRequirements) add(line string) {
+	if !strings.HasPrefix(line, " ") {
+		key, _, _ := strings.Cut(line, ":")
+		r.inRequires = strings.TrimSpace(key) == "Requires"
+		return
+	}
+	if !r.inRequires {
+		return
+	}
+	requirement := strings.TrimSpace(line)
+	if requirement == "" || strings.HasPrefix(requirement, "rpmlib(") || strings.HasPrefix(requirement, "(") {
+		return
+	}
+	// glibc >= 2.34
+	capability, _, _ := strings.Cut(requirement, " ")
+	r.capabilities = append(r.capabilities, capability)
+}
+
+// zypperSearchName returns the package of a row of the table zypper search prints, e.g.
+// glibc for "i+ | glibc | Standard Shared Libraries | package".
+//
+// Parameters:
+// - line: a line of zypper search.
+//
+// Returns:
+// - string: the name of the package, empty for the header, the separator and other lines.
+func zypperSearchName(line string) string {
+	columns := strings.Split(line, "|")
+	if len(columns) < 4 {
+		return ""
+	}
+	name := strings.TrimSpace(columns[1])
+	if name == "Name" || strings.Trim(columns[1], "-+ ") == "" {
+		return ""
+	}
+	return name
+}
+
+// fetchZypperDependencies fetches the dependencies of a package of SUSE distributions with
+// zypper. zypper info --requires lists capabilities, e.g. libc.so.6()(64bit) or /bin/sh,
+// which are resolved to the installed packages providing them with a single zypper search
+// --provides.
+//
+// Parameters:
+// - ctx: the context, the commands are killed when it is cancelled.
+// - runner: runs the commands on the scanned system.
+// - packageName: the name of the package.
+// - maxLineSize: the longest line of output that is accepted, 0 for defaultMaxLineSize.
+//
+// Returns:
+// - []string: the names of the packages providing the requirements.
+// - error: an error if zypper fails.
+func fetchZypperDependencies(ctx context.Context, runner Runner, packageName string, maxLineSize int) ([]string, error) {
+	var requirements zypperRequirements
+	if err := streamCommand(ctx, runner, zypperRequiresCommand(packageName), maxLineSize, requirements.add); err != nil {
+		return nil, err
+	}
+	if len(requirements.capabilities) == 0 {
+		return nil, nil
+	}
+
+	var dependencies []string
+	err := streamCommand(ctx, runner, zypperProvidersCommand(requirements.capabilities), maxLineSize, func(line string) {
+		if name := zypperSearchName(line); name != "" {
+			dependencies = append(dependencies, name)
+		}
+	})
+	// No installed package provides any of the requirements
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == zypperExitCapNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dependencies, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestZypperRequirements(t *testing.T) {
+	runner := &fixtureRunner{outputs: map[string]string{
+		strings.Join(zypperRequiresCommand("bash"), " "): "zypper-info-requires.txt",
+	}}
+	var requirements zypperRequirements
+	if err := streamCommand(context.Background(), runner, zypperRequiresCommand("bash"), 0, requirements.add); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/bin/sh", "libc.so.6()(64bit)", "libc.so.6(GLIBC_2.34)(64bit)", "libreadline.so.8()(64bit)", "bash-sh", "coreutils"}
+	if !slices.Equal(requirements.capabilities, want) {
+		t.Errorf("capabilities = %q, want %q", requirements.capabilities, want)
+	}
+}
+
+func TestZypperSearchName(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"S  | Name         | Summary                    | Type", ""},
+		{"---+--------------+----------------------------+--------", ""},
+		{"i+ | bash         | The GNU Bourne-Again Shell | package", "bash"},
+		{"i  | glibc        | Standard Shared Libraries  | package", "glibc"},
+		{"No matching items found.", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := zypperSearchName(test.line); got != test.want {
+			t.Errorf("zypperSearchName(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestFetchDependenciesZypper(t *testing.T) {
+	capabilities := []string{"/bin/sh", "libc.so.6()(64bit)", "libc.so.6(GLIBC_2.34)(64bit)", "libreadline.so.8()(64bit)", "bash-sh", "coreutils"}
+	runner := &fixtureRunner{outputs: map[string]string{
+		strings.Join(zypperRequiresCommand("bash"), " "):        "zypper-info-requires.txt",
+		strings.Join(zypperProvidersCommand(capabilities), " "): "zypper-search-provides.txt",
+	}}
+	got, err := fetchDependencies(context.Background(), runner, "zypper", "bash", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"bash", "bash-sh", "coreutils", "glibc", "libreadline8"}
+	if !slices.Equal(got, want) {
+		t.Errorf("fetchDependencies() = %q, want %q", got, want)
+	}
+	if len(runner.commands) != 2 {
+		t.Errorf("ran %d commands, want zypper info and zypper search", len(runner.commands))
+	}
+}
+
+func TestFetchDependenciesZypperNothingProvided(t *testing.T) {
+	// zypper search exits with 104 if no installed package provides a requirement
+	runner := &fixtureRunner{
+		outputs:  map[string]string{strings.Join(zypperRequiresCommand("bash"), " "): "zypper-info-requires.txt"},
+		exitCode: zypperExitCapNotFound,
+	}
+	got, err := fetchZypperDependencies(context.Background(), runner, "bash", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("fetchZypperDependencies() = %q, want none", got)
+	}
+}